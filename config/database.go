@@ -0,0 +1,20 @@
+package config
+
+import (
+	"errors"
+	"os"
+)
+
+// Database holds the Postgres connection settings.
+type Database struct {
+	URL string
+}
+
+// LoadDatabase reads the database settings from the environment.
+func LoadDatabase() (Database, error) {
+	cfg := Database{URL: os.Getenv("DATABASE_URL")}
+	if cfg.URL == "" {
+		return cfg, errors.New("DATABASE_URL is not set")
+	}
+	return cfg, nil
+}
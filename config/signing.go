@@ -0,0 +1,40 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Signing holds the key finalized prescriptions are signed with. PrivateKey is
+// nil when PRESCRIPTION_SIGNING_KEY is not set, which disables finalization.
+type Signing struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+// LoadSigning reads the per-deployment Ed25519 signing key from the environment.
+// PRESCRIPTION_SIGNING_KEY is the base64 of a 32-byte seed (openssl rand -base64 32)
+// or of a 64-byte private key.
+func LoadSigning() (Signing, error) {
+	var cfg Signing
+	raw := strings.TrimSpace(os.Getenv("PRESCRIPTION_SIGNING_KEY"))
+	if raw == "" {
+		return cfg, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid PRESCRIPTION_SIGNING_KEY: %w", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		cfg.PrivateKey = ed25519.NewKeyFromSeed(key)
+	case ed25519.PrivateKeySize:
+		cfg.PrivateKey = ed25519.PrivateKey(key)
+	default:
+		return cfg, fmt.Errorf("invalid PRESCRIPTION_SIGNING_KEY: want %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(key))
+	}
+	return cfg, nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+)
+
+func TestLoadSigning(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	private := ed25519.NewKeyFromSeed(seed)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    ed25519.PrivateKey
+		wantErr bool
+	}{
+		{name: "unset disables signing", value: ""},
+		{name: "32-byte seed", value: base64.StdEncoding.EncodeToString(seed), want: private},
+		{name: "64-byte private key", value: " " + base64.StdEncoding.EncodeToString(private) + "\n", want: private},
+		{name: "not base64", value: "not-base64!", wantErr: true},
+		{name: "wrong length", value: base64.StdEncoding.EncodeToString(seed[:16]), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PRESCRIPTION_SIGNING_KEY", tt.value)
+			cfg, err := LoadSigning()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadSigning() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !cfg.PrivateKey.Equal(tt.want) {
+				t.Errorf("LoadSigning() key = %x, want %x", cfg.PrivateKey, tt.want)
+			}
+		})
+	}
+}
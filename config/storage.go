@@ -0,0 +1,128 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Storage drivers
+const (
+	StorageDriverSupabase = "supabase"
+	StorageDriverS3       = "s3"
+	StorageDriverLocal    = "local"
+)
+
+// Storage holds the object storage settings. Driver selects which backend the
+// remaining fields configure.
+type Storage struct {
+	Driver string
+	Bucket string
+
+	SupabaseURL string
+	SupabaseKey string
+
+	S3Endpoint        string
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3ForcePathStyle  bool
+
+	LocalDir string
+
+	// PublicBaseURL is the externally reachable URL of this server, used to build
+	// signed links to locally stored objects.
+	PublicBaseURL string
+	// SigningKey signs local-storage URLs. Without STORAGE_SIGNING_KEY a random
+	// key is generated and SigningKeyGenerated is set; links then stop working
+	// when the server restarts.
+	SigningKey          string
+	SigningKeyGenerated bool
+
+	// SignedURLExpiry is how long download URLs handed to clients stay valid.
+	SignedURLExpiry time.Duration
+}
+
+func envBool(key string, def bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return def
+}
+
+func envDefault(key, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+// LoadStorage reads the storage settings from the environment. Without
+// STORAGE_DRIVER, Supabase is used when SUPABASE_URL is set and the local disk
+// otherwise, so a fresh checkout runs offline.
+func LoadStorage() (Storage, error) {
+	cfg := Storage{
+		Driver:            strings.ToLower(envDefault("STORAGE_DRIVER", "")),
+		Bucket:            envDefault("STORAGE_BUCKET", envDefault("SUPABASE_STORAGE_BUCKET", "prescriptions")),
+		SupabaseURL:       strings.TrimRight(os.Getenv("SUPABASE_URL"), "/"),
+		SupabaseKey:       envDefault("SUPABASE_SERVICE_ROLE_KEY", os.Getenv("SUPABASE_SERVICE_KEY")),
+		S3Endpoint:        strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		S3Region:          envDefault("S3_REGION", "us-east-1"),
+		S3AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3ForcePathStyle:  envBool("S3_FORCE_PATH_STYLE", true),
+		LocalDir:          envDefault("LOCAL_STORAGE_DIR", "./data/uploads"),
+		PublicBaseURL:     strings.TrimRight(envDefault("PUBLIC_BASE_URL", "http://localhost:"+envDefault("PORT", "8080")), "/"),
+		SigningKey:        os.Getenv("STORAGE_SIGNING_KEY"),
+	}
+	cfg.SignedURLExpiry = 5 * time.Minute
+	if ttl := os.Getenv("STORAGE_SIGNED_URL_TTL"); ttl != "" {
+		expiry, err := time.ParseDuration(ttl)
+		if err != nil || expiry < 10*time.Second || expiry > time.Hour {
+			return cfg, fmt.Errorf("invalid STORAGE_SIGNED_URL_TTL %q (use a duration between 10s and 1h)", ttl)
+		}
+		cfg.SignedURLExpiry = expiry
+	}
+
+	if cfg.Driver == "" {
+		cfg.Driver = StorageDriverLocal
+		if cfg.SupabaseURL != "" {
+			cfg.Driver = StorageDriverSupabase
+		}
+	}
+
+	switch cfg.Driver {
+	case StorageDriverSupabase:
+		if cfg.SupabaseURL == "" || cfg.SupabaseKey == "" {
+			return cfg, errors.New("SUPABASE_URL or SUPABASE_SERVICE_ROLE_KEY not set")
+		}
+		// Supabase Storage Authorization expects a JWT (service role / anon legacy key).
+		// Keys like sb_publishable_* are not JWTs and will fail with "Invalid Compact JWS".
+		if strings.HasPrefix(cfg.SupabaseKey, "sb_publishable_") {
+			return cfg, errors.New("invalid Supabase key for server upload: use SUPABASE_SERVICE_ROLE_KEY (JWT), not publishable key")
+		}
+	case StorageDriverS3:
+		if cfg.S3Endpoint == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return cfg, errors.New("S3_ENDPOINT, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set")
+		}
+	case StorageDriverLocal:
+		if cfg.SigningKey == "" {
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return cfg, fmt.Errorf("generate storage signing key: %w", err)
+			}
+			cfg.SigningKey = hex.EncodeToString(key)
+			cfg.SigningKeyGenerated = true
+		}
+	default:
+		return cfg, fmt.Errorf("unknown STORAGE_DRIVER %q (use supabase, s3 or local)", cfg.Driver)
+	}
+	return cfg, nil
+}
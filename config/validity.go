@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MaxValidityDays caps configured and requested validity periods at two years.
+const MaxValidityDays = 730
+
+// Validity holds how long finalized prescriptions stay valid by default, per
+// item type. A prescription gets the longest period of the items it approves.
+type Validity struct {
+	MedicineDays int
+	TestDays     int
+}
+
+func envDays(key string, def int) (int, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 1 || days > MaxValidityDays {
+		return 0, fmt.Errorf("invalid %s %q (use a number of days between 1 and %d)", key, raw, MaxValidityDays)
+	}
+	return days, nil
+}
+
+// LoadValidity reads the default validity periods from the environment:
+// PRESCRIPTION_VALIDITY_MED_DAYS (30 by default) and
+// PRESCRIPTION_VALIDITY_TEST_DAYS (90 by default).
+func LoadValidity() (Validity, error) {
+	var cfg Validity
+	var err error
+	if cfg.MedicineDays, err = envDays("PRESCRIPTION_VALIDITY_MED_DAYS", 30); err != nil {
+		return cfg, err
+	}
+	if cfg.TestDays, err = envDays("PRESCRIPTION_VALIDITY_TEST_DAYS", 90); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
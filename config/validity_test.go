@@ -0,0 +1,39 @@
+package config
+
+import "testing"
+
+func TestLoadValidity(t *testing.T) {
+	tests := []struct {
+		name     string
+		medicine string
+		test     string
+		want     Validity
+		wantErr  bool
+	}{
+		{name: "defaults", want: Validity{MedicineDays: 30, TestDays: 90}},
+		{name: "configured", medicine: " 60 ", test: "180", want: Validity{MedicineDays: 60, TestDays: 180}},
+		{name: "zero days", medicine: "0", wantErr: true},
+		{name: "over the maximum", test: "731", wantErr: true},
+		{name: "not a number", medicine: "30d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PRESCRIPTION_VALIDITY_MED_DAYS", tt.medicine)
+			t.Setenv("PRESCRIPTION_VALIDITY_TEST_DAYS", tt.test)
+			got, err := LoadValidity()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("LoadValidity() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadValidity() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("LoadValidity() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
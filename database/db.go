@@ -2,36 +2,41 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"log"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// InitDB initializes the database connection
-func InitDB(ctx context.Context, connString string) (*pgx.Conn, error) {
-	connConfig, err := pgx.ParseConfig(connString)
+// Connect opens a pool of database connections. Requests and background jobs
+// each take their own connection from the pool, so they never share one.
+func Connect(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, err
 	}
 
-	// Avoid server-side prepared statement cache collisions when a single
-	// connection is shared across concurrent requests.
-	connConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	// Interpolate parameters client-side, as the queries were written for, which
+	// also keeps the pool usable behind transaction-pooling proxies.
+	poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
 
-	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	// Test connection
-	if err := conn.Ping(ctx); err != nil {
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, err
 	}
 
-	return conn, nil
+	return pool, nil
 }
 
 // RunMigrations runs database migrations
-func RunMigrations(ctx context.Context, conn *pgx.Conn) error {
+func RunMigrations(ctx context.Context, conn *pgxpool.Pool) error {
 	// Create users table
 	_, _ = conn.Exec(ctx, `
 	CREATE TABLE IF NOT EXISTS users (
@@ -68,7 +73,61 @@ func RunMigrations(ctx context.Context, conn *pgx.Conn) error {
 		docId BIGINT,
 		symptoms TEXT,
 		link TEXT,
-		seenByPatient BOOLEAN DEFAULT FALSE
+		objectKey TEXT DEFAULT '',
+		seenByPatient BOOLEAN DEFAULT FALSE,
+		followUpAt TIMESTAMPTZ,
+		status TEXT DEFAULT 'submitted',
+		statusChangedAt TIMESTAMPTZ DEFAULT NOW(),
+		finalizedAt TIMESTAMPTZ,
+		contentHash TEXT DEFAULT '',
+		signature TEXT DEFAULT '',
+		signingKeyId TEXT DEFAULT '',
+		parentPresId BIGINT,
+		validUntil TIMESTAMPTZ
+	);
+	`)
+
+	// Create prescription status history table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS prescription_status_history (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		presId BIGINT,
+		fromStatus TEXT DEFAULT '',
+		toStatus TEXT,
+		actorRole TEXT,
+		actorId BIGINT DEFAULT 0,
+		note TEXT DEFAULT ''
+	);
+	`)
+
+	// Create prescription amendments table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS prescription_amendments (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		presId BIGINT,
+		docId BIGINT,
+		reason TEXT,
+		changes JSONB DEFAULT '[]'::jsonb,
+		previousHash TEXT DEFAULT '',
+		contentHash TEXT DEFAULT ''
+	);
+	`)
+
+	// Create prescription versions table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS prescription_versions (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		presId BIGINT,
+		version INT,
+		actorRole TEXT,
+		actorId BIGINT DEFAULT 0,
+		reason TEXT DEFAULT '',
+		snapshot JSONB,
+		diff JSONB DEFAULT '[]'::jsonb,
+		UNIQUE (presId, version)
 	);
 	`)
 
@@ -81,39 +140,738 @@ func RunMigrations(ctx context.Context, conn *pgx.Conn) error {
 		name TEXT,
 		type TEXT,
 		aiReasons TEXT,
-		docReason TEXT
+		docReason TEXT,
+		doseAmount FLOAT DEFAULT 0,
+		doseUnit TEXT DEFAULT '',
+		route TEXT DEFAULT '',
+		frequency TEXT DEFAULT '',
+		timesPerDay INT DEFAULT 0,
+		asNeeded BOOLEAN DEFAULT FALSE,
+		durationDays INT DEFAULT 0,
+		quantity FLOAT DEFAULT 0,
+		instructions TEXT DEFAULT '',
+		approved BOOLEAN DEFAULT FALSE,
+		catalogId BIGINT,
+		matchScore FLOAT DEFAULT 0,
+		refills INT DEFAULT 0,
+		refillIntervalDays INT DEFAULT 0
+	);
+	`)
+
+	// Create doses table (medication schedule generated for approved medicine items)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS doses (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		itemId BIGINT,
+		presId BIGINT,
+		userId BIGINT,
+		scheduledAt TIMESTAMPTZ,
+		amount FLOAT DEFAULT 0,
+		status TEXT DEFAULT 'pending',
+		loggedAt TIMESTAMPTZ,
+		note TEXT DEFAULT ''
+	);
+	`)
+
+	// Create notification preferences table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS notification_preferences (
+		userId BIGINT PRIMARY KEY,
+		channels TEXT[] DEFAULT ARRAY['email'],
+		email TEXT DEFAULT '',
+		phnNumber TEXT DEFAULT '',
+		timezone TEXT DEFAULT 'UTC',
+		quietStart TEXT DEFAULT '',
+		quietEnd TEXT DEFAULT '',
+		pushSubscription TEXT DEFAULT '',
+		doseReminders BOOLEAN DEFAULT TRUE,
+		followUpReminders BOOLEAN DEFAULT TRUE,
+		leadMinutes INT DEFAULT 10,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+
+	// Create reminders table (durable queue shared by all instances)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS reminders (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		userId BIGINT,
+		kind TEXT,
+		refId BIGINT,
+		dueAt TIMESTAMPTZ,
+		status TEXT DEFAULT 'pending',
+		attempts INT DEFAULT 0,
+		lastError TEXT DEFAULT '',
+		sentAt TIMESTAMPTZ,
+		channels TEXT DEFAULT '',
+		lockedBy TEXT DEFAULT '',
+		lockedUntil TIMESTAMPTZ
+	);
+	`)
+
+	// Create drug catalog table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS drug_catalog (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		genericName TEXT UNIQUE,
+		brandNames TEXT[] DEFAULT '{}',
+		strengths TEXT[] DEFAULT '{}',
+		forms TEXT[] DEFAULT '{}',
+		atcCode TEXT DEFAULT ''
+	);
+	`)
+
+	// Count catalog changes so every instance can tell when its in-memory index is stale
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS drug_catalog_version (
+		id INT PRIMARY KEY,
+		version BIGINT NOT NULL DEFAULT 0
+	);
+	INSERT INTO drug_catalog_version (id, version) VALUES (1, 0) ON CONFLICT (id) DO NOTHING;
+	`)
+
+	// Create drug interactions table (loaded from a local dataset)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS drug_interactions (
+		id BIGSERIAL PRIMARY KEY,
+		drugA TEXT,
+		drugB TEXT,
+		severity TEXT,
+		description TEXT DEFAULT '',
+		UNIQUE (drugA, drugB)
+	);
+	`)
+
+	// Create prescription warnings table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS prescription_warnings (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT,
+		itemId BIGINT,
+		kind TEXT,
+		severity TEXT,
+		otherItemId BIGINT,
+		otherPresId BIGINT,
+		subject TEXT DEFAULT '',
+		description TEXT DEFAULT '',
+		acknowledgedAt TIMESTAMPTZ,
+		acknowledgedBy BIGINT
+	);
+	`)
+
+	// Create health profiles table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS health_profiles (
+		userId BIGINT PRIMARY KEY,
+		dateOfBirth TEXT DEFAULT '',
+		weightKg DOUBLE PRECISION DEFAULT 0,
+		pregnancyStatus TEXT DEFAULT 'unknown',
+		allergies JSONB DEFAULT '[]'::jsonb,
+		conditions JSONB DEFAULT '[]'::jsonb,
+		currentMedications JSONB DEFAULT '[]'::jsonb,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+
+	// Create vitals table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS vitals (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		userId BIGINT,
+		type TEXT,
+		code TEXT DEFAULT '',
+		value DOUBLE PRECISION,
+		secondaryValue DOUBLE PRECISION,
+		unit TEXT DEFAULT '',
+		measuredAt TIMESTAMPTZ,
+		context TEXT DEFAULT '',
+		note TEXT DEFAULT '',
+		source TEXT DEFAULT '',
+		recordedBy BIGINT
+	);
+	`)
+
+	// Create lab results table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS lab_results (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		userId BIGINT,
+		presId BIGINT,
+		code TEXT DEFAULT '',
+		name TEXT,
+		value DOUBLE PRECISION,
+		valueText TEXT DEFAULT '',
+		unit TEXT DEFAULT '',
+		refLow DOUBLE PRECISION,
+		refHigh DOUBLE PRECISION,
+		refText TEXT DEFAULT '',
+		flag TEXT DEFAULT '',
+		collectedAt TIMESTAMPTZ,
+		lab TEXT DEFAULT '',
+		note TEXT DEFAULT '',
+		source TEXT DEFAULT '',
+		recordedBy BIGINT
+	);
+	`)
+
+	// Create attachments table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT,
+		position INT DEFAULT 0,
+		fileName TEXT,
+		contentType TEXT,
+		size BIGINT DEFAULT 0,
+		pages INT DEFAULT 1,
+		objectKey TEXT DEFAULT '',
+		thumbnailKey TEXT DEFAULT '',
+		status TEXT DEFAULT 'pending'
+	);
+	`)
+
+	// Create upload outbox table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS upload_outbox (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		attachmentId BIGINT,
+		presId BIGINT,
+		kind TEXT DEFAULT 'original',
+		objectKey TEXT,
+		contentType TEXT,
+		size BIGINT DEFAULT 0,
+		data BYTEA,
+		status TEXT DEFAULT 'pending',
+		attempts INT DEFAULT 0,
+		nextAttemptAt TIMESTAMPTZ DEFAULT NOW(),
+		lastError TEXT DEFAULT '',
+		lockedBy TEXT DEFAULT '',
+		lockedUntil TIMESTAMPTZ,
+		completedAt TIMESTAMPTZ
+	);
+	`)
+
+	// Create storage reconciliation tables
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS storage_issues (
+		id BIGSERIAL PRIMARY KEY,
+		kind TEXT,
+		presId BIGINT,
+		attachmentId BIGINT,
+		objectKey TEXT DEFAULT '',
+		size BIGINT DEFAULT 0,
+		detail TEXT DEFAULT '',
+		detectedAt TIMESTAMPTZ DEFAULT NOW()
+	);
+	`)
+
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS storage_reconciliations (
+		id BIGSERIAL PRIMARY KEY,
+		startedAt TIMESTAMPTZ,
+		finishedAt TIMESTAMPTZ,
+		objectsScanned INT DEFAULT 0,
+		issues INT DEFAULT 0,
+		lastError TEXT DEFAULT ''
+	);
+	`)
+
+	// Create scan results table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS scan_results (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT,
+		attachmentId BIGINT,
+		fileName TEXT DEFAULT '',
+		sha256 TEXT DEFAULT '',
+		size BIGINT DEFAULT 0,
+		scanner TEXT DEFAULT '',
+		verdict TEXT,
+		signature TEXT DEFAULT '',
+		detail TEXT DEFAULT '',
+		durationMs BIGINT DEFAULT 0
+	);
+	`)
+
+	// Create pharmacies table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS pharmacies (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		name TEXT,
+		licenseNumber TEXT UNIQUE,
+		address TEXT DEFAULT '',
+		phnNumber TEXT DEFAULT '',
+		email TEXT UNIQUE,
+		password TEXT
+	);
+	`)
+
+	// Create prescription shares table (prescriptions a patient sent to a pharmacy)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS prescription_shares (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT NOT NULL,
+		pharmacyId BIGINT NOT NULL,
+		userId BIGINT NOT NULL,
+		revokedAt TIMESTAMP,
+		UNIQUE (presId, pharmacyId)
+	);
+	`)
+
+	// Create dispensings table
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS dispensings (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT NOT NULL,
+		itemId BIGINT NOT NULL,
+		pharmacyId BIGINT NOT NULL,
+		quantity DOUBLE PRECISION NOT NULL,
+		batchNumber TEXT NOT NULL,
+		note TEXT DEFAULT ''
+	);
+	`)
+
+	// Create refill requests table (a patient asking for more of a prescription's medicines)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS refill_requests (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT NOT NULL,
+		userId BIGINT NOT NULL,
+		docId BIGINT NOT NULL,
+		itemIds BIGINT[] NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		note TEXT DEFAULT '',
+		docNote TEXT DEFAULT '',
+		decidedAt TIMESTAMPTZ,
+		childPresId BIGINT
+	);
+	`)
+
+	// Create referrals table (a doctor asking another for a second opinion on a prescription or handing it over)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS referrals (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT NOT NULL,
+		fromDocId BIGINT NOT NULL,
+		toDocId BIGINT NOT NULL,
+		kind TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		reason TEXT DEFAULT '',
+		responseNote TEXT DEFAULT '',
+		respondedAt TIMESTAMPTZ,
+		opinion TEXT DEFAULT '',
+		completedAt TIMESTAMPTZ
+	);
+	`)
+
+	// Create item notes table (each doctor's own note on an item)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS item_notes (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		itemId BIGINT NOT NULL,
+		presId BIGINT NOT NULL,
+		docId BIGINT NOT NULL,
+		note TEXT NOT NULL DEFAULT ''
+	);
+	`)
+
+	// Create messages table (the thread between a prescription's patient and doctor)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS messages (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		presId BIGINT NOT NULL,
+		senderRole TEXT NOT NULL,
+		senderId BIGINT NOT NULL,
+		body TEXT DEFAULT '',
+		readAt TIMESTAMPTZ
 	);
 	`)
 
+	// Create doctor schedules tables (weekly consultation hours and their exceptions)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS doctor_schedules (
+		docId BIGINT PRIMARY KEY,
+		timezone TEXT NOT NULL DEFAULT 'UTC',
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS availability_windows (
+		id BIGSERIAL PRIMARY KEY,
+		docId BIGINT NOT NULL,
+		weekday INT NOT NULL,
+		startTime TEXT NOT NULL,
+		endTime TEXT NOT NULL,
+		slotMinutes INT NOT NULL
+	);
+	`)
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS availability_exceptions (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		docId BIGINT NOT NULL,
+		startsAt TIMESTAMPTZ NOT NULL,
+		endsAt TIMESTAMPTZ NOT NULL,
+		available BOOLEAN NOT NULL DEFAULT FALSE,
+		slotMinutes INT DEFAULT 0,
+		reason TEXT DEFAULT ''
+	);
+	`)
+
+	// Create appointments table. The exclusion constraints (which need
+	// btree_gist) keep a doctor's and a patient's booked appointments from
+	// overlapping; booking cannot work without them, so failures stop startup.
+	if _, err := conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS btree_gist"); err != nil {
+		return fmt.Errorf("creating the btree_gist extension (needed for appointments; a superuser may have to run CREATE EXTENSION btree_gist): %w", err)
+	}
+	_, err := conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS appointments (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		docId BIGINT NOT NULL,
+		userId BIGINT NOT NULL,
+		startsAt TIMESTAMPTZ NOT NULL,
+		endsAt TIMESTAMPTZ NOT NULL,
+		status TEXT NOT NULL DEFAULT 'booked',
+		reason TEXT DEFAULT '',
+		presId BIGINT,
+		cancelledAt TIMESTAMPTZ,
+		cancelledBy TEXT DEFAULT '',
+		CHECK (endsAt > startsAt),
+		CONSTRAINT appointments_doctor_no_overlap
+			EXCLUDE USING gist (docId WITH =, tstzrange(startsAt, endsAt) WITH &&) WHERE (status = 'booked'),
+		CONSTRAINT appointments_patient_no_overlap
+			EXCLUDE USING gist (userId WITH =, tstzrange(startsAt, endsAt) WITH &&) WHERE (status = 'booked')
+	);
+	`)
+	if err != nil {
+		return fmt.Errorf("creating the appointments table: %w", err)
+	}
+
+	// Create specialities table, the vocabulary doctors pick their speciality from
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS specialities (
+		code TEXT PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL
+	);
+	`)
+	_, _ = conn.Exec(ctx, `
+	INSERT INTO specialities (code, name) VALUES
+		('general_medicine', 'General Medicine'),
+		('family_medicine', 'Family Medicine'),
+		('internal_medicine', 'Internal Medicine'),
+		('pediatrics', 'Pediatrics'),
+		('cardiology', 'Cardiology'),
+		('dermatology', 'Dermatology'),
+		('endocrinology', 'Endocrinology'),
+		('gastroenterology', 'Gastroenterology'),
+		('nephrology', 'Nephrology'),
+		('neurology', 'Neurology'),
+		('pulmonology', 'Pulmonology'),
+		('rheumatology', 'Rheumatology'),
+		('oncology', 'Oncology'),
+		('hematology', 'Hematology'),
+		('infectious_disease', 'Infectious Disease'),
+		('psychiatry', 'Psychiatry'),
+		('obstetrics_gynecology', 'Obstetrics & Gynecology'),
+		('orthopedics', 'Orthopedics'),
+		('ophthalmology', 'Ophthalmology'),
+		('ent', 'ENT'),
+		('urology', 'Urology'),
+		('general_surgery', 'General Surgery'),
+		('anesthesiology', 'Anesthesiology'),
+		('radiology', 'Radiology'),
+		('emergency_medicine', 'Emergency Medicine'),
+		('geriatrics', 'Geriatrics'),
+		('dentistry', 'Dentistry')
+	ON CONFLICT (code) DO NOTHING
+	`)
+
+	// Other spellings and titles of the specialities ("Cardiologist",
+	// "Paediatrics"), matched when a doctor registers or searches
+	_, _ = conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS speciality_aliases (
+		alias TEXT PRIMARY KEY,
+		code TEXT NOT NULL REFERENCES specialities(code)
+	);
+	`)
+	_, _ = conn.Exec(ctx, `
+	INSERT INTO speciality_aliases (alias, code) VALUES
+		('general physician', 'general_medicine'),
+		('general practitioner', 'general_medicine'),
+		('gp', 'general_medicine'),
+		('physician', 'general_medicine'),
+		('general medicine physician', 'general_medicine'),
+		('mbbs', 'general_medicine'),
+		('family physician', 'family_medicine'),
+		('family doctor', 'family_medicine'),
+		('family practice', 'family_medicine'),
+		('internist', 'internal_medicine'),
+		('internal medicine physician', 'internal_medicine'),
+		('medicine', 'internal_medicine'),
+		('paediatrics', 'pediatrics'),
+		('pediatrician', 'pediatrics'),
+		('paediatrician', 'pediatrics'),
+		('pediatric', 'pediatrics'),
+		('paediatric', 'pediatrics'),
+		('child specialist', 'pediatrics'),
+		('cardiologist', 'cardiology'),
+		('cardiac', 'cardiology'),
+		('heart specialist', 'cardiology'),
+		('dermatologist', 'dermatology'),
+		('skin specialist', 'dermatology'),
+		('endocrinologist', 'endocrinology'),
+		('diabetology', 'endocrinology'),
+		('diabetologist', 'endocrinology'),
+		('gastroenterologist', 'gastroenterology'),
+		('gastro', 'gastroenterology'),
+		('nephrologist', 'nephrology'),
+		('kidney specialist', 'nephrology'),
+		('neurologist', 'neurology'),
+		('pulmonologist', 'pulmonology'),
+		('chest physician', 'pulmonology'),
+		('respiratory medicine', 'pulmonology'),
+		('pulmonary medicine', 'pulmonology'),
+		('rheumatologist', 'rheumatology'),
+		('oncologist', 'oncology'),
+		('cancer specialist', 'oncology'),
+		('haematology', 'hematology'),
+		('hematologist', 'hematology'),
+		('haematologist', 'hematology'),
+		('infectious diseases', 'infectious_disease'),
+		('infectious disease specialist', 'infectious_disease'),
+		('psychiatrist', 'psychiatry'),
+		('obstetrics and gynecology', 'obstetrics_gynecology'),
+		('obstetrics and gynaecology', 'obstetrics_gynecology'),
+		('obstetrics & gynaecology', 'obstetrics_gynecology'),
+		('gynecology', 'obstetrics_gynecology'),
+		('gynaecology', 'obstetrics_gynecology'),
+		('gynecologist', 'obstetrics_gynecology'),
+		('gynaecologist', 'obstetrics_gynecology'),
+		('obstetrics', 'obstetrics_gynecology'),
+		('obstetrician', 'obstetrics_gynecology'),
+		('ob/gyn', 'obstetrics_gynecology'),
+		('obgyn', 'obstetrics_gynecology'),
+		('ob-gyn', 'obstetrics_gynecology'),
+		('orthopaedics', 'orthopedics'),
+		('orthopedic', 'orthopedics'),
+		('orthopaedic', 'orthopedics'),
+		('orthopedist', 'orthopedics'),
+		('orthopaedist', 'orthopedics'),
+		('orthopedic surgeon', 'orthopedics'),
+		('orthopaedic surgeon', 'orthopedics'),
+		('ophthalmologist', 'ophthalmology'),
+		('eye specialist', 'ophthalmology'),
+		('otolaryngology', 'ent'),
+		('otorhinolaryngology', 'ent'),
+		('otolaryngologist', 'ent'),
+		('ent specialist', 'ent'),
+		('ear nose throat', 'ent'),
+		('urologist', 'urology'),
+		('general surgeon', 'general_surgery'),
+		('surgeon', 'general_surgery'),
+		('surgery', 'general_surgery'),
+		('anaesthesiology', 'anesthesiology'),
+		('anesthesia', 'anesthesiology'),
+		('anaesthesia', 'anesthesiology'),
+		('anesthesiologist', 'anesthesiology'),
+		('anaesthesiologist', 'anesthesiology'),
+		('anaesthetist', 'anesthesiology'),
+		('anesthetist', 'anesthesiology'),
+		('radiologist', 'radiology'),
+		('emergency physician', 'emergency_medicine'),
+		('emergency', 'emergency_medicine'),
+		('geriatrician', 'geriatrics'),
+		('geriatric medicine', 'geriatrics'),
+		('dentist', 'dentistry'),
+		('dental surgeon', 'dentistry'),
+		('dental', 'dentistry')
+	ON CONFLICT (alias) DO NOTHING
+	`)
+
+	// Doctor search matches names by trigram similarity and fails without it
+	if _, err := conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_trgm"); err != nil {
+		return fmt.Errorf("creating the pg_trgm extension (needed for doctor search; a superuser may have to run CREATE EXTENSION pg_trgm): %w", err)
+	}
+
 	// Add missing columns to existing tables
 	columnAddStatements := []string{
 		"ALTER TABLE doctors ADD COLUMN IF NOT EXISTS accuracy FLOAT",
 		"ALTER TABLE doctors ADD COLUMN IF NOT EXISTS speciality TEXT",
 		"ALTER TABLE doctors ADD COLUMN IF NOT EXISTS username TEXT",
 		"ALTER TABLE doctors ADD COLUMN IF NOT EXISTS email TEXT",
+		"ALTER TABLE doctors ADD COLUMN IF NOT EXISTS specialityCode TEXT",
 		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS userId BIGINT",
 		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS docId BIGINT",
 		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS symptoms TEXT",
 		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS link TEXT",
 		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS seenByPatient BOOLEAN DEFAULT FALSE",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS followUpAt TIMESTAMPTZ",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS objectKey TEXT DEFAULT ''",
+		// Prescriptions created before statuses existed were already with their doctor.
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS status TEXT DEFAULT 'awaiting_review'",
+		"ALTER TABLE prescriptions ALTER COLUMN status SET DEFAULT 'submitted'",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS statusChangedAt TIMESTAMPTZ DEFAULT NOW()",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS finalizedAt TIMESTAMPTZ",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS contentHash TEXT DEFAULT ''",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS signature TEXT DEFAULT ''",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS signingKeyId TEXT DEFAULT ''",
+		"ALTER TABLE attachments ADD COLUMN IF NOT EXISTS objectKey TEXT DEFAULT ''",
+		"ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnailKey TEXT DEFAULT ''",
+		"ALTER TABLE attachments ADD COLUMN IF NOT EXISTS messageId BIGINT",
+		"ALTER TABLE upload_outbox ADD COLUMN IF NOT EXISTS kind TEXT DEFAULT 'original'",
+		// Each attachment now has an original and a thumbnail upload.
+		"ALTER TABLE upload_outbox DROP CONSTRAINT IF EXISTS upload_outbox_attachmentid_key",
 		"ALTER TABLE items ADD COLUMN IF NOT EXISTS presId BIGINT",
 		"ALTER TABLE items ADD COLUMN IF NOT EXISTS name TEXT",
 		"ALTER TABLE items ADD COLUMN IF NOT EXISTS type TEXT",
 		"ALTER TABLE items ADD COLUMN IF NOT EXISTS aiReasons TEXT",
 		"ALTER TABLE items ADD COLUMN IF NOT EXISTS docReason TEXT",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS doseAmount FLOAT DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS doseUnit TEXT DEFAULT ''",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS route TEXT DEFAULT ''",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS frequency TEXT DEFAULT ''",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS timesPerDay INT DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS asNeeded BOOLEAN DEFAULT FALSE",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS durationDays INT DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS quantity FLOAT DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS instructions TEXT DEFAULT ''",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS approved BOOLEAN DEFAULT FALSE",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS catalogId BIGINT",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS matchScore FLOAT DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS rejected BOOLEAN DEFAULT FALSE",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS refills INT DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS refillIntervalDays INT DEFAULT 0",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS parentPresId BIGINT",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS validUntil TIMESTAMPTZ",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS analysisStatus TEXT DEFAULT ''",
+		"ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS analysisError TEXT DEFAULT ''",
 	}
 
 	for _, stmt := range columnAddStatements {
 		_, _ = conn.Exec(ctx, stmt)
 	}
 
+	// Doctors registered before the speciality vocabulary existed typed their
+	// speciality freely; link those that name a known speciality or one of its
+	// aliases, and report the rest so they can be fixed by hand.
+	_, _ = conn.Exec(ctx, `
+	UPDATE doctors d SET specialityCode = s.code, speciality = s.name
+	FROM specialities s
+	WHERE d.specialityCode IS NULL
+	  AND (LOWER(TRIM(d.speciality)) = LOWER(s.name) OR LOWER(TRIM(d.speciality)) = s.code
+	       OR EXISTS (SELECT 1 FROM speciality_aliases a WHERE a.code = s.code
+	                  AND a.alias = LOWER(regexp_replace(TRIM(d.speciality), '\s+', ' ', 'g'))))
+	`)
+	reportUnmappedSpecialities(ctx, conn)
+
+	// Uploads used to be stored as public or long-lived signed URLs. Keep only the
+	// object key so files are served through short-lived signed URLs; the link
+	// column of attachments only exists on databases created before that.
+	storedLinkPattern := `'^.*/(storage/v1/object/(public|sign)/[^/]+|api/storage/local)/'`
+	linkMigrations := []string{
+		`UPDATE prescriptions
+		 SET objectKey = regexp_replace(regexp_replace(link, ` + storedLinkPattern + `, ''), '\?.*$', ''), link = ''
+		 WHERE COALESCE(objectKey, '') = '' AND link ~ ` + storedLinkPattern,
+		`UPDATE attachments
+		 SET objectKey = regexp_replace(regexp_replace(link, ` + storedLinkPattern + `, ''), '\?.*$', ''), link = ''
+		 WHERE COALESCE(objectKey, '') = '' AND link ~ ` + storedLinkPattern,
+	}
+	for _, stmt := range linkMigrations {
+		_, _ = conn.Exec(ctx, stmt)
+	}
+
+	// Prescriptions created before versions were kept get their current content
+	// as version 1, so later changes never lose it.
+	_, _ = conn.Exec(ctx, `
+	INSERT INTO prescription_versions (presId, version, actorRole, actorId, reason, snapshot, diff)
+	SELECT p.id, 1, 'system', 0, 'recorded when version history was introduced',
+		jsonb_build_object(
+			'docId', COALESCE(p.docId, 0),
+			'symptoms', COALESCE(p.symptoms, ''),
+			'status', COALESCE(p.status, 'submitted'),
+			'followUpAt', p.followUpAt,
+			'items', COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+					'id', i.id, 'name', COALESCE(i.name, ''), 'type', COALESCE(i.type, ''),
+					'docReason', COALESCE(i.docReason, ''), 'approved', COALESCE(i.approved, FALSE), 'catalogId', i.catalogId,
+					'doseAmount', i.doseAmount, 'doseUnit', i.doseUnit, 'route', i.route,
+					'frequency', i.frequency, 'timesPerDay', i.timesPerDay, 'asNeeded', i.asNeeded,
+					'durationDays', i.durationDays, 'quantity', i.quantity, 'instructions', i.instructions
+				) ORDER BY i.id)
+				FROM items i WHERE i.presId = p.id
+			), '[]'::jsonb)
+		),
+		'[]'::jsonb
+	FROM prescriptions p
+	WHERE NOT EXISTS (SELECT 1 FROM prescription_versions v WHERE v.presId = p.id)
+	`)
+
 	// Create indexes
 	indexStatements := []string{
 		"CREATE INDEX IF NOT EXISTS idx_prescriptions_userId ON prescriptions(userId)",
 		"CREATE INDEX IF NOT EXISTS idx_prescriptions_docId ON prescriptions(docId)",
+		"CREATE INDEX IF NOT EXISTS idx_prescriptions_docId_status ON prescriptions(docId, status)",
+		"CREATE INDEX IF NOT EXISTS idx_prescription_status_history_presId ON prescription_status_history(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_prescription_amendments_presId ON prescription_amendments(presId)",
 		"CREATE INDEX IF NOT EXISTS idx_items_presId ON items(presId)",
 		"CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)",
 		"CREATE INDEX IF NOT EXISTS idx_doctors_email ON doctors(email)",
+		"CREATE INDEX IF NOT EXISTS idx_doses_presId ON doses(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_doses_itemId ON doses(itemId)",
+		"CREATE INDEX IF NOT EXISTS idx_doses_userId_scheduledAt ON doses(userId, scheduledAt)",
+		"CREATE INDEX IF NOT EXISTS idx_doses_pending_scheduledAt ON doses(scheduledAt) WHERE status = 'pending'",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_reminders_kind_refId ON reminders(kind, refId)",
+		"CREATE INDEX IF NOT EXISTS idx_items_catalogId ON items(catalogId)",
+		"CREATE INDEX IF NOT EXISTS idx_prescription_warnings_presId ON prescription_warnings(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_vitals_userId_measuredAt ON vitals(userId, measuredAt)",
+		"CREATE INDEX IF NOT EXISTS idx_attachments_presId ON attachments(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_upload_outbox_status_nextAttemptAt ON upload_outbox(status, nextAttemptAt)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_upload_outbox_attachmentId_kind ON upload_outbox(attachmentId, kind)",
+		"CREATE INDEX IF NOT EXISTS idx_scan_results_verdict_created_at ON scan_results(verdict, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_lab_results_userId_collectedAt ON lab_results(userId, collectedAt)",
+		"CREATE INDEX IF NOT EXISTS idx_reminders_status_dueAt ON reminders(status, dueAt)",
+		"CREATE INDEX IF NOT EXISTS idx_prescription_shares_pharmacyId ON prescription_shares(pharmacyId)",
+		"CREATE INDEX IF NOT EXISTS idx_dispensings_presId ON dispensings(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_dispensings_itemId ON dispensings(itemId)",
+		"CREATE INDEX IF NOT EXISTS idx_prescriptions_parentPresId ON prescriptions(parentPresId)",
+		"CREATE INDEX IF NOT EXISTS idx_prescriptions_finalized_validUntil ON prescriptions(validUntil) WHERE status = 'finalized'",
+		"CREATE INDEX IF NOT EXISTS idx_refill_requests_presId ON refill_requests(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_refill_requests_docId_status ON refill_requests(docId, status)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_refill_requests_pending_presId ON refill_requests(presId) WHERE status = 'pending'",
+		"CREATE INDEX IF NOT EXISTS idx_referrals_presId ON referrals(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_referrals_toDocId_status ON referrals(toDocId, status)",
+		"CREATE INDEX IF NOT EXISTS idx_referrals_fromDocId_status ON referrals(fromDocId, status)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_referrals_open_presId_toDocId ON referrals(presId, toDocId) WHERE status IN ('pending', 'accepted')",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_referrals_pending_handoff_presId ON referrals(presId) WHERE kind = 'handoff' AND status = 'pending'",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_item_notes_itemId_docId ON item_notes(itemId, docId)",
+		"CREATE INDEX IF NOT EXISTS idx_messages_presId_id ON messages(presId, id)",
+		"CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(presId, senderRole) WHERE readAt IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_attachments_messageId ON attachments(messageId) WHERE messageId IS NOT NULL",
+		"CREATE INDEX IF NOT EXISTS idx_availability_windows_docId ON availability_windows(docId)",
+		"CREATE INDEX IF NOT EXISTS idx_availability_exceptions_docId_endsAt ON availability_exceptions(docId, endsAt)",
+		"CREATE INDEX IF NOT EXISTS idx_appointments_userId_startsAt ON appointments(userId, startsAt)",
+		"CREATE INDEX IF NOT EXISTS idx_appointments_presId ON appointments(presId)",
+		"CREATE INDEX IF NOT EXISTS idx_doctors_specialityCode ON doctors(specialityCode)",
+		"CREATE INDEX IF NOT EXISTS idx_doctors_name_trgm ON doctors USING gin (LOWER(name) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_doctors_username_trgm ON doctors USING gin (LOWER(username) gin_trgm_ops)",
 	}
 
 	for _, stmt := range indexStatements {
@@ -122,3 +880,27 @@ func RunMigrations(ctx context.Context, conn *pgx.Conn) error {
 
 	return nil
 }
+
+// reportUnmappedSpecialities logs the doctors whose free-text speciality
+// matched nothing in the vocabulary. They can set it from their profile.
+func reportUnmappedSpecialities(ctx context.Context, conn *pgxpool.Pool) {
+	rows, err := conn.Query(ctx, `
+	SELECT TRIM(speciality), COUNT(*)
+	FROM doctors
+	WHERE specialityCode IS NULL AND COALESCE(TRIM(speciality), '') <> ''
+	GROUP BY TRIM(speciality)
+	ORDER BY COUNT(*) DESC`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var speciality string
+		var count int
+		if err := rows.Scan(&speciality, &count); err != nil {
+			return
+		}
+		log.Printf("warning: %d doctor(s) have the unknown speciality %q; add an alias or set it from the doctor profile", count, speciality)
+	}
+}
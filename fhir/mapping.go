@@ -0,0 +1,318 @@
+package fhir
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func id(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func instant(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// PatientReference and PractitionerReference build references to local resources.
+func PatientReference(userID int64) Reference {
+	return Reference{Reference: "Patient/" + id(userID)}
+}
+
+func PractitionerReference(docID int64) *Reference {
+	return &Reference{Reference: "Practitioner/" + id(docID)}
+}
+
+func telecom(email, phone string) []ContactPoint {
+	var points []ContactPoint
+	if email != "" {
+		points = append(points, ContactPoint{System: "email", Value: email})
+	}
+	if phone != "" {
+		points = append(points, ContactPoint{System: "phone", Value: phone})
+	}
+	return points
+}
+
+// NewPatient maps a user and their health profile to a Patient.
+func NewPatient(user *models.User, profile *models.HealthProfile) *Patient {
+	patient := &Patient{
+		ResourceType: "Patient",
+		ID:           id(user.ID),
+		Identifier:   []Identifier{{System: SystemPatient, Value: id(user.ID)}},
+		Name:         []HumanName{{Text: user.Name}},
+		Telecom:      telecom(user.Email, user.PhnNumber),
+	}
+	if profile != nil {
+		patient.BirthDate = profile.DateOfBirth
+	}
+	return patient
+}
+
+// NewPractitioner maps a doctor to a Practitioner; the speciality becomes a qualification.
+func NewPractitioner(doctor *models.Doctor) *Practitioner {
+	practitioner := &Practitioner{
+		ResourceType: "Practitioner",
+		ID:           id(doctor.ID),
+		Identifier:   []Identifier{{System: SystemPractitioner, Value: id(doctor.ID)}},
+		Name:         []HumanName{{Text: doctor.Name}},
+		Telecom:      telecom(doctor.Email, doctor.PhnNumber),
+	}
+	if doctor.Speciality != "" {
+		practitioner.Qualification = []Qualification{{Code: CodeableConcept{Text: doctor.Speciality}}}
+	}
+	return practitioner
+}
+
+// requestIntent is "order" once the doctor has finalized the prescription;
+// before that its items are only proposals.
+func requestIntent(prescription *models.Prescription) string {
+	if prescription.FinalizedAt != nil {
+		return "order"
+	}
+	return "proposal"
+}
+
+// MedicationRequestStatus maps a prescription status and the item's approval
+// to a MedicationRequest status.
+func MedicationRequestStatus(prescription *models.Prescription, item *models.Items) string {
+	switch prescription.Status {
+	case models.PrescriptionStatusCancelled:
+		return "cancelled"
+	case models.PrescriptionStatusExpired:
+		return "stopped"
+	case models.PrescriptionStatusFinalized:
+		if item.Approved {
+			return "active"
+		}
+		return "cancelled"
+	}
+	return "draft"
+}
+
+// ServiceRequestStatus is MedicationRequestStatus for test items, whose value
+// set names withdrawn and ended requests differently.
+func ServiceRequestStatus(prescription *models.Prescription, item *models.Items) string {
+	switch status := MedicationRequestStatus(prescription, item); status {
+	case "cancelled":
+		return "revoked"
+	case "stopped":
+		return "completed"
+	default:
+		return status
+	}
+}
+
+func authoredOn(prescription *models.Prescription) string {
+	if prescription.FinalizedAt != nil {
+		return instant(*prescription.FinalizedAt)
+	}
+	return instant(prescription.CreatedAt)
+}
+
+func prescriptionIdentifier(prescription *models.Prescription) *Identifier {
+	return &Identifier{System: SystemPrescription, Value: id(prescription.ID)}
+}
+
+func reasonCode(prescription *models.Prescription) []CodeableConcept {
+	if strings.TrimSpace(prescription.Symptoms) == "" {
+		return nil
+	}
+	return []CodeableConcept{{Text: prescription.Symptoms}}
+}
+
+func notes(text string) []Annotation {
+	if text == "" {
+		return nil
+	}
+	return []Annotation{{Text: text}}
+}
+
+// NewMedicationRequest maps a medicine item to a MedicationRequest. The items
+// of one prescription share its groupIdentifier. drug is the linked catalog
+// entry, if any, and contributes an ATC coding.
+func NewMedicationRequest(prescription *models.Prescription, item *models.Items, drug *models.Drug, dosageText string) *MedicationRequest {
+	medication := &CodeableConcept{Text: item.Name}
+	if drug != nil && drug.ATCCode != "" {
+		medication.Coding = []Coding{{System: SystemATC, Code: drug.ATCCode, Display: drug.GenericName}}
+	}
+
+	request := &MedicationRequest{
+		ResourceType:              "MedicationRequest",
+		ID:                        id(item.ID),
+		Identifier:                []Identifier{{System: SystemItem, Value: id(item.ID)}},
+		Status:                    MedicationRequestStatus(prescription, item),
+		Intent:                    requestIntent(prescription),
+		MedicationCodeableConcept: medication,
+		Subject:                   PatientReference(prescription.UserID),
+		AuthoredOn:                authoredOn(prescription),
+		Requester:                 PractitionerReference(prescription.DocID),
+		ReasonCode:                reasonCode(prescription),
+		GroupIdentifier:           prescriptionIdentifier(prescription),
+		Note:                      notes(item.DocReason),
+	}
+	if dosage := NewDosage(item.Dosage, dosageText); dosage != nil {
+		request.DosageInstruction = []Dosage{*dosage}
+	}
+	if item.Quantity > 0 || item.DurationDays > 0 || item.Refills > 0 || prescription.ValidUntil != nil {
+		request.DispenseRequest = &DispenseRequest{NumberOfRepeatsAllowed: item.Refills}
+		if prescription.ValidUntil != nil {
+			request.DispenseRequest.ValidityPeriod = &Period{Start: authoredOn(prescription), End: instant(*prescription.ValidUntil)}
+		}
+		if item.Refills > 0 {
+			request.DispenseRequest.DispenseInterval = days(item.RefillIntervalDays)
+		}
+		if item.Quantity > 0 {
+			request.DispenseRequest.Quantity = &Quantity{Value: item.Quantity, Unit: item.DoseUnit}
+		}
+		if item.DurationDays > 0 {
+			request.DispenseRequest.ExpectedSupplyDuration = days(item.DurationDays)
+		}
+	}
+	return request
+}
+
+// NewServiceRequest maps a test item to a ServiceRequest.
+func NewServiceRequest(prescription *models.Prescription, item *models.Items) *ServiceRequest {
+	return &ServiceRequest{
+		ResourceType: "ServiceRequest",
+		ID:           id(item.ID),
+		Identifier:   []Identifier{{System: SystemItem, Value: id(item.ID)}},
+		Requisition:  prescriptionIdentifier(prescription),
+		Status:       ServiceRequestStatus(prescription, item),
+		Intent:       requestIntent(prescription),
+		Code:         &CodeableConcept{Text: item.Name},
+		Subject:      PatientReference(prescription.UserID),
+		AuthoredOn:   authoredOn(prescription),
+		Requester:    PractitionerReference(prescription.DocID),
+		ReasonCode:   reasonCode(prescription),
+		Note:         notes(item.DocReason),
+	}
+}
+
+// NewDocumentReference maps the uploaded files of a prescription to a
+// DocumentReference. contents holds one attachment per file with its URL.
+func NewDocumentReference(prescription *models.Prescription, contents []Attachment) *DocumentReference {
+	document := &DocumentReference{
+		ResourceType: "DocumentReference",
+		ID:           id(prescription.ID),
+		Identifier:   []Identifier{*prescriptionIdentifier(prescription)},
+		Status:       "current",
+		Type:         &CodeableConcept{Text: "Prescription"},
+		Subject:      &Reference{Reference: "Patient/" + id(prescription.UserID)},
+		Date:         instant(prescription.CreatedAt),
+		Author:       []Reference{*PractitionerReference(prescription.DocID)},
+		Description:  prescription.Symptoms,
+		Content:      make([]DocumentContent, 0, len(contents)),
+	}
+	for _, attachment := range contents {
+		document.Content = append(document.Content, DocumentContent{Attachment: attachment})
+	}
+	return document
+}
+
+func days(n int) *Quantity {
+	return &Quantity{Value: float64(n), Unit: "days", System: SystemUCUM, Code: "d"}
+}
+
+// NewDosage maps a structured dosage to a FHIR Dosage; text is its
+// human-readable summary. It returns nil for an empty dosage.
+func NewDosage(dosage models.Dosage, text string) *Dosage {
+	if dosage == (models.Dosage{}) {
+		return nil
+	}
+	result := &Dosage{
+		Text:               text,
+		PatientInstruction: dosage.Instructions,
+		AsNeededBoolean:    dosage.AsNeeded,
+	}
+	if dosage.Route != "" {
+		result.Route = &CodeableConcept{Text: dosage.Route}
+	}
+	if dosage.DoseAmount > 0 {
+		result.DoseAndRate = []DoseAndRate{{DoseQuantity: &Quantity{Value: dosage.DoseAmount, Unit: dosage.DoseUnit}}}
+	}
+	if dosage.TimesPerDay > 0 || dosage.DurationDays > 0 || dosage.Frequency != "" {
+		result.Timing = &Timing{}
+		if dosage.Frequency != "" {
+			result.Timing.Code = &CodeableConcept{Text: dosage.Frequency}
+		}
+		if dosage.TimesPerDay > 0 || dosage.DurationDays > 0 {
+			result.Timing.Repeat = &TimingRepeat{}
+			if dosage.TimesPerDay > 0 {
+				result.Timing.Repeat.Frequency = dosage.TimesPerDay
+				result.Timing.Repeat.Period = 1
+				result.Timing.Repeat.PeriodUnit = "d"
+			}
+			if dosage.DurationDays > 0 {
+				result.Timing.Repeat.BoundsDuration = days(dosage.DurationDays)
+			}
+		}
+	}
+	return result
+}
+
+// periodDays converts a timing period to days; ok is false for units that
+// do not divide a day evenly into doses.
+func periodDays(period float64, unit string) (float64, bool) {
+	switch unit {
+	case "h", "hour", "hours":
+		return period / 24, period > 0
+	case "d", "day", "days":
+		return period, period > 0
+	case "wk", "week", "weeks":
+		return period * 7, period > 0
+	}
+	return 0, false
+}
+
+// DosageFields extracts the structured fields of an incoming FHIR Dosage.
+// Fields that are absent or cannot be represented stay zero; the caller
+// merges them over whatever the dosage text parses to.
+func DosageFields(dosage *Dosage) models.Dosage {
+	var result models.Dosage
+	if dosage == nil {
+		return result
+	}
+	result.Instructions = dosage.PatientInstruction
+	result.AsNeeded = dosage.AsNeededBoolean
+	result.Route = dosage.Route.Label()
+	for _, doseAndRate := range dosage.DoseAndRate {
+		if quantity := doseAndRate.DoseQuantity; quantity != nil {
+			result.DoseAmount = quantity.Value
+			result.DoseUnit = quantity.Unit
+			if result.DoseUnit == "" {
+				result.DoseUnit = quantity.Code
+			}
+			break
+		}
+	}
+	if dosage.Timing != nil {
+		result.Frequency = dosage.Timing.Code.Label()
+		if repeat := dosage.Timing.Repeat; repeat != nil {
+			if perDay, ok := periodDays(repeat.Period, repeat.PeriodUnit); ok && repeat.Frequency > 0 && result.Frequency == "" {
+				times := float64(repeat.Frequency) / perDay
+				if times == float64(int(times)) {
+					result.TimesPerDay = int(times)
+				}
+			}
+			if bounds := repeat.BoundsDuration; bounds != nil {
+				if d, ok := periodDays(bounds.Value, firstNonEmpty(bounds.Code, bounds.Unit)); ok {
+					result.DurationDays = int(d)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
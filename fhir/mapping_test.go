@@ -0,0 +1,97 @@
+package fhir
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestDosageFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		dosage *Dosage
+		want   models.Dosage
+	}{
+		{name: "no dosage", dosage: nil, want: models.Dosage{}},
+		{
+			name: "structured dose, route, frequency and duration",
+			dosage: &Dosage{
+				PatientInstruction: "after food",
+				Route:              &CodeableConcept{Text: "oral"},
+				DoseAndRate:        []DoseAndRate{{DoseQuantity: &Quantity{Value: 500, Unit: "mg"}}},
+				Timing:             &Timing{Repeat: &TimingRepeat{Frequency: 2, Period: 1, PeriodUnit: "d", BoundsDuration: &Quantity{Value: 5, Code: "d"}}},
+			},
+			want: models.Dosage{DoseAmount: 500, DoseUnit: "mg", Route: "oral", TimesPerDay: 2, DurationDays: 5, Instructions: "after food"},
+		},
+		{
+			name:   "hourly period",
+			dosage: &Dosage{Timing: &Timing{Repeat: &TimingRepeat{Frequency: 1, Period: 8, PeriodUnit: "h"}}},
+			want:   models.Dosage{TimesPerDay: 3},
+		},
+		{
+			name:   "timing code wins over repeat",
+			dosage: &Dosage{Timing: &Timing{Code: &CodeableConcept{Text: "BID"}, Repeat: &TimingRepeat{Frequency: 3, Period: 1, PeriodUnit: "d"}}},
+			want:   models.Dosage{Frequency: "BID"},
+		},
+		{
+			name:   "UCUM code when the unit is missing",
+			dosage: &Dosage{DoseAndRate: []DoseAndRate{{DoseQuantity: &Quantity{Value: 2, Code: "{puff}"}}}, AsNeededBoolean: true},
+			want:   models.Dosage{DoseAmount: 2, DoseUnit: "{puff}", AsNeeded: true},
+		},
+		{
+			name:   "duration in weeks",
+			dosage: &Dosage{Timing: &Timing{Repeat: &TimingRepeat{BoundsDuration: &Quantity{Value: 2, Unit: "weeks"}}}},
+			want:   models.Dosage{DurationDays: 14},
+		},
+		{
+			name:   "monthly period is not representable",
+			dosage: &Dosage{Timing: &Timing{Repeat: &TimingRepeat{Frequency: 1, Period: 1, PeriodUnit: "mo"}}},
+			want:   models.Dosage{},
+		},
+		{
+			name:   "fractional doses per day are dropped",
+			dosage: &Dosage{Timing: &Timing{Repeat: &TimingRepeat{Frequency: 3, Period: 2, PeriodUnit: "d"}}},
+			want:   models.Dosage{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DosageFields(tt.dosage); got != tt.want {
+				t.Errorf("DosageFields() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestStatus(t *testing.T) {
+	finalizedAt := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		status      string
+		approved    bool
+		wantMed     string
+		wantService string
+	}{
+		{name: "awaiting review", status: models.PrescriptionStatusAwaitingReview, approved: true, wantMed: "draft", wantService: "draft"},
+		{name: "finalized and approved", status: models.PrescriptionStatusFinalized, approved: true, wantMed: "active", wantService: "active"},
+		{name: "finalized but not approved", status: models.PrescriptionStatusFinalized, wantMed: "cancelled", wantService: "revoked"},
+		{name: "cancelled", status: models.PrescriptionStatusCancelled, approved: true, wantMed: "cancelled", wantService: "revoked"},
+		{name: "expired", status: models.PrescriptionStatusExpired, approved: true, wantMed: "stopped", wantService: "completed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prescription := &models.Prescription{Status: tt.status, FinalizedAt: &finalizedAt}
+			item := &models.Items{Approved: tt.approved}
+			if got := MedicationRequestStatus(prescription, item); got != tt.wantMed {
+				t.Errorf("MedicationRequestStatus() = %q, want %q", got, tt.wantMed)
+			}
+			if got := ServiceRequestStatus(prescription, item); got != tt.wantService {
+				t.Errorf("ServiceRequestStatus() = %q, want %q", got, tt.wantService)
+			}
+		})
+	}
+}
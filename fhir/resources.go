@@ -0,0 +1,296 @@
+// Package fhir maps prescriptions, items, patients and doctors to and from
+// HL7 FHIR R4 resources. Only the elements this backend can fill or consume
+// are modelled; unknown elements in incoming resources are ignored.
+package fhir
+
+import "encoding/json"
+
+// ContentType is the media type of FHIR JSON.
+const ContentType = "application/fhir+json"
+
+// Identifier systems for the IDs this backend assigns.
+const (
+	SystemPatient      = "urn:medinfo:patient"
+	SystemPractitioner = "urn:medinfo:doctor"
+	SystemPrescription = "urn:medinfo:prescription"
+	SystemItem         = "urn:medinfo:item"
+	SystemATC          = "http://www.whocc.no/atc"
+	SystemUCUM         = "http://unitsofmeasure.org"
+)
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Label returns the text of the concept, falling back to the first coding's display.
+func (c *CodeableConcept) Label() string {
+	if c == nil {
+		return ""
+	}
+	if c.Text != "" {
+		return c.Text
+	}
+	for _, coding := range c.Coding {
+		if coding.Display != "" {
+			return coding.Display
+		}
+	}
+	return ""
+}
+
+type HumanName struct {
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+type Quantity struct {
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit,omitempty"`
+	System string  `json:"system,omitempty"`
+	Code   string  `json:"code,omitempty"`
+}
+
+type Meta struct {
+	LastUpdated string `json:"lastUpdated,omitempty"`
+}
+
+type Patient struct {
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	BirthDate    string         `json:"birthDate,omitempty"`
+}
+
+type Qualification struct {
+	Code CodeableConcept `json:"code"`
+}
+
+type Practitioner struct {
+	ResourceType  string          `json:"resourceType"`
+	ID            string          `json:"id,omitempty"`
+	Identifier    []Identifier    `json:"identifier,omitempty"`
+	Name          []HumanName     `json:"name,omitempty"`
+	Telecom       []ContactPoint  `json:"telecom,omitempty"`
+	Qualification []Qualification `json:"qualification,omitempty"`
+}
+
+type TimingRepeat struct {
+	BoundsDuration *Quantity `json:"boundsDuration,omitempty"`
+	Frequency      int       `json:"frequency,omitempty"`
+	Period         float64   `json:"period,omitempty"`
+	PeriodUnit     string    `json:"periodUnit,omitempty"`
+}
+
+type Timing struct {
+	Repeat *TimingRepeat    `json:"repeat,omitempty"`
+	Code   *CodeableConcept `json:"code,omitempty"`
+}
+
+type DoseAndRate struct {
+	DoseQuantity *Quantity `json:"doseQuantity,omitempty"`
+}
+
+type Dosage struct {
+	Text               string           `json:"text,omitempty"`
+	PatientInstruction string           `json:"patientInstruction,omitempty"`
+	Timing             *Timing          `json:"timing,omitempty"`
+	AsNeededBoolean    bool             `json:"asNeededBoolean,omitempty"`
+	Route              *CodeableConcept `json:"route,omitempty"`
+	DoseAndRate        []DoseAndRate    `json:"doseAndRate,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type DispenseRequest struct {
+	ValidityPeriod         *Period   `json:"validityPeriod,omitempty"`
+	DispenseInterval       *Quantity `json:"dispenseInterval,omitempty"`
+	NumberOfRepeatsAllowed int       `json:"numberOfRepeatsAllowed,omitempty"`
+	Quantity               *Quantity `json:"quantity,omitempty"`
+	ExpectedSupplyDuration *Quantity `json:"expectedSupplyDuration,omitempty"`
+}
+
+type MedicationRequest struct {
+	ResourceType              string            `json:"resourceType"`
+	ID                        string            `json:"id,omitempty"`
+	Identifier                []Identifier      `json:"identifier,omitempty"`
+	Status                    string            `json:"status"`
+	Intent                    string            `json:"intent"`
+	MedicationCodeableConcept *CodeableConcept  `json:"medicationCodeableConcept,omitempty"`
+	Subject                   Reference         `json:"subject"`
+	AuthoredOn                string            `json:"authoredOn,omitempty"`
+	Requester                 *Reference        `json:"requester,omitempty"`
+	ReasonCode                []CodeableConcept `json:"reasonCode,omitempty"`
+	GroupIdentifier           *Identifier       `json:"groupIdentifier,omitempty"`
+	Note                      []Annotation      `json:"note,omitempty"`
+	DosageInstruction         []Dosage          `json:"dosageInstruction,omitempty"`
+	DispenseRequest           *DispenseRequest  `json:"dispenseRequest,omitempty"`
+}
+
+type ServiceRequest struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Requisition  *Identifier       `json:"requisition,omitempty"`
+	Status       string            `json:"status"`
+	Intent       string            `json:"intent"`
+	Code         *CodeableConcept  `json:"code,omitempty"`
+	Subject      Reference         `json:"subject"`
+	AuthoredOn   string            `json:"authoredOn,omitempty"`
+	Requester    *Reference        `json:"requester,omitempty"`
+	ReasonCode   []CodeableConcept `json:"reasonCode,omitempty"`
+	Note         []Annotation      `json:"note,omitempty"`
+}
+
+type Attachment struct {
+	ContentType string `json:"contentType,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Creation    string `json:"creation,omitempty"`
+}
+
+type DocumentContent struct {
+	Attachment Attachment `json:"attachment"`
+}
+
+type DocumentReference struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Status       string            `json:"status"`
+	Type         *CodeableConcept  `json:"type,omitempty"`
+	Subject      *Reference        `json:"subject,omitempty"`
+	Date         string            `json:"date,omitempty"`
+	Author       []Reference       `json:"author,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Content      []DocumentContent `json:"content"`
+}
+
+type BundleRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type BundleResponse struct {
+	Status   string            `json:"status"`
+	Location string            `json:"location,omitempty"`
+	Outcome  *OperationOutcome `json:"outcome,omitempty"`
+}
+
+type BundleEntry struct {
+	FullURL  string          `json:"fullUrl,omitempty"`
+	Resource json.RawMessage `json:"resource,omitempty"`
+	Request  *BundleRequest  `json:"request,omitempty"`
+	Response *BundleResponse `json:"response,omitempty"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        *int          `json:"total,omitempty"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+// Issue severities and codes used in OperationOutcome.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+
+	IssueInvalid      = "invalid"
+	IssueRequired     = "required"
+	IssueNotFound     = "not-found"
+	IssueNotSupported = "not-supported"
+	IssueDuplicate    = "duplicate"
+	IssueException    = "exception"
+	IssueBusinessRule = "business-rule"
+)
+
+type Issue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+// NewOperationOutcome returns an outcome with a single error issue.
+func NewOperationOutcome(code, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []Issue{{Severity: SeverityError, Code: code, Diagnostics: diagnostics}},
+	}
+}
+
+// Error lets an outcome carrying validation issues be returned as an error.
+func (o *OperationOutcome) Error() string {
+	if len(o.Issue) == 0 {
+		return "invalid FHIR content"
+	}
+	if len(o.Issue) == 1 {
+		return o.Issue[0].Diagnostics
+	}
+	return o.Issue[0].Diagnostics + " (and more)"
+}
+
+// NewSearchBundle wraps resources in a searchset bundle.
+func NewSearchBundle(baseURL string, resources ...Resource) (*Bundle, error) {
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset", Entry: make([]BundleEntry, 0, len(resources))}
+	for _, resource := range resources {
+		raw, err := json.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Entry = append(bundle.Entry, BundleEntry{FullURL: baseURL + "/" + resource.Ref(), Resource: raw})
+	}
+	total := len(bundle.Entry)
+	bundle.Total = &total
+	return bundle, nil
+}
+
+// Resource is implemented by the resource types this package exports.
+type Resource interface {
+	// Ref returns the relative reference to the resource, e.g. "Patient/12".
+	Ref() string
+}
+
+func (p *Patient) Ref() string           { return "Patient/" + p.ID }
+func (p *Practitioner) Ref() string      { return "Practitioner/" + p.ID }
+func (m *MedicationRequest) Ref() string { return "MedicationRequest/" + m.ID }
+func (s *ServiceRequest) Ref() string    { return "ServiceRequest/" + s.ID }
+func (d *DocumentReference) Ref() string { return "DocumentReference/" + d.ID }
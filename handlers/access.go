@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// requireRole extracts the caller's token claims and checks the role against roles.
+// On failure it writes the error response and returns false.
+func requireRole(w http.ResponseWriter, r *http.Request, roles ...string) (*utils.Claims, bool) {
+	claims, err := ExtractTokenInfo(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	for _, role := range roles {
+		if claims.Role == role {
+			return claims, true
+		}
+	}
+
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return nil, false
+}
+
+// authorizePrescription loads a prescription and checks that the caller is its
+// patient, its assigned doctor or a pharmacy the patient shared it with. On
+// failure it writes the error response and returns false.
+func authorizePrescription(ctx context.Context, w http.ResponseWriter, db *pgxpool.Pool, claims *utils.Claims, presID int64) (*models.Prescription, bool) {
+	return checkPrescriptionAccess(ctx, w, db, claims, presID, false)
+}
+
+// authorizePrescriptionView is authorizePrescription for read-only access,
+// which doctors the prescription was referred to also have.
+func authorizePrescriptionView(ctx context.Context, w http.ResponseWriter, db *pgxpool.Pool, claims *utils.Claims, presID int64) (*models.Prescription, bool) {
+	return checkPrescriptionAccess(ctx, w, db, claims, presID, true)
+}
+
+func checkPrescriptionAccess(ctx context.Context, w http.ResponseWriter, db *pgxpool.Pool, claims *utils.Claims, presID int64, referred bool) (*models.Prescription, bool) {
+	prescription, err := services.NewPrescriptionService(db).GetPrescription(ctx, presID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "prescription not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	switch {
+	case claims.Role == "user" && prescription.UserID == claims.ID:
+		return prescription, true
+	case claims.Role == "doctor" && prescription.DocID == claims.ID:
+		return prescription, true
+	case claims.Role == "doctor" && referred:
+		hasAccess, err := services.NewReferralService(db).HasAccess(ctx, presID, claims.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		if hasAccess {
+			return prescription, true
+		}
+	case claims.Role == "pharmacy":
+		shared, err := services.NewDispensingService(db).IsSharedWith(ctx, presID, claims.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		if shared {
+			return prescription, true
+		}
+	}
+
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return nil, false
+}
+
+// authorizePatient checks that the caller is the patient themselves or a doctor
+// assigned to one of their prescriptions. On failure it writes the error response and returns false.
+func authorizePatient(ctx context.Context, w http.ResponseWriter, db *pgxpool.Pool, claims *utils.Claims, userID int64) bool {
+	switch claims.Role {
+	case "user":
+		if claims.ID == userID {
+			return true
+		}
+	case "doctor":
+		treats, err := services.NewPrescriptionService(db).DoctorTreatsPatient(ctx, claims.ID, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		if treats {
+			return true
+		}
+	}
+
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/scanner"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetStorageReportHandler reports queued and failed uploads, prescriptions with
+// missing files and stored objects nothing refers to.
+// Query param: refresh (optional, "true" reconciles with the store first)
+func GetStorageReportHandler(db *pgxpool.Pool, store storage.ObjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		uploadService := services.NewUploadService(db, store, "")
+		if r.URL.Query().Get("refresh") == "true" {
+			if err := uploadService.Reconcile(context.Background()); err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+
+		report, err := uploadService.StorageReport(context.Background())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// GetScanResultsHandler lists recent malware scan results, newest first.
+// Query params: verdict (optional: clean, infected or error), limit (optional, default 100, max 500)
+func GetScanResultsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		verdict := r.URL.Query().Get("verdict")
+		switch verdict {
+		case "", scanner.VerdictClean, scanner.VerdictInfected, scanner.VerdictError:
+		default:
+			http.Error(w, "invalid verdict", http.StatusBadRequest)
+			return
+		}
+
+		limit := 100
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(parsed, 500)
+		}
+
+		results, err := services.NewScanService(db).GetScanResults(context.Background(), verdict, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// RetryUploadsHandler queues failed uploads again.
+// Query param: id (optional, retries every failed upload when omitted)
+func RetryUploadsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var jobID int64
+		if idStr := r.URL.Query().Get("id"); idStr != "" {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid id", http.StatusBadRequest)
+				return
+			}
+			jobID = id
+		}
+
+		queued, err := services.NewUploadService(db, nil, "").RetryFailedUploads(context.Background(), jobID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if jobID != 0 && queued == 0 {
+			http.Error(w, "failed upload not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"queued": queued})
+	}
+}
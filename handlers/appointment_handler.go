@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// defaultAppointmentDays is the period appointment lists and slot searches
+// cover when no to param is given.
+const defaultAppointmentDays = 14
+
+type updateAvailabilityRequest struct {
+	Timezone string                      `json:"timezone"`
+	Windows  []models.AvailabilityWindow `json:"windows"`
+}
+
+type linkAppointmentPrescriptionRequest struct {
+	PresID int64 `json:"presId"`
+}
+
+// appointmentError writes the response for an error from AppointmentService.
+func appointmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "appointment not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidAvailability):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrSlotUnavailable),
+		errors.Is(err, services.ErrAppointmentConflict),
+		errors.Is(err, services.ErrAppointmentState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// appointmentID parses the ID from the id query param. On failure it writes
+// the error response and returns false.
+func appointmentID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, name+" ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid "+name+" ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetDoctorAvailabilityHandler returns a doctor's weekly availability template
+// and upcoming exceptions. Doctors may omit docId to read their own.
+// Query param: docId
+func GetDoctorAvailabilityHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		docID := claims.ID
+		if v := r.URL.Query().Get("docId"); v != "" {
+			var err error
+			if docID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				http.Error(w, "Invalid Doctor ID", http.StatusBadRequest)
+				return
+			}
+		} else if claims.Role != "doctor" {
+			http.Error(w, "Doctor ID is required", http.StatusBadRequest)
+			return
+		}
+
+		availability, err := services.NewAppointmentService(db).GetAvailability(context.Background(), docID, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(availability)
+	}
+}
+
+// UpdateDoctorAvailabilityHandler replaces the authenticated doctor's weekly
+// availability template. Times are wall-clock times in the given IANA time zone.
+// Body: {"timezone": "Asia/Kolkata", "windows": [{"weekday": 1, "start": "09:00", "end": "13:00", "slotMinutes": 15}]}
+func UpdateDoctorAvailabilityHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		var req updateAvailabilityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Timezone = strings.TrimSpace(req.Timezone)
+		if err := services.ValidateAvailability(req.Timezone, req.Windows); err != nil {
+			appointmentError(w, err)
+			return
+		}
+
+		availability, err := services.NewAppointmentService(db).SetAvailability(context.Background(), claims.ID, req.Timezone, req.Windows)
+		if err != nil {
+			appointmentError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(availability)
+	}
+}
+
+// CreateAvailabilityExceptionHandler lets a doctor block a period of their
+// weekly hours, or add extra hours with "available": true.
+// Body: {"startsAt": "2026-12-24T00:00:00+05:30", "endsAt": "2026-12-27T00:00:00+05:30", "available": false, "reason": "Holidays"}
+func CreateAvailabilityExceptionHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		var exception models.AvailabilityException
+		if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		exception.DocID = claims.ID
+		exception.Reason = strings.TrimSpace(exception.Reason)
+		if err := services.ValidateAvailabilityException(&exception); err != nil {
+			appointmentError(w, err)
+			return
+		}
+
+		if err := services.NewAppointmentService(db).CreateException(context.Background(), &exception); err != nil {
+			appointmentError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(exception)
+	}
+}
+
+// DeleteAvailabilityExceptionHandler removes one of the authenticated doctor's
+// availability exceptions.
+// Query param: id (exception ID)
+func DeleteAvailabilityExceptionHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		id, ok := appointmentID(w, r, "Exception")
+		if !ok {
+			return
+		}
+
+		exception, err := services.NewAppointmentService(db).DeleteException(context.Background(), id, claims.ID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "exception not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exception)
+	}
+}
+
+// GetSlotsHandler lists open appointment slots of one doctor, or of every
+// doctor with a speciality, between from and to (RFC 3339; now and two weeks
+// later by default, at most 31 days apart).
+// Query params: docId or speciality, optional from, to
+func GetSlotsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, ok := requireRole(w, r, "user", "doctor"); !ok {
+			return
+		}
+
+		var docID int64
+		if v := r.URL.Query().Get("docId"); v != "" {
+			var err error
+			if docID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				http.Error(w, "Invalid Doctor ID", http.StatusBadRequest)
+				return
+			}
+		}
+		speciality := strings.TrimSpace(r.URL.Query().Get("speciality"))
+		if docID == 0 && speciality == "" {
+			http.Error(w, "docId or speciality is required", http.StatusBadRequest)
+			return
+		}
+
+		from, to, ok := parseTimeRange(w, r)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		if from.IsZero() {
+			from = now
+		}
+		if to.IsZero() {
+			to = from.AddDate(0, 0, defaultAppointmentDays)
+		}
+		if !to.After(from) || to.Sub(from) > services.MaxSlotSearchDays*24*time.Hour {
+			http.Error(w, "to must be after from and at most 31 days later", http.StatusBadRequest)
+			return
+		}
+
+		slots, err := services.NewAppointmentService(db).FindSlots(context.Background(), docID, speciality, from, to, now)
+		if err != nil {
+			if errors.Is(err, services.ErrUnknownSpeciality) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(slots)
+	}
+}
+
+// BookAppointmentHandler books one of a doctor's open slots for the
+// authenticated patient.
+// Body: {"docId": 7, "startsAt": "2026-11-02T09:15:00+05:30", "reason": "optional"}
+func BookAppointmentHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		var req models.AppointmentBookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.DocID == 0 || req.StartsAt.IsZero() {
+			http.Error(w, "docId and startsAt are required", http.StatusBadRequest)
+			return
+		}
+
+		appointment, err := services.NewAppointmentService(db).Book(context.Background(), claims.ID, &req, time.Now())
+		if err != nil {
+			appointmentError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(appointment)
+	}
+}
+
+// GetAppointmentsHandler lists the authenticated patient's or doctor's
+// appointments starting between from and to (RFC 3339; now and two weeks
+// later by default).
+// Query params: optional from, to, status (booked, cancelled)
+func GetAppointmentsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		from, to, ok := parseTimeRange(w, r)
+		if !ok {
+			return
+		}
+		if from.IsZero() {
+			from = time.Now()
+		}
+		if to.IsZero() {
+			to = from.AddDate(0, 0, defaultAppointmentDays)
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != models.AppointmentStatusBooked && status != models.AppointmentStatusCancelled {
+			http.Error(w, "status must be booked or cancelled", http.StatusBadRequest)
+			return
+		}
+
+		appointments, err := services.NewAppointmentService(db).GetAppointments(context.Background(), claims.Role, claims.ID, from, to, status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(appointments)
+	}
+}
+
+// CancelAppointmentHandler lets the patient or doctor of a booked appointment
+// cancel it before it starts.
+// Query param: id (appointment ID)
+func CancelAppointmentHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		id, ok := appointmentID(w, r, "Appointment")
+		if !ok {
+			return
+		}
+
+		appointment, err := services.NewAppointmentService(db).Cancel(context.Background(), id, claims.Role, claims.ID, time.Now())
+		if err != nil {
+			appointmentError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(appointment)
+	}
+}
+
+// LinkAppointmentPrescriptionHandler links a booked appointment to the
+// prescription written during it, for its patient or doctor.
+// Query param: id (appointment ID)
+// Body: {"presId": 12}
+func LinkAppointmentPrescriptionHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		id, ok := appointmentID(w, r, "Appointment")
+		if !ok {
+			return
+		}
+
+		var req linkAppointmentPrescriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.PresID == 0 {
+			http.Error(w, "presId is required", http.StatusBadRequest)
+			return
+		}
+
+		appointment, err := services.NewAppointmentService(db).LinkPrescription(context.Background(), id, claims.Role, claims.ID, req.PresID)
+		if err != nil {
+			appointmentError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(appointment)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetPrescriptionAttachmentsHandler lists the files uploaded with a prescription
+// to its patient, assigned doctor or a referred doctor.
+// Query param: presId
+func GetPrescriptionAttachmentsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		presIDStr := r.URL.Query().Get("presId")
+		if presIDStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(presIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		attachments, err := services.NewAttachmentService(db).GetPrescriptionAttachments(context.Background(), presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(attachments)
+	}
+}
+
+// fileURLResponse is a short-lived link to a prescription file. ExpiresAt is
+// omitted for links recorded before files were kept private.
+type fileURLResponse struct {
+	URL         string     `json:"url"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	FileName    string     `json:"fileName,omitempty"`
+	ContentType string     `json:"contentType,omitempty"`
+}
+
+// GetPrescriptionFileHandler gives the patient, assigned or referred doctor access to a
+// prescription's uploaded file: a signed URL valid for expiry, or the file itself
+// when download=true.
+// Query params: presId, attachmentId (optional, defaults to the first file),
+// thumbnail (optional, needs attachmentId), download (optional)
+func GetPrescriptionFileHandler(db *pgxpool.Pool, store storage.ObjectStore, expiry time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		presID, err := strconv.ParseInt(r.URL.Query().Get("presId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		prescription, ok := authorizePrescriptionView(ctx, w, db, claims, presID)
+		if !ok {
+			return
+		}
+
+		file := fileURLResponse{}
+		key := prescription.ObjectKey
+		if attachmentIDStr := r.URL.Query().Get("attachmentId"); attachmentIDStr != "" {
+			attachmentID, err := strconv.ParseInt(attachmentIDStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+				return
+			}
+			attachment, err := services.NewAttachmentService(db).GetAttachment(ctx, attachmentID)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if attachment == nil || attachment.PresID != presID || attachment.MessageID != nil {
+				http.Error(w, "attachment not found", http.StatusNotFound)
+				return
+			}
+			if attachment.Status == models.AttachmentStatusQuarantined {
+				http.Error(w, "file is quarantined", http.StatusForbidden)
+				return
+			}
+			key, file.FileName, file.ContentType = attachment.ObjectKey, attachment.FileName, attachment.ContentType
+
+			if r.URL.Query().Get("thumbnail") == "true" {
+				if attachment.ThumbnailKey == "" {
+					http.Error(w, "thumbnail not available", http.StatusNotFound)
+					return
+				}
+				key, file.ContentType = attachment.ThumbnailKey, "image/jpeg"
+				file.FileName = strings.TrimSuffix(file.FileName, path.Ext(file.FileName)) + "_thumb.jpg"
+			}
+		} else if r.URL.Query().Get("thumbnail") == "true" {
+			http.Error(w, "attachmentId is required for thumbnails", http.StatusBadRequest)
+			return
+		}
+
+		if key == "" {
+			if prescription.Link != "" && file.FileName == "" {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(fileURLResponse{URL: prescription.Link})
+				return
+			}
+			http.Error(w, "file not uploaded yet", http.StatusNotFound)
+			return
+		}
+
+		serveStoredFile(ctx, w, r, store, expiry, key, file, presID)
+	}
+}
+
+// serveStoredFile answers a file request: the file itself when download=true,
+// otherwise a signed URL valid for expiry. presID is only used for logging.
+func serveStoredFile(ctx context.Context, w http.ResponseWriter, r *http.Request, store storage.ObjectStore, expiry time.Duration, key string, file fileURLResponse, presID int64) {
+	if r.URL.Query().Get("download") == "true" {
+		body, info, err := store.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, "file not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer body.Close()
+
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = info.ContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": path.Base(firstNonEmpty(file.FileName, key))}))
+		if info.Size > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			log.Printf("failed to stream file for prescription %d: %v", presID, err)
+		}
+		return
+	}
+
+	var err error
+	file.URL, err = store.SignedURL(ctx, key, expiry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	expiresAt := time.Now().Add(expiry).UTC()
+	file.ExpiresAt = &expiresAt
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	json.NewEncoder(w).Encode(file)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -6,12 +6,12 @@ import (
 	"net/http"
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// AuthCheckHandler validates token and returns user/doctor info
+// AuthCheckHandler validates token and returns user/doctor/pharmacy info
 // Frontend uses this to determine if token is valid and redirect accordingly
-func AuthCheckHandler(db *pgx.Conn) http.HandlerFunc {
+func AuthCheckHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -31,7 +31,7 @@ func AuthCheckHandler(db *pgx.Conn) http.HandlerFunc {
 			return
 		}
 
-		// Token is valid - fetch user/doctor details
+		// Token is valid - fetch user/doctor/pharmacy details
 		if claims.Role == "user" {
 			userService := services.NewUserService(db)
 			user, err := userService.GetUser(context.Background(), claims.ID)
@@ -83,6 +83,32 @@ func AuthCheckHandler(db *pgx.Conn) http.HandlerFunc {
 				"phnNumber":     doctor.PhnNumber,
 				"createdAt":     doctor.CreatedAt,
 			})
+		} else if claims.Role == "pharmacy" {
+			pharmacyService := services.NewPharmacyService(db)
+			pharmacy, err := pharmacyService.GetPharmacy(context.Background(), claims.ID)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"authenticated": false,
+					"message":       "Pharmacy not found",
+				})
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"authenticated": true,
+				"role":          "pharmacy",
+				"id":            pharmacy.ID,
+				"name":          pharmacy.Name,
+				"email":         pharmacy.Email,
+				"licenseNumber": pharmacy.LicenseNumber,
+				"address":       pharmacy.Address,
+				"phnNumber":     pharmacy.PhnNumber,
+				"createdAt":     pharmacy.CreatedAt,
+			})
 		} else {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"errors"
 	"net/http"
 	"strings"
@@ -56,3 +57,19 @@ func ExtractTokenInfo(r *http.Request) (*utils.Claims, error) {
 
 	return utils.VerifyToken(parts[1])
 }
+
+// AdminMiddleware wraps an http handler and checks the X-Admin-Key header against
+// apiKey. Admin routes are disabled when no key is configured.
+func AdminMiddleware(apiKey string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey == "" {
+			http.Error(w, "Admin API is disabled", http.StatusNotFound)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(apiKey)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
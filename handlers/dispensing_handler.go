@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type sharePrescriptionRequest struct {
+	PharmacyID int64 `json:"pharmacyId"`
+}
+
+// sharePrescriptionParams parses the prescription ID and the pharmacyId body
+// shared by the share and revoke handlers. On failure it writes the error response.
+func sharePrescriptionParams(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	presID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var req sharePrescriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PharmacyID == 0 {
+		http.Error(w, "pharmacyId is required", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return presID, req.PharmacyID, true
+}
+
+// SharePrescriptionHandler lets a patient share a finalized prescription with a pharmacy.
+// Query param: id
+// Body: {"pharmacyId": 3}
+func SharePrescriptionHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		presID, pharmacyID, ok := sharePrescriptionParams(w, r)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		prescription, ok := authorizePrescription(ctx, w, db, claims, presID)
+		if !ok {
+			return
+		}
+
+		share, err := services.NewDispensingService(db).SharePrescription(ctx, prescription, pharmacyID)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				http.Error(w, "pharmacy not found", http.StatusNotFound)
+			case errors.Is(err, services.ErrNotShareable):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(share)
+	}
+}
+
+// RevokePrescriptionShareHandler lets a patient withdraw a pharmacy's access to a prescription.
+// Query param: id
+// Body: {"pharmacyId": 3}
+func RevokePrescriptionShareHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		presID, pharmacyID, ok := sharePrescriptionParams(w, r)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		if _, ok := authorizePrescription(ctx, w, db, claims, presID); !ok {
+			return
+		}
+
+		share, err := services.NewDispensingService(db).RevokeShare(ctx, presID, pharmacyID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "prescription is not shared with this pharmacy", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(share)
+	}
+}
+
+// GetPrescriptionSharesHandler lists the pharmacies a prescription was shared with (patient).
+// Query param: id
+func GetPrescriptionSharesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		if _, ok := authorizePrescription(ctx, w, db, claims, presID); !ok {
+			return
+		}
+
+		shares, err := services.NewDispensingService(db).GetPrescriptionShares(ctx, presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(shares)
+	}
+}
+
+// GetPrescriptionDispensingHandler reports what has been dispensed of each
+// approved medicine (patient, assigned or referred doctor, or a pharmacy it is shared with).
+// Query param: id
+func GetPrescriptionDispensingHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor", "pharmacy")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		if _, ok := authorizePrescriptionView(ctx, w, db, claims, presID); !ok {
+			return
+		}
+
+		dispensing, err := services.NewDispensingService(db).GetDispensing(ctx, presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dispensing)
+	}
+}
@@ -3,17 +3,19 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // CreateDoctorHandler creates a new doctor
-func CreateDoctorHandler(db *pgx.Conn) http.HandlerFunc {
+func CreateDoctorHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -28,6 +30,10 @@ func CreateDoctorHandler(db *pgx.Conn) http.HandlerFunc {
 
 		doctor, err := services.NewDoctorService(db).CreateDoctorWithRequest(context.Background(), &req)
 		if err != nil {
+			if errors.Is(err, services.ErrUnknownSpeciality) {
+				http.Error(w, err.Error()+"; see /api/specialities", http.StatusBadRequest)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -39,7 +45,7 @@ func CreateDoctorHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // LoginDoctorHandler authenticates a doctor and returns login response
-func LoginDoctorHandler(db *pgx.Conn) http.HandlerFunc {
+func LoginDoctorHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -83,7 +89,7 @@ func LoginDoctorHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // GetDoctorsHandler returns all doctors
-func GetDoctorsHandler(db *pgx.Conn) http.HandlerFunc {
+func GetDoctorsHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -102,8 +108,106 @@ func GetDoctorsHandler(db *pgx.Conn) http.HandlerFunc {
 	}
 }
 
+// SearchDoctorsHandler searches doctors by name, speciality, accuracy and
+// availability, one page at a time.
+// Query params: optional q (name or username, fuzzy), speciality (code or name),
+// minAccuracy, available=true with optional from and to (RFC 3339; the next
+// 7 days by default), page (from 1), pageSize (default 20, max 100)
+func SearchDoctorsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		params := r.URL.Query()
+		query := models.DoctorSearchQuery{
+			Query:      params.Get("q"),
+			Speciality: params.Get("speciality"),
+			Page:       1,
+			PageSize:   services.DefaultDoctorPageSize,
+		}
+
+		var err error
+		if v := params.Get("minAccuracy"); v != "" {
+			if query.MinAccuracy, err = strconv.ParseFloat(v, 64); err != nil {
+				http.Error(w, "minAccuracy must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := params.Get("available"); v != "" {
+			if query.Available, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, "available must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := params.Get("page"); v != "" {
+			if query.Page, err = strconv.Atoi(v); err != nil || query.Page < 1 {
+				http.Error(w, "page must be a positive number", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := params.Get("pageSize"); v != "" {
+			if query.PageSize, err = strconv.Atoi(v); err != nil || query.PageSize < 1 {
+				http.Error(w, "pageSize must be a positive number", http.StatusBadRequest)
+				return
+			}
+			query.PageSize = min(query.PageSize, services.MaxDoctorPageSize)
+		}
+
+		from, to, ok := parseTimeRange(w, r)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		if from.IsZero() {
+			from = now
+		}
+		if to.IsZero() {
+			to = from.AddDate(0, 0, services.DefaultAvailabilityDays)
+		}
+		if query.Available && (!to.After(from) || to.Sub(from) > services.MaxSlotSearchDays*24*time.Hour) {
+			http.Error(w, "to must be after from and at most 31 days later", http.StatusBadRequest)
+			return
+		}
+		query.AvailableFrom, query.AvailableTo = from, to
+
+		result, err := services.NewDoctorService(db).SearchDoctors(context.Background(), &query, now)
+		if err != nil {
+			if errors.Is(err, services.ErrUnknownSpeciality) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// GetSpecialitiesHandler returns the speciality vocabulary doctors register with
+func GetSpecialitiesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		specialities, err := services.NewSpecialityService(db).GetSpecialities(context.Background())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(specialities)
+	}
+}
+
 // GetDoctorHandler returns a specific doctor
-func GetDoctorHandler(db *pgx.Conn) http.HandlerFunc {
+func GetDoctorHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
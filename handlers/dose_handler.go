@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetPrescriptionDosesHandler returns the dose schedule of a prescription to its
+// patient, assigned doctor or a referred doctor.
+// Query params: presId, optional from/to (RFC 3339)
+func GetPrescriptionDosesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		presIDStr := r.URL.Query().Get("presId")
+		if presIDStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(presIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		var from, to time.Time
+		if v := r.URL.Query().Get("from"); v != "" {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := r.URL.Query().Get("to"); v != "" {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if _, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		doses, err := services.NewDoseService(db).GetPrescriptionDoses(context.Background(), presID, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doses)
+	}
+}
+
+// LogDoseHandler lets a patient mark one of their doses as taken or skipped.
+// Query param: id
+// Body: {"status": "taken", "note": "..."}
+func LogDoseHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Dose ID is required", http.StatusBadRequest)
+			return
+		}
+
+		doseID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Dose ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.DoseLogRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		doseService := services.NewDoseService(db)
+		dose, err := doseService.GetDose(context.Background(), doseID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "dose not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if dose.UserID != claims.ID {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if req.Status != models.DoseStatusTaken && req.Status != models.DoseStatusSkipped {
+			http.Error(w, "status must be taken or skipped", http.StatusBadRequest)
+			return
+		}
+
+		updatedDose, err := doseService.LogDose(context.Background(), doseID, req.Status, req.Note, time.Now())
+		if err != nil {
+			if errors.Is(err, services.ErrDoseNotLoggable) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updatedDose)
+	}
+}
+
+// GetPrescriptionAdherenceHandler returns adherence percentages for a prescription
+// to its patient, assigned doctor or a referred doctor.
+// Query param: presId
+func GetPrescriptionAdherenceHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		presIDStr := r.URL.Query().Get("presId")
+		if presIDStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(presIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		adherence, err := services.NewDoseService(db).GetPrescriptionAdherence(context.Background(), presID, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(adherence)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// parseLimit reads the "limit" query param, falling back to def and capping at 50.
+func parseLimit(r *http.Request, def int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return def
+	}
+	return min(limit, 50)
+}
+
+// SearchDrugsHandler fuzzy-matches a medicine name against the drug catalog.
+// Query params: q, optional limit
+func SearchDrugsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, ok := requireRole(w, r, "doctor"); !ok {
+			return
+		}
+
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			http.Error(w, "Search query is required", http.StatusBadRequest)
+			return
+		}
+
+		matches, err := services.NewDrugCatalogService(db).SearchDrugs(context.Background(), query, parseLimit(r, 10), 0.3)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(matches)
+	}
+}
+
+// AutocompleteDrugsHandler suggests generic and brand names starting with a prefix.
+// Query params: q, optional limit
+func AutocompleteDrugsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, ok := requireRole(w, r, "doctor"); !ok {
+			return
+		}
+
+		suggestions, err := services.NewDrugCatalogService(db).Autocomplete(context.Background(), r.URL.Query().Get("q"), parseLimit(r, 10))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(suggestions)
+	}
+}
+
+// GetDrugHandler returns a specific catalog entry
+func GetDrugHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Drug ID is required", http.StatusBadRequest)
+			return
+		}
+
+		drugID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Drug ID", http.StatusBadRequest)
+			return
+		}
+
+		drug, err := services.NewDrugCatalogService(db).GetDrug(context.Background(), drugID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "drug not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(drug)
+	}
+}
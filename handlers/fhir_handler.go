@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/fhir"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fhirBasePath is where the FHIR endpoints are mounted; resource references
+// in bundles are relative to it.
+const fhirBasePath = "/api/fhir"
+
+// maxFHIRBundleSize caps the size of an imported bundle.
+const maxFHIRBundleSize = 5 << 20
+
+func writeFHIR(w http.ResponseWriter, status int, resource interface{}) {
+	w.Header().Set("Content-Type", fhir.ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// fhirError answers with an OperationOutcome, which FHIR clients expect instead of plain text.
+func fhirError(w http.ResponseWriter, status int, code, diagnostics string) {
+	writeFHIR(w, status, fhir.NewOperationOutcome(code, diagnostics))
+}
+
+// fhirResourceID parses the {id} path segment of a FHIR read.
+func fhirResourceID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		fhirError(w, http.StatusBadRequest, fhir.IssueInvalid, "invalid resource id")
+		return 0, false
+	}
+	return id, true
+}
+
+// fhirPatientParam parses the patient search parameter, accepting "12" and "Patient/12".
+func fhirPatientParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	value := r.URL.Query().Get("patient")
+	if value == "" {
+		fhirError(w, http.StatusBadRequest, fhir.IssueRequired, "the patient search parameter is required")
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(strings.TrimPrefix(value, "Patient/"), 10, 64)
+	if err != nil {
+		fhirError(w, http.StatusBadRequest, fhir.IssueInvalid, "invalid patient search parameter")
+		return 0, false
+	}
+	return userID, true
+}
+
+func fhirLoadError(w http.ResponseWriter, err error, resource string) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		fhirError(w, http.StatusNotFound, fhir.IssueNotFound, resource+" not found")
+		return
+	}
+	fhirError(w, http.StatusInternalServerError, fhir.IssueException, err.Error())
+}
+
+// GetFHIRPatientHandler returns a patient as a FHIR Patient (the patient or a doctor treating them).
+// Path: /api/fhir/Patient/{id}
+func GetFHIRPatientHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := fhirResourceID(w, r)
+		if !ok {
+			return
+		}
+
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		patient, err := services.NewFHIRService(db).Patient(context.Background(), userID)
+		if err != nil {
+			fhirLoadError(w, err, "Patient")
+			return
+		}
+		writeFHIR(w, http.StatusOK, patient)
+	}
+}
+
+// GetFHIRPractitionerHandler returns a doctor as a FHIR Practitioner.
+// Path: /api/fhir/Practitioner/{id}
+func GetFHIRPractitionerHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, ok := requireRole(w, r, "user", "doctor"); !ok {
+			return
+		}
+
+		docID, ok := fhirResourceID(w, r)
+		if !ok {
+			return
+		}
+
+		practitioner, err := services.NewFHIRService(db).Practitioner(context.Background(), docID)
+		if err != nil {
+			fhirLoadError(w, err, "Practitioner")
+			return
+		}
+		writeFHIR(w, http.StatusOK, practitioner)
+	}
+}
+
+// GetFHIRItemRequestHandler returns a medicine item as a MedicationRequest or
+// a test item as a ServiceRequest, depending on resourceType (patient or
+// assigned or referred doctor).
+// Path: /api/fhir/MedicationRequest/{id} or /api/fhir/ServiceRequest/{id}
+func GetFHIRItemRequestHandler(db *pgxpool.Pool, resourceType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		itemID, ok := fhirResourceID(w, r)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		item, err := services.NewItemsService(db).GetItem(ctx, itemID)
+		if err != nil {
+			fhirLoadError(w, err, resourceType)
+			return
+		}
+		if (item.Type == "med") != (resourceType == "MedicationRequest") {
+			fhirError(w, http.StatusNotFound, fhir.IssueNotFound, resourceType+" not found")
+			return
+		}
+
+		prescription, ok := authorizePrescriptionView(ctx, w, db, claims, item.PresID)
+		if !ok {
+			return
+		}
+
+		resource, err := services.NewFHIRService(db).ItemRequest(ctx, prescription, item)
+		if err != nil {
+			fhirLoadError(w, err, resourceType)
+			return
+		}
+		writeFHIR(w, http.StatusOK, resource)
+	}
+}
+
+// SearchFHIRItemRequestsHandler returns a patient's medicine or test items as a
+// searchset Bundle (the patient or a doctor treating them).
+// Path: /api/fhir/MedicationRequest or /api/fhir/ServiceRequest
+// Query param: patient
+func SearchFHIRItemRequestsHandler(db *pgxpool.Pool, resourceType, publicBaseURL string) http.HandlerFunc {
+	itemType := "test"
+	if resourceType == "MedicationRequest" {
+		itemType = "med"
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := fhirPatientParam(w, r)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		if !authorizePatient(ctx, w, db, claims, userID) {
+			return
+		}
+
+		resources, err := services.NewFHIRService(db).PatientRequests(ctx, userID, itemType)
+		if err != nil {
+			fhirLoadError(w, err, resourceType)
+			return
+		}
+		bundle, err := fhir.NewSearchBundle(publicBaseURL+fhirBasePath, resources...)
+		if err != nil {
+			fhirLoadError(w, err, resourceType)
+			return
+		}
+		writeFHIR(w, http.StatusOK, bundle)
+	}
+}
+
+// GetFHIRDocumentReferenceHandler returns the uploaded files of a prescription
+// as a DocumentReference (patient, assigned or referred doctor). The resource id is the
+// prescription ID.
+// Path: /api/fhir/DocumentReference/{id}
+func GetFHIRDocumentReferenceHandler(db *pgxpool.Pool, publicBaseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		presID, ok := fhirResourceID(w, r)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		prescription, ok := authorizePrescriptionView(ctx, w, db, claims, presID)
+		if !ok {
+			return
+		}
+
+		document, err := services.NewFHIRService(db).DocumentReference(ctx, prescription, publicBaseURL)
+		if err != nil {
+			fhirLoadError(w, err, "DocumentReference")
+			return
+		}
+		writeFHIR(w, http.StatusOK, document)
+	}
+}
+
+// SearchFHIRDocumentReferencesHandler returns a DocumentReference for each
+// prescription of a patient as a searchset Bundle.
+// Path: /api/fhir/DocumentReference
+// Query param: patient
+func SearchFHIRDocumentReferencesHandler(db *pgxpool.Pool, publicBaseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := fhirPatientParam(w, r)
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		if !authorizePatient(ctx, w, db, claims, userID) {
+			return
+		}
+
+		resources, err := services.NewFHIRService(db).PatientDocuments(ctx, userID, publicBaseURL)
+		if err != nil {
+			fhirLoadError(w, err, "DocumentReference")
+			return
+		}
+		bundle, err := fhir.NewSearchBundle(publicBaseURL+fhirBasePath, resources...)
+		if err != nil {
+			fhirLoadError(w, err, "DocumentReference")
+			return
+		}
+		writeFHIR(w, http.StatusOK, bundle)
+	}
+}
+
+// ImportFHIRBundleHandler creates patients and prescriptions from a FHIR
+// transaction or collection Bundle (admin). Invalid bundles are rejected as a
+// whole with an OperationOutcome listing every problem.
+// Path: /api/fhir
+func ImportFHIRBundleHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var bundle fhir.Bundle
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFHIRBundleSize)).Decode(&bundle); err != nil {
+			fhirError(w, http.StatusBadRequest, fhir.IssueInvalid, "request body is not a valid FHIR Bundle: "+err.Error())
+			return
+		}
+
+		ctx := context.Background()
+		imported, err := services.NewFHIRService(db).ImportBundle(ctx, &bundle)
+		if err != nil {
+			var outcome *fhir.OperationOutcome
+			if errors.As(err, &outcome) {
+				writeFHIR(w, http.StatusUnprocessableEntity, outcome)
+				return
+			}
+			fhirError(w, http.StatusInternalServerError, fhir.IssueException, err.Error())
+			return
+		}
+
+		// Approved medicines get their dose schedules, as when a doctor approves
+		// items. Courses begin when they were ordered, so only the remaining
+		// doses are scheduled.
+		now := time.Now()
+		for _, item := range imported.Items {
+			if item.Type != "med" || !item.Approved {
+				continue
+			}
+			start, ok := imported.CourseStarts[item.ID]
+			if !ok {
+				start = now
+			}
+			if _, err := rescheduleItem(ctx, db, item, start, now); err != nil {
+				log.Printf("failed to schedule doses for imported item %d: %v", item.ID, err)
+			}
+		}
+		writeFHIR(w, http.StatusOK, imported.Response)
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/signing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type finalizePrescriptionRequest struct {
+	Note string `json:"note"`
+	// ValidityDays overrides the default validity period of the prescription.
+	ValidityDays int `json:"validityDays"`
+}
+
+type amendPrescriptionRequest struct {
+	Reason  string                 `json:"reason"`
+	Changes []models.ItemAmendment `json:"changes"`
+}
+
+type amendPrescriptionResponse struct {
+	Amendment *models.PrescriptionAmendment `json:"amendment"`
+	Items     []*models.Items               `json:"items"`
+}
+
+// FinalizePrescriptionHandler lets the assigned doctor finalize a reviewed
+// prescription. Its content is hashed and signed, and it can no longer be
+// edited except through an amendment. It stays valid for validityDays, or the
+// default period for its items.
+// Query param: id
+// Body: {"note": "optional", "validityDays": 60}
+func FinalizePrescriptionHandler(db *pgxpool.Pool, signer *signing.Signer, validity config.Validity) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		// The body is optional.
+		var req finalizePrescriptionRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.ValidityDays < 0 || req.ValidityDays > config.MaxValidityDays {
+			http.Error(w, fmt.Sprintf("validityDays must be between 0 and %d (0 uses the default)", config.MaxValidityDays), http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := authorizePrescription(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		finalized, err := services.NewFinalizationService(db, signer).Finalize(context.Background(), presID, claims.ID, strings.TrimSpace(req.Note), req.ValidityDays, validity)
+		if err != nil {
+			switch {
+			case errors.Is(err, signing.ErrNotConfigured):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			case errors.Is(err, services.ErrInvalidStatusTransition):
+				http.Error(w, "only reviewed prescriptions can be finalized", http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(finalized)
+	}
+}
+
+// VerifyPrescriptionHandler checks that a finalized prescription has not been
+// altered since it was signed (patient, assigned or referred doctor, or a pharmacy it
+// is shared with).
+// Query param: id
+func VerifyPrescriptionHandler(db *pgxpool.Pool, signer *signing.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor", "pharmacy")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		result, err := services.NewFinalizationService(db, signer).Verify(context.Background(), presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// AmendPrescriptionHandler lets the assigned doctor change the items of a
+// finalized prescription. The prescription is re-signed and the amendment is
+// recorded with its reason.
+// Query param: id
+// Body: {"reason": "...", "changes": [{"itemId": 1, "docReason": "...", "dosage": {...}, "refills": {...}, "withdraw": false}]}
+func AmendPrescriptionHandler(db *pgxpool.Pool, signer *signing.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		var req amendPrescriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Changes) == 0 {
+			http.Error(w, "changes are required", http.StatusBadRequest)
+			return
+		}
+		for i := range req.Changes {
+			change := &req.Changes[i]
+			if change.DocReason == nil && change.Dosage == nil && change.Refills == nil && !change.Withdraw {
+				http.Error(w, "each change needs docReason, dosage, refills or withdraw", http.StatusBadRequest)
+				return
+			}
+			if change.DocReason != nil {
+				docReason := strings.TrimSpace(*change.DocReason)
+				change.DocReason = &docReason
+			}
+			if change.Dosage != nil {
+				if err := services.NormalizeDosage(change.Dosage); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if change.Refills != nil {
+				if err := services.ValidateRefillPolicy(*change.Refills); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		prescription, ok := authorizePrescription(context.Background(), w, db, claims, presID)
+		if !ok {
+			return
+		}
+
+		amendment, items, err := services.NewFinalizationService(db, signer).Amend(context.Background(), presID, claims.ID, req.Reason, req.Changes)
+		if err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				http.Error(w, "item not found on this prescription", http.StatusNotFound)
+			case errors.Is(err, services.ErrInvalidDosage):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, services.ErrNotFinalized), errors.Is(err, services.ErrNotAmendable), errors.Is(err, services.ErrNotRefillable):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, signing.ErrNotConfigured):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Keep the patient's dose schedule in step with the amended medicines.
+		doseService := services.NewDoseService(db)
+		for _, item := range items {
+			if item.Type != "med" {
+				continue
+			}
+			if item.Approved {
+				_, err = resumeCourse(context.Background(), db, item, time.Now())
+			} else {
+				err = doseService.ClearPendingDoses(context.Background(), item.ID, time.Now())
+			}
+			if err != nil {
+				log.Printf("failed to update doses of item %d after amendment: %v", item.ID, err)
+			}
+		}
+		if err := services.NewInteractionService(db).RecheckPatientPrescriptions(context.Background(), prescription.UserID, 0); err != nil {
+			log.Printf("interaction recheck failed for user %d: %v", prescription.UserID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(amendPrescriptionResponse{Amendment: amendment, Items: items})
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// profileUserID resolves whose health profile a request is about: patients always
+// get their own, doctors must pass userId.
+func profileUserID(w http.ResponseWriter, r *http.Request, claims *utils.Claims) (int64, bool) {
+	if claims.Role == "user" {
+		return claims.ID, true
+	}
+
+	userIDStr := r.URL.Query().Get("userId")
+	if userIDStr == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid User ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
+
+// GetHealthProfileHandler returns a patient's health profile to the patient or
+// to a doctor treating them.
+// Query param: userId (doctors only)
+func GetHealthProfileHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		profile, err := services.NewHealthProfileService(db).GetProfile(context.Background(), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	}
+}
+
+// UpdateHealthProfileHandler replaces a patient's health profile. Patients edit
+// their own; doctors treating the patient pass userId. Prescriptions are
+// re-checked afterwards because allergies and current medications may have changed.
+// Body: {"dateOfBirth":"1990-04-12","weightKg":62.5,"pregnancyStatus":"not_pregnant",
+//
+//	"allergies":[{"substance":"Penicillin","reaction":"rash","severity":"moderate"}],
+//	"conditions":[{"name":"Type 2 diabetes"}],"currentMedications":[{"name":"Metformin","dose":"500 mg","frequency":"BID"}]}
+func UpdateHealthProfileHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		profile := services.DefaultHealthProfile(userID)
+		if err := json.NewDecoder(r.Body).Decode(profile); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		profile.UserID = userID
+
+		if err := services.ValidateHealthProfile(profile); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := services.NewHealthProfileService(db).SaveProfile(context.Background(), profile); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := services.NewInteractionService(db).RecheckPatientPrescriptions(context.Background(), userID, 0); err != nil {
+			log.Printf("warning recheck failed for user %d: %v", userID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type updateItemNoteRequest struct {
+	Note string `json:"note"`
+}
+
+// UpdateItemNoteHandler sets the authenticated doctor's own note on an item.
+// The assigned doctor and every referred doctor keep separate notes.
+// Query param: id (item ID)
+// Body: {"note": "..."}
+func UpdateItemNoteHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Item ID is required", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Item ID", http.StatusBadRequest)
+			return
+		}
+
+		var req updateItemNoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		item, err := services.NewItemsService(db).GetItem(ctx, itemID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "item not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, ok := authorizePrescriptionView(ctx, w, db, claims, item.PresID); !ok {
+			return
+		}
+
+		note, err := services.NewItemNoteService(db).SetNote(ctx, item, claims.ID, strings.TrimSpace(req.Note))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(note)
+	}
+}
+
+// GetPrescriptionItemNotesHandler lists the doctors' notes on the items of a
+// prescription (assigned or referred doctor).
+// Query param: id (prescription ID)
+func GetPrescriptionItemNotesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		if _, ok := authorizePrescriptionView(ctx, w, db, claims, presID); !ok {
+			return
+		}
+
+		notes, err := services.NewItemNoteService(db).GetPrescriptionNotes(ctx, presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notes)
+	}
+}
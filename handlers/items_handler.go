@@ -4,39 +4,133 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// updateItemDocReasonRequest sets the doctor's note on an item. Reason optionally
+// explains the change in the prescription's version history.
 type updateItemDocReasonRequest struct {
 	DocReason string `json:"docReason"`
+	Reason    string `json:"reason"`
 }
 
-// CreateItemHandler creates a new item in a prescription
-func CreateItemHandler(db *pgx.Conn) http.HandlerFunc {
+// updateItemDosageRequest accepts either a shorthand "sig" such as "1-0-1 x 5 days",
+// explicit dosage fields, or both; explicit fields override what the sig implies.
+type updateItemDosageRequest struct {
+	Sig    string `json:"sig"`
+	Reason string `json:"reason"`
+	models.Dosage
+}
+
+type updateItemRefillsRequest struct {
+	Reason string `json:"reason"`
+	models.RefillPolicy
+}
+
+type parseDosageRequest struct {
+	Sig string `json:"sig"`
+}
+
+// approveItemRequest approves or withdraws approval of an item. StartAt optionally
+// sets when the medication course begins (RFC 3339, defaults to now).
+// AcknowledgeWarnings confirms the doctor reviewed major or contraindicated
+// interactions of the item; without it such an approval is rejected.
+type approveItemRequest struct {
+	Approved            bool   `json:"approved"`
+	StartAt             string `json:"startAt"`
+	AcknowledgeWarnings bool   `json:"acknowledgeWarnings"`
+}
+
+type approveItemResponse struct {
+	Item           *models.Items                 `json:"item"`
+	ScheduledDoses int                           `json:"scheduledDoses"`
+	Warnings       []*models.PrescriptionWarning `json:"warnings"`
+}
+
+// approvalBlockedResponse is returned with 409 when an approval needs the doctor
+// to acknowledge serious warnings first.
+type approvalBlockedResponse struct {
+	Error    string                        `json:"error"`
+	Warnings []*models.PrescriptionWarning `json:"warnings"`
+}
+
+// CreateItemHandler lets the assigned doctor add an item to a prescription
+func CreateItemHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
 		var item models.Items
 		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		prescription, ok := authorizePrescription(context.Background(), w, db, claims, item.PresID)
+		if !ok {
+			return
+		}
+		if err := services.CheckItemsEditable(prescription); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		catalogService := services.NewDrugCatalogService(db)
+		if item.Type == "med" {
+			if err := services.NormalizeDosage(&item.Dosage); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// An explicit catalogId (picked from autocomplete) wins over fuzzy matching.
+			if item.CatalogID != nil {
+				if _, err := catalogService.GetDrug(context.Background(), *item.CatalogID); err != nil {
+					http.Error(w, "catalogId does not match a catalog entry", http.StatusBadRequest)
+					return
+				}
+				item.MatchScore = 1
+			} else if err := catalogService.LinkItems(context.Background(), []*models.Items{&item}); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			item.Dosage = models.Dosage{}
+			item.CatalogID = nil
+			item.MatchScore = 0
+		}
+
 		itemService := services.NewItemsService(db)
-		if err := itemService.CreateItem(context.Background(), &item); err != nil {
+		if err := itemService.CreateItem(context.Background(), &item, claims.Role, claims.ID); err != nil {
+			if errors.Is(err, services.ErrPrescriptionLocked) || errors.Is(err, services.ErrPrescriptionNotEditable) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		if item.Type == "med" {
+			if _, err := services.NewInteractionService(db).CheckPrescription(context.Background(), item.PresID); err != nil {
+				log.Printf("interaction check failed for prescription %d: %v", item.PresID, err)
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(item)
@@ -44,7 +138,7 @@ func CreateItemHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // GetItemHandler returns a specific item
-func GetItemHandler(db *pgx.Conn) http.HandlerFunc {
+func GetItemHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -76,7 +170,7 @@ func GetItemHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // GetPrescriptionItemsHandler returns all items for a prescription
-func GetPrescriptionItemsHandler(db *pgx.Conn) http.HandlerFunc {
+func GetPrescriptionItemsHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -107,16 +201,22 @@ func GetPrescriptionItemsHandler(db *pgx.Conn) http.HandlerFunc {
 	}
 }
 
-// UpdateItemDocReasonHandler updates docReason for a specific item.
+// UpdateItemDocReasonHandler lets the assigned doctor update docReason for a
+// specific item. The previous value is kept in the prescription's version history.
 // Query param: id
-// Body: {"docReason":"..."}
-func UpdateItemDocReasonHandler(db *pgx.Conn) http.HandlerFunc {
+// Body: {"docReason":"...", "reason":"optional reason for the change"}
+func UpdateItemDocReasonHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPut {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
 			http.Error(w, "Item ID is required", http.StatusBadRequest)
@@ -138,7 +238,180 @@ func UpdateItemDocReasonHandler(db *pgx.Conn) http.HandlerFunc {
 		docReason := strings.TrimSpace(req.DocReason)
 
 		itemService := services.NewItemsService(db)
-		updatedItem, err := itemService.UpdateItemDocReason(context.Background(), itemID, docReason)
+		item, err := itemService.GetItem(context.Background(), itemID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "item not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		prescription, ok := authorizePrescription(context.Background(), w, db, claims, item.PresID)
+		if !ok {
+			return
+		}
+		if err := services.CheckItemsEditable(prescription); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		updatedItem, err := itemService.UpdateItemDocReason(context.Background(), itemID, docReason, claims.Role, claims.ID, strings.TrimSpace(req.Reason))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "item not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, services.ErrPrescriptionLocked) || errors.Is(err, services.ErrPrescriptionNotEditable) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updatedItem)
+	}
+}
+
+// UpdateItemDosageHandler updates the structured dosage of a medicine item.
+// Only the doctor assigned to the item's prescription may change it.
+// Query param: id
+// Body: {"sig":"1-0-1 x 5 days"} and/or explicit dosage fields
+func UpdateItemDosageHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Item ID is required", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Item ID", http.StatusBadRequest)
+			return
+		}
+
+		var req updateItemDosageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		itemService := services.NewItemsService(db)
+		item, err := itemService.GetItem(context.Background(), itemID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "item not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if item.Type != "med" {
+			http.Error(w, "dosage can only be set on medicine items", http.StatusBadRequest)
+			return
+		}
+
+		prescription, ok := authorizePrescription(context.Background(), w, db, claims, item.PresID)
+		if !ok {
+			return
+		}
+		if err := services.CheckItemsEditable(prescription); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		dosage := req.Dosage
+		if sig := strings.TrimSpace(req.Sig); sig != "" {
+			parsed, err := services.ParseDosage(sig)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			dosage = services.MergeDosage(parsed, req.Dosage)
+		}
+		if err := services.NormalizeDosage(&dosage); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updatedItem, err := itemService.UpdateItemDosage(context.Background(), itemID, dosage, claims.Role, claims.ID, strings.TrimSpace(req.Reason))
+		if err != nil {
+			if errors.Is(err, services.ErrPrescriptionLocked) || errors.Is(err, services.ErrPrescriptionNotEditable) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Keep the patient's schedule in step with the new dosage.
+		if updatedItem.Approved {
+			if _, err := resumeCourse(context.Background(), db, updatedItem, time.Now()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updatedItem)
+	}
+}
+
+// UpdateItemRefillsHandler sets how many times an approved medicine item may be
+// refilled and the minimum days between refills. Only the doctor assigned to the
+// item's prescription may change it; once finalized, use an amendment.
+// Query param: id
+// Body: {"refills": 3, "refillIntervalDays": 28, "reason": "optional"}
+func UpdateItemRefillsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Item ID is required", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Item ID", http.StatusBadRequest)
+			return
+		}
+
+		var req updateItemRefillsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := services.ValidateRefillPolicy(req.RefillPolicy); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		itemService := services.NewItemsService(db)
+		item, err := itemService.GetItem(context.Background(), itemID)
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
 				http.Error(w, "item not found", http.StatusNotFound)
@@ -148,7 +421,231 @@ func UpdateItemDocReasonHandler(db *pgx.Conn) http.HandlerFunc {
 			return
 		}
 
+		prescription, ok := authorizePrescription(context.Background(), w, db, claims, item.PresID)
+		if !ok {
+			return
+		}
+		if err := services.CheckItemsEditable(prescription); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		updatedItem, err := itemService.UpdateItemRefills(context.Background(), itemID, req.RefillPolicy, claims.Role, claims.ID, strings.TrimSpace(req.Reason))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrNotRefillable):
+				http.Error(w, "refills can only be set on approved medicine items", http.StatusBadRequest)
+			case errors.Is(err, services.ErrPrescriptionLocked), errors.Is(err, services.ErrPrescriptionNotEditable):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(updatedItem)
 	}
 }
+
+// ParseDosageHandler previews how a dosage shorthand would be stored without saving it.
+// Body: {"sig":"1-0-1 x 5 days"}
+func ParseDosageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req parseDosageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	dosage, err := services.ParseDosage(req.Sig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dosage)
+}
+
+// rescheduleItem regenerates the remaining dose schedule of an approved medicine
+// item for a course that began at start, placing doses at wall-clock times in
+// the patient's time zone.
+func rescheduleItem(ctx context.Context, db *pgxpool.Pool, item *models.Items, start, now time.Time) (int, error) {
+	prescription, err := services.NewPrescriptionService(db).GetPrescription(ctx, item.PresID)
+	if err != nil {
+		return 0, err
+	}
+	prefs, err := services.NewNotificationService(db).GetPreferences(ctx, prescription.UserID)
+	if err != nil {
+		return 0, err
+	}
+	loc := services.PreferencesLocation(prefs)
+	doses, err := services.NewDoseService(db).GenerateSchedule(ctx, item, prescription.UserID, start, now, loc)
+	if err != nil {
+		return 0, err
+	}
+	return len(doses), nil
+}
+
+// resumeCourse reschedules the rest of an item's course after its dosage
+// changed, keeping the course's original start.
+func resumeCourse(ctx context.Context, db *pgxpool.Pool, item *models.Items, now time.Time) (int, error) {
+	start, err := services.NewDoseService(db).CourseStart(ctx, item.ID, now)
+	if err != nil {
+		return 0, err
+	}
+	return rescheduleItem(ctx, db, item, start, now)
+}
+
+// ApproveItemHandler lets the assigned doctor approve an item. Approving a medicine
+// with a frequency and duration generates the patient's dose schedule; withdrawing
+// approval removes the doses that have not happened yet.
+// Query param: id
+// Body: {"approved": true, "startAt": "2026-01-02T08:00:00Z"}
+func ApproveItemHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Item ID is required", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Item ID", http.StatusBadRequest)
+			return
+		}
+
+		var req approveItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var start time.Time
+		if req.StartAt != "" {
+			start, err = time.Parse(time.RFC3339, req.StartAt)
+			if err != nil {
+				http.Error(w, "startAt must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+
+		itemService := services.NewItemsService(db)
+		item, err := itemService.GetItem(context.Background(), itemID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "item not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		prescription, ok := authorizePrescription(context.Background(), w, db, claims, item.PresID)
+		if !ok {
+			return
+		}
+		if err := services.CheckItemsEditable(prescription); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		// Check the medicine against the rest of the patient's medication before
+		// approving it; serious interactions must be acknowledged explicitly.
+		interactionService := services.NewInteractionService(db)
+		warnings := make([]*models.PrescriptionWarning, 0)
+		if item.Type == "med" && req.Approved {
+			warnings, err = interactionService.CheckApproval(context.Background(), item.PresID, itemID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if blocking := services.BlockingWarnings(warnings, itemID); len(blocking) > 0 {
+				if !req.AcknowledgeWarnings {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(approvalBlockedResponse{
+						Error:    "item has serious interactions; set acknowledgeWarnings to approve anyway",
+						Warnings: blocking,
+					})
+					return
+				}
+
+				ids := make([]int64, 0, len(blocking))
+				for _, warning := range blocking {
+					ids = append(ids, warning.ID)
+				}
+				now := time.Now()
+				if err := interactionService.AcknowledgeWarnings(context.Background(), ids, claims.ID, now); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for _, warning := range blocking {
+					warning.AcknowledgedAt = &now
+					warning.AcknowledgedBy = &claims.ID
+				}
+			}
+		}
+
+		reason := "approved"
+		if !req.Approved {
+			reason = "approval withdrawn"
+		}
+		updatedItem, err := itemService.SetItemApproved(context.Background(), itemID, req.Approved, claims.Role, claims.ID, reason)
+		if err != nil {
+			if errors.Is(err, services.ErrPrescriptionLocked) || errors.Is(err, services.ErrPrescriptionNotEditable) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := approveItemResponse{Item: updatedItem, Warnings: warnings}
+		if updatedItem.Type == "med" {
+			switch {
+			case req.Approved && start.IsZero():
+				resp.ScheduledDoses, err = resumeCourse(context.Background(), db, updatedItem, time.Now())
+			case req.Approved:
+				resp.ScheduledDoses, err = rescheduleItem(context.Background(), db, updatedItem, start, time.Now())
+			default:
+				err = services.NewDoseService(db).ClearPendingDoses(context.Background(), itemID, time.Now())
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !req.Approved {
+				if _, err := interactionService.CheckPrescription(context.Background(), item.PresID); err != nil {
+					log.Printf("interaction check failed for prescription %d: %v", item.PresID, err)
+				}
+			}
+
+			// The patient's active medication changed, so their other prescriptions
+			// may have gained or lost interactions.
+			if err := interactionService.RecheckPatientPrescriptions(context.Background(), prescription.UserID, item.PresID); err != nil {
+				log.Printf("interaction recheck failed for user %d: %v", prescription.UserID, err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
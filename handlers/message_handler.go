@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/realtime"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/scanner"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/storage"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// maxMessageLength caps the text of one message, in characters.
+	maxMessageLength = 4000
+	// defaultMessagePage and maxMessagePage bound how many messages one request returns.
+	defaultMessagePage = 50
+	maxMessagePage     = 200
+	// streamKeepAlive is how often an idle event stream gets a comment line so
+	// proxies do not close it.
+	streamKeepAlive = 25 * time.Second
+)
+
+type sendMessageRequest struct {
+	Body string `json:"body"`
+}
+
+type markMessagesReadRequest struct {
+	UpTo int64 `json:"upTo"`
+}
+
+// messageThread authorizes the caller for the message thread of the prescription
+// in the id query param. Only its patient and assigned doctor take part. On
+// failure it writes the error response and returns false.
+func messageThread(ctx context.Context, w http.ResponseWriter, r *http.Request, db *pgxpool.Pool) (*utils.Claims, *models.Prescription, bool) {
+	claims, ok := requireRole(w, r, "user", "doctor")
+	if !ok {
+		return nil, nil, false
+	}
+
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	presID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	prescription, ok := authorizePrescription(ctx, w, db, claims, presID)
+	if !ok {
+		return nil, nil, false
+	}
+	return claims, prescription, true
+}
+
+// publishToThread sends an event to every connection of the prescription's
+// patient and assigned doctor.
+func publishToThread(hub *realtime.Hub, prescription *models.Prescription, event realtime.Event) {
+	hub.Publish("user", prescription.UserID, event)
+	hub.Publish("doctor", prescription.DocID, event)
+}
+
+// fillUnreadMessages sets UnreadMessages on prescriptions listed for the
+// reader with readerRole and readerID. The list routes do not require a token,
+// so message activity is only filled in for a caller signed in as that reader.
+func fillUnreadMessages(ctx context.Context, db *pgxpool.Pool, r *http.Request, readerRole string, readerID int64, prescriptions []*models.Prescription) error {
+	claims, err := ExtractTokenInfo(r)
+	if err != nil || claims.Role != readerRole || claims.ID != readerID {
+		return nil
+	}
+
+	presIDs := make([]int64, 0, len(prescriptions))
+	for _, prescription := range prescriptions {
+		presIDs = append(presIDs, prescription.ID)
+	}
+	counts, err := services.NewMessageService(db).UnreadCounts(ctx, readerRole, presIDs)
+	if err != nil {
+		return err
+	}
+	for _, prescription := range prescriptions {
+		prescription.UnreadMessages = counts[prescription.ID]
+	}
+	return nil
+}
+
+// GetMessagesHandler returns the message thread of a prescription to its
+// patient or assigned doctor, oldest first.
+// Query params: id, optional before (message ID) and limit
+func GetMessagesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := context.Background()
+		_, prescription, ok := messageThread(ctx, w, r, db)
+		if !ok {
+			return
+		}
+
+		var before int64
+		if beforeStr := r.URL.Query().Get("before"); beforeStr != "" {
+			var err error
+			before, err = strconv.ParseInt(beforeStr, 10, 64)
+			if err != nil || before <= 0 {
+				http.Error(w, "Invalid before", http.StatusBadRequest)
+				return
+			}
+		}
+		limit := defaultMessagePage
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 || limit > maxMessagePage {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxMessagePage), http.StatusBadRequest)
+				return
+			}
+		}
+
+		messages, err := services.NewMessageService(db).GetMessages(ctx, prescription.ID, before, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(messages)
+	}
+}
+
+// SendMessageHandler posts a message to the thread of a prescription. Text is
+// sent as JSON; a file is sent as multipart form data with an optional "body"
+// field and one "file" part, checked and stored like prescription uploads.
+// Query param: id
+// Body: {"body": "..."}
+func SendMessageHandler(db *pgxpool.Pool, fileScanner scanner.Scanner, hub *realtime.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := context.Background()
+		claims, prescription, ok := messageThread(ctx, w, r, db)
+		if !ok {
+			return
+		}
+
+		var body string
+		var file *uploadedFile
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			r.Body = http.MaxBytesReader(w, r.Body, maxUploadFileSize+(1<<20))
+			if err := r.ParseMultipartForm(2 << 20); err != nil {
+				http.Error(w, "failed to parse multipart form: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer r.MultipartForm.RemoveAll()
+
+			parts := r.MultipartForm.File["file"]
+			if len(parts) != 1 {
+				http.Error(w, "exactly one file is required", http.StatusBadRequest)
+				return
+			}
+			var err error
+			file, err = readUploadedFile(parts[0])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = r.FormValue("body")
+		} else {
+			var req sendMessageRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			body = req.Body
+		}
+
+		body = strings.TrimSpace(body)
+		if body == "" && file == nil {
+			http.Error(w, "body or file is required", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(body) > maxMessageLength {
+			http.Error(w, fmt.Sprintf("body is too long (max %d characters)", maxMessageLength), http.StatusBadRequest)
+			return
+		}
+
+		message := &models.Message{
+			PresID:     prescription.ID,
+			SenderRole: claims.Role,
+			SenderID:   claims.ID,
+			Body:       body,
+		}
+
+		var attachment *models.Attachment
+		var uploads []*models.UploadJob
+		var scan *models.ScanResult
+		if file != nil {
+			var err error
+			scan, err = services.ScanFile(r.Context(), fileScanner, file.Name, file.Data)
+			if err != nil {
+				log.Printf("malware scan of %s failed: %v", file.Name, err)
+				http.Error(w, "file scanning is unavailable, please try again later", http.StatusServiceUnavailable)
+				return
+			}
+			file.Quarantined = scan.Verdict == scanner.VerdictInfected
+
+			attachment = &models.Attachment{
+				FileName:    file.Name,
+				ContentType: file.ContentType,
+				Size:        int64(len(file.Data)),
+				Pages:       file.Pages,
+			}
+			key := storageObjectPath(prescription.ID, file.Name)
+			if file.Quarantined {
+				attachment.Status = models.AttachmentStatusQuarantined
+				key = quarantinePrefix + key
+			}
+			uploads = []*models.UploadJob{{Kind: models.UploadKindOriginal, ObjectKey: key, ContentType: file.ContentType, Data: file.Data}}
+			if file.Thumbnail != nil && !file.Quarantined {
+				uploads = append(uploads, &models.UploadJob{Kind: models.UploadKindThumbnail, ObjectKey: storageThumbnailPath(key), ContentType: "image/jpeg", Data: file.Thumbnail})
+			}
+		}
+
+		if err := services.NewMessageService(db).SendMessage(ctx, message, attachment, uploads); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if scan != nil {
+			scan.PresID, scan.AttachmentID = prescription.ID, attachment.ID
+			if scan.Verdict == scanner.VerdictInfected {
+				log.Printf("quarantined %s in message %d on prescription %d: %s", scan.FileName, message.ID, prescription.ID, scan.Signature)
+			}
+			if err := services.NewScanService(db).RecordScanResults(ctx, []*models.ScanResult{scan}); err != nil {
+				log.Printf("failed to record scan result for message %d: %v", message.ID, err)
+			}
+		}
+
+		publishToThread(hub, prescription, realtime.Event{Type: realtime.EventMessage, Data: message})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message)
+	}
+}
+
+// MarkMessagesReadHandler marks the messages the other side sent in a
+// prescription's thread as read, which the sender sees as a read receipt.
+// Query param: id
+// Body (optional): {"upTo": 42}; without it every message is marked read
+func MarkMessagesReadHandler(db *pgxpool.Pool, hub *realtime.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := context.Background()
+		claims, prescription, ok := messageThread(ctx, w, r, db)
+		if !ok {
+			return
+		}
+
+		// The body is optional.
+		var req markMessagesReadRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		receipt, err := services.NewMessageService(db).MarkRead(ctx, prescription.ID, claims.Role, req.UpTo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if receipt.Count > 0 {
+			publishToThread(hub, prescription, realtime.Event{Type: realtime.EventRead, Data: receipt})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(receipt)
+	}
+}
+
+// GetMessageFileHandler gives the patient or assigned doctor access to a file
+// sent in a prescription's thread: a signed URL valid for expiry, or the file
+// itself when download=true.
+// Query params: id, attachmentId, thumbnail (optional), download (optional)
+func GetMessageFileHandler(db *pgxpool.Pool, store storage.ObjectStore, expiry time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := context.Background()
+		_, prescription, ok := messageThread(ctx, w, r, db)
+		if !ok {
+			return
+		}
+
+		attachmentID, err := strconv.ParseInt(r.URL.Query().Get("attachmentId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			return
+		}
+
+		attachment, err := services.NewMessageService(db).GetMessageAttachment(ctx, prescription.ID, attachmentID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "attachment not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if attachment.Status == models.AttachmentStatusQuarantined {
+			http.Error(w, "file is quarantined", http.StatusForbidden)
+			return
+		}
+
+		key := attachment.ObjectKey
+		file := fileURLResponse{FileName: attachment.FileName, ContentType: attachment.ContentType}
+		if r.URL.Query().Get("thumbnail") == "true" {
+			if attachment.ThumbnailKey == "" {
+				http.Error(w, "thumbnail not available", http.StatusNotFound)
+				return
+			}
+			key, file.ContentType = attachment.ThumbnailKey, "image/jpeg"
+			file.FileName = strings.TrimSuffix(file.FileName, path.Ext(file.FileName)) + "_thumb.jpg"
+		}
+		if key == "" {
+			http.Error(w, "file not uploaded yet", http.StatusNotFound)
+			return
+		}
+
+		serveStoredFile(ctx, w, r, store, expiry, key, file, prescription.ID)
+	}
+}
+
+type streamTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// StreamTokenHandler issues a short-lived token for opening the message stream
+// from clients that cannot send an Authorization header, such as EventSource.
+func StreamTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		token, expiresAt, err := utils.GenerateStreamToken(claims)
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(streamTokenResponse{Token: token, ExpiresAt: expiresAt})
+	}
+}
+
+// streamClaims authenticates a stream request by its Authorization header or,
+// for EventSource clients, by a stream token in the token query parameter.
+func streamClaims(w http.ResponseWriter, r *http.Request) (*utils.Claims, bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return requireRole(w, r, "user", "doctor")
+	}
+	claims, err := utils.VerifyStreamToken(token)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return nil, false
+	}
+	if claims.Role != "user" && claims.Role != "doctor" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
+
+// MessageStreamHandler streams new messages and read receipts of the caller's
+// prescription threads as server-sent events. Events for the authenticated
+// patient or doctor arrive as "message" and "read" events with a JSON payload.
+// The caller authenticates with a Bearer header or a token query parameter
+// from StreamTokenHandler; the stream outlives the token.
+func MessageStreamHandler(hub *realtime.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := streamClaims(w, r)
+		if !ok {
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		events, unsubscribe := hub.Subscribe(claims.Role, claims.ID)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case event := <-events:
+				data, err := json.Marshal(event.Data)
+				if err != nil {
+					log.Printf("failed to encode %s event: %v", event.Type, err)
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
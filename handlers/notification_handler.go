@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/notify"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetNotificationPreferencesHandler returns the authenticated patient's reminder settings.
+func GetNotificationPreferencesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		prefs, err := services.NewNotificationService(db).GetPreferences(context.Background(), claims.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs)
+	}
+}
+
+// UpdateNotificationPreferencesHandler replaces the authenticated patient's reminder settings.
+// Body: {"channels":["email","push"],"timezone":"Asia/Kolkata","quietStart":"22:00","quietEnd":"07:00",
+//
+//	"pushSubscription":{...},"doseReminders":true,"followUpReminders":true,"leadMinutes":10}
+func UpdateNotificationPreferencesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		prefs := services.DefaultNotificationPreferences(claims.ID)
+		if err := json.NewDecoder(r.Body).Decode(prefs); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		prefs.UserID = claims.ID
+
+		if err := services.ValidateNotificationPreferences(prefs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := services.NewNotificationService(db).SavePreferences(context.Background(), prefs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs)
+	}
+}
+
+// VAPIDPublicKeyHandler returns the application server key browsers need to subscribe to push reminders.
+func VAPIDPublicKeyHandler(notifiers map[string]notify.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		push, ok := notifiers[notify.ChannelPush].(*notify.WebPushNotifier)
+		if !ok {
+			http.Error(w, "push notifications are not configured", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"publicKey": push.PublicKey()})
+	}
+}
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxObservationCSVSize limits vitals and lab CSV uploads.
+const maxObservationCSVSize = 2 << 20
+
+// maxTimelineEntries caps the number of entries a timeline request returns.
+const maxTimelineEntries = 500
+
+// parseTimeRange reads the optional from/to query params (RFC 3339).
+// On failure it writes the error response and returns false.
+func parseTimeRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+// observationSource records who entered a reading.
+func observationSource(claims *utils.Claims) string {
+	if claims.Role == "doctor" {
+		return "doctor"
+	}
+	return "patient"
+}
+
+// readCSVUpload reads the "file" part of a multipart CSV upload.
+// On failure it writes the error response and returns false.
+func readCSVUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxObservationCSVSize+(1<<20))
+	if err := r.ParseMultipartForm(maxObservationCSVSize); err != nil {
+		http.Error(w, "failed to parse multipart form: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxObservationCSVSize+1))
+	if err != nil {
+		http.Error(w, "failed to read file: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if len(data) > maxObservationCSVSize {
+		http.Error(w, "file too large (max 2MB)", http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
+
+// CreateVitalHandler records a vital sign reading for a patient. Patients record
+// their own; doctors treating the patient pass userId.
+// Body: {"type":"blood_pressure","value":128,"secondaryValue":84,"unit":"mmHg","measuredAt":"2026-03-01T08:00:00Z"}
+func CreateVitalHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		var vital models.Vital
+		if err := json.NewDecoder(r.Body).Decode(&vital); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		vital.UserID = userID
+		vital.Source = observationSource(claims)
+		vital.RecordedBy = claims.ID
+
+		if err := services.ValidateVital(&vital, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := services.NewObservationService(db).CreateVitals(context.Background(), []*models.Vital{&vital}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(vital)
+	}
+}
+
+// GetVitalsHandler lists a patient's vital sign readings, newest first.
+// Query params: userId (doctors only), optional type, from, to
+func GetVitalsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		from, to, ok := parseTimeRange(w, r)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		vitals, err := services.NewObservationService(db).GetUserVitals(context.Background(), userID, r.URL.Query().Get("type"), from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(vitals)
+	}
+}
+
+// ImportVitalsHandler stores the readings of a CSV file uploaded as the "file"
+// form field. The import is all-or-nothing.
+// Query param: userId (doctors only)
+func ImportVitalsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		data, ok := readCSVUpload(w, r)
+		if !ok {
+			return
+		}
+
+		vitals, err := services.ParseVitalsCSV(bytes.NewReader(data))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, vital := range vitals {
+			vital.UserID = userID
+			vital.Source = "import"
+			vital.RecordedBy = claims.ID
+		}
+
+		if err := services.ValidateVitals(vitals, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := services.NewObservationService(db).CreateVitals(context.Background(), vitals); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.ImportResult{Imported: len(vitals)})
+	}
+}
+
+// CreateLabResultsHandler records the results of a lab report for a patient.
+// Query param: userId (doctors only)
+// Body: [{"code":"4548-4","value":7.2,"unit":"%","collectedAt":"2026-03-01T08:00:00Z","lab":"City Labs"}]
+func CreateLabResultsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		var results []*models.LabResult
+		if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(results) == 0 {
+			http.Error(w, "at least one lab result is required", http.StatusBadRequest)
+			return
+		}
+
+		for _, result := range results {
+			if result.PresID != nil {
+				prescription, err := services.NewPrescriptionService(db).GetPrescription(context.Background(), *result.PresID)
+				if err != nil || prescription.UserID != userID {
+					http.Error(w, "presId does not belong to this patient", http.StatusBadRequest)
+					return
+				}
+			}
+			result.UserID = userID
+			result.Source = observationSource(claims)
+			result.RecordedBy = claims.ID
+		}
+
+		if err := services.ValidateLabResults(results, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := services.NewObservationService(db).CreateLabResults(context.Background(), results); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// GetLabResultsHandler lists a patient's lab results, newest first.
+// Query params: userId (doctors only), optional code, from, to
+func GetLabResultsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		from, to, ok := parseTimeRange(w, r)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		results, err := services.NewObservationService(db).GetUserLabResults(context.Background(), userID, r.URL.Query().Get("code"), from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// ImportLabResultsHandler stores the results of a CSV file uploaded as the
+// "file" form field. The import is all-or-nothing.
+// Query param: userId (doctors only)
+func ImportLabResultsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		data, ok := readCSVUpload(w, r)
+		if !ok {
+			return
+		}
+
+		results, err := services.ParseLabResultsCSV(bytes.NewReader(data))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, result := range results {
+			result.UserID = userID
+			result.Source = "import"
+			result.RecordedBy = claims.ID
+		}
+
+		if err := services.ValidateLabResults(results, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := services.NewObservationService(db).CreateLabResults(context.Background(), results); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.ImportResult{Imported: len(results)})
+	}
+}
+
+// GetPatientTimelineHandler merges a patient's vitals, lab results and
+// prescriptions into one chronological list, newest first.
+// Query params: userId (doctors only), optional type (comma-separated vital, lab,
+// prescription), from, to, limit (default 100, max 500)
+func GetPatientTimelineHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		userID, ok := profileUserID(w, r, claims)
+		if !ok {
+			return
+		}
+		from, to, ok := parseTimeRange(w, r)
+		if !ok {
+			return
+		}
+		kinds, err := services.ParseTimelineKinds(r.URL.Query().Get("type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !authorizePatient(context.Background(), w, db, claims, userID) {
+			return
+		}
+
+		limit := 100
+		if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+			limit = min(v, maxTimelineEntries)
+		}
+
+		entries, err := services.NewObservationService(db).Timeline(context.Background(), userID, kinds, from, to, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pharmacyLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// pharmacyPrescription is what a pharmacy sees of a shared prescription: who
+// it is for and from, the approved medicines and what has been dispensed.
+type pharmacyPrescription struct {
+	Prescription *models.Prescription           `json:"prescription"`
+	PatientName  string                         `json:"patientName"`
+	DoctorName   string                         `json:"doctorName"`
+	Items        []*models.Items                `json:"items"`
+	Dispensing   *models.PrescriptionDispensing `json:"dispensing"`
+}
+
+type dispenseRequest struct {
+	Items []*models.Dispensing `json:"items"`
+}
+
+// CreatePharmacyHandler registers a pharmacy
+func CreatePharmacyHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req models.PharmacyCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pharmacy, err := services.NewPharmacyService(db).CreatePharmacy(context.Background(), &req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(pharmacy)
+	}
+}
+
+// LoginPharmacyHandler authenticates a pharmacy and returns a token with the "pharmacy" role
+func LoginPharmacyHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var loginReq pharmacyLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pharmacy, err := services.NewPharmacyService(db).LoginPharmacy(context.Background(), loginReq.Email, loginReq.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		token, err := utils.GenerateToken(pharmacy.ID, pharmacy.Email, "pharmacy")
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.PharmacyLoginResponse{
+			ID:            pharmacy.ID,
+			Name:          pharmacy.Name,
+			Email:         pharmacy.Email,
+			LicenseNumber: pharmacy.LicenseNumber,
+			Token:         token,
+		})
+	}
+}
+
+// GetPharmaciesHandler lists pharmacies, so patients can pick one to share with
+func GetPharmaciesHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		pharmacies, err := services.NewPharmacyService(db).GetAllPharmacies(context.Background())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pharmacies)
+	}
+}
+
+// PharmacyProfileHandler returns the authenticated pharmacy's profile
+func PharmacyProfileHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "pharmacy")
+		if !ok {
+			return
+		}
+
+		pharmacy, err := services.NewPharmacyService(db).GetPharmacy(context.Background(), claims.ID)
+		if err != nil {
+			http.Error(w, "Pharmacy not found", http.StatusNotFound)
+			return
+		}
+		pharmacy.Password = ""
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pharmacy)
+	}
+}
+
+// pharmacyView assembles what a pharmacy may see of a prescription. AI
+// reasoning and items the doctor did not approve are left out.
+func pharmacyView(ctx context.Context, db *pgxpool.Pool, prescription *models.Prescription) (*pharmacyPrescription, error) {
+	patient, err := services.NewUserService(db).GetUser(ctx, prescription.UserID)
+	if err != nil {
+		return nil, err
+	}
+	doctor, err := services.NewDoctorService(db).GetDoctor(ctx, prescription.DocID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := services.NewItemsService(db).GetPrescriptionItems(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+	dispensing, err := services.NewDispensingService(db).GetDispensing(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &pharmacyPrescription{
+		Prescription: prescription,
+		PatientName:  patient.Name,
+		DoctorName:   doctor.Name,
+		Items:        make([]*models.Items, 0, len(items)),
+		Dispensing:   dispensing,
+	}
+	for _, item := range items {
+		if item.Type != "med" || !item.Approved {
+			continue
+		}
+		item.AIReasons = ""
+		view.Items = append(view.Items, item)
+	}
+	return view, nil
+}
+
+// GetPharmacyPrescriptionsHandler lists the prescriptions patients have shared
+// with the authenticated pharmacy, with their medicines and dispensing state.
+func GetPharmacyPrescriptionsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "pharmacy")
+		if !ok {
+			return
+		}
+
+		ctx := context.Background()
+		prescriptions, err := services.NewDispensingService(db).GetPharmacyPrescriptions(ctx, claims.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]*pharmacyPrescription, 0, len(prescriptions))
+		for _, prescription := range prescriptions {
+			view, err := pharmacyView(ctx, db, prescription)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			response = append(response, view)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// DispensePrescriptionHandler records medicines handed out by the
+// authenticated pharmacy against a prescription shared with it. Dispensing can
+// be partial; the total per item may not exceed the prescribed quantity.
+// Query param: id
+// Body: {"items": [{"itemId": 12, "quantity": 10, "batchNumber": "B2024-117", "note": "optional"}]}
+func DispensePrescriptionHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "pharmacy")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		var req dispenseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Items) == 0 {
+			http.Error(w, "items is required", http.StatusBadRequest)
+			return
+		}
+		for _, entry := range req.Items {
+			if entry == nil || entry.ItemID == 0 {
+				http.Error(w, "each entry needs an itemId", http.StatusBadRequest)
+				return
+			}
+			if entry.Quantity <= 0 || math.IsNaN(entry.Quantity) || math.IsInf(entry.Quantity, 0) {
+				http.Error(w, "quantity must be a positive number", http.StatusBadRequest)
+				return
+			}
+			if strings.TrimSpace(entry.BatchNumber) == "" {
+				http.Error(w, "batchNumber is required", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx := context.Background()
+		if _, ok := authorizePrescription(ctx, w, db, claims, presID); !ok {
+			return
+		}
+
+		dispensingService := services.NewDispensingService(db)
+		if _, err := dispensingService.Dispense(ctx, presID, claims.ID, req.Items); err != nil {
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, services.ErrNotDispensable), errors.Is(err, services.ErrOverDispense):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		dispensing, err := dispensingService.GetDispensing(ctx, presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(dispensing)
+	}
+}
@@ -5,24 +5,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/scanner"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
-	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type prescriptionWithItems struct {
-	Prescription *models.Prescription `json:"prescription"`
-	Items        []*models.Items      `json:"items"`
+	Prescription *models.Prescription          `json:"prescription"`
+	Items        []*models.Items               `json:"items"`
+	Warnings     []*models.PrescriptionWarning `json:"warnings,omitempty"`
 }
 
 // createPrescriptionResponse keeps backward compatibility for clients expecting
@@ -32,13 +31,19 @@ type createPrescriptionResponse struct {
 	*models.Prescription
 	PrescriptionData *models.Prescription `json:"prescription"`
 	Items            []*models.Items      `json:"items"`
+	Attachments      []*models.Attachment `json:"attachments"`
 }
 
 type updatePrescriptionSeenStatusRequest struct {
 	SeenByPatient bool `json:"seenByPatient"`
 }
 
-func persistAIItems(ctx context.Context, db *pgx.Conn, presID int64, aiResp *models.AIResponse) error {
+// updatePrescriptionFollowUpRequest sets the follow-up date; an empty value clears it.
+type updatePrescriptionFollowUpRequest struct {
+	FollowUpAt string `json:"followUpAt"`
+}
+
+func persistAIItems(ctx context.Context, db *pgxpool.Pool, presID int64, aiResp *models.AIResponse) error {
 	if aiResp == nil {
 		return nil
 	}
@@ -86,22 +91,33 @@ func persistAIItems(ctx context.Context, db *pgx.Conn, presID int64, aiResp *mod
 		})
 	}
 
-	if err := itemService.CreateItemsBulk(ctx, items); err != nil {
+	// Link medicine names to the drug catalog so brand, generic and misspelled
+	// variants resolve to the same drug. Matching is best-effort.
+	if err := services.NewDrugCatalogService(db).LinkItems(ctx, items); err != nil {
+		log.Printf("failed to match AI medicines to drug catalog for prescription %d: %v", presID, err)
+	}
+
+	if err := itemService.CreateItemsBulk(ctx, items, models.StatusActorSystem, 0); err != nil {
 		return fmt.Errorf("failed to store AI items: %w", err)
 	}
+
+	// Flag suggested medicines that interact with each other or with the
+	// patient's current medication so the doctor sees it before approving.
+	if _, err := services.NewInteractionService(db).CheckPrescription(ctx, presID); err != nil {
+		log.Printf("interaction check failed for prescription %d: %v", presID, err)
+	}
 	return nil
 }
 
 // CreatePrescriptionHandler creates a new prescription
-func CreatePrescriptionHandler(db *pgx.Conn) http.HandlerFunc {
+func CreatePrescriptionHandler(db *pgxpool.Pool, fileScanner scanner.Scanner) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		const maxFileSize = 10 << 20
-		const maxRequestSize = maxFileSize + (1 << 20) // file + multipart overhead
+		const maxRequestSize = maxUploadTotalSize + (1 << 20) // files + multipart overhead
 
 		// Enforce a hard request size limit before parsing multipart data.
 		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
@@ -115,72 +131,34 @@ func CreatePrescriptionHandler(db *pgx.Conn) http.HandlerFunc {
 			defer r.MultipartForm.RemoveAll()
 		}
 
-		// Read file from form field 'file'
-		file, header, err := r.FormFile("file")
+		// Read images and PDFs from the form fields 'files' and 'file'
+		files, err := readUploadedFiles(r.MultipartForm)
 		if err != nil {
-			http.Error(w, "file is required: "+err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer file.Close()
-
-		limitedReader := io.LimitReader(file, maxFileSize+1)
-		fileBytes, err := io.ReadAll(limitedReader)
-		if err != nil {
-			http.Error(w, "failed to read file: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if len(fileBytes) > maxFileSize {
-			http.Error(w, "file too large (max 10MB)", http.StatusBadRequest)
-			return
-		}
-
-		// Build object path and upload
-		bucket := os.Getenv("SUPABASE_STORAGE_BUCKET")
-		if bucket == "" {
-			bucket = "prescriptions"
-		}
-		// sanitize filename and add timestamp
-		fname := header.Filename
-		ext := filepath.Ext(fname)
-		nameOnly := fname[0 : len(fname)-len(ext)]
-		objectPath := fmt.Sprintf("%s_%d%s", nameOnly, time.Now().UnixNano(), ext)
-		objectPath = filepath.ToSlash(objectPath)
-
-		contentType := header.Header.Get("Content-Type")
-		if contentType == "" {
-			contentType = http.DetectContentType(fileBytes)
-		}
-
-		// Validate MIME type - allow only common image types
-		allowedTypes := map[string]bool{
-			"image/png":     true,
-			"image/jpeg":    true,
-			"image/jpg":     true,
-			"image/gif":     true,
-			"image/webp":    true,
-			"image/bmp":     true,
-			"image/svg+xml": true,
-		}
-		if !strings.HasPrefix(contentType, "image/") || !allowedTypes[contentType] {
-			http.Error(w, "only image uploads are allowed", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Validate extension
-		extLower := strings.ToLower(ext)
-		allowedExts := map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true, ".svg": true}
-		if !allowedExts[extLower] {
-			http.Error(w, "unsupported file extension", http.StatusBadRequest)
-			return
+		// Scan every file before anything is stored. Flagged files are kept in
+		// quarantine for review rather than rejected.
+		scans := make([]*models.ScanResult, len(files))
+		for i, file := range files {
+			scans[i], err = services.ScanFile(r.Context(), fileScanner, file.Name, file.Data)
+			if err != nil {
+				log.Printf("malware scan of %s failed: %v", file.Name, err)
+				http.Error(w, "file scanning is unavailable, please try again later", http.StatusServiceUnavailable)
+				return
+			}
+			file.Quarantined = scans[i].Verdict == scanner.VerdictInfected
 		}
 
 		// Parse other form fields
 		symptoms := r.FormValue("symptoms")
 		userIDStr := r.FormValue("userId")
 		doctorIdentifier := strings.TrimSpace(r.FormValue("doctorUsername"))
+		doctorIDStr := strings.TrimSpace(r.FormValue("doctorId"))
 
-		if userIDStr == "" || doctorIdentifier == "" {
-			http.Error(w, "userId and doctorUsername are required", http.StatusBadRequest)
+		if userIDStr == "" || doctorIdentifier == "" && doctorIDStr == "" {
+			http.Error(w, "userId and doctorUsername or doctorId are required", http.StatusBadRequest)
 			return
 		}
 
@@ -190,9 +168,20 @@ func CreatePrescriptionHandler(db *pgx.Conn) http.HandlerFunc {
 			return
 		}
 
-		// Resolve doctor by username or email.
+		// Resolve doctor by ID (as returned by the doctor search), or else by
+		// username or email.
 		docService := services.NewDoctorService(db)
-		doctor, err := docService.GetDoctorByIdentifier(context.Background(), doctorIdentifier)
+		var doctor *models.Doctor
+		if doctorIDStr != "" {
+			docID, err := strconv.ParseInt(doctorIDStr, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid doctorId", http.StatusBadRequest)
+				return
+			}
+			doctor, err = docService.GetDoctor(context.Background(), docID)
+		} else {
+			doctor, err = docService.GetDoctorByIdentifier(context.Background(), doctorIdentifier)
+		}
 		if err != nil {
 			http.Error(w, "doctor not found", http.StatusNotFound)
 			return
@@ -205,51 +194,113 @@ func CreatePrescriptionHandler(db *pgx.Conn) http.HandlerFunc {
 			DocID:    doctor.ID,
 		}
 
+		// The prescription, its attachments and the outbox jobs that store the
+		// files are created together; the background uploader retries the jobs
+		// until the files are stored.
 		presService := services.NewPrescriptionService(db)
-		if err := presService.CreatePrescription(context.Background(), prescription); err != nil {
+		attachments, err := presService.CreatePrescriptionWithAttachments(context.Background(), prescription, func(presID int64) ([]*models.Attachment, [][]*models.UploadJob) {
+			attachments := make([]*models.Attachment, 0, len(files))
+			uploads := make([][]*models.UploadJob, 0, len(files))
+			for i, file := range files {
+				attachment := &models.Attachment{
+					PresID:      presID,
+					Position:    i,
+					FileName:    file.Name,
+					ContentType: file.ContentType,
+					Size:        int64(len(file.Data)),
+					Pages:       file.Pages,
+				}
+				key := storageObjectPath(presID, file.Name)
+				if file.Quarantined {
+					attachment.Status = models.AttachmentStatusQuarantined
+					key = quarantinePrefix + key
+				}
+				attachments = append(attachments, attachment)
+
+				jobs := []*models.UploadJob{{Kind: models.UploadKindOriginal, ObjectKey: key, ContentType: file.ContentType, Data: file.Data}}
+				if file.Thumbnail != nil && !file.Quarantined {
+					jobs = append(jobs, &models.UploadJob{Kind: models.UploadKindThumbnail, ObjectKey: storageThumbnailPath(key), ContentType: "image/jpeg", Data: file.Thumbnail})
+				}
+				uploads = append(uploads, jobs)
+			}
+			return attachments, uploads
+		})
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		presID := prescription.ID
 
-		// Upload image in background and attach the public link once available.
+		for i, scan := range scans {
+			scan.PresID, scan.AttachmentID = presID, attachments[i].ID
+			if scan.Verdict == scanner.VerdictInfected {
+				log.Printf("quarantined %s on prescription %d: %s", scan.FileName, presID, scan.Signature)
+			}
+		}
+		if err := services.NewScanService(db).RecordScanResults(context.Background(), scans); err != nil {
+			log.Printf("failed to record scan results for prescription %d: %v", presID, err)
+		}
+
+		// Run AI analysis in background and store generated items. The
+		// prescription goes to the doctor afterwards even if the analysis failed.
 		go func() {
-			publicURL, err := utils.UploadToSupabase(bucket, objectPath, fileBytes, contentType)
-			if err != nil {
-				log.Printf("async upload failed for prescription %d: %v", presID, err)
+			if _, err := presService.TransitionStatus(context.Background(), presID, models.PrescriptionStatusAnalyzing, models.StatusActorSystem, 0, ""); err != nil {
+				log.Printf("failed to start analysis of prescription %d: %v", presID, err)
 				return
 			}
-			if err := presService.UpdatePrescriptionLink(context.Background(), presID, publicURL); err != nil {
-				log.Printf("failed to update prescription link for %d: %v", presID, err)
+			defer func() {
+				if _, err := presService.TransitionStatus(context.Background(), presID, models.PrescriptionStatusAwaitingReview, models.StatusActorSystem, 0, ""); err != nil {
+					log.Printf("failed to hand prescription %d to its doctor: %v", presID, err)
+				}
+			}()
+
+			// Give the AI the patient's allergies, conditions and medication.
+			profile, err := services.NewHealthProfileService(db).GetProfile(context.Background(), userID)
+			if err != nil {
+				log.Printf("failed to load health profile for prescription %d: %v", presID, err)
 			}
-		}()
 
-		// Run AI analysis in background and store generated items.
-		go func() {
-			aiResp, err := services.CallAIService(fileBytes, symptoms, doctor.Speciality)
+			// The doctor sees whether the analysis failed or left files out.
+			pages, skipped := analysisPages(context.Background(), presID, files)
+			recordAnalysis := func(status string, problems ...string) {
+				problems = append(problems, skipped...)
+				if err := presService.SetAnalysisResult(context.Background(), presID, status, strings.Join(problems, "; ")); err != nil {
+					log.Printf("failed to record the analysis result of prescription %d: %v", presID, err)
+				}
+			}
+			aiResp, err := services.CallAIService(pages, symptoms, doctor.Speciality, services.AIProfile(profile, time.Now()))
 			if err != nil {
 				log.Printf("async AI analysis failed for prescription %d: %v", presID, err)
+				recordAnalysis(models.AnalysisStatusFailed, err.Error())
 				return
 			}
 			if err := persistAIItems(context.Background(), db, presID, aiResp); err != nil {
 				log.Printf("failed to persist AI items for prescription %d: %v", presID, err)
+				recordAnalysis(models.AnalysisStatusFailed, err.Error())
+				return
+			}
+			if len(skipped) > 0 {
+				recordAnalysis(models.AnalysisStatusPartial)
+			} else {
+				recordAnalysis(models.AnalysisStatusCompleted)
 			}
 		}()
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		resp := createPrescriptionResponse{
-			Prescription:    prescription,
+			Prescription:     prescription,
 			PrescriptionData: prescription,
-			Items:           make([]*models.Items, 0),
+			Items:            make([]*models.Items, 0),
+			Attachments:      attachments,
 		}
 		json.NewEncoder(w).Encode(resp)
 	}
 }
 
 // GetPrescriptionHandler returns a specific prescription
-func GetPrescriptionHandler(db *pgx.Conn) http.HandlerFunc {
+func GetPrescriptionHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -281,7 +332,9 @@ func GetPrescriptionHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // GetUserPrescriptionsHandler returns all prescriptions for a user
-func GetUserPrescriptionsHandler(db *pgx.Conn) http.HandlerFunc {
+// Optional query params: status, a comma-separated list such as "awaiting_review,reviewed",
+// and view: active (default), archive or all.
+func GetUserPrescriptionsHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -300,12 +353,27 @@ func GetUserPrescriptionsHandler(db *pgx.Conn) http.HandlerFunc {
 			return
 		}
 
+		statuses, none, err := parseListFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if none {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(make([]interface{}, 0))
+			return
+		}
+
 		presService := services.NewPrescriptionService(db)
-		prescriptions, err := presService.GetUserPrescriptions(context.Background(), userID)
+		prescriptions, err := presService.GetUserPrescriptions(context.Background(), userID, statuses...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := fillUnreadMessages(context.Background(), db, r, "user", userID, prescriptions); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(prescriptions)
@@ -313,7 +381,9 @@ func GetUserPrescriptionsHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // GetUserPrescriptionsWithItemsHandler returns all prescriptions for a user with their items.
-func GetUserPrescriptionsWithItemsHandler(db *pgx.Conn) http.HandlerFunc {
+// Optional query params: status, a comma-separated list such as "awaiting_review,reviewed",
+// and view: active (default), archive or all.
+func GetUserPrescriptionsWithItemsHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -332,12 +402,27 @@ func GetUserPrescriptionsWithItemsHandler(db *pgx.Conn) http.HandlerFunc {
 			return
 		}
 
+		statuses, none, err := parseListFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if none {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(make([]interface{}, 0))
+			return
+		}
+
 		presService := services.NewPrescriptionService(db)
-		prescriptions, err := presService.GetUserPrescriptions(context.Background(), userID)
+		prescriptions, err := presService.GetUserPrescriptions(context.Background(), userID, statuses...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := fillUnreadMessages(context.Background(), db, r, "user", userID, prescriptions); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		itemService := services.NewItemsService(db)
 		response := make([]*prescriptionWithItems, 0, len(prescriptions))
@@ -360,7 +445,9 @@ func GetUserPrescriptionsWithItemsHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // GetDoctorPrescriptionsWithItemsHandler returns all prescriptions for a doctor with their items.
-func GetDoctorPrescriptionsWithItemsHandler(db *pgx.Conn) http.HandlerFunc {
+// Optional query params: status, a comma-separated list such as "awaiting_review,reviewed",
+// and view: active (default), archive or all.
+func GetDoctorPrescriptionsWithItemsHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -379,14 +466,30 @@ func GetDoctorPrescriptionsWithItemsHandler(db *pgx.Conn) http.HandlerFunc {
 			return
 		}
 
+		statuses, none, err := parseListFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if none {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(make([]interface{}, 0))
+			return
+		}
+
 		presService := services.NewPrescriptionService(db)
-		prescriptions, err := presService.GetDoctorPrescriptions(context.Background(), docID)
+		prescriptions, err := presService.GetDoctorPrescriptions(context.Background(), docID, statuses...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := fillUnreadMessages(context.Background(), db, r, "doctor", docID, prescriptions); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		itemService := services.NewItemsService(db)
+		interactionService := services.NewInteractionService(db)
 		response := make([]*prescriptionWithItems, 0, len(prescriptions))
 		for _, pres := range prescriptions {
 			items, err := itemService.GetPrescriptionItems(context.Background(), pres.ID)
@@ -395,9 +498,17 @@ func GetDoctorPrescriptionsWithItemsHandler(db *pgx.Conn) http.HandlerFunc {
 				return
 			}
 
+			// Doctors see the interaction warnings they need to review.
+			warnings, err := interactionService.GetPrescriptionWarnings(context.Background(), pres.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
 			response = append(response, &prescriptionWithItems{
 				Prescription: pres,
 				Items:        items,
+				Warnings:     warnings,
 			})
 		}
 
@@ -409,7 +520,7 @@ func GetDoctorPrescriptionsWithItemsHandler(db *pgx.Conn) http.HandlerFunc {
 // UpdatePrescriptionSeenStatusHandler updates seenByPatient for a specific prescription.
 // Query param: id
 // Body: {"seenByPatient": true}
-func UpdatePrescriptionSeenStatusHandler(db *pgx.Conn) http.HandlerFunc {
+func UpdatePrescriptionSeenStatusHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPut {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -449,3 +560,62 @@ func UpdatePrescriptionSeenStatusHandler(db *pgx.Conn) http.HandlerFunc {
 		json.NewEncoder(w).Encode(updatedPrescription)
 	}
 }
+
+// UpdatePrescriptionFollowUpHandler lets the assigned doctor set when the patient
+// should follow up. The patient is reminded a day ahead.
+// Query param: id
+// Body: {"followUpAt": "2026-03-10T10:00:00+05:30"}
+func UpdatePrescriptionFollowUpHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		var req updatePrescriptionFollowUpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var followUpAt *time.Time
+		if req.FollowUpAt != "" {
+			t, err := time.Parse(time.RFC3339, req.FollowUpAt)
+			if err != nil {
+				http.Error(w, "followUpAt must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			followUpAt = &t
+		}
+
+		if _, ok := authorizePrescription(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		updatedPrescription, err := services.NewPrescriptionService(db).UpdatePrescriptionFollowUp(context.Background(), presID, followUpAt, claims.Role, claims.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updatedPrescription)
+	}
+}
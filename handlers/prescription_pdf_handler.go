@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/signing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// publicVerifyPath is the unauthenticated endpoint printed as a QR code on
+// prescription PDFs.
+const publicVerifyPath = "/api/public/prescriptions/verify"
+
+// GetPrescriptionPDFHandler renders a finalized prescription as a printable PDF
+// with a QR code for verifying it (patient, assigned or referred doctor, or a pharmacy
+// it is shared with).
+// Query param: id
+func GetPrescriptionPDFHandler(db *pgxpool.Pool, signer *signing.Signer, publicBaseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor", "pharmacy")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		prescription, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID)
+		if !ok {
+			return
+		}
+		if prescription.FinalizedAt == nil {
+			http.Error(w, "only finalized prescriptions can be printed", http.StatusConflict)
+			return
+		}
+
+		verifyURL := publicBaseURL + publicVerifyPath + "?" + url.Values{
+			"id":   {strconv.FormatInt(prescription.ID, 10)},
+			"code": {services.VerificationCode(prescription.ContentHash)},
+		}.Encode()
+
+		document, err := services.NewFinalizationService(db, signer).RenderPDF(context.Background(), prescription, verifyURL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=prescription-%d.pdf", prescription.ID))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(document)
+	}
+}
+
+// PublicVerifyPrescriptionHandler confirms that a printed prescription is
+// authentic and current. It needs no login and reveals only the status and
+// finalization date; unknown prescriptions and wrong codes both return 404.
+// Query params: id, code
+func PublicVerifyPrescriptionHandler(db *pgxpool.Pool, signer *signing.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		presID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := services.NewFinalizationService(db, signer).VerifyPublic(context.Background(), presID, r.URL.Query().Get("code"))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "prescription not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(result)
+	}
+}
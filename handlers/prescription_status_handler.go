@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type updatePrescriptionStatusRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// parseStatusFilter reads the optional comma-separated status query param of the list endpoints.
+func parseStatusFilter(r *http.Request) ([]string, error) {
+	raw := strings.TrimSpace(r.URL.Query().Get("status"))
+	if raw == "" {
+		return nil, nil
+	}
+
+	var statuses []string
+	for _, status := range strings.Split(raw, ",") {
+		status = strings.TrimSpace(status)
+		if !services.ValidPrescriptionStatus(status) {
+			return nil, fmt.Errorf("unknown status %q", status)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Views of the prescription list endpoints
+const (
+	prescriptionViewActive  = "active"
+	prescriptionViewArchive = "archive"
+	prescriptionViewAll     = "all"
+)
+
+// parseListFilter combines the status filter with the optional view query param
+// of the list endpoints: "active" hides expired and cancelled prescriptions,
+// "archive" lists only those and "all" lists everything. The view defaults to
+// "active", or to "all" when statuses are given. It returns the statuses to
+// list; none is false when the filter and the view exclude each other.
+func parseListFilter(r *http.Request) (statuses []string, none bool, err error) {
+	statuses, err = parseStatusFilter(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	view := strings.TrimSpace(r.URL.Query().Get("view"))
+	if view == "" {
+		view = prescriptionViewActive
+		if len(statuses) > 0 {
+			view = prescriptionViewAll
+		}
+	}
+
+	var allowed []string
+	switch view {
+	case prescriptionViewAll:
+		return statuses, false, nil
+	case prescriptionViewActive:
+		allowed = services.ActiveStatuses
+	case prescriptionViewArchive:
+		allowed = services.ArchivedStatuses
+	default:
+		return nil, false, fmt.Errorf("unknown view %q (use active, archive or all)", view)
+	}
+	if len(statuses) == 0 {
+		return allowed, false, nil
+	}
+
+	var selected []string
+	for _, status := range statuses {
+		if slices.Contains(allowed, status) {
+			selected = append(selected, status)
+		}
+	}
+	return selected, len(selected) == 0, nil
+}
+
+// UpdatePrescriptionStatusHandler moves a prescription to a new status on behalf
+// of its patient or assigned doctor. Which moves each role may make is decided
+// by the prescription service.
+// Query param: id
+// Body: {"status": "reviewed", "note": "optional"}
+func UpdatePrescriptionStatusHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		var req updatePrescriptionStatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !services.ValidPrescriptionStatus(req.Status) {
+			http.Error(w, "unknown status", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := authorizePrescription(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		updatedPrescription, err := services.NewPrescriptionService(db).TransitionStatus(
+			context.Background(), presID, req.Status, claims.Role, claims.ID, strings.TrimSpace(req.Note))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrStatusTransitionForbidden):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, services.ErrInvalidStatusTransition):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updatedPrescription)
+	}
+}
+
+// GetPrescriptionStatusHistoryHandler lists the status changes of a prescription, oldest first.
+// Query param: id
+func GetPrescriptionStatusHistoryHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		history, err := services.NewPrescriptionService(db).GetStatusHistory(context.Background(), presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	}
+}
@@ -3,14 +3,17 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // UserProfileHandler returns authenticated user's profile
-func UserProfileHandler(db *pgx.Conn) http.HandlerFunc {
+func UserProfileHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -50,7 +53,7 @@ func UserProfileHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // DoctorProfileHandler returns authenticated doctor's profile
-func DoctorProfileHandler(db *pgx.Conn) http.HandlerFunc {
+func DoctorProfileHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -79,15 +82,59 @@ func DoctorProfileHandler(db *pgx.Conn) http.HandlerFunc {
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":         doctor.ID,
-			"name":       doctor.Name,
-			"email":      doctor.Email,
-			"username":   doctor.Username,
-			"speciality": doctor.Speciality,
-			"accuracy":   doctor.Accuracy,
-			"phnNumber":  doctor.PhnNumber,
-			"createdAt":  doctor.CreatedAt,
-		})
+		json.NewEncoder(w).Encode(doctorProfile(doctor))
+	}
+}
+
+// UpdateDoctorProfileHandler lets the authenticated doctor change their
+// speciality, for example one typed freely before the vocabulary existed.
+// Body: {"speciality": "Cardiology"}
+func UpdateDoctorProfileHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		var req models.DoctorProfileUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		doctor, err := services.NewDoctorService(db).UpdateSpeciality(context.Background(), claims.ID, req.Speciality)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrUnknownSpeciality):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, pgx.ErrNoRows):
+				http.Error(w, "Doctor not found", http.StatusNotFound)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doctorProfile(doctor))
+	}
+}
+
+func doctorProfile(doctor *models.Doctor) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             doctor.ID,
+		"name":           doctor.Name,
+		"email":          doctor.Email,
+		"username":       doctor.Username,
+		"speciality":     doctor.Speciality,
+		"specialityCode": doctor.SpecialityCode,
+		"accuracy":       doctor.Accuracy,
+		"phnNumber":      doctor.PhnNumber,
+		"createdAt":      doctor.CreatedAt,
 	}
 }
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type respondReferralRequest struct {
+	Accepted bool   `json:"accepted"`
+	Note     string `json:"note"`
+}
+
+type completeReferralRequest struct {
+	Opinion string `json:"opinion"`
+}
+
+// referralError writes the response for an error from ReferralService.
+func referralError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "referral not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidReferral):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrReferralState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// referralID parses the referral ID from the id query param. On failure it
+// writes the error response and returns false.
+func referralID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, "Referral ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid Referral ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// CreateReferralHandler lets the assigned doctor refer a prescription to another
+// doctor for a second opinion, or hand it over to them.
+// Query param: id (prescription ID)
+// Body: {"toDocId": 7} or {"toUsername": "..."} or {"speciality": "Cardiology"},
+// plus "kind" ("second_opinion" by default, or "handoff") and "reason"
+func CreateReferralHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.ReferralCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		prescription, ok := authorizePrescription(ctx, w, db, claims, presID)
+		if !ok {
+			return
+		}
+
+		referral, err := services.NewReferralService(db).Create(ctx, prescription, &req)
+		if err != nil {
+			referralError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(referral)
+	}
+}
+
+// GetReferralsHandler lists the referrals the authenticated doctor received,
+// or made with direction=outgoing.
+// Query params: optional direction (incoming, outgoing), status
+func GetReferralsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		var incoming bool
+		switch r.URL.Query().Get("direction") {
+		case "", "incoming":
+			incoming = true
+		case "outgoing":
+		default:
+			http.Error(w, "direction must be incoming or outgoing", http.StatusBadRequest)
+			return
+		}
+
+		referrals, err := services.NewReferralService(db).GetDoctorReferrals(context.Background(), claims.ID, incoming, r.URL.Query().Get("status"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(referrals)
+	}
+}
+
+// GetPrescriptionReferralsHandler lists the referrals of a prescription
+// (patient, assigned or referred doctor).
+// Query param: id
+func GetPrescriptionReferralsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		if _, ok := authorizePrescriptionView(ctx, w, db, claims, presID); !ok {
+			return
+		}
+
+		referrals, err := services.NewReferralService(db).GetPrescriptionReferrals(ctx, presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(referrals)
+	}
+}
+
+// RespondReferralHandler lets the referred doctor accept or decline a pending
+// referral. Accepting a handoff makes them the assigned doctor.
+// Query param: id (referral ID)
+// Body: {"accepted": true, "note": "optional"}
+func RespondReferralHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		id, ok := referralID(w, r)
+		if !ok {
+			return
+		}
+
+		var req respondReferralRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		referral, err := services.NewReferralService(db).Respond(context.Background(), id, claims.ID, req.Accepted, strings.TrimSpace(req.Note))
+		if err != nil {
+			referralError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(referral)
+	}
+}
+
+// CompleteReferralHandler lets the referred doctor close an accepted second
+// opinion with a summary. Their notes on the items stay with the prescription.
+// Query param: id (referral ID)
+// Body: {"opinion": "..."}
+func CompleteReferralHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		id, ok := referralID(w, r)
+		if !ok {
+			return
+		}
+
+		var req completeReferralRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		opinion := strings.TrimSpace(req.Opinion)
+		if opinion == "" {
+			http.Error(w, "opinion is required", http.StatusBadRequest)
+			return
+		}
+
+		referral, err := services.NewReferralService(db).Complete(context.Background(), id, claims.ID, opinion)
+		if err != nil {
+			referralError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(referral)
+	}
+}
+
+// CancelReferralHandler lets the referring doctor withdraw a pending or
+// accepted referral.
+// Query param: id (referral ID)
+func CancelReferralHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		id, ok := referralID(w, r)
+		if !ok {
+			return
+		}
+
+		referral, err := services.NewReferralService(db).Cancel(context.Background(), id, claims.ID)
+		if err != nil {
+			referralError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(referral)
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/signing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type reviewRefillRequest struct {
+	Approved bool   `json:"approved"`
+	Note     string `json:"note"`
+}
+
+type reviewRefillResponse struct {
+	Request      *models.RefillRequest `json:"request"`
+	Prescription *models.Prescription  `json:"prescription,omitempty"`
+	Items        []*models.Items       `json:"items,omitempty"`
+}
+
+type prescriptionRefillsResponse struct {
+	Items    []*models.ItemRefillStatus `json:"items"`
+	Requests []*models.RefillRequest    `json:"requests"`
+}
+
+// refillError writes the response for an error from RefillService.
+func refillError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "refill request not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrNotRefillable), errors.Is(err, services.ErrRefillTooEarly),
+		errors.Is(err, services.ErrRefillPending), errors.Is(err, services.ErrRefillDecided):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, signing.ErrNotConfigured):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetPrescriptionRefillsHandler reports the refills left on each medicine of a
+// prescription and its refill requests (patient, assigned or referred doctor).
+// Query param: id
+func GetPrescriptionRefillsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		prescription, ok := authorizePrescriptionView(ctx, w, db, claims, presID)
+		if !ok {
+			return
+		}
+
+		refillService := services.NewRefillService(db, nil)
+		statuses, err := refillService.RefillStatus(ctx, prescription)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requests, err := refillService.GetPrescriptionRefillRequests(ctx, presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prescriptionRefillsResponse{Items: statuses, Requests: requests})
+	}
+}
+
+// RequestRefillHandler lets a patient ask their doctor to refill medicines of a
+// finalized prescription.
+// Query param: id
+// Body: {"itemIds": [12], "note": "optional"}; without itemIds every medicine with refills left is requested
+func RequestRefillHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		// The body is optional.
+		var req models.RefillCreateRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx := context.Background()
+		prescription, ok := authorizePrescription(ctx, w, db, claims, presID)
+		if !ok {
+			return
+		}
+
+		request, err := services.NewRefillService(db, nil).RequestRefill(ctx, prescription, &req, time.Now())
+		if err != nil {
+			refillError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(request)
+	}
+}
+
+// GetRefillRequestsHandler lists the refill requests of the authenticated
+// patient, or the pending requests waiting for the authenticated doctor.
+func GetRefillRequestsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		refillService := services.NewRefillService(db, nil)
+		var requests []*models.RefillRequest
+		var err error
+		if claims.Role == "doctor" {
+			requests, err = refillService.GetDoctorRefillQueue(context.Background(), claims.ID)
+		} else {
+			requests, err = refillService.GetUserRefillRequests(context.Background(), claims.ID)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(requests)
+	}
+}
+
+// ReviewRefillHandler lets the assigned doctor approve or deny a pending refill
+// request. Approval issues a finalized, signed child prescription with the
+// requested medicines, without a new AI run.
+// Query param: id (refill request ID)
+// Body: {"approved": true, "note": "optional"}
+func ReviewRefillHandler(db *pgxpool.Pool, signer *signing.Signer, validity config.Validity) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "doctor")
+		if !ok {
+			return
+		}
+
+		idStr := r.URL.Query().Get("id")
+		if idStr == "" {
+			http.Error(w, "Refill request ID is required", http.StatusBadRequest)
+			return
+		}
+
+		requestID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid refill request ID", http.StatusBadRequest)
+			return
+		}
+
+		var req reviewRefillRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		note := strings.TrimSpace(req.Note)
+
+		ctx := context.Background()
+		refillService := services.NewRefillService(db, signer)
+		request, err := refillService.GetRefillRequest(ctx, requestID)
+		if err != nil {
+			refillError(w, err)
+			return
+		}
+		if _, ok := authorizePrescription(ctx, w, db, claims, request.PresID); !ok {
+			return
+		}
+
+		if !req.Approved {
+			request, err = refillService.Deny(ctx, requestID, claims.ID, note)
+			if err != nil {
+				refillError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(reviewRefillResponse{Request: request})
+			return
+		}
+
+		request, child, items, err := refillService.Approve(ctx, requestID, claims.ID, note, validity)
+		if err != nil {
+			refillError(w, err)
+			return
+		}
+
+		// The refilled medicines get their dose schedules, and the new
+		// prescription is checked for interactions, as when a doctor approves items.
+		now := time.Now()
+		for _, item := range items {
+			if item.Type != "med" {
+				continue
+			}
+			if _, err := rescheduleItem(ctx, db, item, now, now); err != nil {
+				log.Printf("failed to schedule doses for refilled item %d: %v", item.ID, err)
+			}
+		}
+		if _, err := services.NewInteractionService(db).CheckPrescription(ctx, child.ID); err != nil {
+			log.Printf("interaction check failed for refill prescription %d: %v", child.ID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(reviewRefillResponse{Request: request, Prescription: child, Items: items})
+	}
+}
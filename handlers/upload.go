@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+)
+
+// Upload limits for prescription attachments.
+const (
+	maxUploadFiles     = 10
+	maxUploadFileSize  = 10 << 20
+	maxUploadTotalSize = 25 << 20
+	maxUploadPages     = 20
+)
+
+// allowedUploadTypes maps accepted MIME types to the extensions allowed for them.
+// SVG is not accepted: it can carry scripts and is served back to browsers.
+var allowedUploadTypes = map[string][]string{
+	"image/png":       {".png"},
+	"image/jpeg":      {".jpg", ".jpeg"},
+	"image/jpg":       {".jpg", ".jpeg"},
+	"image/gif":       {".gif"},
+	"image/webp":      {".webp"},
+	"image/bmp":       {".bmp"},
+	"application/pdf": {".pdf"},
+}
+
+// quarantinePrefix is prepended to the object keys of files flagged by the malware scanner.
+const quarantinePrefix = "quarantine/"
+
+// uploadedFile is a validated attachment read from a multipart request. Images
+// are already sanitized; Thumbnail and AIData are their JPEG derivatives.
+type uploadedFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+	Pages       int
+	Thumbnail   []byte
+	AIData      []byte
+	Quarantined bool
+}
+
+func (f *uploadedFile) isPDF() bool {
+	return f.ContentType == "application/pdf"
+}
+
+// uploadFileParts returns the file parts of a prescription upload: every "files"
+// part plus the single "file" part older clients send.
+func uploadFileParts(form *multipart.Form) []*multipart.FileHeader {
+	if form == nil {
+		return nil
+	}
+	return append(append([]*multipart.FileHeader{}, form.File["file"]...), form.File["files"]...)
+}
+
+// readUploadedFile reads and validates one attachment.
+func readUploadedFile(header *multipart.FileHeader) (*uploadedFile, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", header.Filename, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", header.Filename, err)
+	}
+	if len(data) > maxUploadFileSize {
+		return nil, fmt.Errorf("%s is too large (max %dMB per file)", header.Filename, maxUploadFileSize>>20)
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+
+	extensions, ok := allowedUploadTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%s: only image and PDF uploads are allowed", header.Filename)
+	}
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	extOK := false
+	for _, allowed := range extensions {
+		extOK = extOK || ext == allowed
+	}
+	if !extOK {
+		return nil, fmt.Errorf("%s: unsupported file extension", header.Filename)
+	}
+
+	upload := &uploadedFile{Name: header.Filename, ContentType: contentType, Data: data, Pages: 1}
+	if upload.isPDF() {
+		if !services.IsPDF(data) {
+			return nil, fmt.Errorf("%s is not a valid PDF", header.Filename)
+		}
+		upload.Pages = max(services.CountPDFPages(data), 1)
+		return upload, nil
+	}
+
+	// Strip metadata such as GPS positions and store the image upright.
+	sanitized, err := services.SanitizeImage(data, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", header.Filename, err)
+	}
+	upload.Data, upload.ContentType = sanitized.Data, sanitized.ContentType
+	upload.Thumbnail, upload.AIData = sanitized.Thumbnail, sanitized.AIImage
+	if sanitized.Ext != ext && !(sanitized.Ext == ".jpg" && ext == ".jpeg") {
+		upload.Name = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename)) + sanitized.Ext
+	}
+	return upload, nil
+}
+
+// readUploadedFiles reads and validates every attachment of a parsed multipart
+// request, enforcing the file count, total size and page limits.
+func readUploadedFiles(form *multipart.Form) ([]*uploadedFile, error) {
+	parts := uploadFileParts(form)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("at least one file is required")
+	}
+	if len(parts) > maxUploadFiles {
+		return nil, fmt.Errorf("too many files (max %d)", maxUploadFiles)
+	}
+
+	files := make([]*uploadedFile, 0, len(parts))
+	total, pages := 0, 0
+	for _, part := range parts {
+		upload, err := readUploadedFile(part)
+		if err != nil {
+			return nil, err
+		}
+		total += len(upload.Data)
+		pages += upload.Pages
+		if total > maxUploadTotalSize {
+			return nil, fmt.Errorf("files too large (max %dMB in total)", maxUploadTotalSize>>20)
+		}
+		if pages > maxUploadPages {
+			return nil, fmt.Errorf("too many pages (max %d in total)", maxUploadPages)
+		}
+		files = append(files, upload)
+	}
+	return files, nil
+}
+
+// storageThumbnailPath returns the key of the thumbnail stored alongside objectKey.
+func storageThumbnailPath(objectKey string) string {
+	return strings.TrimSuffix(objectKey, path.Ext(objectKey)) + "_thumb.jpg"
+}
+
+// storageObjectPath builds a unique object key for a prescription's uploaded file.
+// Keys are grouped by prescription so stray objects can be traced back.
+func storageObjectPath(presID int64, fileName string) string {
+	ext := filepath.Ext(fileName)
+	nameOnly := filepath.Base(fileName[0 : len(fileName)-len(ext)])
+	return filepath.ToSlash(fmt.Sprintf("%d/%s_%d%s", presID, nameOnly, time.Now().UnixNano(), ext))
+}
+
+// analysisPages returns the page images sent to the AI: images as uploaded and
+// PDFs rasterized locally. Quarantined files are skipped, and so are PDFs that
+// cannot be rasterized, which are returned with the reason.
+func analysisPages(ctx context.Context, presID int64, files []*uploadedFile) ([][]byte, []string) {
+	pages := make([][]byte, 0, len(files))
+	var skipped []string
+	for _, file := range files {
+		if len(pages) >= maxUploadPages {
+			break
+		}
+		if file.Quarantined {
+			continue
+		}
+		if !file.isPDF() {
+			if file.AIData != nil {
+				pages = append(pages, file.AIData)
+			} else {
+				pages = append(pages, file.Data)
+			}
+			continue
+		}
+
+		rendered, err := services.DefaultPDFRasterizer.Rasterize(ctx, file.Data, maxUploadPages-len(pages))
+		if err != nil {
+			log.Printf("failed to rasterize %s for prescription %d: %v", file.Name, presID, err)
+			skipped = append(skipped, file.Name+": "+err.Error())
+			continue
+		}
+		pages = append(pages, rendered...)
+	}
+	return pages, skipped
+}
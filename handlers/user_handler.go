@@ -8,11 +8,11 @@ import (
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // GetUsersHandler returns all users
-func GetUsersHandler(db *pgx.Conn) http.HandlerFunc {
+func GetUsersHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -32,7 +32,7 @@ func GetUsersHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // CreateUserHandler creates a new user
-func CreateUserHandler(db *pgx.Conn) http.HandlerFunc {
+func CreateUserHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -58,7 +58,7 @@ func CreateUserHandler(db *pgx.Conn) http.HandlerFunc {
 }
 
 // LoginUserHandler authenticates a user and returns login response
-func LoginUserHandler(db *pgx.Conn) http.HandlerFunc {
+func LoginUserHandler(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
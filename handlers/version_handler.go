@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// versionPrescriptionID parses the prescription id query param and checks the
+// caller may see it. On failure it writes the error response and returns false.
+func versionPrescriptionID(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool) (int64, bool) {
+	claims, ok := requireRole(w, r, "user", "doctor")
+	if !ok {
+		return 0, false
+	}
+
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+
+	presID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	if _, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID); !ok {
+		return 0, false
+	}
+	return presID, true
+}
+
+// versionNumber parses a positive version number query param. On failure it
+// writes the error response and returns false.
+func versionNumber(w http.ResponseWriter, r *http.Request, param string) (int, bool) {
+	number, err := strconv.Atoi(r.URL.Query().Get(param))
+	if err != nil || number < 1 {
+		http.Error(w, param+" must be a version number", http.StatusBadRequest)
+		return 0, false
+	}
+	return number, true
+}
+
+// GetPrescriptionVersionsHandler lists the versions of a prescription, oldest
+// first, with who made each change, when, why and what changed.
+// Query param: id
+func GetPrescriptionVersionsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		presID, ok := versionPrescriptionID(w, r, db)
+		if !ok {
+			return
+		}
+
+		versions, err := services.NewVersionService(db).ListVersions(context.Background(), presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+	}
+}
+
+// GetPrescriptionVersionHandler returns one version of a prescription with the
+// full snapshot of its content at that point.
+// Query params: id, version
+func GetPrescriptionVersionHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		presID, ok := versionPrescriptionID(w, r, db)
+		if !ok {
+			return
+		}
+		number, ok := versionNumber(w, r, "version")
+		if !ok {
+			return
+		}
+
+		version, err := services.NewVersionService(db).GetVersion(context.Background(), presID, number)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "version not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version)
+	}
+}
+
+// GetPrescriptionVersionDiffHandler lists the fields that differ between two
+// versions of a prescription.
+// Query params: id, from, to
+func GetPrescriptionVersionDiffHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		presID, ok := versionPrescriptionID(w, r, db)
+		if !ok {
+			return
+		}
+		from, ok := versionNumber(w, r, "from")
+		if !ok {
+			return
+		}
+		to, ok := versionNumber(w, r, "to")
+		if !ok {
+			return
+		}
+
+		diff, err := services.NewVersionService(db).DiffVersions(context.Background(), presID, from, to)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "version not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diff)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetPrescriptionWarningsHandler returns the clinical warnings of a prescription,
+// most severe first. Passing refresh=true re-runs the interaction check first.
+// Query params: presId, optional refresh
+func GetPrescriptionWarningsHandler(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		claims, ok := requireRole(w, r, "user", "doctor")
+		if !ok {
+			return
+		}
+
+		presIDStr := r.URL.Query().Get("presId")
+		if presIDStr == "" {
+			http.Error(w, "Prescription ID is required", http.StatusBadRequest)
+			return
+		}
+
+		presID, err := strconv.ParseInt(presIDStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Prescription ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := authorizePrescriptionView(context.Background(), w, db, claims, presID); !ok {
+			return
+		}
+
+		interactionService := services.NewInteractionService(db)
+		if r.URL.Query().Get("refresh") == "true" {
+			_, err = interactionService.CheckPrescription(context.Background(), presID)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		warnings, err := interactionService.GetPrescriptionWarnings(context.Background(), presID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(warnings)
+	}
+}
@@ -5,9 +5,20 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
+	_ "time/tzdata" // patients' reminder time zones must resolve in minimal containers
 
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/database"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/notify"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/realtime"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/routes"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/scanner"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/scheduler"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/services"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/signing"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
@@ -37,6 +48,37 @@ func enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// startScheduler registers the background jobs and runs them until ctx is cancelled.
+func startScheduler(ctx context.Context, conn *pgxpool.Pool, notifiers map[string]notify.Notifier, store storage.ObjectStore, validity config.Validity) {
+	reminders := services.NewReminderService(conn, notifiers, scheduler.InstanceID())
+	uploads := services.NewUploadService(conn, store, scheduler.InstanceID())
+	prescriptions := services.NewPrescriptionService(conn)
+
+	sched := scheduler.New()
+	sched.Register(scheduler.Job{Name: "enqueue-dose-reminders", Interval: time.Minute, Run: reminders.EnqueueDoseReminders})
+	sched.Register(scheduler.Job{Name: "enqueue-follow-up-reminders", Interval: 15 * time.Minute, Run: reminders.EnqueueFollowUpReminders})
+	sched.Register(scheduler.Job{Name: "dispatch-reminders", Interval: 30 * time.Second, Run: reminders.DispatchDueReminders})
+	sched.Register(scheduler.Job{Name: "dispatch-uploads", Interval: 5 * time.Second, Run: uploads.DispatchPendingUploads})
+	sched.Register(scheduler.Job{Name: "reconcile-storage", Interval: time.Hour, Run: uploads.Reconcile})
+	sched.Register(scheduler.Job{Name: "release-stalled-analyses", Interval: 5 * time.Minute, Run: func(ctx context.Context) error {
+		released, err := prescriptions.ReleaseStalledAnalyses(ctx, 15*time.Minute)
+		if released > 0 {
+			log.Printf("released %d prescriptions whose analysis stalled", released)
+		}
+		return err
+	}})
+	sched.Register(scheduler.Job{Name: "expire-prescriptions", Interval: 15 * time.Minute, Run: func(ctx context.Context) error {
+		expired, err := prescriptions.ExpirePrescriptions(ctx, time.Now(), validity.MedicineDays)
+		if expired > 0 {
+			log.Printf("expired %d prescriptions", expired)
+		}
+		return err
+	}})
+
+	go sched.Run(ctx)
+}
+
 func main() {
 
 	log.Println("Starting application...")
@@ -53,18 +95,18 @@ func main() {
 	}
 
 	// Get DATABASE_URL
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL is not set")
+	dbConfig, err := config.LoadDatabase()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Initialize DB
 	ctx := context.Background()
-	conn, err := database.InitDB(ctx, databaseURL)
+	conn, err := database.Connect(ctx, dbConfig.URL)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer conn.Close(ctx)
+	defer conn.Close()
 
 	// Run migrations
 	if err := database.RunMigrations(ctx, conn); err != nil {
@@ -73,8 +115,99 @@ func main() {
 
 	log.Println("Database ready")
 
+	// Load the local drug catalog used to normalise medicine names
+	if catalogFile := os.Getenv("DRUG_CATALOG_FILE"); catalogFile != "" {
+		drugs, err := services.LoadDrugCatalogFile(catalogFile)
+		if err != nil {
+			log.Fatalf("Failed to read drug catalog: %v", err)
+		}
+		count, err := services.NewDrugCatalogService(conn).ImportDrugs(ctx, drugs)
+		if err != nil {
+			log.Fatalf("Failed to import drug catalog: %v", err)
+		}
+		log.Printf("Drug catalog loaded (%d entries)", count)
+	}
+
+	// Load the local drug interaction dataset used to check prescriptions
+	if interactionsFile := os.Getenv("DRUG_INTERACTIONS_FILE"); interactionsFile != "" {
+		interactions, err := services.LoadInteractionsFile(interactionsFile)
+		if err != nil {
+			log.Fatalf("Failed to read drug interactions: %v", err)
+		}
+		count, err := services.NewInteractionService(conn).ImportInteractions(ctx, interactions)
+		if err != nil {
+			log.Fatalf("Failed to import drug interactions: %v", err)
+		}
+		log.Printf("Drug interactions loaded (%d entries)", count)
+	}
+
+	// Set up notification channels for reminders
+	notifiers, err := notify.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure notifications: %v", err)
+	}
+
+	// Set up object storage for uploaded files
+	storageConfig, err := config.LoadStorage()
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
+	store, err := storage.New(storageConfig)
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+	log.Printf("Using %s storage (bucket %q)", storageConfig.Driver, storageConfig.Bucket)
+	if storageConfig.SigningKeyGenerated {
+		log.Printf("STORAGE_SIGNING_KEY not set; using a temporary key, so file links stop working on restart and differ between instances")
+	}
+
+	// Set up malware scanning of uploads
+	fileScanner, err := scanner.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure file scanning: %v", err)
+	}
+	log.Printf("Scanning uploads with %s", fileScanner.Name())
+
+	// Uploaded PDFs are rendered locally before the AI analysis
+	if err := services.DefaultPDFRasterizer.Available(); err != nil {
+		log.Printf("%v; uploaded PDFs will be stored but not analyzed (install poppler-utils or set PDFTOPPM_PATH)", err)
+	}
+
+	// Set up the key finalized prescriptions are signed with
+	signingConfig, err := config.LoadSigning()
+	if err != nil {
+		log.Fatalf("Failed to configure prescription signing: %v", err)
+	}
+	signer := signing.NewSigner(signingConfig.PrivateKey)
+	if signer == nil {
+		log.Println("PRESCRIPTION_SIGNING_KEY not set; prescriptions cannot be finalized")
+	} else {
+		log.Printf("Signing finalized prescriptions with key %s", signer.KeyID())
+	}
+
+	// Default validity periods of finalized prescriptions
+	validity, err := config.LoadValidity()
+	if err != nil {
+		log.Fatalf("Failed to configure prescription validity: %v", err)
+	}
+
+	// Start background jobs
+	schedulerCtx, stopScheduler := context.WithCancel(ctx)
+	defer stopScheduler()
+	startScheduler(schedulerCtx, conn, notifiers, store, validity)
+
 	// Register routes BEFORE starting server
-	routes.RegisterRoutes(conn)
+	routes.RegisterRoutes(conn, routes.Dependencies{
+		Notifiers:       notifiers,
+		Store:           store,
+		Scanner:         fileScanner,
+		Signer:          signer,
+		SignedURLExpiry: storageConfig.SignedURLExpiry,
+		PublicBaseURL:   storageConfig.PublicBaseURL,
+		AdminAPIKey:     os.Getenv("ADMIN_API_KEY"),
+		Validity:        validity,
+		Hub:             realtime.NewHub(),
+	})
 
 	log.Printf("Server is running on port %s\n", port)
 
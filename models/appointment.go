@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Appointment statuses
+const (
+	AppointmentStatusBooked    = "booked"
+	AppointmentStatusCancelled = "cancelled"
+)
+
+// AvailabilityWindow is a weekly block of consultation hours, in the doctor's
+// time zone, split into slots of SlotMinutes. Weekday is 0 for Sunday; Start
+// and End are "HH:MM".
+type AvailabilityWindow struct {
+	Weekday     int    `json:"weekday"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	SlotMinutes int    `json:"slotMinutes"`
+}
+
+// AvailabilityException changes a doctor's weekly hours for one period: it
+// either blocks it (holidays, conferences) or, with Available, adds extra
+// slots of SlotMinutes.
+type AvailabilityException struct {
+	ID          int64     `db:"id" json:"id"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	DocID       int64     `db:"docId" json:"docId"`
+	StartsAt    time.Time `db:"startsAt" json:"startsAt"`
+	EndsAt      time.Time `db:"endsAt" json:"endsAt"`
+	Available   bool      `db:"available" json:"available"`
+	SlotMinutes int       `db:"slotMinutes" json:"slotMinutes,omitempty"`
+	Reason      string    `db:"reason" json:"reason,omitempty"`
+}
+
+// DoctorAvailability is a doctor's weekly availability template, the time
+// zone its hours are in, and the exceptions that have not ended yet.
+type DoctorAvailability struct {
+	DocID      int64                    `json:"docId"`
+	Timezone   string                   `json:"timezone"`
+	Windows    []AvailabilityWindow     `json:"windows"`
+	Exceptions []*AvailabilityException `json:"exceptions"`
+}
+
+// Slot is an open appointment time of a doctor.
+type Slot struct {
+	DocID      int64     `json:"docId"`
+	DoctorName string    `json:"doctorName"`
+	Speciality string    `json:"speciality"`
+	Timezone   string    `json:"timezone"`
+	StartsAt   time.Time `json:"startsAt"`
+	EndsAt     time.Time `json:"endsAt"`
+}
+
+// Appointment is a patient's booking of one of a doctor's slots. PresID links
+// it to the prescription that came out of the consultation.
+type Appointment struct {
+	ID          int64      `db:"id" json:"id"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	DocID       int64      `db:"docId" json:"docId"`
+	UserID      int64      `db:"userId" json:"userId"`
+	StartsAt    time.Time  `db:"startsAt" json:"startsAt"`
+	EndsAt      time.Time  `db:"endsAt" json:"endsAt"`
+	Status      string     `db:"status" json:"status"`
+	Reason      string     `db:"reason" json:"reason,omitempty"`
+	PresID      *int64     `db:"presId" json:"presId,omitempty"`
+	CancelledAt *time.Time `db:"cancelledAt" json:"cancelledAt,omitempty"`
+	CancelledBy string     `db:"cancelledBy" json:"cancelledBy,omitempty"`
+}
+
+// AppointmentBookRequest is the body of a booking: one of the slots offered for DocID.
+type AppointmentBookRequest struct {
+	DocID    int64     `json:"docId"`
+	StartsAt time.Time `json:"startsAt"`
+	Reason   string    `json:"reason"`
+}
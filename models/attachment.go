@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Attachment upload statuses
+const (
+	AttachmentStatusPending  = "pending"
+	AttachmentStatusUploaded = "uploaded"
+	AttachmentStatusFailed   = "failed"
+	// AttachmentStatusQuarantined marks a file flagged by the malware scanner.
+	// It is kept under a quarantine key for review and never served.
+	AttachmentStatusQuarantined = "quarantined"
+)
+
+// Attachment is a file uploaded with a prescription: an image or a PDF.
+// Pages is the page count of PDFs and 1 for images. Images also get a JPEG
+// thumbnail stored under ThumbnailKey. MessageID is set on files sent in the
+// prescription's message thread, which are not part of the prescription itself.
+type Attachment struct {
+	ID           int64     `db:"id" json:"id"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+	PresID       int64     `db:"presId" json:"presId"`
+	Position     int       `db:"position" json:"position"`
+	FileName     string    `db:"fileName" json:"fileName"`
+	ContentType  string    `db:"contentType" json:"contentType"`
+	Size         int64     `db:"size" json:"size"`
+	Pages        int       `db:"pages" json:"pages"`
+	ObjectKey    string    `db:"objectKey" json:"objectKey"`
+	ThumbnailKey string    `db:"thumbnailKey" json:"thumbnailKey,omitempty"`
+	Status       string    `db:"status" json:"status"`
+	MessageID    *int64    `db:"messageId" json:"messageId,omitempty"`
+}
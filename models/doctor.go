@@ -2,20 +2,29 @@ package models
 
 import "time"
 
-// Doctor represents a medical doctor
+// Doctor represents a medical doctor. Speciality is the name of the entry of
+// the speciality vocabulary given by SpecialityCode.
 type Doctor struct {
-	ID         int64     `db:"id" json:"id"`
-	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
-	Accuracy   float64   `db:"accuracy" json:"accuracy"`
-	Name       string    `db:"name" json:"name"`
-	PhnNumber  string    `db:"phnNumber" json:"phnNumber"`
-	Speciality string    `db:"speciality" json:"speciality"`
-	Username   string    `db:"username" json:"username"`
-	Email      string    `db:"email" json:"email"`
-	Password   string    `db:"password" json:"password,omitempty"`
-}
-
-// DoctorCreateRequest represents doctor registration data (without accuracy)
+	ID             int64     `db:"id" json:"id"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+	Accuracy       float64   `db:"accuracy" json:"accuracy"`
+	Name           string    `db:"name" json:"name"`
+	PhnNumber      string    `db:"phnNumber" json:"phnNumber"`
+	Speciality     string    `db:"speciality" json:"speciality"`
+	SpecialityCode string    `db:"specialityCode" json:"specialityCode,omitempty"`
+	Username       string    `db:"username" json:"username"`
+	Email          string    `db:"email" json:"email"`
+	Password       string    `db:"password" json:"password,omitempty"`
+}
+
+// Speciality is an entry of the controlled vocabulary of doctor specialities.
+type Speciality struct {
+	Code string `db:"code" json:"code"`
+	Name string `db:"name" json:"name"`
+}
+
+// DoctorCreateRequest represents doctor registration data (without accuracy).
+// Speciality is the code or name of a vocabulary entry.
 type DoctorCreateRequest struct {
 	Name       string `json:"name"`
 	PhnNumber  string `json:"phnNumber"`
@@ -25,6 +34,12 @@ type DoctorCreateRequest struct {
 	Password   string `json:"password"`
 }
 
+// DoctorProfileUpdateRequest changes a doctor's speciality, given as a
+// vocabulary code, name or alias. An empty speciality clears it.
+type DoctorProfileUpdateRequest struct {
+	Speciality string `json:"speciality"`
+}
+
 // DoctorLoginRequest represents doctor login credentials
 type DoctorLoginRequest struct {
 	Email    string `json:"email"`
@@ -41,3 +56,42 @@ type DoctorLoginResponse struct {
 	Accuracy   float64 `json:"accuracy"`
 	Token      string  `json:"token"`
 }
+
+// DoctorSearchQuery filters a doctor search. Query matches names and usernames
+// by prefix or trigram similarity; Speciality is a vocabulary code or name.
+// With Available, only doctors with an open slot between AvailableFrom and
+// AvailableTo are returned.
+type DoctorSearchQuery struct {
+	Query         string
+	Speciality    string
+	MinAccuracy   float64
+	Available     bool
+	AvailableFrom time.Time
+	AvailableTo   time.Time
+	Page          int
+	PageSize      int
+}
+
+// DoctorSearchHit is a doctor found by a search. Score is the name similarity
+// to the query; NextSlot is the earliest open slot when searching by availability.
+type DoctorSearchHit struct {
+	ID             int64   `json:"id"`
+	Name           string  `json:"name"`
+	Username       string  `json:"username"`
+	Speciality     string  `json:"speciality"`
+	SpecialityCode string  `json:"specialityCode,omitempty"`
+	Accuracy       float64 `json:"accuracy"`
+	Score          float64 `json:"score,omitempty"`
+	NextSlot       *Slot   `json:"nextSlot,omitempty"`
+}
+
+// DoctorSearchResult is one page of a doctor search and the total number of
+// matches. Truncated is set when a search by availability had more candidates
+// than it checks, so Total counts only the best of them.
+type DoctorSearchResult struct {
+	Doctors   []*DoctorSearchHit `json:"doctors"`
+	Total     int                `json:"total"`
+	Page      int                `json:"page"`
+	PageSize  int                `json:"pageSize"`
+	Truncated bool               `json:"truncated,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Dose statuses
+const (
+	DoseStatusPending = "pending"
+	DoseStatusTaken   = "taken"
+	DoseStatusSkipped = "skipped"
+)
+
+// Dose is a single scheduled administration of an approved medicine item
+type Dose struct {
+	ID          int64      `db:"id" json:"id"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	ItemID      int64      `db:"itemId" json:"itemId"`
+	PresID      int64      `db:"presId" json:"presId"`
+	UserID      int64      `db:"userId" json:"userId"`
+	ScheduledAt time.Time  `db:"scheduledAt" json:"scheduledAt"`
+	Amount      float64    `db:"amount" json:"amount"`
+	Status      string     `db:"status" json:"status"`
+	LoggedAt    *time.Time `db:"loggedAt" json:"loggedAt,omitempty"`
+	Note        string     `db:"note" json:"note"`
+}
+
+// DoseLogRequest represents a patient marking a dose as taken or skipped
+type DoseLogRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// ItemAdherence summarises dose adherence for one medicine item
+type ItemAdherence struct {
+	ItemID           int64    `json:"itemId"`
+	Name             string   `json:"name"`
+	Scheduled        int      `json:"scheduled"`
+	Due              int      `json:"due"`
+	Taken            int      `json:"taken"`
+	Skipped          int      `json:"skipped"`
+	Missed           int      `json:"missed"`
+	AdherencePercent *float64 `json:"adherencePercent"`
+}
+
+// PrescriptionAdherence summarises dose adherence across a prescription.
+// AdherencePercent is taken/due and is null until the first dose falls due.
+type PrescriptionAdherence struct {
+	PresID           int64            `json:"presId"`
+	Scheduled        int              `json:"scheduled"`
+	Due              int              `json:"due"`
+	Taken            int              `json:"taken"`
+	Skipped          int              `json:"skipped"`
+	Missed           int              `json:"missed"`
+	AdherencePercent *float64         `json:"adherencePercent"`
+	Items            []*ItemAdherence `json:"items"`
+}
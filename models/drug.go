@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Drug is an entry of the local drug catalog
+type Drug struct {
+	ID          int64     `db:"id" json:"id"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	GenericName string    `db:"genericName" json:"genericName"`
+	BrandNames  []string  `db:"brandNames" json:"brandNames"`
+	Strengths   []string  `db:"strengths" json:"strengths"`
+	Forms       []string  `db:"forms" json:"forms"`
+	ATCCode     string    `db:"atcCode" json:"atcCode"`
+}
+
+// DrugMatch is a catalog entry matched against a free-text medicine name.
+// Score is between 0 and 1, where 1 is an exact match on a generic or brand name.
+type DrugMatch struct {
+	Drug        *Drug   `json:"drug"`
+	MatchedName string  `json:"matchedName"`
+	Score       float64 `json:"score"`
+}
+
+// DrugSuggestion is an autocomplete entry for a generic or brand name
+type DrugSuggestion struct {
+	DrugID      int64  `json:"drugId"`
+	Name        string `json:"name"`
+	GenericName string `json:"genericName"`
+	IsBrand     bool   `json:"isBrand"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// PrescriptionVerification reports whether a finalized prescription still
+// matches the content that was signed. Reason explains a failed check.
+type PrescriptionVerification struct {
+	PresID       int64      `json:"presId"`
+	Status       string     `json:"status"`
+	Finalized    bool       `json:"finalized"`
+	Valid        bool       `json:"valid"`
+	Reason       string     `json:"reason,omitempty"`
+	FinalizedAt  *time.Time `json:"finalizedAt,omitempty"`
+	ContentHash  string     `json:"contentHash,omitempty"`
+	ComputedHash string     `json:"computedHash,omitempty"`
+	Signature    string     `json:"signature,omitempty"`
+	KeyID        string     `json:"keyId,omitempty"`
+	PublicKey    string     `json:"publicKey,omitempty"`
+}
+
+// ItemAmendment changes one item of a finalized prescription. Nil fields are
+// left as they are; Withdraw revokes the doctor's approval of the item.
+type ItemAmendment struct {
+	ItemID    int64         `json:"itemId"`
+	DocReason *string       `json:"docReason,omitempty"`
+	Dosage    *Dosage       `json:"dosage,omitempty"`
+	Refills   *RefillPolicy `json:"refills,omitempty"`
+	Withdraw  bool          `json:"withdraw,omitempty"`
+}
+
+// PrescriptionAmendment records a change to a finalized prescription and the
+// content hashes before and after it.
+type PrescriptionAmendment struct {
+	ID           int64           `db:"id" json:"id"`
+	CreatedAt    time.Time       `db:"created_at" json:"createdAt"`
+	PresID       int64           `db:"presId" json:"presId"`
+	DocID        int64           `db:"docId" json:"docId"`
+	Reason       string          `db:"reason" json:"reason"`
+	Changes      []ItemAmendment `db:"changes" json:"changes"`
+	PreviousHash string          `db:"previousHash" json:"previousHash"`
+	ContentHash  string          `db:"contentHash" json:"contentHash"`
+}
+
+// PublicVerification is what anyone holding a printed prescription learns by
+// checking its verification code: whether the copy is authentic and current,
+// and nothing about the patient or the items.
+type PublicVerification struct {
+	PresID      int64      `json:"presId"`
+	Valid       bool       `json:"valid"`
+	Status      string     `json:"status"`
+	FinalizedAt *time.Time `json:"finalizedAt"`
+	ValidUntil  *time.Time `json:"validUntil,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Pregnancy statuses
+const (
+	PregnancyUnknown       = "unknown"
+	PregnancyNotPregnant   = "not_pregnant"
+	PregnancyPregnant      = "pregnant"
+	PregnancyBreastfeeding = "breastfeeding"
+)
+
+// Allergy is a documented allergy or intolerance of a patient
+type Allergy struct {
+	Substance string `json:"substance"`
+	Reaction  string `json:"reaction"`
+	Severity  string `json:"severity"` // mild, moderate or severe
+}
+
+// Condition is a chronic or ongoing diagnosis of a patient
+type Condition struct {
+	Name  string `json:"name"`
+	Since string `json:"since,omitempty"` // YYYY or YYYY-MM-DD
+	Notes string `json:"notes,omitempty"`
+}
+
+// CurrentMedication is a medicine the patient takes outside this app's prescriptions
+type CurrentMedication struct {
+	Name      string `json:"name"`
+	Dose      string `json:"dose,omitempty"`
+	Frequency string `json:"frequency,omitempty"`
+}
+
+// HealthProfile holds the clinical context of a patient. DateOfBirth is YYYY-MM-DD.
+type HealthProfile struct {
+	UserID             int64               `db:"userId" json:"userId"`
+	DateOfBirth        string              `db:"dateOfBirth" json:"dateOfBirth"`
+	WeightKg           float64             `db:"weightKg" json:"weightKg"`
+	PregnancyStatus    string              `db:"pregnancyStatus" json:"pregnancyStatus"`
+	Allergies          []Allergy           `db:"allergies" json:"allergies"`
+	Conditions         []Condition         `db:"conditions" json:"conditions"`
+	CurrentMedications []CurrentMedication `db:"currentMedications" json:"currentMedications"`
+	UpdatedAt          time.Time           `db:"updated_at" json:"updatedAt"`
+}
+
+// AIPatientProfile is the part of the health profile sent to the AI service.
+// It carries the age rather than the date of birth.
+type AIPatientProfile struct {
+	AgeYears           int      `json:"age_years,omitempty"`
+	WeightKg           float64  `json:"weight_kg,omitempty"`
+	PregnancyStatus    string   `json:"pregnancy_status,omitempty"`
+	Allergies          []string `json:"allergies"`
+	Conditions         []string `json:"conditions"`
+	CurrentMedications []string `json:"current_medications"`
+}
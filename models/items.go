@@ -4,11 +4,37 @@ import "time"
 
 // Items represents medical items (medicines or tests) in a prescription
 type Items struct {
-	ID        int64     `db:"id" json:"id"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
-	Name      string    `db:"name" json:"name"`
-	Type      string    `db:"type" json:"type"`
-	AIReasons string    `db:"aiReasons" json:"aiReasons"`
-	DocReason string    `db:"docReason" json:"docReason"`
-	PresID    int64     `db:"presId" json:"presId"`
+	ID         int64     `db:"id" json:"id"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+	Name       string    `db:"name" json:"name"`
+	Type       string    `db:"type" json:"type"`
+	AIReasons  string    `db:"aiReasons" json:"aiReasons"`
+	DocReason  string    `db:"docReason" json:"docReason"`
+	PresID     int64     `db:"presId" json:"presId"`
+	Approved   bool      `db:"approved" json:"approved"`
+	CatalogID  *int64    `db:"catalogId" json:"catalogId,omitempty"`
+	MatchScore float64   `db:"matchScore" json:"matchScore"`
+	Dosage
+	RefillPolicy
+}
+
+// Dosage holds the structured administration details of a medicine item.
+// Quantity is the total number of dose units to dispense for the course.
+type Dosage struct {
+	DoseAmount   float64 `db:"doseAmount" json:"doseAmount"`
+	DoseUnit     string  `db:"doseUnit" json:"doseUnit"`
+	Route        string  `db:"route" json:"route"`
+	Frequency    string  `db:"frequency" json:"frequency"`
+	TimesPerDay  int     `db:"timesPerDay" json:"timesPerDay"`
+	AsNeeded     bool    `db:"asNeeded" json:"asNeeded"`
+	DurationDays int     `db:"durationDays" json:"durationDays"`
+	Quantity     float64 `db:"quantity" json:"quantity"`
+	Instructions string  `db:"instructions" json:"instructions"`
+}
+
+// RefillPolicy lets the patient request an approved medicine again. Refills is
+// how many times, RefillIntervalDays the minimum number of days between fills.
+type RefillPolicy struct {
+	Refills            int `db:"refills" json:"refills,omitempty"`
+	RefillIntervalDays int `db:"refillIntervalDays" json:"refillIntervalDays,omitempty"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Message is one message in the thread of a prescription between its patient
+// and assigned doctor. SenderRole is "user" or "doctor". ReadAt is set once the
+// other side has read it.
+type Message struct {
+	ID         int64       `db:"id" json:"id"`
+	CreatedAt  time.Time   `db:"created_at" json:"createdAt"`
+	PresID     int64       `db:"presId" json:"presId"`
+	SenderRole string      `db:"senderRole" json:"senderRole"`
+	SenderID   int64       `db:"senderId" json:"senderId"`
+	Body       string      `db:"body" json:"body"`
+	ReadAt     *time.Time  `db:"readAt" json:"readAt,omitempty"`
+	Attachment *Attachment `json:"attachment,omitempty"`
+}
+
+// MessageReadReceipt reports messages of a thread marked read by one side, up
+// to and including message UpTo.
+type MessageReadReceipt struct {
+	PresID     int64     `json:"presId"`
+	ReaderRole string    `json:"readerRole"`
+	UpTo       int64     `json:"upTo"`
+	Count      int       `json:"count"`
+	ReadAt     time.Time `json:"readAt"`
+}
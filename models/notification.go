@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Reminder kinds
+const (
+	ReminderKindDose     = "dose"
+	ReminderKindFollowUp = "followup"
+)
+
+// Reminder statuses
+const (
+	ReminderStatusPending   = "pending"
+	ReminderStatusSending   = "sending"
+	ReminderStatusSent      = "sent"
+	ReminderStatusFailed    = "failed"
+	ReminderStatusCancelled = "cancelled"
+)
+
+// NotificationPreferences holds a patient's reminder settings. QuietStart and
+// QuietEnd are "HH:MM" wall-clock times in Timezone; reminders falling inside
+// the window are held until it ends.
+type NotificationPreferences struct {
+	UserID            int64           `db:"userId" json:"userId"`
+	Channels          []string        `db:"channels" json:"channels"`
+	Email             string          `db:"email" json:"email"`
+	PhnNumber         string          `db:"phnNumber" json:"phnNumber"`
+	Timezone          string          `db:"timezone" json:"timezone"`
+	QuietStart        string          `db:"quietStart" json:"quietStart"`
+	QuietEnd          string          `db:"quietEnd" json:"quietEnd"`
+	PushSubscription  json.RawMessage `db:"pushSubscription" json:"pushSubscription,omitempty"`
+	DoseReminders     bool            `db:"doseReminders" json:"doseReminders"`
+	FollowUpReminders bool            `db:"followUpReminders" json:"followUpReminders"`
+	LeadMinutes       int             `db:"leadMinutes" json:"leadMinutes"`
+	UpdatedAt         time.Time       `db:"updated_at" json:"updatedAt"`
+}
+
+// Reminder is a queued notification for an upcoming dose or prescription follow-up
+type Reminder struct {
+	ID          int64      `db:"id" json:"id"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	UserID      int64      `db:"userId" json:"userId"`
+	Kind        string     `db:"kind" json:"kind"`
+	RefID       int64      `db:"refId" json:"refId"`
+	DueAt       time.Time  `db:"dueAt" json:"dueAt"`
+	Status      string     `db:"status" json:"status"`
+	Attempts    int        `db:"attempts" json:"attempts"`
+	LastError   string     `db:"lastError" json:"lastError"`
+	SentAt      *time.Time `db:"sentAt" json:"sentAt,omitempty"`
+	Channels    string     `db:"channels" json:"channels"`
+	LockedBy    string     `db:"lockedBy" json:"-"`
+	LockedUntil *time.Time `db:"lockedUntil" json:"-"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// Lab result flags
+const (
+	LabFlagNormal       = "N"
+	LabFlagLow          = "L"
+	LabFlagHigh         = "H"
+	LabFlagCriticalLow  = "LL"
+	LabFlagCriticalHigh = "HH"
+	LabFlagAbnormal     = "A"
+)
+
+// Timeline entry kinds
+const (
+	TimelineKindVital        = "vital"
+	TimelineKindLab          = "lab"
+	TimelineKindPrescription = "prescription"
+)
+
+// Vital is a single vital sign reading. Blood pressure stores the systolic value
+// in Value and the diastolic value in SecondaryValue.
+type Vital struct {
+	ID             int64     `db:"id" json:"id"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+	UserID         int64     `db:"userId" json:"userId"`
+	Type           string    `db:"type" json:"type"`
+	Code           string    `db:"code" json:"code"`
+	Value          float64   `db:"value" json:"value"`
+	SecondaryValue *float64  `db:"secondaryValue" json:"secondaryValue,omitempty"`
+	Unit           string    `db:"unit" json:"unit"`
+	MeasuredAt     time.Time `db:"measuredAt" json:"measuredAt"`
+	Context        string    `db:"context" json:"context,omitempty"`
+	Note           string    `db:"note" json:"note,omitempty"`
+	Source         string    `db:"source" json:"source"`
+	RecordedBy     int64     `db:"recordedBy" json:"recordedBy"`
+}
+
+// LabResult is one analyte of a lab report. Code is a LOINC-style identifier.
+// Numeric results use Value; qualitative ones ("positive") use ValueText.
+type LabResult struct {
+	ID          int64     `db:"id" json:"id"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	UserID      int64     `db:"userId" json:"userId"`
+	PresID      *int64    `db:"presId" json:"presId,omitempty"`
+	Code        string    `db:"code" json:"code"`
+	Name        string    `db:"name" json:"name"`
+	Value       *float64  `db:"value" json:"value,omitempty"`
+	ValueText   string    `db:"valueText" json:"valueText,omitempty"`
+	Unit        string    `db:"unit" json:"unit"`
+	RefLow      *float64  `db:"refLow" json:"refLow,omitempty"`
+	RefHigh     *float64  `db:"refHigh" json:"refHigh,omitempty"`
+	RefText     string    `db:"refText" json:"refText,omitempty"`
+	Flag        string    `db:"flag" json:"flag"`
+	CollectedAt time.Time `db:"collectedAt" json:"collectedAt"`
+	Lab         string    `db:"lab" json:"lab,omitempty"`
+	Note        string    `db:"note" json:"note,omitempty"`
+	Source      string    `db:"source" json:"source"`
+	RecordedBy  int64     `db:"recordedBy" json:"recordedBy"`
+}
+
+// TimelineEntry is one event of a patient's history. Data holds the underlying
+// Vital, LabResult or Prescription.
+type TimelineEntry struct {
+	Kind     string      `json:"kind"`
+	At       time.Time   `json:"at"`
+	ID       int64       `json:"id"`
+	Summary  string      `json:"summary"`
+	Abnormal bool        `json:"abnormal"`
+	Data     interface{} `json:"data"`
+}
+
+// ImportResult reports how many rows of a CSV import were stored.
+type ImportResult struct {
+	Imported int `json:"imported"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Pharmacy is a dispensing pharmacy. Patients share finalized prescriptions
+// with a pharmacy, which then records what it dispensed.
+type Pharmacy struct {
+	ID            int64     `db:"id" json:"id"`
+	CreatedAt     time.Time `db:"created_at" json:"createdAt"`
+	Name          string    `db:"name" json:"name"`
+	LicenseNumber string    `db:"licenseNumber" json:"licenseNumber"`
+	Address       string    `db:"address" json:"address"`
+	PhnNumber     string    `db:"phnNumber" json:"phnNumber"`
+	Email         string    `db:"email" json:"email"`
+	Password      string    `db:"password" json:"password,omitempty"`
+}
+
+// PharmacyCreateRequest represents pharmacy registration data
+type PharmacyCreateRequest struct {
+	Name          string `json:"name"`
+	LicenseNumber string `json:"licenseNumber"`
+	Address       string `json:"address"`
+	PhnNumber     string `json:"phnNumber"`
+	Email         string `json:"email"`
+	Password      string `json:"password"`
+}
+
+// PharmacyLoginResponse represents the response after successful pharmacy login
+type PharmacyLoginResponse struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	LicenseNumber string `json:"licenseNumber"`
+	Token         string `json:"token"`
+}
+
+// PrescriptionShare grants a pharmacy access to one prescription until the
+// patient revokes it.
+type PrescriptionShare struct {
+	ID         int64      `db:"id" json:"id"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	PresID     int64      `db:"presId" json:"presId"`
+	PharmacyID int64      `db:"pharmacyId" json:"pharmacyId"`
+	UserID     int64      `db:"userId" json:"userId"`
+	RevokedAt  *time.Time `db:"revokedAt" json:"revokedAt,omitempty"`
+}
+
+// Dispensing statuses of an item
+const (
+	DispensingStatusNone     = "not_dispensed"
+	DispensingStatusPartial  = "partial"
+	DispensingStatusComplete = "dispensed"
+)
+
+// Dispensing records a quantity of one item handed out by a pharmacy.
+type Dispensing struct {
+	ID          int64     `db:"id" json:"id"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+	PresID      int64     `db:"presId" json:"presId"`
+	ItemID      int64     `db:"itemId" json:"itemId"`
+	PharmacyID  int64     `db:"pharmacyId" json:"pharmacyId"`
+	Quantity    float64   `db:"quantity" json:"quantity"`
+	BatchNumber string    `db:"batchNumber" json:"batchNumber"`
+	Note        string    `db:"note" json:"note,omitempty"`
+}
+
+// ItemDispensing is the dispensing state of one approved medicine. Prescribed
+// is zero when the prescription gives no countable quantity; such an item is
+// dispensed in one go.
+type ItemDispensing struct {
+	ItemID      int64         `json:"itemId"`
+	Name        string        `json:"name"`
+	Prescribed  float64       `json:"prescribed"`
+	Dispensed   float64       `json:"dispensed"`
+	Remaining   float64       `json:"remaining"`
+	Status      string        `json:"status"`
+	Dispensings []*Dispensing `json:"dispensings"`
+}
+
+// PrescriptionDispensing summarises the dispensing of a prescription. Status is
+// not_dispensed until anything is handed out, dispensed once every item is and
+// partial in between.
+type PrescriptionDispensing struct {
+	PresID int64             `json:"presId"`
+	Status string            `json:"status"`
+	Items  []*ItemDispensing `json:"items"`
+}
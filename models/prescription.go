@@ -2,15 +2,75 @@ package models
 
 import "time"
 
-// Prescription represents a medical prescription
+// Prescription lifecycle statuses
+const (
+	PrescriptionStatusSubmitted      = "submitted"
+	PrescriptionStatusAnalyzing      = "analyzing"
+	PrescriptionStatusAwaitingReview = "awaiting_review"
+	PrescriptionStatusReviewed       = "reviewed"
+	PrescriptionStatusFinalized      = "finalized"
+	PrescriptionStatusCancelled      = "cancelled"
+	PrescriptionStatusExpired        = "expired"
+)
+
+// Outcomes of the AI analysis of an uploaded prescription
+const (
+	AnalysisStatusCompleted = "completed"
+	// AnalysisStatusPartial means some files could not be read and were left out.
+	AnalysisStatusPartial = "partial"
+	AnalysisStatusFailed  = "failed"
+)
+
+// StatusActorSystem is the actor role recorded for status changes made by the
+// server itself, such as the AI analysis moving a prescription along.
+const StatusActorSystem = "system"
+
+// Prescription represents a medical prescription. ObjectKey names the first
+// uploaded file in the private store; Link is only set on rows that predate it.
+// A finalized prescription and its items can only change through an amendment.
 type Prescription struct {
-	ID            int64     `db:"id" json:"id"`
-	CreatedAt     time.Time `db:"created_at" json:"createdAt"`
-	Symptoms      string    `db:"symptoms" json:"symptoms"`
-	Link          string    `db:"link" json:"link"`
-	UserID        int64     `db:"userId" json:"userId"`
-	DocID         int64     `db:"docId" json:"docId"`
-	SeenByPatient bool      `db:"seenByPatient" json:"seenByPatient"`
+	ID              int64      `db:"id" json:"id"`
+	CreatedAt       time.Time  `db:"created_at" json:"createdAt"`
+	Symptoms        string     `db:"symptoms" json:"symptoms"`
+	Link            string     `db:"link" json:"link"`
+	ObjectKey       string     `db:"objectKey" json:"objectKey"`
+	UserID          int64      `db:"userId" json:"userId"`
+	DocID           int64      `db:"docId" json:"docId"`
+	SeenByPatient   bool       `db:"seenByPatient" json:"seenByPatient"`
+	FollowUpAt      *time.Time `db:"followUpAt" json:"followUpAt,omitempty"`
+	Status          string     `db:"status" json:"status"`
+	StatusChangedAt time.Time  `db:"statusChangedAt" json:"statusChangedAt"`
+	// Set once the doctor finalizes the prescription: ContentHash is the SHA-256
+	// of its canonical content and Signature the deployment key's signature of it.
+	FinalizedAt  *time.Time `db:"finalizedAt" json:"finalizedAt,omitempty"`
+	ContentHash  string     `db:"contentHash" json:"contentHash,omitempty"`
+	Signature    string     `db:"signature" json:"signature,omitempty"`
+	SigningKeyID string     `db:"signingKeyId" json:"signingKeyId,omitempty"`
+	// ParentPresID is set on a prescription issued by approving a refill of another.
+	ParentPresID *int64 `db:"parentPresId" json:"parentPresId,omitempty"`
+	// ValidUntil is set at finalization; afterwards the prescription expires and
+	// can no longer be dispensed or refilled.
+	ValidUntil *time.Time `db:"validUntil" json:"validUntil,omitempty"`
+	// AnalysisStatus is set once the AI analysis ends; AnalysisError says why
+	// it failed or which files it left out.
+	AnalysisStatus string `db:"analysisStatus" json:"analysisStatus,omitempty"`
+	AnalysisError  string `db:"analysisError" json:"analysisError,omitempty"`
+	// UnreadMessages is filled in by the list endpoints: the messages in the
+	// prescription's thread that the patient or doctor listing it has not read.
+	UnreadMessages int `db:"-" json:"unreadMessages,omitempty"`
+}
+
+// PrescriptionStatusChange is one entry of a prescription's status history.
+// ActorRole is "user", "doctor" or StatusActorSystem; ActorID is 0 for the system.
+type PrescriptionStatusChange struct {
+	ID         int64     `db:"id" json:"id"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+	PresID     int64     `db:"presId" json:"presId"`
+	FromStatus string    `db:"fromStatus" json:"fromStatus"`
+	ToStatus   string    `db:"toStatus" json:"toStatus"`
+	ActorRole  string    `db:"actorRole" json:"actorRole"`
+	ActorID    int64     `db:"actorId" json:"actorId"`
+	Note       string    `db:"note" json:"note,omitempty"`
 }
 type Test struct {
 	Name       string  `json:"name"`
@@ -38,8 +98,12 @@ type AIResponse struct {
 	Medicines map[string]Medicine `json:"medicines"`
 }
 
+// AIRequest is sent to the AI service. File holds the first page for older
+// service versions; Files holds every page in upload order.
 type AIRequest struct {
-	File             string `json:"file"`
-	Symptoms         string `json:"symptoms"`
-	DoctorSpeciality string `json:"doctor_speciality"`
+	File             string            `json:"file"`
+	Files            []string          `json:"files,omitempty"`
+	Symptoms         string            `json:"symptoms"`
+	DoctorSpeciality string            `json:"doctor_speciality"`
+	PatientProfile   *AIPatientProfile `json:"patient_profile,omitempty"`
 }
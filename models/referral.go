@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Referral kinds
+const (
+	// ReferralKindSecondOpinion asks another doctor to review a prescription;
+	// the referring doctor stays assigned.
+	ReferralKindSecondOpinion = "second_opinion"
+	// ReferralKindHandoff makes the referred doctor the assigned doctor once they accept.
+	ReferralKindHandoff = "handoff"
+)
+
+// Referral statuses
+const (
+	ReferralStatusPending   = "pending"
+	ReferralStatusAccepted  = "accepted"
+	ReferralStatusDeclined  = "declined"
+	ReferralStatusCompleted = "completed"
+	ReferralStatusCancelled = "cancelled"
+)
+
+// Referral is the assigned doctor of a prescription asking another doctor for
+// a second opinion on it, or handing it over to them. ResponseNote is the
+// referred doctor's answer when accepting or declining, Opinion their summary
+// when completing a second opinion.
+type Referral struct {
+	ID           int64      `db:"id" json:"id"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	PresID       int64      `db:"presId" json:"presId"`
+	FromDocID    int64      `db:"fromDocId" json:"fromDocId"`
+	ToDocID      int64      `db:"toDocId" json:"toDocId"`
+	Kind         string     `db:"kind" json:"kind"`
+	Status       string     `db:"status" json:"status"`
+	Reason       string     `db:"reason" json:"reason"`
+	ResponseNote string     `db:"responseNote" json:"responseNote,omitempty"`
+	RespondedAt  *time.Time `db:"respondedAt" json:"respondedAt,omitempty"`
+	Opinion      string     `db:"opinion" json:"opinion,omitempty"`
+	CompletedAt  *time.Time `db:"completedAt" json:"completedAt,omitempty"`
+}
+
+// ReferralCreateRequest is the body of a referral. The referred doctor is
+// given by ToDocID or ToUsername; with only Speciality, the most accurate
+// doctor of that speciality is chosen.
+type ReferralCreateRequest struct {
+	ToDocID    int64  `json:"toDocId"`
+	ToUsername string `json:"toUsername"`
+	Speciality string `json:"speciality"`
+	Kind       string `json:"kind"`
+	Reason     string `json:"reason"`
+}
+
+// ItemNote is one doctor's note on an item. Every doctor with access to the
+// prescription keeps their own note, separate from the assigned doctor's docReason.
+type ItemNote struct {
+	ID        int64     `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+	ItemID    int64     `db:"itemId" json:"itemId"`
+	PresID    int64     `db:"presId" json:"presId"`
+	DocID     int64     `db:"docId" json:"docId"`
+	Note      string    `db:"note" json:"note"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Refill request statuses
+const (
+	RefillStatusPending  = "pending"
+	RefillStatusApproved = "approved"
+	RefillStatusDenied   = "denied"
+)
+
+// RefillRequest is a patient asking the doctor for more of the refillable
+// medicines on a finalized prescription. Approving it issues a child
+// prescription, ChildPresID, holding copies of those items.
+type RefillRequest struct {
+	ID          int64      `db:"id" json:"id"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	PresID      int64      `db:"presId" json:"presId"`
+	UserID      int64      `db:"userId" json:"userId"`
+	DocID       int64      `db:"docId" json:"docId"`
+	ItemIDs     []int64    `db:"itemIds" json:"itemIds"`
+	Status      string     `db:"status" json:"status"`
+	Note        string     `db:"note" json:"note,omitempty"`
+	DocNote     string     `db:"docNote" json:"docNote,omitempty"`
+	DecidedAt   *time.Time `db:"decidedAt" json:"decidedAt,omitempty"`
+	ChildPresID *int64     `db:"childPresId" json:"childPresId,omitempty"`
+}
+
+// RefillCreateRequest is the body of a refill request. An empty ItemIDs asks
+// for every medicine that still has refills left.
+type RefillCreateRequest struct {
+	ItemIDs []int64 `json:"itemIds"`
+	Note    string  `json:"note"`
+}
+
+// ItemRefillStatus reports how many refills of an item are left and when the
+// next one can be requested.
+type ItemRefillStatus struct {
+	ItemID             int64      `json:"itemId"`
+	Name               string     `json:"name"`
+	Refills            int        `json:"refills"`
+	RefillIntervalDays int        `json:"refillIntervalDays"`
+	Used               int        `json:"used"`
+	Remaining          int        `json:"remaining"`
+	NextEligibleAt     *time.Time `json:"nextEligibleAt,omitempty"`
+}
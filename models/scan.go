@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ScanResult records the malware scan of an uploaded file. Verdict is clean,
+// infected or error (not scanned, accepted because scanning fails open).
+type ScanResult struct {
+	ID           int64     `db:"id" json:"id"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+	PresID       int64     `db:"presId" json:"presId"`
+	AttachmentID int64     `db:"attachmentId" json:"attachmentId"`
+	FileName     string    `db:"fileName" json:"fileName"`
+	SHA256       string    `db:"sha256" json:"sha256"`
+	Size         int64     `db:"size" json:"size"`
+	Scanner      string    `db:"scanner" json:"scanner"`
+	Verdict      string    `db:"verdict" json:"verdict"`
+	Signature    string    `db:"signature" json:"signature,omitempty"`
+	Detail       string    `db:"detail" json:"detail,omitempty"`
+	DurationMs   int64     `db:"durationMs" json:"durationMs"`
+}
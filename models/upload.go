@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Upload job statuses
+const (
+	UploadStatusPending   = "pending"
+	UploadStatusUploading = "uploading"
+	UploadStatusDone      = "done"
+	UploadStatusFailed    = "failed"
+)
+
+// Upload job kinds
+const (
+	UploadKindOriginal  = "original"
+	UploadKindThumbnail = "thumbnail"
+)
+
+// Storage issue kinds found by reconciliation
+const (
+	StorageIssueMissingFile  = "missing_file"
+	StorageIssueOrphanObject = "orphan_object"
+)
+
+// UploadJob is an outbox entry that stores one attachment in the object store.
+// The file bytes stay in the outbox until the upload succeeds.
+type UploadJob struct {
+	ID            int64      `db:"id" json:"id"`
+	CreatedAt     time.Time  `db:"created_at" json:"createdAt"`
+	AttachmentID  int64      `db:"attachmentId" json:"attachmentId"`
+	PresID        int64      `db:"presId" json:"presId"`
+	Kind          string     `db:"kind" json:"kind"`
+	ObjectKey     string     `db:"objectKey" json:"objectKey"`
+	ContentType   string     `db:"contentType" json:"contentType"`
+	Size          int64      `db:"size" json:"size"`
+	Status        string     `db:"status" json:"status"`
+	Attempts      int        `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time  `db:"nextAttemptAt" json:"nextAttemptAt"`
+	LastError     string     `db:"lastError" json:"lastError,omitempty"`
+	CompletedAt   *time.Time `db:"completedAt" json:"completedAt,omitempty"`
+	Data          []byte     `db:"data" json:"-"`
+}
+
+// StorageIssue is a prescription file missing from storage or a stored object
+// no prescription refers to.
+type StorageIssue struct {
+	Kind         string    `db:"kind" json:"kind"`
+	PresID       *int64    `db:"presId" json:"presId,omitempty"`
+	AttachmentID *int64    `db:"attachmentId" json:"attachmentId,omitempty"`
+	ObjectKey    string    `db:"objectKey" json:"objectKey,omitempty"`
+	Size         int64     `db:"size" json:"size,omitempty"`
+	Detail       string    `db:"detail" json:"detail"`
+	DetectedAt   time.Time `db:"detectedAt" json:"detectedAt"`
+}
+
+// StorageReport summarises the upload pipeline for administrators.
+type StorageReport struct {
+	GeneratedAt      time.Time       `json:"generatedAt"`
+	LastReconciledAt *time.Time      `json:"lastReconciledAt,omitempty"`
+	ReconcileError   string          `json:"reconcileError,omitempty"`
+	PendingUploads   int             `json:"pendingUploads"`
+	FailedUploads    []*UploadJob    `json:"failedUploads"`
+	MissingFiles     []*StorageIssue `json:"missingFiles"`
+	OrphanObjects    []*StorageIssue `json:"orphanObjects"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// PrescriptionVersion is one recorded state of a prescription and its items.
+// Version 1 is the state at creation; every later change adds a version with
+// the actor, the reason and the fields that changed. Snapshot is only filled
+// when a single version is fetched.
+type PrescriptionVersion struct {
+	ID        int64                 `db:"id" json:"id"`
+	CreatedAt time.Time             `db:"created_at" json:"createdAt"`
+	PresID    int64                 `db:"presId" json:"presId"`
+	Version   int                   `db:"version" json:"version"`
+	ActorRole string                `db:"actorRole" json:"actorRole"`
+	ActorID   int64                 `db:"actorId" json:"actorId"`
+	Reason    string                `db:"reason" json:"reason,omitempty"`
+	Diff      []FieldChange         `db:"diff" json:"diff"`
+	Snapshot  *PrescriptionSnapshot `db:"snapshot" json:"snapshot,omitempty"`
+}
+
+// PrescriptionSnapshot is the content of a prescription at one version.
+type PrescriptionSnapshot struct {
+	DocID      int64          `json:"docId"`
+	Symptoms   string         `json:"symptoms"`
+	Status     string         `json:"status"`
+	FollowUpAt *time.Time     `json:"followUpAt"`
+	Items      []SnapshotItem `json:"items"`
+}
+
+// SnapshotItem is an item as recorded in a PrescriptionSnapshot.
+type SnapshotItem struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	DocReason string `json:"docReason"`
+	Approved  bool   `json:"approved"`
+	CatalogID *int64 `json:"catalogId"`
+	Dosage
+	RefillPolicy
+}
+
+// FieldChange is one difference between two snapshots. Field is a path such as
+// "status" or "items[12].docReason"; an added or removed item has Field
+// "items[12]" and a nil Old or New.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
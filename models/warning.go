@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Warning severities, from least to most serious
+const (
+	SeverityMinor           = "minor"
+	SeverityModerate        = "moderate"
+	SeverityMajor           = "major"
+	SeverityContraindicated = "contraindicated"
+)
+
+// Warning kinds
+const (
+	WarningKindInteraction = "interaction"
+	WarningKindAllergy     = "allergy"
+)
+
+// SeverityRank orders severities so warnings can be ranked; unknown values rank lowest.
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityContraindicated:
+		return 4
+	case SeverityMajor:
+		return 3
+	case SeverityModerate:
+		return 2
+	case SeverityMinor:
+		return 1
+	}
+	return 0
+}
+
+// DrugInteraction is an entry of the local interaction dataset. DrugA and DrugB
+// are normalised generic names stored in alphabetical order.
+type DrugInteraction struct {
+	ID          int64  `db:"id" json:"id"`
+	DrugA       string `db:"drugA" json:"drugA"`
+	DrugB       string `db:"drugB" json:"drugB"`
+	Severity    string `db:"severity" json:"severity"`
+	Description string `db:"description" json:"description"`
+}
+
+// PrescriptionWarning is a clinical warning attached to a prescription item that
+// the doctor should review before approving it.
+type PrescriptionWarning struct {
+	ID             int64      `db:"id" json:"id"`
+	CreatedAt      time.Time  `db:"created_at" json:"createdAt"`
+	PresID         int64      `db:"presId" json:"presId"`
+	ItemID         int64      `db:"itemId" json:"itemId"`
+	Kind           string     `db:"kind" json:"kind"`
+	Severity       string     `db:"severity" json:"severity"`
+	OtherItemID    *int64     `db:"otherItemId" json:"otherItemId,omitempty"`
+	OtherPresID    *int64     `db:"otherPresId" json:"otherPresId,omitempty"`
+	Subject        string     `db:"subject" json:"subject"`
+	Description    string     `db:"description" json:"description"`
+	AcknowledgedAt *time.Time `db:"acknowledgedAt" json:"acknowledgedAt,omitempty"`
+	AcknowledgedBy *int64     `db:"acknowledgedBy" json:"acknowledgedBy,omitempty"`
+}
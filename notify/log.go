@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogNotifier is a local stand-in that writes notifications to the application
+// log, or appends them as JSON lines to a file when Path is set.
+type LogNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewLogNotifier(path string) *LogNotifier {
+	return &LogNotifier{Path: path}
+}
+
+func (n *LogNotifier) Channel() string {
+	return ChannelLog
+}
+
+func (n *LogNotifier) Send(ctx context.Context, to Recipient, msg Message) error {
+	if n.Path == "" {
+		log.Printf("notification for user %d: %s - %s", to.UserID, msg.Subject, msg.Body)
+		return nil
+	}
+
+	entry, err := json.Marshal(map[string]interface{}{
+		"sentAt":  time.Now().UTC(),
+		"userId":  to.UserID,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+		"data":    msg.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(entry, '\n'))
+	return err
+}
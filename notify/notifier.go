@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+)
+
+// Channel names used in notification preferences.
+const (
+	ChannelLog   = "log"
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelPush  = "push"
+)
+
+// ErrNoAddress is returned when a recipient has no address for the notifier's channel.
+var ErrNoAddress = errors.New("recipient has no address for this channel")
+
+// Recipient identifies who a notification is delivered to on each channel.
+type Recipient struct {
+	UserID           int64
+	Name             string
+	Email            string
+	Phone            string
+	PushSubscription string // JSON Web Push subscription as produced by PushManager.subscribe()
+}
+
+// Message is the channel-independent content of a notification.
+type Message struct {
+	Subject string
+	Body    string
+	Data    map[string]string
+}
+
+// Notifier delivers messages over a single channel.
+type Notifier interface {
+	Channel() string
+	Send(ctx context.Context, to Recipient, msg Message) error
+}
+
+// NewFromEnv builds the notifiers whose settings are present in the environment,
+// keyed by channel. The log notifier is always available so reminders have
+// somewhere to go in local development.
+func NewFromEnv() (map[string]Notifier, error) {
+	notifiers := map[string]Notifier{
+		ChannelLog: NewLogNotifier(os.Getenv("NOTIFY_LOG_FILE")),
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+		notifiers[ChannelEmail] = &EmailNotifier{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+	}
+
+	if gateway := os.Getenv("SMS_GATEWAY_URL"); gateway != "" {
+		notifiers[ChannelSMS] = &SMSNotifier{
+			GatewayURL: gateway,
+			Token:      os.Getenv("SMS_GATEWAY_TOKEN"),
+			Sender:     os.Getenv("SMS_SENDER"),
+		}
+	}
+
+	if privateKey := os.Getenv("VAPID_PRIVATE_KEY"); privateKey != "" {
+		push, err := NewWebPushNotifier(privateKey, os.Getenv("VAPID_SUBJECT"))
+		if err != nil {
+			return nil, err
+		}
+		notifiers[ChannelPush] = push
+	}
+
+	return notifiers, nil
+}
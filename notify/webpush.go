@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pushRecordSize is the aes128gcm record size advertised in the payload header.
+const pushRecordSize = 4096
+
+// pushSubscription is the JSON produced by PushManager.subscribe() in the browser.
+type pushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// WebPushNotifier delivers encrypted Web Push messages (RFC 8291) authenticated
+// with VAPID (RFC 8292).
+type WebPushNotifier struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  string
+	subject    string
+	Client     *http.Client
+}
+
+// NewWebPushNotifier creates a notifier from a base64url-encoded raw P-256 VAPID
+// private key. subject is the contact URI sent to push services (mailto: or https:).
+func NewWebPushNotifier(vapidPrivateKey, subject string) (*WebPushNotifier, error) {
+	raw, err := decodeBase64URL(vapidPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	privateKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	publicKey, err := privateKey.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if subject == "" {
+		subject = "mailto:admin@localhost"
+	}
+
+	return &WebPushNotifier{
+		privateKey: privateKey,
+		publicKey:  base64.RawURLEncoding.EncodeToString(publicKey),
+		subject:    subject,
+	}, nil
+}
+
+// PublicKey returns the VAPID application server key browsers subscribe with.
+func (n *WebPushNotifier) PublicKey() string {
+	return n.publicKey
+}
+
+func (n *WebPushNotifier) Channel() string {
+	return ChannelPush
+}
+
+func (n *WebPushNotifier) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.PushSubscription == "" {
+		return ErrNoAddress
+	}
+
+	var sub pushSubscription
+	if err := json.Unmarshal([]byte(to.PushSubscription), &sub); err != nil {
+		return fmt.Errorf("invalid push subscription: %w", err)
+	}
+	if sub.Endpoint == "" || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		return errors.New("invalid push subscription: endpoint and keys are required")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"title": msg.Subject,
+		"body":  msg.Body,
+		"data":  msg.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := encryptPushPayload(payload, sub.Keys.P256dh, sub.Keys.Auth)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := n.vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "3600")
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", authorization)
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("push service error: status=%d body=%s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// vapidAuthorization builds the "vapid t=..., k=..." header for the push service origin.
+func (n *WebPushNotifier) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": n.subject,
+	})
+	signed, err := token.SignedString(n.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, n.publicKey), nil
+}
+
+// encryptPushPayload encrypts payload for a subscription using the aes128gcm
+// content coding (RFC 8188) with the Web Push key derivation from RFC 8291.
+func encryptPushPayload(payload []byte, p256dh, authSecret string) ([]byte, error) {
+	uaPublicBytes, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	auth, err := decodeBase64URL(authSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	curve := ecdh.P256()
+	uaPublic, err := curve.NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	asPrivate, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public, 32)
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, auth)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublicBytes) + string(asPublicBytes)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record: the payload followed by the 0x02 last-record delimiter.
+	if len(payload)+1+gcm.Overhead() > pushRecordSize {
+		return nil, errors.New("push payload too large")
+	}
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	// Header: salt (16) || record size (4) || key id length (1) || key id (as_public).
+	header := make([]byte, 0, 21+len(asPublicBytes))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(asPublicBytes)))
+	header = append(header, asPublicBytes...)
+
+	return append(header, ciphertext...), nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers emit either.
+func decodeBase64URL(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,258 @@
+package qr
+
+// encoder places function patterns and codewords on the module grid.
+type encoder struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func newEncoder(version int) *encoder {
+	size := version*4 + 17
+	e := &encoder{version: version, size: size}
+	e.modules = make([][]bool, size)
+	e.isFunction = make([][]bool, size)
+	for y := range e.modules {
+		e.modules[y] = make([]bool, size)
+		e.isFunction[y] = make([]bool, size)
+	}
+	return e
+}
+
+func (e *encoder) setFunction(x, y int, dark bool) {
+	e.modules[y][x] = dark
+	e.isFunction[y][x] = true
+}
+
+func (e *encoder) drawFunctionPatterns() {
+	// Timing patterns
+	for i := 0; i < e.size; i++ {
+		e.setFunction(6, i, i%2 == 0)
+		e.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	e.drawFinder(3, 3)
+	e.drawFinder(e.size-4, 3)
+	e.drawFinder(3, e.size-4)
+
+	// Alignment patterns, except where they would overlap a finder
+	positions := alignmentPositions[e.version-1]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			e.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is chosen.
+	e.drawFormatBits(0, 0)
+	e.drawVersionBits()
+}
+
+func (e *encoder) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= e.size || y < 0 || y >= e.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			e.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (e *encoder) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			e.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the level and mask with their BCH code.
+func (e *encoder) drawFormatBits(level Level, mask int) {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		e.setFunction(8, i, bit(i))
+	}
+	e.setFunction(8, 7, bit(6))
+	e.setFunction(8, 8, bit(7))
+	e.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		e.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		e.setFunction(e.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		e.setFunction(8, e.size-15+i, bit(i))
+	}
+	e.setFunction(8, e.size-8, true) // dark module
+}
+
+// drawVersionBits draws the version information of versions 7 and up.
+func (e *encoder) drawVersionBits() {
+	if e.version < 7 {
+		return
+	}
+	rem := e.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := e.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 == 1
+		a, b := e.size-11+i%3, i/3
+		e.setFunction(a, b, dark)
+		e.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order, two columns at a
+// time from the bottom-right corner, skipping function modules.
+func (e *encoder) drawCodewords(codewords []byte) {
+	i := 0
+	for right := e.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < e.size; vert++ {
+			y := vert
+			if upward {
+				y = e.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if e.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				e.modules[y][x] = (codewords[i/8]>>(7-i%8))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by mask. Applying it twice undoes it.
+func (e *encoder) applyMask(mask int) {
+	for y := 0; y < e.size; y++ {
+		for x := 0; x < e.size; x++ {
+			if e.isFunction[y][x] {
+				continue
+			}
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip {
+				e.modules[y][x] = !e.modules[y][x]
+			}
+		}
+	}
+}
+
+// finderLike is the 1:1:3:1:1 finder pattern with four light modules on one side.
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty scores the symbol with the four rules of the standard; the mask with
+// the lowest score is the easiest to read.
+func (e *encoder) penalty() int {
+	penalty := 0
+	dark := 0
+	for i := 0; i < e.size; i++ {
+		penalty += e.linePenalty(func(j int) bool { return e.modules[i][j] })
+		penalty += e.linePenalty(func(j int) bool { return e.modules[j][i] })
+	}
+
+	for y := 0; y < e.size; y++ {
+		for x := 0; x < e.size; x++ {
+			if e.modules[y][x] {
+				dark++
+			}
+			if x < e.size-1 && y < e.size-1 {
+				c := e.modules[y][x]
+				if c == e.modules[y][x+1] && c == e.modules[y+1][x] && c == e.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := e.size * e.size
+	percent := dark * 100 / total
+	penalty += abs(percent-50) / 5 * 10
+	return penalty
+}
+
+// linePenalty scores runs of five or more same-coloured modules and
+// finder-like patterns in one row or column.
+func (e *encoder) linePenalty(at func(int) bool) int {
+	penalty := 0
+	run := 1
+	for j := 1; j <= e.size; j++ {
+		if j < e.size && at(j) == at(j-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += 3 + run - 5
+		}
+		run = 1
+	}
+
+	for j := 0; j+11 <= e.size; j++ {
+		for _, pattern := range finderLike {
+			match := true
+			for k, dark := range pattern {
+				if at(j+k) != dark {
+					match = false
+					break
+				}
+			}
+			if match {
+				penalty += 40
+			}
+		}
+	}
+	return penalty
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
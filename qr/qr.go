@@ -0,0 +1,195 @@
+// Package qr encodes data as a QR Code (ISO/IEC 18004) in byte mode. It
+// supports versions 1 to 10, which hold up to 271 bytes at level L, enough
+// for the verification links printed on prescriptions.
+package qr
+
+import (
+	"errors"
+	"math"
+)
+
+// Level is the error correction level of a symbol.
+type Level int
+
+// Error correction levels, recovering roughly 7%, 15%, 25% and 30% of the symbol.
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+// MaxVersion is the largest symbol version Encode produces.
+const MaxVersion = 10
+
+// ErrTooLong is returned when the data does not fit in a version 10 symbol.
+var ErrTooLong = errors.New("qr: data too long")
+
+// formatBits are the two error correction bits of the format information.
+var formatBits = [4]int{L: 1, M: 0, Q: 3, H: 2}
+
+// blockLayout describes the error correction blocks of one version and level:
+// the ECC codewords per block, then pairs of block count and data codewords per
+// block for the first and (optional) second group.
+type blockLayout struct {
+	ecc            int
+	blocks1, data1 int
+	blocks2, data2 int
+}
+
+// layouts is indexed by version-1 and level.
+var layouts = [MaxVersion][4]blockLayout{
+	{{7, 1, 19, 0, 0}, {10, 1, 16, 0, 0}, {13, 1, 13, 0, 0}, {17, 1, 9, 0, 0}},
+	{{10, 1, 34, 0, 0}, {16, 1, 28, 0, 0}, {22, 1, 22, 0, 0}, {28, 1, 16, 0, 0}},
+	{{15, 1, 55, 0, 0}, {26, 1, 44, 0, 0}, {18, 2, 17, 0, 0}, {22, 2, 13, 0, 0}},
+	{{20, 1, 80, 0, 0}, {18, 2, 32, 0, 0}, {26, 2, 24, 0, 0}, {16, 4, 9, 0, 0}},
+	{{26, 1, 108, 0, 0}, {24, 2, 43, 0, 0}, {18, 2, 15, 2, 16}, {22, 2, 11, 2, 12}},
+	{{18, 2, 68, 0, 0}, {16, 4, 27, 0, 0}, {24, 4, 19, 0, 0}, {28, 4, 15, 0, 0}},
+	{{20, 2, 78, 0, 0}, {18, 4, 31, 0, 0}, {18, 2, 14, 4, 15}, {26, 4, 13, 1, 14}},
+	{{24, 2, 97, 0, 0}, {22, 2, 38, 2, 39}, {22, 4, 18, 2, 19}, {26, 4, 14, 2, 15}},
+	{{30, 2, 116, 0, 0}, {22, 3, 36, 2, 37}, {20, 4, 16, 4, 17}, {24, 4, 12, 4, 13}},
+	{{18, 2, 68, 2, 69}, {26, 4, 43, 1, 44}, {24, 6, 19, 2, 20}, {28, 6, 15, 2, 16}},
+}
+
+// alignmentPositions are the alignment pattern centre coordinates per version.
+var alignmentPositions = [MaxVersion][]int{
+	nil,
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+func (b blockLayout) dataCodewords() int {
+	return b.blocks1*b.data1 + b.blocks2*b.data2
+}
+
+// Code is an encoded QR symbol. Modules are addressed by column x and row y,
+// both from the top-left corner; the quiet zone is not included.
+type Code struct {
+	Version int
+	Size    int
+	modules [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes data in byte mode at the given level, using the smallest
+// version that fits.
+func Encode(data []byte, level Level) (*Code, error) {
+	version := 0
+	for v := 1; v <= MaxVersion; v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*layouts[v-1][level].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	codewords := addErrorCorrection(encodeData(data, version, level), layouts[version-1][level])
+
+	e := newEncoder(version)
+	e.drawFunctionPatterns()
+	e.drawCodewords(codewords)
+
+	// Apply the mask with the lowest penalty.
+	best, bestPenalty := 0, math.MaxInt
+	for mask := 0; mask < 8; mask++ {
+		e.applyMask(mask)
+		e.drawFormatBits(level, mask)
+		if penalty := e.penalty(); penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		e.applyMask(mask) // masks are their own inverse
+	}
+	e.applyMask(best)
+	e.drawFormatBits(level, best)
+
+	return &Code{Version: version, Size: e.size, modules: e.modules}, nil
+}
+
+// encodeData builds the data codewords: mode, count, data, terminator and padding.
+func encodeData(data []byte, version int, level Level) []byte {
+	capacity := layouts[version-1][level].dataCodewords()
+	var bits bitBuffer
+	bits.append(0x4, 4) // byte mode
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, capacity*8-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity*8; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+// addErrorCorrection splits data into blocks, appends Reed-Solomon codewords to
+// each and interleaves them.
+func addErrorCorrection(data []byte, layout blockLayout) []byte {
+	divisor := rsDivisor(layout.ecc)
+	var dataBlocks, eccBlocks [][]byte
+	offset := 0
+	for i := 0; i < layout.blocks1+layout.blocks2; i++ {
+		size := layout.data1
+		if i >= layout.blocks1 {
+			size = layout.data2
+		}
+		block := data[offset : offset+size]
+		offset += size
+		dataBlocks = append(dataBlocks, block)
+		eccBlocks = append(eccBlocks, rsRemainder(block, divisor))
+	}
+
+	result := make([]byte, 0, len(data)+len(eccBlocks)*layout.ecc)
+	for i := 0; i < max(layout.data1, layout.data2); i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecc; i++ {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, count int) {
+	for i := count - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, (len(b)+7)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
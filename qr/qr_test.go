@@ -0,0 +1,279 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readFormat returns the 15 format bits of the copy around the top-left finder
+// and of the copy split between the other two finders.
+func readFormat(modules [][]bool, size int) (int, int) {
+	var first, second int
+	set := func(bits *int, i int, dark bool) {
+		if dark {
+			*bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(&first, i, modules[i][8])
+	}
+	set(&first, 6, modules[7][8])
+	set(&first, 7, modules[8][8])
+	set(&first, 8, modules[8][7])
+	for i := 9; i < 15; i++ {
+		set(&first, i, modules[8][14-i])
+	}
+	for i := 0; i < 8; i++ {
+		set(&second, i, modules[8][size-1-i])
+	}
+	for i := 8; i < 15; i++ {
+		set(&second, i, modules[size-15+i][8])
+	}
+	return first, second
+}
+
+// decode reads the data back out of a symbol: it reads the level and mask from
+// the format bits, removes the mask, collects the codewords in placement order,
+// undoes the interleaving, checks each block's error correction and parses the
+// byte mode segment.
+func decode(code *Code) ([]byte, Level, error) {
+	format, copy2 := readFormat(code.modules, code.Size)
+	if format != copy2 {
+		return nil, 0, fmt.Errorf("format copies differ: %015b, %015b", format, copy2)
+	}
+	format ^= 0x5412
+	mask := format >> 10 & 7
+	level := Level(-1)
+	for l, bits := range formatBits {
+		if bits == format>>13 {
+			level = Level(l)
+		}
+	}
+	if level < 0 {
+		return nil, 0, fmt.Errorf("invalid format bits %015b", format)
+	}
+
+	e := newEncoder(code.Version)
+	e.drawFunctionPatterns()
+	for y := range e.modules {
+		for x := range e.modules[y] {
+			if !e.isFunction[y][x] {
+				e.modules[y][x] = code.modules[y][x]
+			}
+		}
+	}
+	e.applyMask(mask)
+
+	layout := layouts[code.Version-1][level]
+	blocks := layout.blocks1 + layout.blocks2
+	total := layout.dataCodewords() + blocks*layout.ecc
+	codewords := make([]byte, total)
+	i := 0
+	for right := e.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < e.size; vert++ {
+			y := vert
+			if upward {
+				y = e.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if e.isFunction[y][x] || i >= total*8 {
+					continue
+				}
+				if e.modules[y][x] {
+					codewords[i/8] |= 0x80 >> (i % 8)
+				}
+				i++
+			}
+		}
+	}
+
+	dataBlocks := make([][]byte, blocks)
+	eccBlocks := make([][]byte, blocks)
+	next := 0
+	for k := 0; k < max(layout.data1, layout.data2); k++ {
+		for b := range dataBlocks {
+			size := layout.data1
+			if b >= layout.blocks1 {
+				size = layout.data2
+			}
+			if k < size {
+				dataBlocks[b] = append(dataBlocks[b], codewords[next])
+				next++
+			}
+		}
+	}
+	for k := 0; k < layout.ecc; k++ {
+		for b := range eccBlocks {
+			eccBlocks[b] = append(eccBlocks[b], codewords[next])
+			next++
+		}
+	}
+	var data []byte
+	divisor := rsDivisor(layout.ecc)
+	for b := range dataBlocks {
+		if !bytes.Equal(rsRemainder(dataBlocks[b], divisor), eccBlocks[b]) {
+			return nil, 0, fmt.Errorf("block %d fails error correction", b)
+		}
+		data = append(data, dataBlocks[b]...)
+	}
+
+	var bits strings.Builder
+	for _, b := range data {
+		fmt.Fprintf(&bits, "%08b", b)
+	}
+	read := func(n int) int {
+		s := bits.String()[:n]
+		v, _ := strconv.ParseInt(s, 2, 64)
+		rest := bits.String()[n:]
+		bits.Reset()
+		bits.WriteString(rest)
+		return int(v)
+	}
+	if mode := read(4); mode != 0x4 {
+		return nil, 0, fmt.Errorf("mode %04b, want byte mode", mode)
+	}
+	countBits := 8
+	if code.Version >= 10 {
+		countBits = 16
+	}
+	out := make([]byte, read(countBits))
+	for k := range out {
+		out[k] = byte(read(8))
+	}
+	return out, level, nil
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name        string
+		length      int
+		level       Level
+		wantVersion int
+	}{
+		{name: "empty", length: 0, level: L, wantVersion: 1},
+		{name: "version 1 L capacity", length: 17, level: L, wantVersion: 1},
+		{name: "one byte over version 1 L", length: 18, level: L, wantVersion: 2},
+		{name: "version 1 M capacity", length: 14, level: M, wantVersion: 1},
+		{name: "verification link", length: 96, level: M, wantVersion: 6},
+		{name: "version 7 carries version bits", length: 140, level: L, wantVersion: 7},
+		{name: "version 9 L capacity", length: 230, level: L, wantVersion: 9},
+		{name: "16-bit count from version 10", length: 231, level: L, wantVersion: 10},
+		{name: "version 10 L capacity", length: 271, level: L, wantVersion: 10},
+		{name: "version 10 H capacity", length: 119, level: H, wantVersion: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.length)
+			for i := range data {
+				data[i] = byte(i*37 + 11)
+			}
+			code, err := Encode(data, tt.level)
+			if err != nil {
+				t.Fatalf("Encode() error: %v", err)
+			}
+			if code.Version != tt.wantVersion || code.Size != 17+4*tt.wantVersion {
+				t.Fatalf("Encode() = version %d size %d, want version %d size %d", code.Version, code.Size, tt.wantVersion, 17+4*tt.wantVersion)
+			}
+			got, level, err := decode(code)
+			if err != nil {
+				t.Fatalf("decode() error: %v", err)
+			}
+			if level != tt.level || !bytes.Equal(got, data) {
+				t.Errorf("decode() = %x at level %d, want %x at level %d", got, level, data, tt.level)
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	tests := []struct {
+		length int
+		level  Level
+	}{
+		{length: 272, level: L},
+		{length: 120, level: H},
+	}
+
+	for _, tt := range tests {
+		if _, err := Encode(make([]byte, tt.length), tt.level); !errors.Is(err, ErrTooLong) {
+			t.Errorf("Encode(%d bytes, level %d) error = %v, want ErrTooLong", tt.length, tt.level, err)
+		}
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	// Reference format strings from ISO/IEC 18004, table C.1.
+	tests := []struct {
+		level Level
+		mask  int
+		want  string
+	}{
+		{level: L, mask: 0, want: "111011111000100"},
+		{level: L, mask: 4, want: "110011000101111"},
+		{level: M, mask: 0, want: "101010000010010"},
+		{level: Q, mask: 0, want: "011010101011111"},
+		{level: H, mask: 0, want: "001011010001001"},
+	}
+
+	for _, tt := range tests {
+		e := newEncoder(1)
+		e.drawFormatBits(tt.level, tt.mask)
+		first, second := readFormat(e.modules, e.size)
+		want, _ := strconv.ParseInt(tt.want, 2, 32)
+		if first != int(want) || second != int(want) {
+			t.Errorf("format bits for level %d mask %d = %015b, %015b, want %s", tt.level, tt.mask, first, second, tt.want)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	// Reference version strings from ISO/IEC 18004, table D.1.
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{version: 7, want: "000111110010010100"},
+		{version: 8, want: "001000010110111100"},
+		{version: 10, want: "001010010011010011"},
+	}
+
+	for _, tt := range tests {
+		e := newEncoder(tt.version)
+		e.drawVersionBits()
+		var got, transposed int
+		for i := 0; i < 18; i++ {
+			a, b := e.size-11+i%3, i/3
+			if e.modules[b][a] {
+				got |= 1 << i
+			}
+			if e.modules[a][b] {
+				transposed |= 1 << i
+			}
+		}
+		want, _ := strconv.ParseInt(tt.want, 2, 32)
+		if got != int(want) || transposed != int(want) {
+			t.Errorf("version %d bits = %018b, %018b, want %s", tt.version, got, transposed, tt.want)
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// The "HELLO WORLD" 1-M example: 16 data codewords and their 10 error
+	// correction codewords.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := rsRemainder(data, rsDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package realtime
+
+import "sync"
+
+// Event types delivered to subscribers.
+const (
+	// EventMessage carries a new message of a prescription thread.
+	EventMessage = "message"
+	// EventRead carries a read receipt for messages of a prescription thread.
+	EventRead = "read"
+)
+
+// subscriberBuffer is how many events a subscriber can fall behind before
+// further events are dropped for it.
+const subscriberBuffer = 16
+
+// Event is something that happened which a connected client should learn about.
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type account struct {
+	role string
+	id   int64
+}
+
+// Hub fans events out to the clients connected to this instance, keyed by the
+// account they are logged in as. An account may be connected several times,
+// e.g. from a phone and a browser. Events for accounts connected to another
+// instance are not delivered; clients catch up from the list endpoints.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[account]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[account]map[chan Event]struct{})}
+}
+
+// Subscribe registers a connection of an account. The returned function
+// unsubscribes it and must be called when the connection closes.
+func (h *Hub) Subscribe(role string, id int64) (<-chan Event, func()) {
+	key := account{role: role, id: id}
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[key] == nil {
+		h.subscribers[key] = make(map[chan Event]struct{})
+	}
+	h.subscribers[key][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[key], ch)
+		if len(h.subscribers[key]) == 0 {
+			delete(h.subscribers, key)
+		}
+	}
+}
+
+// Publish delivers an event to every connection of an account without
+// blocking. A connection whose buffer is full misses the event.
+func (h *Hub) Publish(role string, id int64, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[account{role: role, id: id}] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -2,12 +2,39 @@ package routes
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/handlers"
-	"github.com/jackc/pgx/v5"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/notify"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/realtime"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/scanner"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/signing"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func RegisterRoutes(db *pgx.Conn) {
+// Dependencies holds the shared components handlers need besides the database connection.
+type Dependencies struct {
+	Notifiers map[string]notify.Notifier
+	Store     storage.ObjectStore
+	Scanner   scanner.Scanner
+	// Signer signs finalized prescriptions; nil disables finalization.
+	Signer *signing.Signer
+	// SignedURLExpiry is how long download URLs for stored files stay valid.
+	SignedURLExpiry time.Duration
+	// PublicBaseURL is the externally reachable URL of this server, printed in
+	// the verification QR code of prescription PDFs.
+	PublicBaseURL string
+	// AdminAPIKey guards the admin routes; they are disabled when it is empty.
+	AdminAPIKey string
+	// Validity holds the default validity periods of finalized prescriptions.
+	Validity config.Validity
+	// Hub delivers new messages and read receipts to connected clients.
+	Hub *realtime.Hub
+}
+
+func RegisterRoutes(db *pgxpool.Pool, deps Dependencies) {
 	// Health check route
 	http.HandleFunc("/health", handlers.HealthHandler)
 
@@ -19,24 +46,143 @@ func RegisterRoutes(db *pgx.Conn) {
 	http.HandleFunc("/api/users/create", handlers.CreateUserHandler(db))
 	http.HandleFunc("/api/users/login", handlers.LoginUserHandler(db))
 	http.HandleFunc("/api/users/profile", handlers.AuthMiddleware(handlers.UserProfileHandler(db)))
+	http.HandleFunc("/api/users/health-profile", handlers.AuthMiddleware(handlers.GetHealthProfileHandler(db)))
+	http.HandleFunc("/api/users/health-profile/update", handlers.AuthMiddleware(handlers.UpdateHealthProfileHandler(db)))
+	http.HandleFunc("/api/users/timeline", handlers.AuthMiddleware(handlers.GetPatientTimelineHandler(db)))
+
+	// Vitals and lab results routes
+	http.HandleFunc("/api/vitals", handlers.AuthMiddleware(handlers.GetVitalsHandler(db)))
+	http.HandleFunc("/api/vitals/create", handlers.AuthMiddleware(handlers.CreateVitalHandler(db)))
+	http.HandleFunc("/api/vitals/import", handlers.AuthMiddleware(handlers.ImportVitalsHandler(db)))
+	http.HandleFunc("/api/labs", handlers.AuthMiddleware(handlers.GetLabResultsHandler(db)))
+	http.HandleFunc("/api/labs/create", handlers.AuthMiddleware(handlers.CreateLabResultsHandler(db)))
+	http.HandleFunc("/api/labs/import", handlers.AuthMiddleware(handlers.ImportLabResultsHandler(db)))
 
 	// Doctor routes
 	http.HandleFunc("/api/doctors", handlers.GetDoctorsHandler(db))
 	http.HandleFunc("/api/doctors/create", handlers.CreateDoctorHandler(db))
 	http.HandleFunc("/api/doctors/get", handlers.GetDoctorHandler(db))
+	http.HandleFunc("/api/doctors/search", handlers.AuthMiddleware(handlers.SearchDoctorsHandler(db)))
+	http.HandleFunc("/api/specialities", handlers.GetSpecialitiesHandler(db))
 	http.HandleFunc("/api/doctors/login", handlers.LoginDoctorHandler(db))
 	http.HandleFunc("/api/doctors/profile", handlers.AuthMiddleware(handlers.DoctorProfileHandler(db)))
+	http.HandleFunc("/api/doctors/profile/update", handlers.AuthMiddleware(handlers.UpdateDoctorProfileHandler(db)))
+
+	// Pharmacy routes
+	http.HandleFunc("/api/pharmacies", handlers.GetPharmaciesHandler(db))
+	http.HandleFunc("/api/pharmacies/create", handlers.CreatePharmacyHandler(db))
+	http.HandleFunc("/api/pharmacies/login", handlers.LoginPharmacyHandler(db))
+	http.HandleFunc("/api/pharmacies/profile", handlers.AuthMiddleware(handlers.PharmacyProfileHandler(db)))
+	http.HandleFunc("/api/pharmacies/prescriptions", handlers.AuthMiddleware(handlers.GetPharmacyPrescriptionsHandler(db)))
+	http.HandleFunc("/api/pharmacies/dispense", handlers.AuthMiddleware(handlers.DispensePrescriptionHandler(db)))
+
 	// Prescription routes
 	http.HandleFunc("/api/prescriptions", handlers.GetUserPrescriptionsHandler(db))
-	http.HandleFunc("/api/prescriptions/create", handlers.CreatePrescriptionHandler(db))
+	http.HandleFunc("/api/prescriptions/create", handlers.CreatePrescriptionHandler(db, deps.Scanner))
 	http.HandleFunc("/api/prescriptions/get", handlers.GetPrescriptionHandler(db))
 	http.HandleFunc("/api/prescriptions/with-items", handlers.GetUserPrescriptionsWithItemsHandler(db))
 	http.HandleFunc("/api/prescriptions/seen/update", handlers.UpdatePrescriptionSeenStatusHandler(db))
 	http.HandleFunc("/api/doctors/prescriptions-with-items", handlers.GetDoctorPrescriptionsWithItemsHandler(db))
+	http.HandleFunc("/api/prescriptions/adherence", handlers.AuthMiddleware(handlers.GetPrescriptionAdherenceHandler(db)))
+	http.HandleFunc("/api/prescriptions/status/update", handlers.AuthMiddleware(handlers.UpdatePrescriptionStatusHandler(db)))
+	http.HandleFunc("/api/prescriptions/status/history", handlers.AuthMiddleware(handlers.GetPrescriptionStatusHistoryHandler(db)))
+	http.HandleFunc("/api/prescriptions/finalize", handlers.AuthMiddleware(handlers.FinalizePrescriptionHandler(db, deps.Signer, deps.Validity)))
+	http.HandleFunc("/api/prescriptions/verify", handlers.AuthMiddleware(handlers.VerifyPrescriptionHandler(db, deps.Signer)))
+	http.HandleFunc("/api/prescriptions/amend", handlers.AuthMiddleware(handlers.AmendPrescriptionHandler(db, deps.Signer)))
+	http.HandleFunc("/api/prescriptions/pdf", handlers.AuthMiddleware(handlers.GetPrescriptionPDFHandler(db, deps.Signer, deps.PublicBaseURL)))
+	http.HandleFunc("/api/prescriptions/share", handlers.AuthMiddleware(handlers.SharePrescriptionHandler(db)))
+	http.HandleFunc("/api/prescriptions/share/revoke", handlers.AuthMiddleware(handlers.RevokePrescriptionShareHandler(db)))
+	http.HandleFunc("/api/prescriptions/shares", handlers.AuthMiddleware(handlers.GetPrescriptionSharesHandler(db)))
+	http.HandleFunc("/api/prescriptions/dispensing", handlers.AuthMiddleware(handlers.GetPrescriptionDispensingHandler(db)))
+	http.HandleFunc("/api/prescriptions/refills", handlers.AuthMiddleware(handlers.GetPrescriptionRefillsHandler(db)))
+	http.HandleFunc("/api/prescriptions/versions", handlers.AuthMiddleware(handlers.GetPrescriptionVersionsHandler(db)))
+	http.HandleFunc("/api/prescriptions/versions/get", handlers.AuthMiddleware(handlers.GetPrescriptionVersionHandler(db)))
+	http.HandleFunc("/api/prescriptions/versions/diff", handlers.AuthMiddleware(handlers.GetPrescriptionVersionDiffHandler(db)))
+	http.HandleFunc("/api/prescriptions/follow-up/update", handlers.AuthMiddleware(handlers.UpdatePrescriptionFollowUpHandler(db)))
+	http.HandleFunc("/api/prescriptions/attachments", handlers.AuthMiddleware(handlers.GetPrescriptionAttachmentsHandler(db)))
+	http.HandleFunc("/api/prescriptions/file", handlers.AuthMiddleware(handlers.GetPrescriptionFileHandler(db, deps.Store, deps.SignedURLExpiry)))
+	http.HandleFunc("/api/prescriptions/warnings", handlers.AuthMiddleware(handlers.GetPrescriptionWarningsHandler(db)))
+	http.HandleFunc("/api/prescriptions/referrals", handlers.AuthMiddleware(handlers.GetPrescriptionReferralsHandler(db)))
+	http.HandleFunc("/api/prescriptions/item-notes", handlers.AuthMiddleware(handlers.GetPrescriptionItemNotesHandler(db)))
+
+	// Public verification of printed prescriptions (no auth required)
+	http.HandleFunc("/api/public/prescriptions/verify", handlers.PublicVerifyPrescriptionHandler(db, deps.Signer))
+
+	// FHIR R4 routes
+	http.HandleFunc("/api/fhir", handlers.AdminMiddleware(deps.AdminAPIKey, handlers.ImportFHIRBundleHandler(db)))
+	http.HandleFunc("/api/fhir/Patient/{id}", handlers.AuthMiddleware(handlers.GetFHIRPatientHandler(db)))
+	http.HandleFunc("/api/fhir/Practitioner/{id}", handlers.AuthMiddleware(handlers.GetFHIRPractitionerHandler(db)))
+	http.HandleFunc("/api/fhir/MedicationRequest", handlers.AuthMiddleware(handlers.SearchFHIRItemRequestsHandler(db, "MedicationRequest", deps.PublicBaseURL)))
+	http.HandleFunc("/api/fhir/MedicationRequest/{id}", handlers.AuthMiddleware(handlers.GetFHIRItemRequestHandler(db, "MedicationRequest")))
+	http.HandleFunc("/api/fhir/ServiceRequest", handlers.AuthMiddleware(handlers.SearchFHIRItemRequestsHandler(db, "ServiceRequest", deps.PublicBaseURL)))
+	http.HandleFunc("/api/fhir/ServiceRequest/{id}", handlers.AuthMiddleware(handlers.GetFHIRItemRequestHandler(db, "ServiceRequest")))
+	http.HandleFunc("/api/fhir/DocumentReference", handlers.AuthMiddleware(handlers.SearchFHIRDocumentReferencesHandler(db, deps.PublicBaseURL)))
+	http.HandleFunc("/api/fhir/DocumentReference/{id}", handlers.AuthMiddleware(handlers.GetFHIRDocumentReferenceHandler(db, deps.PublicBaseURL)))
 
 	// Items routes
 	http.HandleFunc("/api/items", handlers.GetPrescriptionItemsHandler(db))
-	http.HandleFunc("/api/items/create", handlers.CreateItemHandler(db))
+	http.HandleFunc("/api/items/create", handlers.AuthMiddleware(handlers.CreateItemHandler(db)))
 	http.HandleFunc("/api/items/get", handlers.GetItemHandler(db))
-	http.HandleFunc("/api/items/update", handlers.UpdateItemDocReasonHandler(db))
+	http.HandleFunc("/api/items/update", handlers.AuthMiddleware(handlers.UpdateItemDocReasonHandler(db)))
+	http.HandleFunc("/api/items/dosage/update", handlers.AuthMiddleware(handlers.UpdateItemDosageHandler(db)))
+	http.HandleFunc("/api/items/dosage/parse", handlers.ParseDosageHandler)
+	http.HandleFunc("/api/items/approve", handlers.AuthMiddleware(handlers.ApproveItemHandler(db)))
+	http.HandleFunc("/api/items/refills/update", handlers.AuthMiddleware(handlers.UpdateItemRefillsHandler(db)))
+	http.HandleFunc("/api/items/notes/update", handlers.AuthMiddleware(handlers.UpdateItemNoteHandler(db)))
+
+	// Refill routes
+	http.HandleFunc("/api/refills", handlers.AuthMiddleware(handlers.GetRefillRequestsHandler(db)))
+	http.HandleFunc("/api/refills/request", handlers.AuthMiddleware(handlers.RequestRefillHandler(db)))
+	http.HandleFunc("/api/refills/review", handlers.AuthMiddleware(handlers.ReviewRefillHandler(db, deps.Signer, deps.Validity)))
+
+	// Referral routes
+	http.HandleFunc("/api/referrals", handlers.AuthMiddleware(handlers.GetReferralsHandler(db)))
+	http.HandleFunc("/api/referrals/create", handlers.AuthMiddleware(handlers.CreateReferralHandler(db)))
+	http.HandleFunc("/api/referrals/respond", handlers.AuthMiddleware(handlers.RespondReferralHandler(db)))
+	http.HandleFunc("/api/referrals/complete", handlers.AuthMiddleware(handlers.CompleteReferralHandler(db)))
+	http.HandleFunc("/api/referrals/cancel", handlers.AuthMiddleware(handlers.CancelReferralHandler(db)))
+
+	// Message routes
+	http.HandleFunc("/api/messages", handlers.AuthMiddleware(handlers.GetMessagesHandler(db)))
+	http.HandleFunc("/api/messages/send", handlers.AuthMiddleware(handlers.SendMessageHandler(db, deps.Scanner, deps.Hub)))
+	http.HandleFunc("/api/messages/read", handlers.AuthMiddleware(handlers.MarkMessagesReadHandler(db, deps.Hub)))
+	http.HandleFunc("/api/messages/file", handlers.AuthMiddleware(handlers.GetMessageFileHandler(db, deps.Store, deps.SignedURLExpiry)))
+	http.HandleFunc("/api/messages/stream-token", handlers.AuthMiddleware(handlers.StreamTokenHandler()))
+	// The stream authenticates itself: EventSource clients pass a stream token instead of a header
+	http.HandleFunc("/api/messages/stream", handlers.MessageStreamHandler(deps.Hub))
+
+	// Appointment routes
+	http.HandleFunc("/api/doctors/availability", handlers.AuthMiddleware(handlers.GetDoctorAvailabilityHandler(db)))
+	http.HandleFunc("/api/doctors/availability/update", handlers.AuthMiddleware(handlers.UpdateDoctorAvailabilityHandler(db)))
+	http.HandleFunc("/api/doctors/availability/exceptions/create", handlers.AuthMiddleware(handlers.CreateAvailabilityExceptionHandler(db)))
+	http.HandleFunc("/api/doctors/availability/exceptions/delete", handlers.AuthMiddleware(handlers.DeleteAvailabilityExceptionHandler(db)))
+	http.HandleFunc("/api/appointments", handlers.AuthMiddleware(handlers.GetAppointmentsHandler(db)))
+	http.HandleFunc("/api/appointments/slots", handlers.AuthMiddleware(handlers.GetSlotsHandler(db)))
+	http.HandleFunc("/api/appointments/book", handlers.AuthMiddleware(handlers.BookAppointmentHandler(db)))
+	http.HandleFunc("/api/appointments/cancel", handlers.AuthMiddleware(handlers.CancelAppointmentHandler(db)))
+	http.HandleFunc("/api/appointments/prescription", handlers.AuthMiddleware(handlers.LinkAppointmentPrescriptionHandler(db)))
+
+	// Drug catalog routes
+	http.HandleFunc("/api/drugs/get", handlers.GetDrugHandler(db))
+	http.HandleFunc("/api/drugs/search", handlers.AuthMiddleware(handlers.SearchDrugsHandler(db)))
+	http.HandleFunc("/api/drugs/autocomplete", handlers.AuthMiddleware(handlers.AutocompleteDrugsHandler(db)))
+
+	// Dose schedule routes
+	http.HandleFunc("/api/doses", handlers.AuthMiddleware(handlers.GetPrescriptionDosesHandler(db)))
+	http.HandleFunc("/api/doses/log", handlers.AuthMiddleware(handlers.LogDoseHandler(db)))
+
+	// Notification routes
+	http.HandleFunc("/api/notifications/preferences", handlers.AuthMiddleware(handlers.GetNotificationPreferencesHandler(db)))
+	http.HandleFunc("/api/notifications/preferences/update", handlers.AuthMiddleware(handlers.UpdateNotificationPreferencesHandler(db)))
+	http.HandleFunc("/api/notifications/vapid-public-key", handlers.VAPIDPublicKeyHandler(deps.Notifiers))
+
+	// Admin routes
+	http.HandleFunc("/api/admin/storage/report", handlers.AdminMiddleware(deps.AdminAPIKey, handlers.GetStorageReportHandler(db, deps.Store)))
+	http.HandleFunc("/api/admin/scans", handlers.AdminMiddleware(deps.AdminAPIKey, handlers.GetScanResultsHandler(db)))
+	http.HandleFunc("/api/admin/uploads/retry", handlers.AdminMiddleware(deps.AdminAPIKey, handlers.RetryUploadsHandler(db)))
+
+	// Signed links to files kept on local disk are served by the store itself.
+	if local, ok := deps.Store.(*storage.LocalStore); ok {
+		http.Handle(storage.LocalPathPrefix, local)
+	}
 }
@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the INSTREAM chunks sent to clamd; it must stay
+// below clamd's StreamMaxLength.
+const clamdChunkSize = 64 << 10
+
+// ClamdScanner streams files to a ClamAV daemon with the INSTREAM command over
+// TCP or a unix socket.
+type ClamdScanner struct {
+	Network string // "tcp" or "unix"
+	Address string
+	Timeout time.Duration
+}
+
+// NewClamdScanner parses an address such as tcp://localhost:3310,
+// unix:///var/run/clamav/clamd.ctl, localhost:3310 or /var/run/clamav/clamd.ctl.
+func NewClamdScanner(address string) (*ClamdScanner, error) {
+	scanner := &ClamdScanner{Network: "tcp", Address: address, Timeout: 30 * time.Second}
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		scanner.Address = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		scanner.Network, scanner.Address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "/"):
+		scanner.Network = "unix"
+	}
+	if scanner.Address == "" {
+		return nil, errors.New("invalid clamd address")
+	}
+	return scanner, nil
+}
+
+func (s *ClamdScanner) Name() string {
+	return NameClamd
+}
+
+func (s *ClamdScanner) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// command sends a null-terminated command and returns clamd's reply.
+func (s *ClamdScanner) command(ctx context.Context, cmd string, body func(conn net.Conn) error) (string, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("z" + cmd + "\x00")); err != nil {
+		return "", fmt.Errorf("clamd write failed: %w", err)
+	}
+	if body != nil {
+		if err := body(conn); err != nil {
+			return "", fmt.Errorf("clamd write failed: %w", err)
+		}
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("clamd read failed: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// Ping checks that clamd is reachable.
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	reply, err := s.command(ctx, "PING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// Scan streams data to clamd. Replies look like "stream: OK",
+// "stream: Win.Test.EICAR_HDB-1 FOUND" or "... ERROR".
+func (s *ClamdScanner) Scan(ctx context.Context, data []byte) (*Result, error) {
+	reply, err := s.command(ctx, "INSTREAM", func(conn net.Conn) error {
+		size := make([]byte, 4)
+		for start := 0; start < len(data); start += clamdChunkSize {
+			chunk := data[start:min(start+clamdChunkSize, len(data))]
+			binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+			if _, err := conn.Write(size); err != nil {
+				return err
+			}
+			if _, err := conn.Write(chunk); err != nil {
+				return err
+			}
+		}
+		_, err := conn.Write([]byte{0, 0, 0, 0})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseClamdReply(reply)
+}
+
+func parseClamdReply(reply string) (*Result, error) {
+	status := reply
+	if i := strings.Index(reply, ": "); i >= 0 {
+		status = reply[i+2:]
+	}
+	switch {
+	case status == "OK":
+		return &Result{Verdict: VerdictClean}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return &Result{Verdict: VerdictInfected, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	case strings.HasSuffix(status, " ERROR"):
+		return nil, fmt.Errorf("clamd error: %s", strings.TrimSuffix(status, " ERROR"))
+	}
+	return nil, fmt.Errorf("unexpected clamd reply %q", reply)
+}
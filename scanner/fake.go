@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+)
+
+// eicar is the standard antivirus test file, split so this source is not flagged.
+var eicar = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$` + `EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// NoopScanner accepts every file. It is the default when no scanner is configured.
+type NoopScanner struct{}
+
+func (NoopScanner) Name() string {
+	return NameNoop
+}
+
+func (NoopScanner) Scan(ctx context.Context, data []byte) (*Result, error) {
+	return &Result{Verdict: VerdictClean}, nil
+}
+
+// FakeScanner flags files containing the EICAR test string or any of
+// Signatures (name to byte pattern), and fails every scan when Err is set. It
+// lets development and tests exercise quarantine without ClamAV.
+type FakeScanner struct {
+	Signatures map[string]string
+	Err        error
+}
+
+func (s *FakeScanner) Name() string {
+	return NameFake
+}
+
+func (s *FakeScanner) Scan(ctx context.Context, data []byte) (*Result, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if bytes.Contains(data, eicar) {
+		return &Result{Verdict: VerdictInfected, Signature: "EICAR-Test-File"}, nil
+	}
+	for name, pattern := range s.Signatures {
+		if pattern != "" && bytes.Contains(data, []byte(pattern)) {
+			return &Result{Verdict: VerdictInfected, Signature: name}, nil
+		}
+	}
+	return &Result{Verdict: VerdictClean}, nil
+}
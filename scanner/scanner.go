@@ -0,0 +1,94 @@
+// Package scanner checks uploaded files for malware before they are stored.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Scanner names
+const (
+	NameClamd = "clamd"
+	NameNoop  = "noop"
+	NameFake  = "fake"
+)
+
+// Verdicts
+const (
+	VerdictClean    = "clean"
+	VerdictInfected = "infected"
+	// VerdictError means the file could not be scanned but was accepted anyway.
+	VerdictError = "error"
+)
+
+// Result is the outcome of scanning one file.
+type Result struct {
+	Verdict   string
+	Signature string // name of the detected malware, if any
+	Detail    string
+}
+
+// Scanner inspects file contents. Scan returns an error when the file could not
+// be scanned; an infected file is a successful scan with VerdictInfected.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, data []byte) (*Result, error)
+}
+
+// failOpen turns scanner errors into VerdictError results so uploads are still
+// accepted while the scanner is unavailable.
+type failOpen struct {
+	Scanner
+}
+
+func (s failOpen) Scan(ctx context.Context, data []byte) (*Result, error) {
+	result, err := s.Scanner.Scan(ctx, data)
+	if err != nil {
+		return &Result{Verdict: VerdictError, Detail: err.Error()}, nil
+	}
+	return result, nil
+}
+
+// NewFromEnv builds the scanner selected by SCANNER (clamd, fake or noop). clamd
+// is chosen by default when CLAMD_ADDRESS is set. Uploads are rejected while
+// the scanner is failing unless SCAN_FAIL_OPEN=true.
+func NewFromEnv() (Scanner, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("SCANNER")))
+	address := os.Getenv("CLAMD_ADDRESS")
+	if name == "" {
+		name = NameNoop
+		if address != "" {
+			name = NameClamd
+		}
+	}
+
+	var scanner Scanner
+	switch name {
+	case NameClamd:
+		if address == "" {
+			return nil, fmt.Errorf("CLAMD_ADDRESS must be set for the clamd scanner")
+		}
+		clamd, err := NewClamdScanner(address)
+		if err != nil {
+			return nil, err
+		}
+		if timeout, err := time.ParseDuration(os.Getenv("CLAMD_TIMEOUT")); err == nil && timeout > 0 {
+			clamd.Timeout = timeout
+		}
+		scanner = clamd
+	case NameFake:
+		scanner = &FakeScanner{}
+	case NameNoop:
+		scanner = NoopScanner{}
+	default:
+		return nil, fmt.Errorf("unknown SCANNER %q (use clamd, fake or noop)", name)
+	}
+
+	if strings.EqualFold(os.Getenv("SCAN_FAIL_OPEN"), "true") {
+		return failOpen{scanner}, nil
+	}
+	return scanner, nil
+}
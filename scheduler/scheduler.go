@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Job is a unit of recurring background work.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type jobState struct {
+	Job
+	nextRun time.Time
+}
+
+// Scheduler runs registered jobs at their intervals. Jobs must be safe to run
+// on several instances at once; they coordinate through row claims in Postgres
+// rather than through the scheduler.
+type Scheduler struct {
+	jobs []*jobState
+	tick time.Duration
+}
+
+func New() *Scheduler {
+	return &Scheduler{tick: time.Second}
+}
+
+// Register adds a job. The first run happens on the scheduler's first tick.
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, &jobState{Job: job})
+}
+
+// Run executes due jobs until ctx is cancelled. Jobs run one at a time, so a
+// slow job delays the next ones instead of overlapping with itself; each takes
+// its own connections from the database pool, apart from those serving requests.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	for {
+		for _, job := range s.jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Now().Before(job.nextRun) {
+				continue
+			}
+			s.runJob(ctx, job)
+			job.nextRun = time.Now().Add(job.Interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, job *jobState) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("scheduler job %s panicked: %v", job.Name, r)
+		}
+	}()
+
+	jobCtx, cancel := context.WithTimeout(ctx, max(job.Interval, time.Minute))
+	defer cancel()
+
+	if err := job.Run(jobCtx); err != nil {
+		log.Printf("scheduler job %s failed: %v", job.Name, err)
+	}
+}
+
+// InstanceID identifies this process when claiming work shared with other instances.
+func InstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -26,16 +26,25 @@ func isRetryableAIError(err error) bool {
 	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
-// CallAIService sends image + metadata to external AI API
-func CallAIService(fileBytes []byte, symptoms string, doctorSpeciality string) (*models.AIResponse, error) {
+// CallAIService sends page images + metadata to external AI API. profile may be
+// nil when the patient has not filled in a health profile.
+func CallAIService(pages [][]byte, symptoms string, doctorSpeciality string, profile *models.AIPatientProfile) (*models.AIResponse, error) {
+	if len(pages) == 0 {
+		return nil, errors.New("no pages to analyze")
+	}
 
-	// Convert image to base64
-	base64Image := base64.StdEncoding.EncodeToString(fileBytes)
+	// Convert images to base64
+	encoded := make([]string, 0, len(pages))
+	for _, page := range pages {
+		encoded = append(encoded, base64.StdEncoding.EncodeToString(page))
+	}
 
 	reqBody := models.AIRequest{
-		File:             base64Image,
+		File:             encoded[0],
+		Files:            encoded,
 		Symptoms:         symptoms,
 		DoctorSpeciality: doctorSpeciality,
+		PatientProfile:   profile,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -0,0 +1,591 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// minSlotMinutes and maxSlotMinutes bound the length of an appointment slot.
+	minSlotMinutes = 5
+	maxSlotMinutes = 240
+	// MaxSlotSearchDays caps the period one slot search covers.
+	MaxSlotSearchDays = 31
+	// maxBookingAheadDays is how far ahead appointments can be booked.
+	maxBookingAheadDays = 90
+	// maxSlotResults caps the slots returned by one search.
+	maxSlotResults = 500
+	// exclusionViolation is the SQLSTATE of a violated exclusion constraint.
+	exclusionViolation = "23P01"
+)
+
+// ErrInvalidAvailability is returned for an availability template or exception that cannot be used.
+var ErrInvalidAvailability = errors.New("invalid availability")
+
+// ErrSlotUnavailable is returned when booking a time the doctor does not offer or that is already taken.
+var ErrSlotUnavailable = errors.New("slot is not available")
+
+// ErrAppointmentConflict is returned when a booking overlaps another booked
+// appointment of the doctor or the patient.
+var ErrAppointmentConflict = errors.New("appointment overlaps another booking")
+
+// ErrAppointmentState is returned when an appointment cannot be changed in its current state.
+var ErrAppointmentState = errors.New("appointment cannot be changed")
+
+// appointmentColumns lists the appointments columns in the order scanAppointment expects them.
+const appointmentColumns = "id, created_at, docId, userId, startsAt, endsAt, status, COALESCE(reason, ''), presId, cancelledAt, COALESCE(cancelledBy, '')"
+
+func scanAppointment(row pgx.Row, appointment *models.Appointment) error {
+	return row.Scan(&appointment.ID, &appointment.CreatedAt, &appointment.DocID, &appointment.UserID,
+		&appointment.StartsAt, &appointment.EndsAt, &appointment.Status, &appointment.Reason,
+		&appointment.PresID, &appointment.CancelledAt, &appointment.CancelledBy)
+}
+
+// availabilityExceptionColumns lists the availability_exceptions columns in the
+// order scanAvailabilityException expects them.
+const availabilityExceptionColumns = "id, created_at, docId, startsAt, endsAt, available, COALESCE(slotMinutes, 0), COALESCE(reason, '')"
+
+func scanAvailabilityException(row pgx.Row, exception *models.AvailabilityException) error {
+	return row.Scan(&exception.ID, &exception.CreatedAt, &exception.DocID, &exception.StartsAt,
+		&exception.EndsAt, &exception.Available, &exception.SlotMinutes, &exception.Reason)
+}
+
+// ValidateAvailability checks a weekly availability template: a known time
+// zone, and windows on valid weekdays that hold at least one slot and do not
+// overlap each other.
+func ValidateAvailability(timezone string, windows []models.AvailabilityWindow) error {
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidAvailability, timezone)
+	}
+
+	type span struct{ start, end int }
+	byDay := make(map[int][]span)
+	for _, window := range windows {
+		if window.Weekday < 0 || window.Weekday > 6 {
+			return fmt.Errorf("%w: weekday must be between 0 (Sunday) and 6", ErrInvalidAvailability)
+		}
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAvailability, err)
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAvailability, err)
+		}
+		if window.SlotMinutes < minSlotMinutes || window.SlotMinutes > maxSlotMinutes {
+			return fmt.Errorf("%w: slotMinutes must be between %d and %d", ErrInvalidAvailability, minSlotMinutes, maxSlotMinutes)
+		}
+		if end-start < window.SlotMinutes {
+			return fmt.Errorf("%w: window %s-%s is shorter than one slot", ErrInvalidAvailability, window.Start, window.End)
+		}
+		for _, other := range byDay[window.Weekday] {
+			if start < other.end && other.start < end {
+				return fmt.Errorf("%w: windows on weekday %d overlap", ErrInvalidAvailability, window.Weekday)
+			}
+		}
+		byDay[window.Weekday] = append(byDay[window.Weekday], span{start, end})
+	}
+	return nil
+}
+
+// ValidateAvailabilityException checks an exception's period and, for extra
+// hours, its slot length.
+func ValidateAvailabilityException(exception *models.AvailabilityException) error {
+	if !exception.EndsAt.After(exception.StartsAt) {
+		return fmt.Errorf("%w: endsAt must be after startsAt", ErrInvalidAvailability)
+	}
+	if exception.EndsAt.Sub(exception.StartsAt) > 366*24*time.Hour {
+		return fmt.Errorf("%w: an exception can span at most a year", ErrInvalidAvailability)
+	}
+	if !exception.Available {
+		exception.SlotMinutes = 0
+		return nil
+	}
+	if exception.SlotMinutes < minSlotMinutes || exception.SlotMinutes > maxSlotMinutes {
+		return fmt.Errorf("%w: slotMinutes must be between %d and %d", ErrInvalidAvailability, minSlotMinutes, maxSlotMinutes)
+	}
+	if exception.EndsAt.Sub(exception.StartsAt) < time.Duration(exception.SlotMinutes)*time.Minute {
+		return fmt.Errorf("%w: the extra hours are shorter than one slot", ErrInvalidAvailability)
+	}
+	return nil
+}
+
+type AppointmentService struct {
+	db *pgxpool.Pool
+}
+
+func NewAppointmentService(db *pgxpool.Pool) *AppointmentService {
+	return &AppointmentService{db: db}
+}
+
+// SetAvailability replaces a doctor's weekly availability template.
+// Appointments already booked are kept.
+func (s *AppointmentService) SetAvailability(ctx context.Context, docID int64, timezone string, windows []models.AvailabilityWindow) (*models.DoctorAvailability, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO doctor_schedules (docId, timezone) VALUES ($1, $2)
+		 ON CONFLICT (docId) DO UPDATE SET timezone = EXCLUDED.timezone, updated_at = CURRENT_TIMESTAMP`,
+		docID, timezone); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM availability_windows WHERE docId = $1", docID); err != nil {
+		return nil, err
+	}
+	for _, window := range windows {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO availability_windows (docId, weekday, startTime, endTime, slotMinutes)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			docID, window.Weekday, window.Start, window.End, window.SlotMinutes); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetAvailability(ctx, docID, time.Now())
+}
+
+// GetAvailability returns a doctor's weekly template and the exceptions that
+// have not ended by now. A doctor who never published one has no windows.
+func (s *AppointmentService) GetAvailability(ctx context.Context, docID int64, now time.Time) (*models.DoctorAvailability, error) {
+	availability := &models.DoctorAvailability{DocID: docID, Timezone: "UTC"}
+	err := s.db.QueryRow(ctx, "SELECT timezone FROM doctor_schedules WHERE docId = $1", docID).Scan(&availability.Timezone)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	availability.Windows, err = availabilityWindows(ctx, s.db, docID)
+	if err != nil {
+		return nil, err
+	}
+	availability.Exceptions, err = s.availabilityExceptions(ctx, docID, now, now.AddDate(100, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	return availability, nil
+}
+
+func availabilityWindows(ctx context.Context, q querier, docID int64) ([]models.AvailabilityWindow, error) {
+	rows, err := q.Query(ctx,
+		"SELECT weekday, startTime, endTime, slotMinutes FROM availability_windows WHERE docId = $1 ORDER BY weekday, startTime",
+		docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := make([]models.AvailabilityWindow, 0)
+	for rows.Next() {
+		var window models.AvailabilityWindow
+		if err := rows.Scan(&window.Weekday, &window.Start, &window.End, &window.SlotMinutes); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
+
+// availabilityExceptions lists a doctor's exceptions that overlap [from, to).
+func (s *AppointmentService) availabilityExceptions(ctx context.Context, docID int64, from, to time.Time) ([]*models.AvailabilityException, error) {
+	rows, err := s.db.Query(ctx,
+		"SELECT "+availabilityExceptionColumns+" FROM availability_exceptions WHERE docId = $1 AND startsAt < $3 AND endsAt > $2 ORDER BY startsAt, id",
+		docID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := make([]*models.AvailabilityException, 0)
+	for rows.Next() {
+		exception := &models.AvailabilityException{}
+		if err := scanAvailabilityException(rows, exception); err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, exception)
+	}
+	return exceptions, rows.Err()
+}
+
+// CreateException records an availability exception for a doctor.
+func (s *AppointmentService) CreateException(ctx context.Context, exception *models.AvailabilityException) error {
+	return scanAvailabilityException(s.db.QueryRow(ctx,
+		`INSERT INTO availability_exceptions (docId, startsAt, endsAt, available, slotMinutes, reason)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+availabilityExceptionColumns,
+		exception.DocID, exception.StartsAt, exception.EndsAt, exception.Available, exception.SlotMinutes, exception.Reason,
+	), exception)
+}
+
+// DeleteException removes one of a doctor's availability exceptions and
+// returns it. An exception of another doctor reads as not found.
+func (s *AppointmentService) DeleteException(ctx context.Context, exceptionID, docID int64) (*models.AvailabilityException, error) {
+	exception := &models.AvailabilityException{}
+	err := scanAvailabilityException(s.db.QueryRow(ctx,
+		"DELETE FROM availability_exceptions WHERE id = $1 AND docId = $2 RETURNING "+availabilityExceptionColumns,
+		exceptionID, docID), exception)
+	if err != nil {
+		return nil, err
+	}
+	return exception, nil
+}
+
+// slotDoctor is a doctor whose slots are being computed.
+type slotDoctor struct {
+	id         int64
+	name       string
+	speciality string
+	timezone   string
+}
+
+// FindSlots returns the open slots between from and to of one doctor (docID)
+// or of every doctor with the given speciality (code, name or alias), earliest first. Slots before
+// now are never offered.
+func (s *AppointmentService) FindSlots(ctx context.Context, docID int64, speciality string, from, to, now time.Time) ([]*models.Slot, error) {
+	if from.Before(now) {
+		from = now
+	}
+
+	var specialityCode string
+	if strings.TrimSpace(speciality) != "" {
+		resolved, err := NewSpecialityService(s.db).Resolve(ctx, speciality)
+		if err != nil {
+			return nil, err
+		}
+		specialityCode = resolved.Code
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT d.id, COALESCE(d.name, ''), COALESCE(d.speciality, ''), s.timezone
+		 FROM doctors d JOIN doctor_schedules s ON s.docId = d.id
+		 WHERE ($1 = 0 OR d.id = $1) AND ($2 = '' OR d.specialityCode = $2)
+		 ORDER BY d.accuracy DESC NULLS LAST, d.id`,
+		docID, specialityCode)
+	if err != nil {
+		return nil, err
+	}
+	var doctors []slotDoctor
+	for rows.Next() {
+		var doctor slotDoctor
+		if err := rows.Scan(&doctor.id, &doctor.name, &doctor.speciality, &doctor.timezone); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		doctors = append(doctors, doctor)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slots := make([]*models.Slot, 0)
+	for _, doctor := range doctors {
+		doctorSlots, err := s.doctorSlots(ctx, doctor, from, to)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, doctorSlots...)
+	}
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].StartsAt.Before(slots[j].StartsAt) })
+	if len(slots) > maxSlotResults {
+		slots = slots[:maxSlotResults]
+	}
+	return slots, nil
+}
+
+// NextSlot returns a search hit's earliest open slot between from and to, or
+// nil if there is none. timezone is the doctor's schedule time zone.
+func (s *AppointmentService) NextSlot(ctx context.Context, hit *models.DoctorSearchHit, timezone string, from, to, now time.Time) (*models.Slot, error) {
+	if from.Before(now) {
+		from = now
+	}
+	if !to.After(from) {
+		return nil, nil
+	}
+	slots, err := s.doctorSlots(ctx, slotDoctor{id: hit.ID, name: hit.Name, speciality: hit.Speciality, timezone: timezone}, from, to)
+	if err != nil || len(slots) == 0 {
+		return nil, err
+	}
+	return slots[0], nil
+}
+
+// doctorSlots computes a doctor's open slots starting in [from, to). Weekly
+// windows are laid out on each calendar day in the doctor's time zone, so
+// slots follow daylight saving changes; extra hours are added, and blocked
+// periods and booked appointments removed.
+func (s *AppointmentService) doctorSlots(ctx context.Context, doctor slotDoctor, from, to time.Time) ([]*models.Slot, error) {
+	loc, err := time.LoadLocation(doctor.timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	windows, err := availabilityWindows(ctx, s.db, doctor.id)
+	if err != nil {
+		return nil, err
+	}
+	// Slots that start before to may end after it.
+	exceptions, err := s.availabilityExceptions(ctx, doctor.id, from, to.Add(maxSlotMinutes*time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	booked, err := s.queryAppointments(ctx,
+		"SELECT "+appointmentColumns+" FROM appointments WHERE docId = $1 AND status = $2 AND startsAt < $4 AND endsAt > $3",
+		doctor.id, models.AppointmentStatusBooked, from, to.Add(maxSlotMinutes*time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	return openSlots(doctor, loc, windows, exceptions, booked, from, to), nil
+}
+
+// openSlots lays out the slots of windows and extra hours starting in
+// [from, to) and drops those that overlap a blocked period or a booking.
+func openSlots(doctor slotDoctor, loc *time.Location, windows []models.AvailabilityWindow, exceptions []*models.AvailabilityException, booked []*models.Appointment, from, to time.Time) []*models.Slot {
+	candidates := make(map[int64]*models.Slot)
+	addSlots := func(start, end time.Time, minutes int) {
+		length := time.Duration(minutes) * time.Minute
+		for t := start; !t.Add(length).After(end); t = t.Add(length) {
+			if t.Before(from) || !t.Before(to) {
+				continue
+			}
+			candidates[t.Unix()] = &models.Slot{
+				DocID:      doctor.id,
+				DoctorName: doctor.name,
+				Speciality: doctor.speciality,
+				Timezone:   loc.String(),
+				StartsAt:   t.UTC(),
+				EndsAt:     t.Add(length).UTC(),
+			}
+		}
+	}
+
+	first := from.In(loc)
+	for day := 0; ; day++ {
+		date := time.Date(first.Year(), first.Month(), first.Day()+day, 0, 0, 0, 0, loc)
+		if !date.Before(to) {
+			break
+		}
+		for _, window := range windows {
+			if time.Weekday(window.Weekday) != date.Weekday() {
+				continue
+			}
+			start, err := parseClock(window.Start)
+			if err != nil {
+				continue
+			}
+			end, err := parseClock(window.End)
+			if err != nil {
+				continue
+			}
+			addSlots(
+				time.Date(date.Year(), date.Month(), date.Day(), start/60, start%60, 0, 0, loc),
+				time.Date(date.Year(), date.Month(), date.Day(), end/60, end%60, 0, 0, loc),
+				window.SlotMinutes)
+		}
+	}
+	for _, exception := range exceptions {
+		if exception.Available {
+			addSlots(exception.StartsAt, exception.EndsAt, exception.SlotMinutes)
+		}
+	}
+
+	slots := make([]*models.Slot, 0, len(candidates))
+	for _, slot := range candidates {
+		blocked := false
+		for _, exception := range exceptions {
+			if !exception.Available && slot.StartsAt.Before(exception.EndsAt) && exception.StartsAt.Before(slot.EndsAt) {
+				blocked = true
+				break
+			}
+		}
+		for _, appointment := range booked {
+			if blocked {
+				break
+			}
+			blocked = slot.StartsAt.Before(appointment.EndsAt) && appointment.StartsAt.Before(slot.EndsAt)
+		}
+		if !blocked {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartsAt.Before(slots[j].StartsAt) })
+	return slots
+}
+
+// Book reserves one of a doctor's open slots for a patient. The exclusion
+// constraints on appointments reject a booking that races another one for an
+// overlapping time.
+func (s *AppointmentService) Book(ctx context.Context, userID int64, req *models.AppointmentBookRequest, now time.Time) (*models.Appointment, error) {
+	if !req.StartsAt.After(now) {
+		return nil, fmt.Errorf("%w: startsAt must be in the future", ErrSlotUnavailable)
+	}
+	if req.StartsAt.After(now.AddDate(0, 0, maxBookingAheadDays)) {
+		return nil, fmt.Errorf("%w: appointments can be booked at most %d days ahead", ErrSlotUnavailable, maxBookingAheadDays)
+	}
+
+	slots, err := s.FindSlots(ctx, req.DocID, "", req.StartsAt, req.StartsAt.Add(time.Second), now)
+	if err != nil {
+		return nil, err
+	}
+	var slot *models.Slot
+	for _, candidate := range slots {
+		if candidate.StartsAt.Equal(req.StartsAt) {
+			slot = candidate
+			break
+		}
+	}
+	if slot == nil {
+		return nil, ErrSlotUnavailable
+	}
+
+	appointment := &models.Appointment{}
+	err = scanAppointment(s.db.QueryRow(ctx,
+		`INSERT INTO appointments (docId, userId, startsAt, endsAt, status, reason)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+appointmentColumns,
+		slot.DocID, userID, slot.StartsAt, slot.EndsAt, models.AppointmentStatusBooked, strings.TrimSpace(req.Reason),
+	), appointment)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation {
+			return nil, ErrAppointmentConflict
+		}
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// GetAppointments lists the appointments of a patient (role "user") or doctor
+// starting in [from, to), optionally only those with the given status, earliest first.
+func (s *AppointmentService) GetAppointments(ctx context.Context, role string, id int64, from, to time.Time, status string) ([]*models.Appointment, error) {
+	column := "userId"
+	if role == "doctor" {
+		column = "docId"
+	}
+	return s.queryAppointments(ctx,
+		"SELECT "+appointmentColumns+" FROM appointments WHERE "+column+" = $1 AND startsAt >= $2 AND startsAt < $3 AND ($4 = '' OR status = $4) ORDER BY startsAt, id",
+		id, from, to, status)
+}
+
+func (s *AppointmentService) queryAppointments(ctx context.Context, query string, args ...interface{}) ([]*models.Appointment, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := make([]*models.Appointment, 0)
+	for rows.Next() {
+		appointment := &models.Appointment{}
+		if err := scanAppointment(rows, appointment); err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, appointment)
+	}
+	return appointments, rows.Err()
+}
+
+// lockAppointment locks an appointment inside tx and checks that it belongs to
+// the patient or doctor acting on it; otherwise it reads as not found.
+func lockAppointment(ctx context.Context, tx pgx.Tx, appointmentID int64, role string, actorID int64) (*models.Appointment, error) {
+	appointment := &models.Appointment{}
+	err := scanAppointment(tx.QueryRow(ctx,
+		"SELECT "+appointmentColumns+" FROM appointments WHERE id = $1 FOR UPDATE",
+		appointmentID), appointment)
+	if err != nil {
+		return nil, err
+	}
+	if role == "doctor" && appointment.DocID != actorID || role == "user" && appointment.UserID != actorID {
+		return nil, pgx.ErrNoRows
+	}
+	return appointment, nil
+}
+
+// Cancel cancels a booked appointment that has not started, on behalf of its
+// patient or doctor, and frees its slot.
+func (s *AppointmentService) Cancel(ctx context.Context, appointmentID int64, role string, actorID int64, now time.Time) (*models.Appointment, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	appointment, err := lockAppointment(ctx, tx, appointmentID, role, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if appointment.Status != models.AppointmentStatusBooked {
+		return nil, fmt.Errorf("%w: it is %s", ErrAppointmentState, appointment.Status)
+	}
+	if !appointment.StartsAt.After(now) {
+		return nil, fmt.Errorf("%w: it has already started", ErrAppointmentState)
+	}
+
+	err = scanAppointment(tx.QueryRow(ctx,
+		`UPDATE appointments SET status = $2, cancelledAt = $3, cancelledBy = $4
+		 WHERE id = $1
+		 RETURNING `+appointmentColumns,
+		appointmentID, models.AppointmentStatusCancelled, now, role,
+	), appointment)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// LinkPrescription records the prescription that came out of a booked
+// appointment. It must be a prescription of the same patient and doctor.
+func (s *AppointmentService) LinkPrescription(ctx context.Context, appointmentID int64, role string, actorID int64, presID int64) (*models.Appointment, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	appointment, err := lockAppointment(ctx, tx, appointmentID, role, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if appointment.Status != models.AppointmentStatusBooked {
+		return nil, fmt.Errorf("%w: it is %s", ErrAppointmentState, appointment.Status)
+	}
+
+	var userID, docID int64
+	err = tx.QueryRow(ctx, "SELECT userId, docId FROM prescriptions WHERE id = $1", presID).Scan(&userID, &docID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: prescription not found", ErrAppointmentState)
+		}
+		return nil, err
+	}
+	if userID != appointment.UserID || docID != appointment.DocID {
+		return nil, fmt.Errorf("%w: the prescription is not between the appointment's patient and doctor", ErrAppointmentState)
+	}
+
+	err = scanAppointment(tx.QueryRow(ctx,
+		"UPDATE appointments SET presId = $2 WHERE id = $1 RETURNING "+appointmentColumns,
+		appointmentID, presID,
+	), appointment)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestValidateAvailability(t *testing.T) {
+	window := func(weekday int, start, end string, minutes int) models.AvailabilityWindow {
+		return models.AvailabilityWindow{Weekday: weekday, Start: start, End: end, SlotMinutes: minutes}
+	}
+
+	tests := []struct {
+		name     string
+		timezone string
+		windows  []models.AvailabilityWindow
+		wantErr  bool
+	}{
+		{name: "no windows", timezone: "UTC"},
+		{name: "morning and evening", timezone: "UTC", windows: []models.AvailabilityWindow{window(1, "09:00", "12:00", 15), window(1, "17:00", "19:00", 30)}},
+		{name: "adjacent windows", timezone: "UTC", windows: []models.AvailabilityWindow{window(2, "09:00", "12:00", 15), window(2, "12:00", "13:00", 15)}},
+		{name: "same hours on different days", timezone: "UTC", windows: []models.AvailabilityWindow{window(0, "09:00", "12:00", 15), window(6, "09:00", "12:00", 15)}},
+		{name: "empty time zone", timezone: "", wantErr: true},
+		{name: "unknown time zone", timezone: "Mars/Olympus", wantErr: true},
+		{name: "weekday out of range", timezone: "UTC", windows: []models.AvailabilityWindow{window(7, "09:00", "12:00", 15)}, wantErr: true},
+		{name: "invalid clock", timezone: "UTC", windows: []models.AvailabilityWindow{window(1, "9am", "12:00", 15)}, wantErr: true},
+		{name: "slot too short", timezone: "UTC", windows: []models.AvailabilityWindow{window(1, "09:00", "12:00", minSlotMinutes-1)}, wantErr: true},
+		{name: "slot too long", timezone: "UTC", windows: []models.AvailabilityWindow{window(1, "00:00", "23:00", maxSlotMinutes+1)}, wantErr: true},
+		{name: "window shorter than a slot", timezone: "UTC", windows: []models.AvailabilityWindow{window(1, "09:00", "09:20", 30)}, wantErr: true},
+		{name: "end before start", timezone: "UTC", windows: []models.AvailabilityWindow{window(1, "12:00", "09:00", 15)}, wantErr: true},
+		{name: "overlapping windows", timezone: "UTC", windows: []models.AvailabilityWindow{window(3, "09:00", "12:00", 15), window(3, "11:30", "13:00", 15)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAvailability(tt.timezone, tt.windows); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAvailability() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAvailabilityException(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		exception       models.AvailabilityException
+		wantSlotMinutes int
+		wantErr         bool
+	}{
+		{name: "blocked day drops the slot length", exception: models.AvailabilityException{StartsAt: start, EndsAt: start.Add(8 * time.Hour), SlotMinutes: 15}},
+		{name: "extra hours", exception: models.AvailabilityException{StartsAt: start, EndsAt: start.Add(2 * time.Hour), Available: true, SlotMinutes: 20}, wantSlotMinutes: 20},
+		{name: "empty period", exception: models.AvailabilityException{StartsAt: start, EndsAt: start}, wantErr: true},
+		{name: "longer than a year", exception: models.AvailabilityException{StartsAt: start, EndsAt: start.AddDate(1, 0, 2)}, wantErr: true},
+		{name: "extra hours without a slot length", exception: models.AvailabilityException{StartsAt: start, EndsAt: start.Add(time.Hour), Available: true}, wantErr: true},
+		{name: "extra hours shorter than a slot", exception: models.AvailabilityException{StartsAt: start, EndsAt: start.Add(20 * time.Minute), Available: true, SlotMinutes: 30}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exception := tt.exception
+			err := ValidateAvailabilityException(&exception)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ValidateAvailabilityException() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateAvailabilityException() error: %v", err)
+			}
+			if exception.SlotMinutes != tt.wantSlotMinutes {
+				t.Errorf("slotMinutes = %d, want %d", exception.SlotMinutes, tt.wantSlotMinutes)
+			}
+		})
+	}
+}
+
+func TestOpenSlots(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	utc := func(value string) time.Time {
+		t.Helper()
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+	// 09:00-10:00 on Saturdays and Sundays, in half-hour slots.
+	weekend := []models.AvailabilityWindow{
+		{Weekday: 6, Start: "09:00", End: "10:00", SlotMinutes: 30},
+		{Weekday: 0, Start: "09:00", End: "10:00", SlotMinutes: 30},
+	}
+
+	tests := []struct {
+		name       string
+		exceptions []*models.AvailabilityException
+		booked     []*models.Appointment
+		from, to   string
+		want       []string
+	}{
+		{
+			name: "clocks go forward",
+			from: "2026-03-07T00:00:00Z", to: "2026-03-09T00:00:00Z",
+			want: []string{"2026-03-07T14:00:00Z", "2026-03-07T14:30:00Z", "2026-03-08T13:00:00Z", "2026-03-08T13:30:00Z"},
+		},
+		{
+			name: "clocks go back",
+			from: "2026-10-31T00:00:00Z", to: "2026-11-02T00:00:00Z",
+			want: []string{"2026-10-31T13:00:00Z", "2026-10-31T13:30:00Z", "2026-11-01T14:00:00Z", "2026-11-01T14:30:00Z"},
+		},
+		{
+			name: "search bounds cut slots",
+			from: "2026-03-07T14:15:00Z", to: "2026-03-08T13:30:00Z",
+			want: []string{"2026-03-07T14:30:00Z", "2026-03-08T13:00:00Z"},
+		},
+		{
+			name: "blocked period and booking",
+			exceptions: []*models.AvailabilityException{
+				{StartsAt: utc("2026-03-08T00:00:00Z"), EndsAt: utc("2026-03-08T13:10:00Z")},
+			},
+			booked: []*models.Appointment{{StartsAt: utc("2026-03-07T14:30:00Z"), EndsAt: utc("2026-03-07T15:00:00Z")}},
+			from:   "2026-03-07T00:00:00Z", to: "2026-03-09T00:00:00Z",
+			want: []string{"2026-03-07T14:00:00Z", "2026-03-08T13:30:00Z"},
+		},
+		{
+			name: "extra hours",
+			exceptions: []*models.AvailabilityException{
+				{StartsAt: utc("2026-03-09T18:00:00Z"), EndsAt: utc("2026-03-09T18:50:00Z"), Available: true, SlotMinutes: 20},
+			},
+			from: "2026-03-09T00:00:00Z", to: "2026-03-10T00:00:00Z",
+			want: []string{"2026-03-09T18:00:00Z", "2026-03-09T18:20:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doctor := slotDoctor{id: 9, name: "Dr. Rao", timezone: loc.String()}
+			slots := openSlots(doctor, loc, weekend, tt.exceptions, tt.booked, utc(tt.from), utc(tt.to))
+			got := make([]string, len(slots))
+			for i, slot := range slots {
+				got[i] = slot.StartsAt.Format(time.RFC3339)
+				if slot.DocID != doctor.id || slot.Timezone != loc.String() {
+					t.Errorf("slot %s belongs to doctor %d in %s", got[i], slot.DocID, slot.Timezone)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("openSlots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
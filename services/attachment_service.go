@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// attachmentColumns lists the attachments columns in the order scanAttachment expects them.
+const attachmentColumns = "id, created_at, presId, position, fileName, contentType, size, pages, COALESCE(objectKey, ''), COALESCE(thumbnailKey, ''), status, messageId"
+
+func scanAttachment(row pgx.Row, attachment *models.Attachment) error {
+	return row.Scan(&attachment.ID, &attachment.CreatedAt, &attachment.PresID, &attachment.Position,
+		&attachment.FileName, &attachment.ContentType, &attachment.Size, &attachment.Pages,
+		&attachment.ObjectKey, &attachment.ThumbnailKey, &attachment.Status, &attachment.MessageID)
+}
+
+type AttachmentService struct {
+	db *pgxpool.Pool
+}
+
+func NewAttachmentService(db *pgxpool.Pool) *AttachmentService {
+	return &AttachmentService{db: db}
+}
+
+// CreateAttachmentUploads records attachments together with the outbox jobs that
+// store their files, so no file is accepted without a durable upload attempt.
+// uploads[i] holds the files of attachments[i]: the original and any thumbnail.
+func (s *AttachmentService) CreateAttachmentUploads(ctx context.Context, attachments []*models.Attachment, uploads [][]*models.UploadJob) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := createAttachmentUploads(ctx, tx, attachments, uploads); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func createAttachmentUploads(ctx context.Context, tx pgx.Tx, attachments []*models.Attachment, uploads [][]*models.UploadJob) error {
+	for i, attachment := range attachments {
+		if attachment.Status == "" {
+			attachment.Status = models.AttachmentStatusPending
+		}
+		err := tx.QueryRow(ctx,
+			`INSERT INTO attachments (presId, position, fileName, contentType, size, pages, objectKey, status, messageId)
+			 VALUES ($1, $2, $3, $4, $5, $6, '', $7, $8)
+			 RETURNING id, created_at`,
+			attachment.PresID, attachment.Position, attachment.FileName, attachment.ContentType,
+			attachment.Size, attachment.Pages, attachment.Status, attachment.MessageID,
+		).Scan(&attachment.ID, &attachment.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range uploads[i] {
+			job.AttachmentID, job.PresID, job.Size = attachment.ID, attachment.PresID, int64(len(job.Data))
+			if job.Kind == "" {
+				job.Kind = models.UploadKindOriginal
+			}
+			err = tx.QueryRow(ctx,
+				`INSERT INTO upload_outbox (attachmentId, presId, kind, objectKey, contentType, size, data)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)
+				 RETURNING id, created_at, status, nextAttemptAt`,
+				job.AttachmentID, job.PresID, job.Kind, job.ObjectKey, job.ContentType, job.Size, job.Data,
+			).Scan(&job.ID, &job.CreatedAt, &job.Status, &job.NextAttemptAt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetPrescriptionAttachments retrieves the attachments of a prescription in
+// upload order, without the files sent in its message thread.
+func (s *AttachmentService) GetPrescriptionAttachments(ctx context.Context, presID int64) ([]*models.Attachment, error) {
+	return prescriptionAttachments(ctx, s.db, presID)
+}
+
+func prescriptionAttachments(ctx context.Context, q querier, presID int64) ([]*models.Attachment, error) {
+	rows, err := q.Query(ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE presId = $1 AND messageId IS NULL ORDER BY position, id",
+		presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make([]*models.Attachment, 0)
+	for rows.Next() {
+		attachment := &models.Attachment{}
+		if err := scanAttachment(rows, attachment); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// GetAttachment retrieves an attachment by ID
+func (s *AttachmentService) GetAttachment(ctx context.Context, attachmentID int64) (*models.Attachment, error) {
+	attachment := &models.Attachment{}
+	err := scanAttachment(s.db.QueryRow(ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE id = $1",
+		attachmentID), attachment)
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
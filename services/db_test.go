@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to the database in TEST_DATABASE_URL and runs the
+// migrations. Tests that need a database are skipped when it is not set; use a
+// scratch database, as they leave their rows behind.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	pool, err := database.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if err := database.RunMigrations(ctx, pool); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return pool
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNotShareable is returned when sharing a prescription that is not finalized or has expired.
+var ErrNotShareable = errors.New("only finalized, unexpired prescriptions can be shared with a pharmacy")
+
+// ErrNotDispensable is returned when dispensing against a prescription that is
+// not finalized, has expired or is no longer shared with the pharmacy.
+var ErrNotDispensable = errors.New("prescription cannot be dispensed")
+
+// ErrOverDispense is returned when a dispensing would exceed the prescribed quantity.
+var ErrOverDispense = errors.New("dispensing exceeds the prescribed quantity")
+
+// dispensingEpsilon absorbs floating point error when comparing quantities.
+const dispensingEpsilon = 1e-9
+
+const shareColumns = "id, created_at, presId, pharmacyId, userId, revokedAt"
+
+func scanShare(row pgx.Row, share *models.PrescriptionShare) error {
+	return row.Scan(&share.ID, &share.CreatedAt, &share.PresID, &share.PharmacyID, &share.UserID, &share.RevokedAt)
+}
+
+const dispensingColumns = "id, created_at, presId, itemId, pharmacyId, quantity, batchNumber, COALESCE(note, '')"
+
+func scanDispensing(row pgx.Row, dispensing *models.Dispensing) error {
+	return row.Scan(&dispensing.ID, &dispensing.CreatedAt, &dispensing.PresID, &dispensing.ItemID,
+		&dispensing.PharmacyID, &dispensing.Quantity, &dispensing.BatchNumber, &dispensing.Note)
+}
+
+type DispensingService struct {
+	db *pgxpool.Pool
+}
+
+func NewDispensingService(db *pgxpool.Pool) *DispensingService {
+	return &DispensingService{db: db}
+}
+
+// SharePrescription gives a pharmacy access to a finalized, unexpired
+// prescription on behalf of its patient. Sharing again restores a revoked share.
+func (s *DispensingService) SharePrescription(ctx context.Context, prescription *models.Prescription, pharmacyID int64) (*models.PrescriptionShare, error) {
+	if prescription.Status != models.PrescriptionStatusFinalized || IsExpired(prescription, time.Now()) {
+		return nil, ErrNotShareable
+	}
+	if _, err := NewPharmacyService(s.db).GetPharmacy(ctx, pharmacyID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("pharmacy %d: %w", pharmacyID, err)
+		}
+		return nil, err
+	}
+
+	share := &models.PrescriptionShare{}
+	err := scanShare(s.db.QueryRow(ctx,
+		`INSERT INTO prescription_shares (presId, pharmacyId, userId)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (presId, pharmacyId) DO UPDATE SET revokedAt = NULL, created_at = NOW()
+		 RETURNING `+shareColumns,
+		prescription.ID, pharmacyID, prescription.UserID), share)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// RevokeShare withdraws a pharmacy's access to a prescription. Dispensings it
+// already recorded are kept.
+func (s *DispensingService) RevokeShare(ctx context.Context, presID, pharmacyID int64) (*models.PrescriptionShare, error) {
+	share := &models.PrescriptionShare{}
+	err := scanShare(s.db.QueryRow(ctx,
+		`UPDATE prescription_shares SET revokedAt = COALESCE(revokedAt, NOW())
+		 WHERE presId = $1 AND pharmacyId = $2
+		 RETURNING `+shareColumns,
+		presID, pharmacyID), share)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// GetPrescriptionShares lists the pharmacies a prescription was shared with, including revoked shares.
+func (s *DispensingService) GetPrescriptionShares(ctx context.Context, presID int64) ([]*models.PrescriptionShare, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+shareColumns+" FROM prescription_shares WHERE presId = $1 ORDER BY created_at, id", presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]*models.PrescriptionShare, 0)
+	for rows.Next() {
+		share := &models.PrescriptionShare{}
+		if err := scanShare(rows, share); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// IsSharedWith reports whether a prescription is currently shared with a pharmacy.
+func (s *DispensingService) IsSharedWith(ctx context.Context, presID, pharmacyID int64) (bool, error) {
+	var shared bool
+	err := s.db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM prescription_shares WHERE presId = $1 AND pharmacyId = $2 AND revokedAt IS NULL)",
+		presID, pharmacyID).Scan(&shared)
+	return shared, err
+}
+
+// GetPharmacyPrescriptions lists the prescriptions currently shared with a pharmacy, most recently shared first.
+func (s *DispensingService) GetPharmacyPrescriptions(ctx context.Context, pharmacyID int64) ([]*models.Prescription, error) {
+	return NewPrescriptionService(s.db).queryPrescriptions(ctx,
+		`SELECT `+prescriptionColumns+` FROM prescriptions
+		 WHERE id IN (SELECT presId FROM prescription_shares WHERE pharmacyId = $1 AND revokedAt IS NULL)
+		 ORDER BY (SELECT created_at FROM prescription_shares WHERE presId = prescriptions.id AND pharmacyId = $1) DESC`,
+		pharmacyID)
+}
+
+// Dispense records what a pharmacy handed out against a shared, finalized
+// prescription. All entries are recorded or none: each must be an approved
+// medicine of the prescription, and the total dispensed per item may not
+// exceed its prescribed quantity. Items without a countable quantity can be
+// dispensed once.
+func (s *DispensingService) Dispense(ctx context.Context, presID, pharmacyID int64, entries []*models.Dispensing) ([]*models.Dispensing, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the prescription so concurrent dispensings are counted one after another.
+	var status string
+	var validUntil *time.Time
+	var shared bool
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(status, 'submitted'), validUntil,
+			EXISTS (SELECT 1 FROM prescription_shares WHERE presId = $1 AND pharmacyId = $2 AND revokedAt IS NULL)
+		 FROM prescriptions WHERE id = $1 FOR UPDATE`,
+		presID, pharmacyID).Scan(&status, &validUntil, &shared)
+	if err != nil {
+		return nil, err
+	}
+	if !shared {
+		return nil, fmt.Errorf("%w: it is not shared with this pharmacy", ErrNotDispensable)
+	}
+	if status != models.PrescriptionStatusFinalized {
+		return nil, fmt.Errorf("%w: it is %s", ErrNotDispensable, status)
+	}
+	if validUntil != nil && !time.Now().Before(*validUntil) {
+		return nil, fmt.Errorf("%w: it expired on %s", ErrNotDispensable, validUntil.UTC().Format(time.DateOnly))
+	}
+
+	recorded := make([]*models.Dispensing, 0, len(entries))
+	for _, entry := range entries {
+		item := &models.Items{}
+		err := scanItem(tx.QueryRow(ctx, "SELECT "+itemColumns+" FROM items WHERE id = $1", entry.ItemID), item)
+		if err != nil || item.PresID != presID {
+			return nil, fmt.Errorf("item %d: %w", entry.ItemID, pgx.ErrNoRows)
+		}
+		if item.Type != "med" || !item.Approved {
+			return nil, fmt.Errorf("%w: item %d is not an approved medicine", ErrNotDispensable, item.ID)
+		}
+
+		var dispensed float64
+		var count int
+		err = tx.QueryRow(ctx,
+			"SELECT COALESCE(SUM(quantity), 0), COUNT(*) FROM dispensings WHERE itemId = $1",
+			item.ID).Scan(&dispensed, &count)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case item.Quantity > 0 && dispensed+entry.Quantity > item.Quantity+dispensingEpsilon:
+			return nil, fmt.Errorf("%w: %s has %s of %s left", ErrOverDispense, item.Name,
+				formatNumber(item.Quantity-dispensed), formatNumber(item.Quantity))
+		case item.Quantity == 0 && count > 0:
+			return nil, fmt.Errorf("%w: %s was already dispensed", ErrOverDispense, item.Name)
+		}
+
+		dispensing := &models.Dispensing{
+			PresID:      presID,
+			ItemID:      item.ID,
+			PharmacyID:  pharmacyID,
+			Quantity:    entry.Quantity,
+			BatchNumber: strings.TrimSpace(entry.BatchNumber),
+			Note:        strings.TrimSpace(entry.Note),
+		}
+		err = tx.QueryRow(ctx,
+			`INSERT INTO dispensings (presId, itemId, pharmacyId, quantity, batchNumber, note)
+			 VALUES ($1, $2, $3, $4, $5, $6)
+			 RETURNING id, created_at`,
+			dispensing.PresID, dispensing.ItemID, dispensing.PharmacyID, dispensing.Quantity, dispensing.BatchNumber, dispensing.Note,
+		).Scan(&dispensing.ID, &dispensing.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, dispensing)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// GetDispensing reports how much of each approved medicine of a prescription
+// has been dispensed, with every dispensing record.
+func (s *DispensingService) GetDispensing(ctx context.Context, presID int64) (*models.PrescriptionDispensing, error) {
+	items, err := prescriptionItems(ctx, s.db, presID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, "SELECT "+dispensingColumns+" FROM dispensings WHERE presId = $1 ORDER BY created_at, id", presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byItem := make(map[int64][]*models.Dispensing)
+	for rows.Next() {
+		dispensing := &models.Dispensing{}
+		if err := scanDispensing(rows, dispensing); err != nil {
+			return nil, err
+		}
+		byItem[dispensing.ItemID] = append(byItem[dispensing.ItemID], dispensing)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &models.PrescriptionDispensing{PresID: presID, Status: models.DispensingStatusComplete, Items: make([]*models.ItemDispensing, 0)}
+	anyDispensed := false
+	for _, item := range items {
+		if item.Type != "med" || !item.Approved {
+			continue
+		}
+		state := &models.ItemDispensing{
+			ItemID:      item.ID,
+			Name:        item.Name,
+			Prescribed:  item.Quantity,
+			Status:      models.DispensingStatusNone,
+			Dispensings: byItem[item.ID],
+		}
+		if state.Dispensings == nil {
+			state.Dispensings = make([]*models.Dispensing, 0)
+		}
+		for _, dispensing := range state.Dispensings {
+			state.Dispensed += dispensing.Quantity
+		}
+		if item.Quantity > 0 {
+			state.Remaining = max(item.Quantity-state.Dispensed, 0)
+		}
+		switch {
+		case len(state.Dispensings) == 0:
+		case item.Quantity > 0 && state.Remaining > dispensingEpsilon:
+			state.Status = models.DispensingStatusPartial
+		default:
+			state.Status = models.DispensingStatusComplete
+		}
+
+		if state.Status != models.DispensingStatusNone {
+			anyDispensed = true
+		}
+		if state.Status != models.DispensingStatusComplete {
+			result.Status = models.DispensingStatusPartial
+		}
+		result.Items = append(result.Items, state)
+	}
+	if !anyDispensed {
+		result.Status = models.DispensingStatusNone
+	}
+	return result, nil
+}
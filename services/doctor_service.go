@@ -4,22 +4,62 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const (
+	// DefaultDoctorPageSize and MaxDoctorPageSize bound the page size of a doctor search.
+	DefaultDoctorPageSize = 20
+	MaxDoctorPageSize     = 100
+	// DefaultAvailabilityDays is the period a search by availability covers by default.
+	DefaultAvailabilityDays = 7
+	// MaxAvailabilityCandidates bounds how many of the best matches a search
+	// by availability computes open slots for.
+	MaxAvailabilityCandidates = 200
+)
+
+// doctorColumns lists the doctors columns in the order scanDoctor expects them.
+const doctorColumns = "id, created_at, accuracy, name, phnNumber, speciality, COALESCE(specialityCode, ''), username, email, password"
+
+func scanDoctor(row pgx.Row, doctor *models.Doctor) error {
+	return row.Scan(&doctor.ID, &doctor.CreatedAt, &doctor.Accuracy, &doctor.Name, &doctor.PhnNumber,
+		&doctor.Speciality, &doctor.SpecialityCode, &doctor.Username, &doctor.Email, &doctor.Password)
+}
+
 type DoctorService struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewDoctorService(db *pgx.Conn) *DoctorService {
+func NewDoctorService(db *pgxpool.Pool) *DoctorService {
 	return &DoctorService{db: db}
 }
 
+// resolveSpeciality replaces the doctor's speciality with the matching
+// vocabulary entry. A doctor may leave it empty.
+func (s *DoctorService) resolveSpeciality(ctx context.Context, doctor *models.Doctor) error {
+	if strings.TrimSpace(doctor.Speciality) == "" {
+		doctor.Speciality, doctor.SpecialityCode = "", ""
+		return nil
+	}
+	speciality, err := NewSpecialityService(s.db).Resolve(ctx, doctor.Speciality)
+	if err != nil {
+		return err
+	}
+	doctor.Speciality, doctor.SpecialityCode = speciality.Name, speciality.Code
+	return nil
+}
+
 // CreateDoctor creates a new doctor with hashed password
 func (s *DoctorService) CreateDoctor(ctx context.Context, doctor *models.Doctor) error {
+	if err := s.resolveSpeciality(ctx, doctor); err != nil {
+		return err
+	}
+
 	// Hash the password
 	hashedPassword, err := utils.HashPassword(doctor.Password)
 	if err != nil {
@@ -27,19 +67,13 @@ func (s *DoctorService) CreateDoctor(ctx context.Context, doctor *models.Doctor)
 	}
 
 	err = s.db.QueryRow(ctx,
-		"INSERT INTO doctors (accuracy, name, phnNumber, speciality, username, email, password) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
-		doctor.Accuracy, doctor.Name, doctor.PhnNumber, doctor.Speciality, doctor.Username, doctor.Email, hashedPassword).Scan(&doctor.ID, &doctor.CreatedAt)
+		"INSERT INTO doctors (accuracy, name, phnNumber, speciality, specialityCode, username, email, password) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8) RETURNING id, created_at",
+		doctor.Accuracy, doctor.Name, doctor.PhnNumber, doctor.Speciality, doctor.SpecialityCode, doctor.Username, doctor.Email, hashedPassword).Scan(&doctor.ID, &doctor.CreatedAt)
 	return err
 }
 
 // CreateDoctorWithRequest creates a new doctor from DoctorCreateRequest (accuracy defaults to 0.0)
 func (s *DoctorService) CreateDoctorWithRequest(ctx context.Context, req *models.DoctorCreateRequest) (*models.Doctor, error) {
-	// Hash the password
-	hashedPassword, err := utils.HashPassword(req.Password)
-	if err != nil {
-		return nil, err
-	}
-
 	doctor := &models.Doctor{
 		Accuracy:   0.0, // Initialize accuracy to 0.0 for new doctors
 		Name:       req.Name,
@@ -48,10 +82,19 @@ func (s *DoctorService) CreateDoctorWithRequest(ctx context.Context, req *models
 		Username:   req.Username,
 		Email:      req.Email,
 	}
+	if err := s.resolveSpeciality(ctx, doctor); err != nil {
+		return nil, err
+	}
+
+	// Hash the password
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
 
 	err = s.db.QueryRow(ctx,
-		"INSERT INTO doctors (accuracy, name, phnNumber, speciality, username, email, password) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
-		doctor.Accuracy, doctor.Name, doctor.PhnNumber, doctor.Speciality, doctor.Username, doctor.Email, hashedPassword).Scan(&doctor.ID, &doctor.CreatedAt)
+		"INSERT INTO doctors (accuracy, name, phnNumber, speciality, specialityCode, username, email, password) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8) RETURNING id, created_at",
+		doctor.Accuracy, doctor.Name, doctor.PhnNumber, doctor.Speciality, doctor.SpecialityCode, doctor.Username, doctor.Email, hashedPassword).Scan(&doctor.ID, &doctor.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -59,12 +102,27 @@ func (s *DoctorService) CreateDoctorWithRequest(ctx context.Context, req *models
 	return doctor, nil
 }
 
+// UpdateSpeciality sets a doctor's speciality from the vocabulary.
+func (s *DoctorService) UpdateSpeciality(ctx context.Context, docID int64, speciality string) (*models.Doctor, error) {
+	doctor := &models.Doctor{Speciality: speciality}
+	if err := s.resolveSpeciality(ctx, doctor); err != nil {
+		return nil, err
+	}
+	err := scanDoctor(s.db.QueryRow(ctx,
+		"UPDATE doctors SET speciality = $2, specialityCode = NULLIF($3, '') WHERE id = $1 RETURNING "+doctorColumns,
+		docID, doctor.Speciality, doctor.SpecialityCode), doctor)
+	if err != nil {
+		return nil, err
+	}
+	return doctor, nil
+}
+
 // GetDoctor retrieves a doctor by ID
 func (s *DoctorService) GetDoctor(ctx context.Context, docID int64) (*models.Doctor, error) {
 	doctor := &models.Doctor{}
-	err := s.db.QueryRow(ctx,
-		"SELECT id, created_at, accuracy, name, phnNumber, speciality, username, email, password FROM doctors WHERE id = $1",
-		docID).Scan(&doctor.ID, &doctor.CreatedAt, &doctor.Accuracy, &doctor.Name, &doctor.PhnNumber, &doctor.Speciality, &doctor.Username, &doctor.Email, &doctor.Password)
+	err := scanDoctor(s.db.QueryRow(ctx,
+		"SELECT "+doctorColumns+" FROM doctors WHERE id = $1",
+		docID), doctor)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +132,7 @@ func (s *DoctorService) GetDoctor(ctx context.Context, docID int64) (*models.Doc
 // GetAllDoctors retrieves all doctors
 func (s *DoctorService) GetAllDoctors(ctx context.Context) ([]*models.Doctor, error) {
 	rows, err := s.db.Query(ctx,
-		"SELECT id, created_at, accuracy, name, phnNumber, speciality, username, email, password FROM doctors ORDER BY accuracy DESC")
+		"SELECT "+doctorColumns+" FROM doctors ORDER BY accuracy DESC")
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +141,7 @@ func (s *DoctorService) GetAllDoctors(ctx context.Context) ([]*models.Doctor, er
 	var doctors []*models.Doctor
 	for rows.Next() {
 		doctor := &models.Doctor{}
-		if err := rows.Scan(&doctor.ID, &doctor.CreatedAt, &doctor.Accuracy, &doctor.Name, &doctor.PhnNumber, &doctor.Speciality, &doctor.Username, &doctor.Email, &doctor.Password); err != nil {
+		if err := scanDoctor(rows, doctor); err != nil {
 			return nil, err
 		}
 		doctors = append(doctors, doctor)
@@ -94,9 +152,9 @@ func (s *DoctorService) GetAllDoctors(ctx context.Context) ([]*models.Doctor, er
 // GetDoctorByUsername retrieves a doctor by username
 func (s *DoctorService) GetDoctorByUsername(ctx context.Context, username string) (*models.Doctor, error) {
 	doctor := &models.Doctor{}
-	err := s.db.QueryRow(ctx,
-		"SELECT id, created_at, accuracy, name, phnNumber, speciality, username, email, password FROM doctors WHERE username = $1",
-		username).Scan(&doctor.ID, &doctor.CreatedAt, &doctor.Accuracy, &doctor.Name, &doctor.PhnNumber, &doctor.Speciality, &doctor.Username, &doctor.Email, &doctor.Password)
+	err := scanDoctor(s.db.QueryRow(ctx,
+		"SELECT "+doctorColumns+" FROM doctors WHERE username = $1",
+		username), doctor)
 	if err != nil {
 		return nil, err
 	}
@@ -107,14 +165,14 @@ func (s *DoctorService) GetDoctorByUsername(ctx context.Context, username string
 func (s *DoctorService) GetDoctorByIdentifier(ctx context.Context, identifier string) (*models.Doctor, error) {
 	normalized := strings.TrimSpace(identifier)
 	doctor := &models.Doctor{}
-	err := s.db.QueryRow(ctx,
-		`SELECT id, created_at, accuracy, name, phnNumber, speciality, username, email, password
+	err := scanDoctor(s.db.QueryRow(ctx,
+		`SELECT `+doctorColumns+`
 		 FROM doctors
 		 WHERE LOWER(TRIM(username)) = LOWER(TRIM($1))
 		    OR LOWER(TRIM(email)) = LOWER(TRIM($1))
 		 LIMIT 1`,
 		normalized,
-	).Scan(&doctor.ID, &doctor.CreatedAt, &doctor.Accuracy, &doctor.Name, &doctor.PhnNumber, &doctor.Speciality, &doctor.Username, &doctor.Email, &doctor.Password)
+	), doctor)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +182,7 @@ func (s *DoctorService) GetDoctorByIdentifier(ctx context.Context, identifier st
 // LoginDoctor authenticates a doctor by email and password
 func (s *DoctorService) LoginDoctor(ctx context.Context, email, password string) (*models.Doctor, error) {
 	doctor := &models.Doctor{}
-	err := s.db.QueryRow(ctx, "SELECT id, created_at, accuracy, name, phnNumber, speciality, username, email, password FROM doctors WHERE email = $1", email).Scan(&doctor.ID, &doctor.CreatedAt, &doctor.Accuracy, &doctor.Name, &doctor.PhnNumber, &doctor.Speciality, &doctor.Username, &doctor.Email, &doctor.Password)
+	err := scanDoctor(s.db.QueryRow(ctx, "SELECT "+doctorColumns+" FROM doctors WHERE email = $1", email), doctor)
 	if err != nil {
 		return nil, errors.New("invalid email or password")
 	}
@@ -136,3 +194,95 @@ func (s *DoctorService) LoginDoctor(ctx context.Context, email, password string)
 
 	return doctor, nil
 }
+
+// likePrefix escapes the LIKE wildcards in s and appends %, so it matches
+// strings starting with s.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// SearchDoctors finds doctors matching the query, best matches first: names
+// or usernames (or a word of the name) starting with the query text, then
+// names similar to it by trigrams (which tolerates misspellings), then by
+// accuracy. A search by availability only considers doctors with weekly hours
+// or extra hours in the period, computes slots for the best
+// MaxAvailabilityCandidates of them and keeps those with an open slot.
+func (s *DoctorService) SearchDoctors(ctx context.Context, query *models.DoctorSearchQuery, now time.Time) (*models.DoctorSearchResult, error) {
+	result := &models.DoctorSearchResult{Doctors: make([]*models.DoctorSearchHit, 0), Page: query.Page, PageSize: query.PageSize}
+
+	var specialityCode string
+	if query.Speciality != "" {
+		speciality, err := NewSpecialityService(s.db).Resolve(ctx, query.Speciality)
+		if err != nil {
+			return nil, err
+		}
+		specialityCode = speciality.Code
+	}
+
+	// Open slots are computed from the schedules in Go, so the candidates are
+	// read up front and the page cut afterwards.
+	text := strings.ToLower(strings.TrimSpace(query.Query))
+	limit, offset := query.PageSize, (query.Page-1)*query.PageSize
+	if query.Available {
+		limit, offset = MaxAvailabilityCandidates, 0
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT d.id, COALESCE(d.name, ''), COALESCE(d.username, ''), COALESCE(d.speciality, ''),
+		        COALESCE(d.specialityCode, ''), COALESCE(d.accuracy, 0), COALESCE(sc.timezone, 'UTC'),
+		        CASE WHEN $1 = '' THEN 0
+		             ELSE GREATEST(similarity(LOWER(COALESCE(d.name, '')), $1), similarity(LOWER(COALESCE(d.username, '')), $1)) END AS score,
+		        COUNT(*) OVER ()
+		 FROM doctors d
+		 LEFT JOIN doctor_schedules sc ON sc.docId = d.id
+		 WHERE ($1 = '' OR LOWER(d.name) LIKE $2 OR LOWER(d.name) LIKE '% ' || $2 OR LOWER(d.username) LIKE $2
+		        OR LOWER(d.name) % $1 OR LOWER(d.username) % $1)
+		   AND ($3 = '' OR d.specialityCode = $3)
+		   AND COALESCE(d.accuracy, 0) >= $4
+		   AND (NOT $5 OR sc.docId IS NOT NULL)
+		 ORDER BY ($1 <> '' AND (LOWER(d.name) LIKE $2 OR LOWER(d.name) LIKE '% ' || $2 OR LOWER(d.username) LIKE $2)) DESC,
+		          score DESC, d.accuracy DESC NULLS LAST, d.id
+		 LIMIT $6 OFFSET $7`,
+		text, likePrefix(text), specialityCode, query.MinAccuracy, query.Available, limit, offset,
+		query.AvailableFrom, query.AvailableTo)
+	if err != nil {
+		return nil, err
+	}
+	timezones := make(map[int64]string)
+	for rows.Next() {
+		hit := &models.DoctorSearchHit{}
+		var timezone string
+		if err := rows.Scan(&hit.ID, &hit.Name, &hit.Username, &hit.Speciality, &hit.SpecialityCode,
+			&hit.Accuracy, &timezone, &hit.Score, &result.Total); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		timezones[hit.ID] = timezone
+		result.Doctors = append(result.Doctors, hit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !query.Available {
+		return result, nil
+	}
+
+	result.Truncated = result.Total > MaxAvailabilityCandidates
+	appointments := NewAppointmentService(s.db)
+	available := make([]*models.DoctorSearchHit, 0)
+	for _, hit := range result.Doctors {
+		slot, err := appointments.NextSlot(ctx, hit, timezones[hit.ID], query.AvailableFrom, query.AvailableTo, now)
+		if err != nil {
+			return nil, err
+		}
+		if slot != nil {
+			hit.NextSlot = slot
+			available = append(available, hit)
+		}
+	}
+	result.Total = len(available)
+	start := min((query.Page-1)*query.PageSize, len(available))
+	result.Doctors = available[start:min(start+query.PageSize, len(available))]
+	return result, nil
+}
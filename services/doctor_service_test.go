@@ -0,0 +1,23 @@
+package services
+
+import "testing"
+
+func TestLikePrefix(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "rao", want: `rao%`},
+		{text: "", want: `%`},
+		{text: "100%", want: `100\%%`},
+		{text: "dr_rao", want: `dr\_rao%`},
+		{text: `a\b`, want: `a\\b%`},
+		{text: `\%_`, want: `\\\%\_%`},
+	}
+
+	for _, tt := range tests {
+		if got := likePrefix(tt.text); got != tt.want {
+			t.Errorf("likePrefix(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+// ErrInvalidDosage is returned when a dosage fails parsing or validation.
+var ErrInvalidDosage = errors.New("invalid dosage")
+
+// doseUnits maps accepted spellings to the canonical unit stored on items.
+var doseUnits = map[string]string{
+	"mg": "mg", "milligram": "mg", "milligrams": "mg",
+	"g": "g", "gm": "g", "gram": "g", "grams": "g",
+	"mcg": "mcg", "µg": "mcg", "ug": "mcg", "microgram": "mcg", "micrograms": "mcg",
+	"ml": "ml", "milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml",
+	"iu": "iu", "unit": "unit", "units": "unit",
+	"tab": "tab", "tabs": "tab", "tablet": "tab", "tablets": "tab",
+	"cap": "cap", "caps": "cap", "capsule": "cap", "capsules": "cap",
+	"drop": "drop", "drops": "drop", "gtt": "drop", "gtts": "drop",
+	"puff": "puff", "puffs": "puff",
+	"spray": "spray", "sprays": "spray",
+	"sachet": "sachet", "sachets": "sachet",
+	"patch": "patch", "patches": "patch",
+	"tsp": "tsp", "teaspoon": "tsp", "teaspoons": "tsp",
+	"tbsp": "tbsp", "tablespoon": "tbsp", "tablespoons": "tbsp",
+	"application": "application", "applications": "application",
+	"supp": "suppository", "suppository": "suppository", "suppositories": "suppository",
+}
+
+// countableUnits are units whose totals translate directly into a dispensable quantity.
+var countableUnits = map[string]bool{
+	"tab": true, "cap": true, "drop": true, "puff": true, "spray": true, "sachet": true,
+	"patch": true, "tsp": true, "tbsp": true, "ml": true, "application": true, "suppository": true,
+}
+
+// doseRoutes maps accepted spellings to the canonical route of administration.
+var doseRoutes = map[string]string{
+	"po": "oral", "oral": "oral", "orally": "oral",
+	"iv": "iv", "intravenous": "iv",
+	"im": "im", "intramuscular": "im",
+	"sc": "sc", "sq": "sc", "subcut": "sc", "subcutaneous": "sc",
+	"sl": "sublingual", "sublingual": "sublingual",
+	"top": "topical", "topical": "topical", "ext": "topical",
+	"inh": "inhalation", "inhaled": "inhalation", "inhalation": "inhalation",
+	"pr": "rectal", "rectal": "rectal",
+	"pv": "vaginal", "vaginal": "vaginal",
+	"nasal": "nasal", "intranasal": "nasal",
+	"eye": "ophthalmic", "ophthalmic": "ophthalmic",
+	"ear": "otic", "otic": "otic",
+	"transdermal": "transdermal",
+}
+
+// frequencyCodes maps prescription shorthand to a canonical code and daily count.
+var frequencyCodes = map[string]struct {
+	code     string
+	times    int
+	asNeeded bool
+}{
+	"od": {"OD", 1, false}, "qd": {"OD", 1, false}, "daily": {"OD", 1, false},
+	"bd": {"BID", 2, false}, "bid": {"BID", 2, false},
+	"tds": {"TID", 3, false}, "tid": {"TID", 3, false},
+	"qds": {"QID", 4, false}, "qid": {"QID", 4, false},
+	"hs": {"HS", 1, false}, "qhs": {"HS", 1, false},
+	"stat": {"STAT", 1, false},
+	"prn":  {"", 0, true}, "sos": {"", 0, true},
+}
+
+// frequencyPhrases rewrites common long-hand phrases into shorthand tokens before tokenizing.
+// Longer phrases come first so "three times a day" wins over "a day".
+var frequencyPhrases = []struct {
+	pattern *regexp.Regexp
+	repl    string
+}{
+	{regexp.MustCompile(`\bevery\s+(\d+)\s*(?:hours?|hrs?|h)\b`), " q${1}h "},
+	{regexp.MustCompile(`\b(?:four times|4 times)\s+(?:a day|daily|per day)\b`), " qid "},
+	{regexp.MustCompile(`\b(?:three times|thrice|3 times)\s+(?:a day|daily|per day)\b`), " tds "},
+	{regexp.MustCompile(`\b(?:twice|two times|2 times)\s+(?:a day|daily|per day)\b`), " bd "},
+	{regexp.MustCompile(`\b(?:once|one time|1 time)\s+(?:a day|daily|per day)\b`), " od "},
+	{regexp.MustCompile(`\b(?:at bedtime|at night)\b`), " hs "},
+	{regexp.MustCompile(`\b(?:as needed|when required|if needed|as required)\b`), " prn "},
+	{regexp.MustCompile(`\bby mouth\b`), " po "},
+}
+
+var (
+	dosePatternRe  = regexp.MustCompile(`^\d+(?:\.\d+)?(?:-\d+(?:\.\d+)?){2,3}$`)
+	intervalCodeRe = regexp.MustCompile(`^q(\d{1,2})h$`)
+	amountUnitRe   = regexp.MustCompile(`^(\d+(?:\.\d+)?)([a-zµ]+)$`)
+	numberRe       = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+	durationJoinRe = regexp.MustCompile(`^x(\d+)([a-z]*)$`)
+
+	abbreviationDotRe = regexp.MustCompile(`([a-z])\.`)
+)
+
+// durationDays converts a duration amount and unit ("days", "wk", "months") into days.
+func durationDays(amount int, unit string) (int, bool) {
+	switch unit {
+	case "", "d", "day", "days":
+		return amount, true
+	case "w", "wk", "wks", "week", "weeks":
+		return amount * 7, true
+	case "m", "mo", "month", "months":
+		return amount * 30, true
+	}
+	return 0, false
+}
+
+// ParseDosage parses common prescription shorthand such as "1-0-1 x 5 days",
+// "500 mg PO BID for 1 week" or "2 puffs q6h prn" into a structured dosage.
+// Words the parser does not recognise are kept as free-text instructions.
+func ParseDosage(sig string) (models.Dosage, error) {
+	var dosage models.Dosage
+
+	text := strings.ToLower(strings.TrimSpace(sig))
+	if text == "" {
+		return dosage, fmt.Errorf("%w: empty dosage", ErrInvalidDosage)
+	}
+	text = strings.NewReplacer("×", " x ", "½", "0.5", ",", " ", ";", " ").Replace(text)
+	// Drop dots from abbreviations like "b.i.d." while keeping decimals such as 2.5.
+	text = abbreviationDotRe.ReplaceAllString(text, "$1")
+	for _, phrase := range frequencyPhrases {
+		text = phrase.pattern.ReplaceAllString(text, phrase.repl)
+	}
+
+	tokens := strings.Fields(text)
+	var extra []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+
+		switch {
+		case dosePatternRe.MatchString(token):
+			dosage.Frequency = token
+			continue
+		case token == "x" || token == "for":
+			if numberRe.MatchString(next) {
+				amount, _ := strconv.Atoi(strings.SplitN(next, ".", 2)[0])
+				unit := ""
+				if i+2 < len(tokens) {
+					if _, ok := durationDays(1, tokens[i+2]); ok {
+						unit = tokens[i+2]
+						i++
+					}
+				}
+				days, _ := durationDays(amount, unit)
+				dosage.DurationDays = days
+				i++
+				continue
+			}
+			if m := amountUnitRe.FindStringSubmatch(next); m != nil {
+				amount, _ := strconv.Atoi(strings.SplitN(m[1], ".", 2)[0])
+				if days, ok := durationDays(amount, m[2]); ok {
+					dosage.DurationDays = days
+					i++
+					continue
+				}
+			}
+		}
+
+		if m := durationJoinRe.FindStringSubmatch(token); m != nil {
+			amount, _ := strconv.Atoi(m[1])
+			if days, ok := durationDays(amount, m[2]); ok {
+				dosage.DurationDays = days
+				continue
+			}
+		}
+		if freq, ok := frequencyCodes[token]; ok {
+			if freq.asNeeded {
+				// "q6h prn" keeps its interval; PRN only marks the dose as optional.
+				dosage.AsNeeded = true
+				continue
+			}
+			dosage.Frequency = freq.code
+			dosage.TimesPerDay = freq.times
+			continue
+		}
+		if m := intervalCodeRe.FindStringSubmatch(token); m != nil {
+			hours, _ := strconv.Atoi(m[1])
+			if hours == 0 || 24%hours != 0 {
+				return dosage, fmt.Errorf("%w: unsupported interval %q", ErrInvalidDosage, token)
+			}
+			dosage.Frequency = strings.ToUpper(token)
+			dosage.TimesPerDay = 24 / hours
+			continue
+		}
+		if route, ok := doseRoutes[token]; ok {
+			dosage.Route = route
+			continue
+		}
+		if numberRe.MatchString(token) {
+			amount, _ := strconv.ParseFloat(token, 64)
+			if unit, ok := doseUnits[next]; ok {
+				dosage.DoseAmount = amount
+				dosage.DoseUnit = unit
+				i++
+				continue
+			}
+			if days, ok := durationDays(int(amount), next); ok && next != "" {
+				dosage.DurationDays = days
+				i++
+				continue
+			}
+		}
+		if m := amountUnitRe.FindStringSubmatch(token); m != nil {
+			amount, _ := strconv.ParseFloat(m[1], 64)
+			if unit, ok := doseUnits[m[2]]; ok {
+				dosage.DoseAmount = amount
+				dosage.DoseUnit = unit
+				continue
+			}
+			if days, ok := durationDays(int(amount), m[2]); ok {
+				dosage.DurationDays = days
+				continue
+			}
+		}
+		extra = append(extra, token)
+	}
+
+	if dosage.Frequency == "" && dosage.DoseAmount == 0 && dosage.DurationDays == 0 && !dosage.AsNeeded && dosage.Route == "" {
+		return dosage, fmt.Errorf("%w: could not understand %q", ErrInvalidDosage, sig)
+	}
+	dosage.Instructions = strings.Join(extra, " ")
+
+	if err := NormalizeDosage(&dosage); err != nil {
+		return dosage, err
+	}
+	return dosage, nil
+}
+
+// patternDoses returns the per-slot amounts of a "1-0-1" style pattern.
+func patternDoses(frequency string) ([]float64, bool) {
+	if !dosePatternRe.MatchString(frequency) {
+		return nil, false
+	}
+	parts := strings.Split(frequency, "-")
+	doses := make([]float64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, false
+		}
+		doses[i] = value
+	}
+	return doses, true
+}
+
+// NormalizeDosage canonicalises units, routes and frequency codes, derives
+// TimesPerDay and Quantity where they can be inferred, and validates ranges.
+func NormalizeDosage(dosage *models.Dosage) error {
+	dosage.DoseUnit = strings.ToLower(strings.TrimSpace(dosage.DoseUnit))
+	if dosage.DoseUnit != "" {
+		unit, ok := doseUnits[dosage.DoseUnit]
+		if !ok {
+			return fmt.Errorf("%w: unknown dose unit %q", ErrInvalidDosage, dosage.DoseUnit)
+		}
+		dosage.DoseUnit = unit
+	}
+
+	dosage.Route = strings.ToLower(strings.TrimSpace(dosage.Route))
+	if dosage.Route != "" {
+		route, ok := doseRoutes[dosage.Route]
+		if !ok {
+			return fmt.Errorf("%w: unknown route %q", ErrInvalidDosage, dosage.Route)
+		}
+		dosage.Route = route
+	}
+
+	frequency := strings.ToLower(strings.TrimSpace(dosage.Frequency))
+	slotDoses, isPattern := patternDoses(frequency)
+	switch {
+	case frequency == "":
+	case isPattern:
+		times := 0
+		for _, dose := range slotDoses {
+			if dose > 0 {
+				times++
+			}
+		}
+		if times == 0 {
+			return fmt.Errorf("%w: dose pattern %q has no doses", ErrInvalidDosage, frequency)
+		}
+		dosage.TimesPerDay = times
+	default:
+		if freq, ok := frequencyCodes[frequency]; ok && freq.asNeeded {
+			frequency = ""
+			dosage.TimesPerDay = 0
+			dosage.AsNeeded = true
+		} else if ok {
+			frequency = freq.code
+			dosage.TimesPerDay = freq.times
+		} else if m := intervalCodeRe.FindStringSubmatch(frequency); m != nil {
+			hours, _ := strconv.Atoi(m[1])
+			if hours == 0 || 24%hours != 0 {
+				return fmt.Errorf("%w: unsupported interval %q", ErrInvalidDosage, dosage.Frequency)
+			}
+			frequency = strings.ToUpper(frequency)
+			dosage.TimesPerDay = 24 / hours
+		} else {
+			return fmt.Errorf("%w: unknown frequency %q", ErrInvalidDosage, dosage.Frequency)
+		}
+	}
+	dosage.Frequency = frequency
+
+	if isPattern && dosage.DoseAmount == 0 {
+		// A uniform pattern such as 1-0-1 implies one unit per administration.
+		uniform := 0.0
+		for _, dose := range slotDoses {
+			if dose == 0 {
+				continue
+			}
+			if uniform != 0 && dose != uniform {
+				uniform = -1
+				break
+			}
+			uniform = dose
+		}
+		if uniform > 0 {
+			dosage.DoseAmount = uniform
+		}
+	}
+
+	switch {
+	case dosage.DoseAmount < 0 || math.IsNaN(dosage.DoseAmount) || math.IsInf(dosage.DoseAmount, 0):
+		return fmt.Errorf("%w: dose amount must be a positive number", ErrInvalidDosage)
+	case dosage.DoseAmount > 0 && dosage.DoseUnit == "" && !isPattern:
+		return fmt.Errorf("%w: dose unit is required with a dose amount", ErrInvalidDosage)
+	case dosage.TimesPerDay < 0 || dosage.TimesPerDay > 24:
+		return fmt.Errorf("%w: timesPerDay must be between 0 and 24", ErrInvalidDosage)
+	case dosage.DurationDays < 0 || dosage.DurationDays > 365:
+		return fmt.Errorf("%w: durationDays must be between 0 and 365", ErrInvalidDosage)
+	case dosage.Quantity < 0:
+		return fmt.Errorf("%w: quantity must not be negative", ErrInvalidDosage)
+	}
+
+	if dosage.Quantity == 0 && dosage.DurationDays > 0 && !dosage.AsNeeded {
+		dosage.Quantity = courseQuantity(*dosage, slotDoses)
+	}
+	dosage.Instructions = strings.TrimSpace(dosage.Instructions)
+	return nil
+}
+
+// courseQuantity computes the total dose units for the whole course when the
+// unit is countable (tablets, ml, puffs...); strengths such as mg yield zero.
+func courseQuantity(dosage models.Dosage, slotDoses []float64) float64 {
+	if dosage.DoseUnit != "" && !countableUnits[dosage.DoseUnit] {
+		return 0
+	}
+	perDay := 0.0
+	if len(slotDoses) > 0 && (dosage.DoseUnit == "" || dosage.DoseAmount == 0) {
+		for _, dose := range slotDoses {
+			perDay += dose
+		}
+	} else {
+		perDay = dosage.DoseAmount * float64(dosage.TimesPerDay)
+	}
+	return perDay * float64(dosage.DurationDays)
+}
+
+// DosageSummary renders a dosage as one line for printing, e.g.
+// "1 tab oral BID for 5 days (qty 10). Take after food".
+func DosageSummary(dosage models.Dosage) string {
+	var parts []string
+	if dosage.DoseAmount > 0 {
+		parts = append(parts, strings.TrimSpace(formatNumber(dosage.DoseAmount)+" "+dosage.DoseUnit))
+	}
+	if dosage.Route != "" {
+		parts = append(parts, dosage.Route)
+	}
+	if dosage.Frequency != "" {
+		parts = append(parts, dosage.Frequency)
+	} else if dosage.TimesPerDay > 0 {
+		parts = append(parts, fmt.Sprintf("%d times a day", dosage.TimesPerDay))
+	}
+	if dosage.AsNeeded {
+		parts = append(parts, "as needed")
+	}
+	if dosage.DurationDays > 0 {
+		parts = append(parts, fmt.Sprintf("for %d days", dosage.DurationDays))
+	}
+	if dosage.Quantity > 0 {
+		parts = append(parts, "(qty "+formatNumber(dosage.Quantity)+")")
+	}
+	summary := strings.Join(parts, " ")
+	if dosage.Instructions != "" {
+		if summary != "" {
+			summary += ". "
+		}
+		summary += dosage.Instructions
+	}
+	return summary
+}
+
+// MergeDosage overlays the explicitly set fields of override onto base.
+func MergeDosage(base, override models.Dosage) models.Dosage {
+	if override.DoseAmount != 0 {
+		base.DoseAmount = override.DoseAmount
+	}
+	if override.DoseUnit != "" {
+		base.DoseUnit = override.DoseUnit
+	}
+	if override.Route != "" {
+		base.Route = override.Route
+	}
+	if override.Frequency != "" {
+		base.Frequency = override.Frequency
+		base.TimesPerDay = override.TimesPerDay
+	} else if override.TimesPerDay != 0 {
+		base.TimesPerDay = override.TimesPerDay
+	}
+	if override.AsNeeded {
+		base.AsNeeded = true
+	}
+	if override.DurationDays != 0 {
+		base.DurationDays = override.DurationDays
+	}
+	if override.Quantity != 0 {
+		base.Quantity = override.Quantity
+	}
+	if override.Instructions != "" {
+		base.Instructions = override.Instructions
+	}
+	return base
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestParseDosage(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  string
+		want models.Dosage
+	}{
+		{
+			name: "dose pattern with duration",
+			sig:  "1-0-1 x 5 days",
+			want: models.Dosage{DoseAmount: 1, Frequency: "1-0-1", TimesPerDay: 2, DurationDays: 5, Quantity: 10},
+		},
+		{
+			name: "strength, route and weeks",
+			sig:  "500 mg PO BID for 1 week",
+			want: models.Dosage{DoseAmount: 500, DoseUnit: "mg", Route: "oral", Frequency: "BID", TimesPerDay: 2, DurationDays: 7},
+		},
+		{
+			name: "interval as needed",
+			sig:  "2 puffs q6h prn",
+			want: models.Dosage{DoseAmount: 2, DoseUnit: "puff", Frequency: "Q6H", TimesPerDay: 4, AsNeeded: true},
+		},
+		{
+			name: "dotted abbreviation, joined duration and instructions",
+			sig:  "1 tab b.i.d. after food x5d",
+			want: models.Dosage{DoseAmount: 1, DoseUnit: "tab", Frequency: "BID", TimesPerDay: 2, DurationDays: 5, Quantity: 10, Instructions: "after food"},
+		},
+		{
+			name: "long-hand interval",
+			sig:  "10 ml every 8 hours for 3 days",
+			want: models.Dosage{DoseAmount: 10, DoseUnit: "ml", Frequency: "Q8H", TimesPerDay: 3, DurationDays: 3, Quantity: 90},
+		},
+		{
+			name: "long-hand frequency",
+			sig:  "1 cap twice a day by mouth",
+			want: models.Dosage{DoseAmount: 1, DoseUnit: "cap", Route: "oral", Frequency: "BID", TimesPerDay: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDosage(tt.sig)
+			if err != nil {
+				t.Fatalf("ParseDosage(%q) error: %v", tt.sig, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDosage(%q) = %+v, want %+v", tt.sig, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDosageInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  string
+	}{
+		{name: "empty", sig: "  "},
+		{name: "interval not dividing the day", sig: "1 tab q5h"},
+		{name: "pattern without doses", sig: "0-0-0 x 5 days"},
+		{name: "nothing recognised", sig: "take with water"},
+		{name: "duration too long", sig: "1 tab od x 400 days"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDosage(tt.sig); !errors.Is(err, ErrInvalidDosage) {
+				t.Errorf("ParseDosage(%q) error = %v, want ErrInvalidDosage", tt.sig, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeDosage(t *testing.T) {
+	tests := []struct {
+		name    string
+		dosage  models.Dosage
+		want    models.Dosage
+		wantErr bool
+	}{
+		{
+			name:   "canonical spellings",
+			dosage: models.Dosage{DoseAmount: 2, DoseUnit: "Tablets", Route: "PO", Frequency: "tds", DurationDays: 3},
+			want:   models.Dosage{DoseAmount: 2, DoseUnit: "tab", Route: "oral", Frequency: "TID", TimesPerDay: 3, DurationDays: 3, Quantity: 18},
+		},
+		{
+			name:   "prn frequency marks as needed",
+			dosage: models.Dosage{DoseAmount: 1, DoseUnit: "tab", Frequency: "SOS", TimesPerDay: 3},
+			want:   models.Dosage{DoseAmount: 1, DoseUnit: "tab", AsNeeded: true},
+		},
+		{
+			name:   "explicit quantity is kept",
+			dosage: models.Dosage{DoseAmount: 1, DoseUnit: "tab", Frequency: "od", DurationDays: 10, Quantity: 14},
+			want:   models.Dosage{DoseAmount: 1, DoseUnit: "tab", Frequency: "OD", TimesPerDay: 1, DurationDays: 10, Quantity: 14},
+		},
+		{name: "unknown unit", dosage: models.Dosage{DoseAmount: 1, DoseUnit: "bottle"}, wantErr: true},
+		{name: "unknown route", dosage: models.Dosage{Route: "intrathecal"}, wantErr: true},
+		{name: "unknown frequency", dosage: models.Dosage{Frequency: "weekly"}, wantErr: true},
+		{name: "amount without unit", dosage: models.Dosage{DoseAmount: 5, Frequency: "od"}, wantErr: true},
+		{name: "negative amount", dosage: models.Dosage{DoseAmount: -1, DoseUnit: "mg"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dosage := tt.dosage
+			err := NormalizeDosage(&dosage)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidDosage) {
+					t.Errorf("NormalizeDosage(%+v) error = %v, want ErrInvalidDosage", tt.dosage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeDosage(%+v) error: %v", tt.dosage, err)
+			}
+			if dosage != tt.want {
+				t.Errorf("NormalizeDosage(%+v) = %+v, want %+v", tt.dosage, dosage, tt.want)
+			}
+		})
+	}
+}
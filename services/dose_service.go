@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrDoseNotLoggable is returned when a dose is logged too far ahead of its scheduled time.
+var ErrDoseNotLoggable = errors.New("dose cannot be logged yet")
+
+// doseEarlyLogWindow is how long before its scheduled time a dose may be logged.
+const doseEarlyLogWindow = 2 * time.Hour
+
+// doseColumns lists the doses columns in the order scanDose expects them.
+const doseColumns = "id, created_at, itemId, presId, userId, scheduledAt, amount, status, loggedAt, note"
+
+func scanDose(row pgx.Row, dose *models.Dose) error {
+	return row.Scan(&dose.ID, &dose.CreatedAt, &dose.ItemID, &dose.PresID, &dose.UserID,
+		&dose.ScheduledAt, &dose.Amount, &dose.Status, &dose.LoggedAt, &dose.Note)
+}
+
+// DoseSlot is a planned administration produced by BuildDoseSchedule.
+type DoseSlot struct {
+	At     time.Time
+	Amount float64
+}
+
+// slotClock is an hour:minute time of day.
+type slotClock struct {
+	hour, minute int
+}
+
+// defaultSlotClocks are the times of day used for n doses per day.
+var defaultSlotClocks = map[int][]slotClock{
+	1: {{9, 0}},
+	2: {{9, 0}, {21, 0}},
+	3: {{8, 0}, {14, 0}, {20, 0}},
+	4: {{8, 0}, {12, 0}, {16, 0}, {20, 0}},
+}
+
+// patternSlotClocks are the morning/noon/evening(/night) times for "1-0-1" style patterns.
+var patternSlotClocks = map[int][]slotClock{
+	3: {{8, 0}, {14, 0}, {20, 0}},
+	4: {{8, 0}, {13, 0}, {18, 0}, {22, 0}},
+}
+
+// dailySlots returns the times of day and amounts for one day of the dosage.
+func dailySlots(dosage models.Dosage) ([]slotClock, []float64) {
+	if doses, ok := patternDoses(dosage.Frequency); ok {
+		var clocks []slotClock
+		var amounts []float64
+		for i, amount := range doses {
+			if amount > 0 {
+				clocks = append(clocks, patternSlotClocks[len(doses)][i])
+				amounts = append(amounts, amount)
+			}
+		}
+		return clocks, amounts
+	}
+
+	amountFor := func(n int) []float64 {
+		amounts := make([]float64, n)
+		for i := range amounts {
+			amounts[i] = dosage.DoseAmount
+		}
+		return amounts
+	}
+
+	switch {
+	case dosage.Frequency == "HS":
+		return []slotClock{{21, 0}}, amountFor(1)
+	case strings.HasPrefix(dosage.Frequency, "Q") && strings.HasSuffix(dosage.Frequency, "H"):
+		hours, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(dosage.Frequency, "Q"), "H"))
+		if err == nil && hours > 0 {
+			var clocks []slotClock
+			for h := 0; h < 24; h += hours {
+				clocks = append(clocks, slotClock{(8 + h) % 24, 0})
+			}
+			return clocks, amountFor(len(clocks))
+		}
+	}
+
+	if clocks, ok := defaultSlotClocks[dosage.TimesPerDay]; ok {
+		return clocks, amountFor(len(clocks))
+	}
+
+	// Spread any other count evenly across the day starting at 08:00.
+	var clocks []slotClock
+	step := 24 * 60 / dosage.TimesPerDay
+	for i := 0; i < dosage.TimesPerDay; i++ {
+		minutes := 8*60 + i*step
+		clocks = append(clocks, slotClock{(minutes / 60) % 24, minutes % 60})
+	}
+	return clocks, amountFor(len(clocks))
+}
+
+// BuildDoseSchedule expands a dosage into concrete dose times starting at start,
+// using the wall-clock slots of loc. It returns nil for as-needed medicines or
+// dosages without a frequency and duration.
+func BuildDoseSchedule(dosage models.Dosage, start time.Time, loc *time.Location) []DoseSlot {
+	if dosage.AsNeeded || dosage.TimesPerDay <= 0 {
+		return nil
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	start = start.In(loc)
+
+	if dosage.Frequency == "STAT" {
+		return []DoseSlot{{At: start, Amount: dosage.DoseAmount}}
+	}
+	if dosage.DurationDays <= 0 {
+		return nil
+	}
+
+	clocks, amounts := dailySlots(dosage)
+	if len(clocks) == 0 {
+		return nil
+	}
+	total := len(clocks) * dosage.DurationDays
+
+	// Collect the slots of each day in chronological order; a course that starts
+	// mid-day begins at the next slot and runs until the full count is reached.
+	slots := make([]DoseSlot, 0, total)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	for len(slots) < total {
+		var daySlots []DoseSlot
+		for i, clock := range clocks {
+			at := time.Date(day.Year(), day.Month(), day.Day(), clock.hour, clock.minute, 0, 0, loc)
+			if at.Before(start) {
+				continue
+			}
+			daySlots = append(daySlots, DoseSlot{At: at, Amount: amounts[i]})
+		}
+		slices.SortFunc(daySlots, func(a, b DoseSlot) int { return a.At.Compare(b.At) })
+		for _, slot := range daySlots {
+			if len(slots) == total {
+				break
+			}
+			slots = append(slots, slot)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return slots
+}
+
+// remainingSlots drops the slots of a course that are before now, and the
+// first logged of the rest, which were taken or skipped ahead of time.
+func remainingSlots(slots []DoseSlot, now time.Time, logged int) []DoseSlot {
+	i, _ := slices.BinarySearchFunc(slots, now, func(slot DoseSlot, t time.Time) int { return slot.At.Compare(t) })
+	return slots[min(i+logged, len(slots)):]
+}
+
+// CourseStart returns when the dose schedule of an item began: its first
+// dose, or fallback for an item without any.
+func (s *DoseService) CourseStart(ctx context.Context, itemID int64, fallback time.Time) (time.Time, error) {
+	var start *time.Time
+	if err := s.db.QueryRow(ctx, "SELECT MIN(scheduledAt) FROM doses WHERE itemId = $1", itemID).Scan(&start); err != nil {
+		return time.Time{}, err
+	}
+	if start == nil {
+		return fallback, nil
+	}
+	return *start, nil
+}
+
+type DoseService struct {
+	db *pgxpool.Pool
+}
+
+func NewDoseService(db *pgxpool.Pool) *DoseService {
+	return &DoseService{db: db}
+}
+
+// GenerateSchedule replaces the pending future doses of an approved medicine
+// item with the rest of a course that began at start. Doses before now are
+// kept as they are, and every dose already logged ahead of its time uses up
+// the next slot, so the course still ends when it did. The item row is locked
+// for the whole replacement, so concurrent approvals or reschedules of the
+// same item do not both insert the course.
+func (s *DoseService) GenerateSchedule(ctx context.Context, item *models.Items, userID int64, start, now time.Time, loc *time.Location) ([]*models.Dose, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := clearPendingDoses(ctx, tx, item.ID, now); err != nil {
+		return nil, err
+	}
+
+	var logged int
+	err = tx.QueryRow(ctx,
+		"SELECT COUNT(*) FROM doses WHERE itemId = $1 AND status <> $2 AND scheduledAt >= $3",
+		item.ID, models.DoseStatusPending, now).Scan(&logged)
+	if err != nil {
+		return nil, err
+	}
+
+	doses := make([]*models.Dose, 0)
+	slots := remainingSlots(BuildDoseSchedule(item.Dosage, start, loc), now, logged)
+	if len(slots) > 0 {
+		valueParts := make([]string, 0, len(slots))
+		args := make([]interface{}, 0, len(slots)*5+1)
+		args = append(args, pgx.QueryExecModeSimpleProtocol)
+		for i, slot := range slots {
+			base := i*5 + 1
+			valueParts = append(valueParts, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", base, base+1, base+2, base+3, base+4))
+			args = append(args, item.ID, item.PresID, userID, slot.At, slot.Amount)
+		}
+
+		rows, err := tx.Query(ctx,
+			"INSERT INTO doses (itemId, presId, userId, scheduledAt, amount) VALUES "+strings.Join(valueParts, ", ")+" RETURNING "+doseColumns,
+			args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			dose := &models.Dose{}
+			if err := scanDose(rows, dose); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			doses = append(doses, dose)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return doses, nil
+}
+
+// ClearPendingDoses removes the not-yet-logged doses of an item scheduled at
+// or after from, holding the item row lock like GenerateSchedule.
+func (s *DoseService) ClearPendingDoses(ctx context.Context, itemID int64, from time.Time) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := clearPendingDoses(ctx, tx, itemID, from); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// clearPendingDoses locks an item row inside tx and removes its pending doses
+// scheduled at or after from.
+func clearPendingDoses(ctx context.Context, tx pgx.Tx, itemID int64, from time.Time) error {
+	var locked int64
+	if err := tx.QueryRow(ctx, "SELECT id FROM items WHERE id = $1 FOR UPDATE", itemID).Scan(&locked); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx,
+		"DELETE FROM doses WHERE itemId = $1 AND status = $2 AND scheduledAt >= $3",
+		itemID, models.DoseStatusPending, from)
+	return err
+}
+
+// GetDose retrieves a dose by ID
+func (s *DoseService) GetDose(ctx context.Context, doseID int64) (*models.Dose, error) {
+	dose := &models.Dose{}
+	if err := scanDose(s.db.QueryRow(ctx, "SELECT "+doseColumns+" FROM doses WHERE id = $1", doseID), dose); err != nil {
+		return nil, err
+	}
+	return dose, nil
+}
+
+// GetPrescriptionDoses retrieves the doses of a prescription scheduled within [from, to).
+// Zero times leave that side of the range open.
+func (s *DoseService) GetPrescriptionDoses(ctx context.Context, presID int64, from, to time.Time) ([]*models.Dose, error) {
+	query := "SELECT " + doseColumns + " FROM doses WHERE presId = $1"
+	args := []interface{}{presID}
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(" AND scheduledAt >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(" AND scheduledAt < $%d", len(args))
+	}
+	query += " ORDER BY scheduledAt, id"
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	doses := make([]*models.Dose, 0)
+	for rows.Next() {
+		dose := &models.Dose{}
+		if err := scanDose(rows, dose); err != nil {
+			return nil, err
+		}
+		doses = append(doses, dose)
+	}
+	return doses, rows.Err()
+}
+
+// LogDose records a dose as taken or skipped by the patient.
+func (s *DoseService) LogDose(ctx context.Context, doseID int64, status, note string, now time.Time) (*models.Dose, error) {
+	if status != models.DoseStatusTaken && status != models.DoseStatusSkipped {
+		return nil, fmt.Errorf("status must be %q or %q", models.DoseStatusTaken, models.DoseStatusSkipped)
+	}
+
+	dose := &models.Dose{}
+	err := scanDose(s.db.QueryRow(ctx,
+		`UPDATE doses
+		 SET status = $2, note = $3, loggedAt = $4
+		 WHERE id = $1 AND scheduledAt <= $5
+		 RETURNING `+doseColumns,
+		doseID, status, strings.TrimSpace(note), now, now.Add(doseEarlyLogWindow),
+	), dose)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if _, getErr := s.GetDose(ctx, doseID); getErr == nil {
+				return nil, ErrDoseNotLoggable
+			}
+		}
+		return nil, err
+	}
+	return dose, nil
+}
+
+// GetPrescriptionAdherence computes taken/skipped/missed counts per medicine item
+// of a prescription. Doses count as due once their scheduled time has passed
+// or once they are logged, so a dose taken early counts the same as on time.
+func (s *DoseService) GetPrescriptionAdherence(ctx context.Context, presID int64, now time.Time) (*models.PrescriptionAdherence, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT i.id, i.name,
+		        COUNT(d.id),
+		        COUNT(d.id) FILTER (WHERE d.scheduledAt <= $2 OR d.status <> 'pending'),
+		        COUNT(d.id) FILTER (WHERE d.status = 'taken'),
+		        COUNT(d.id) FILTER (WHERE d.status = 'skipped'),
+		        COUNT(d.id) FILTER (WHERE d.status = 'pending' AND d.scheduledAt <= $2)
+		 FROM items i
+		 JOIN doses d ON d.itemId = i.id
+		 WHERE i.presId = $1
+		 GROUP BY i.id, i.name
+		 ORDER BY i.id`,
+		presID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adherence := &models.PrescriptionAdherence{PresID: presID, Items: make([]*models.ItemAdherence, 0)}
+	for rows.Next() {
+		item := &models.ItemAdherence{}
+		if err := rows.Scan(&item.ItemID, &item.Name, &item.Scheduled, &item.Due, &item.Taken, &item.Skipped, &item.Missed); err != nil {
+			return nil, err
+		}
+		item.AdherencePercent = adherencePercent(item.Taken, item.Due)
+
+		adherence.Scheduled += item.Scheduled
+		adherence.Due += item.Due
+		adherence.Taken += item.Taken
+		adherence.Skipped += item.Skipped
+		adherence.Missed += item.Missed
+		adherence.Items = append(adherence.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	adherence.AdherencePercent = adherencePercent(adherence.Taken, adherence.Due)
+	return adherence, nil
+}
+
+func adherencePercent(taken, due int) *float64 {
+	if due == 0 {
+		return nil
+	}
+	percent := float64(taken) * 100 / float64(due)
+	percent = float64(int(percent*10+0.5)) / 10
+	return &percent
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+// formatSlots renders slots as "2006-01-02 15:04 MST x<amount>" in loc.
+func formatSlots(slots []DoseSlot, loc *time.Location) []string {
+	formatted := make([]string, len(slots))
+	for i, slot := range slots {
+		formatted[i] = fmt.Sprintf("%s x%g", slot.At.In(loc).Format("2006-01-02 15:04 MST"), slot.Amount)
+	}
+	return formatted
+}
+
+func TestBuildDoseSchedule(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		dosage models.Dosage
+		start  time.Time
+		loc    *time.Location
+		want   []string
+	}{
+		{
+			name:   "twice a day from midnight",
+			dosage: models.Dosage{DoseAmount: 1, Frequency: "BID", TimesPerDay: 2, DurationDays: 2},
+			start:  time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+			loc:    time.UTC,
+			want:   []string{"2026-03-02 09:00 UTC x1", "2026-03-02 21:00 UTC x1", "2026-03-03 09:00 UTC x1", "2026-03-03 21:00 UTC x1"},
+		},
+		{
+			name:   "mid-day start runs until the full count",
+			dosage: models.Dosage{DoseAmount: 1, Frequency: "BID", TimesPerDay: 2, DurationDays: 2},
+			start:  time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC),
+			loc:    time.UTC,
+			want:   []string{"2026-03-02 21:00 UTC x1", "2026-03-03 09:00 UTC x1", "2026-03-03 21:00 UTC x1", "2026-03-04 09:00 UTC x1"},
+		},
+		{
+			name:   "dose pattern keeps per-slot amounts",
+			dosage: models.Dosage{Frequency: "1-0-2", TimesPerDay: 2, DurationDays: 1},
+			start:  time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+			loc:    time.UTC,
+			want:   []string{"2026-03-02 08:00 UTC x1", "2026-03-02 20:00 UTC x2"},
+		},
+		{
+			name:   "interval wraps past midnight",
+			dosage: models.Dosage{DoseAmount: 5, Frequency: "Q8H", TimesPerDay: 3, DurationDays: 1},
+			start:  time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC),
+			loc:    time.UTC,
+			want:   []string{"2026-03-02 08:00 UTC x5", "2026-03-02 16:00 UTC x5", "2026-03-03 00:00 UTC x5"},
+		},
+		{
+			name:   "stat dose at start",
+			dosage: models.Dosage{DoseAmount: 2, Frequency: "STAT", TimesPerDay: 1},
+			start:  time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC),
+			loc:    time.UTC,
+			want:   []string{"2026-03-02 10:30 UTC x2"},
+		},
+		{
+			name:   "wall clock kept across the DST change",
+			dosage: models.Dosage{DoseAmount: 1, Frequency: "OD", TimesPerDay: 1, DurationDays: 2},
+			start:  time.Date(2026, 3, 7, 0, 0, 0, 0, newYork),
+			loc:    newYork,
+			want:   []string{"2026-03-07 09:00 EST x1", "2026-03-08 09:00 EDT x1"},
+		},
+		{
+			name:   "as needed has no schedule",
+			dosage: models.Dosage{DoseAmount: 1, Frequency: "Q6H", TimesPerDay: 4, AsNeeded: true, DurationDays: 5},
+			start:  time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+			loc:    time.UTC,
+			want:   []string{},
+		},
+		{
+			name:   "no duration has no schedule",
+			dosage: models.Dosage{DoseAmount: 1, Frequency: "OD", TimesPerDay: 1},
+			start:  time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+			loc:    time.UTC,
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatSlots(BuildDoseSchedule(tt.dosage, tt.start, tt.loc), tt.loc)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("BuildDoseSchedule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemainingSlots(t *testing.T) {
+	dosage := models.Dosage{DoseAmount: 1, Frequency: "BID", TimesPerDay: 2, DurationDays: 2}
+	slots := BuildDoseSchedule(dosage, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), time.UTC)
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		logged int
+		want   []string
+	}{
+		{
+			name: "before the course",
+			now:  time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+			want: formatSlots(slots, time.UTC),
+		},
+		{
+			name: "past slots are dropped",
+			now:  time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC),
+			want: []string{"2026-03-02 21:00 UTC x1", "2026-03-03 09:00 UTC x1", "2026-03-03 21:00 UTC x1"},
+		},
+		{
+			name: "a slot due now is kept",
+			now:  time.Date(2026, 3, 2, 21, 0, 0, 0, time.UTC),
+			want: []string{"2026-03-02 21:00 UTC x1", "2026-03-03 09:00 UTC x1", "2026-03-03 21:00 UTC x1"},
+		},
+		{
+			name:   "doses logged ahead of time are skipped",
+			now:    time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC),
+			logged: 1,
+			want:   []string{"2026-03-03 09:00 UTC x1", "2026-03-03 21:00 UTC x1"},
+		},
+		{
+			name:   "more logged than remaining",
+			now:    time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC),
+			logged: 3,
+			want:   []string{},
+		},
+		{
+			name: "after the course",
+			now:  time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC),
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatSlots(remainingSlots(slots, tt.now, tt.logged), time.UTC)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("remainingSlots(%s, %d) = %v, want %v", tt.now.Format(time.RFC3339), tt.logged, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MinDrugMatchScore is the lowest similarity at which an item is linked to a catalog entry.
+const MinDrugMatchScore = 0.6
+
+var (
+	drugStrengthRe = regexp.MustCompile(`\d+(?:\.\d+)?\s*(?:mg|mcg|µg|g|ml|iu|%|units?)\b`)
+	drugNonWordRe  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// drugNoiseWords are dosage-form and pharmacopoeia tokens that don't identify the drug.
+var drugNoiseWords = map[string]bool{
+	"tab": true, "tabs": true, "tablet": true, "tablets": true,
+	"cap": true, "caps": true, "capsule": true, "capsules": true,
+	"syrup": true, "syp": true, "suspension": true, "susp": true, "solution": true,
+	"inj": true, "injection": true, "cream": true, "ointment": true, "gel": true,
+	"drops": true, "drop": true, "spray": true, "inhaler": true, "sachet": true,
+	"ip": true, "bp": true, "usp": true, "oral": true,
+}
+
+// NormalizeDrugName reduces a free-text medicine name to the words that identify
+// the drug, e.g. "Tab. PARACETAMOL 500mg IP" becomes "paracetamol".
+func NormalizeDrugName(name string) string {
+	name = strings.ToLower(name)
+	name = drugStrengthRe.ReplaceAllString(name, " ")
+	name = drugNonWordRe.ReplaceAllString(name, " ")
+
+	var words []string
+	for _, word := range strings.Fields(name) {
+		if drugNoiseWords[word] {
+			continue
+		}
+		if strings.Trim(word, "0123456789") == "" {
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// trigrams returns the set of padded three-letter sequences of each word, in the
+// same way Postgres pg_trgm does.
+func trigrams(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(s) {
+		padded := "  " + word + " "
+		runes := []rune(padded)
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+func trigramSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// levenshteinRatio is 1 - editDistance/maxLen, which copes better than trigrams
+// with single-letter misspellings of short names.
+func levenshteinRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// drugIndexEntry is one searchable name (generic or brand) of a catalog drug.
+type drugIndexEntry struct {
+	drug       *models.Drug
+	name       string
+	normalized string
+	trigrams   map[string]bool
+	isBrand    bool
+}
+
+// drugIndexCheckInterval is how often a loaded index compares its catalog
+// version with the database, so imports made by other instances are picked up.
+const drugIndexCheckInterval = 30 * time.Second
+
+// drugIndex caches the catalog in memory for fuzzy matching. It is rebuilt
+// lazily after the catalog changes: at once for imports made by this process,
+// and within drugIndexCheckInterval for imports made by other instances.
+var drugIndex struct {
+	sync.RWMutex
+	loaded     bool
+	version    int64     // catalog version the entries were built from
+	checkedAt  time.Time // when version was last compared with the database
+	generation int64     // bumped by every invalidation
+	entries    []*drugIndexEntry
+}
+
+func invalidateDrugIndex() {
+	drugIndex.Lock()
+	drugIndex.loaded = false
+	drugIndex.entries = nil
+	drugIndex.generation++
+	drugIndex.Unlock()
+}
+
+type DrugCatalogService struct {
+	db *pgxpool.Pool
+}
+
+func NewDrugCatalogService(db *pgxpool.Pool) *DrugCatalogService {
+	return &DrugCatalogService{db: db}
+}
+
+// GetDrug retrieves a catalog entry by ID
+func (s *DrugCatalogService) GetDrug(ctx context.Context, drugID int64) (*models.Drug, error) {
+	drug := &models.Drug{}
+	err := s.db.QueryRow(ctx,
+		"SELECT id, created_at, genericName, brandNames, strengths, forms, atcCode FROM drug_catalog WHERE id = $1",
+		drugID,
+	).Scan(&drug.ID, &drug.CreatedAt, &drug.GenericName, &drug.BrandNames, &drug.Strengths, &drug.Forms, &drug.ATCCode)
+	if err != nil {
+		return nil, err
+	}
+	return drug, nil
+}
+
+// GetAllDrugs retrieves the whole catalog ordered by generic name
+func (s *DrugCatalogService) GetAllDrugs(ctx context.Context) ([]*models.Drug, error) {
+	rows, err := s.db.Query(ctx,
+		"SELECT id, created_at, genericName, brandNames, strengths, forms, atcCode FROM drug_catalog ORDER BY genericName")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drugs []*models.Drug
+	for rows.Next() {
+		drug := &models.Drug{}
+		if err := rows.Scan(&drug.ID, &drug.CreatedAt, &drug.GenericName, &drug.BrandNames, &drug.Strengths, &drug.Forms, &drug.ATCCode); err != nil {
+			return nil, err
+		}
+		drugs = append(drugs, drug)
+	}
+	return drugs, rows.Err()
+}
+
+// ImportDrugs upserts catalog entries keyed by generic name and returns how
+// many were written. The catalog version is bumped with them.
+func (s *DrugCatalogService) ImportDrugs(ctx context.Context, drugs []*models.Drug) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, drug := range drugs {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO drug_catalog (genericName, brandNames, strengths, forms, atcCode)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (genericName) DO UPDATE SET
+				brandNames = EXCLUDED.brandNames, strengths = EXCLUDED.strengths,
+				forms = EXCLUDED.forms, atcCode = EXCLUDED.atcCode`,
+			drug.GenericName, drug.BrandNames, drug.Strengths, drug.Forms, drug.ATCCode)
+		if err != nil {
+			return 0, fmt.Errorf("failed to import %s: %w", drug.GenericName, err)
+		}
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO drug_catalog_version (id, version) VALUES (1, 1)
+		 ON CONFLICT (id) DO UPDATE SET version = drug_catalog_version.version + 1`)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	invalidateDrugIndex()
+	return len(drugs), nil
+}
+
+// catalogVersion returns the version of the catalog in the database.
+func (s *DrugCatalogService) catalogVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := s.db.QueryRow(ctx, "SELECT version FROM drug_catalog_version WHERE id = 1").Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// index returns the cached catalog entries, rebuilding them when they were
+// invalidated or the catalog version in the database moved on. A rebuild only
+// becomes the cache if no invalidation happened while it read the catalog.
+func (s *DrugCatalogService) index(ctx context.Context) ([]*drugIndexEntry, error) {
+	now := time.Now()
+	drugIndex.RLock()
+	loaded, version, checkedAt, generation, entries := drugIndex.loaded, drugIndex.version, drugIndex.checkedAt, drugIndex.generation, drugIndex.entries
+	drugIndex.RUnlock()
+	if loaded && now.Sub(checkedAt) < drugIndexCheckInterval {
+		return entries, nil
+	}
+
+	// Read the version before the catalog, so a change made in between is seen
+	// as newer on the next check.
+	current, err := s.catalogVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if loaded && current == version {
+		drugIndex.Lock()
+		if drugIndex.generation == generation {
+			drugIndex.checkedAt = now
+		}
+		drugIndex.Unlock()
+		return entries, nil
+	}
+
+	drugs, err := s.GetAllDrugs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries = buildDrugIndex(drugs)
+	drugIndex.Lock()
+	if drugIndex.generation == generation {
+		drugIndex.entries = entries
+		drugIndex.version = current
+		drugIndex.checkedAt = now
+		drugIndex.loaded = true
+	}
+	drugIndex.Unlock()
+	return entries, nil
+}
+
+// buildDrugIndex returns the searchable generic and brand names of drugs.
+func buildDrugIndex(drugs []*models.Drug) []*drugIndexEntry {
+	var entries []*drugIndexEntry
+	add := func(drug *models.Drug, name string, isBrand bool) {
+		normalized := NormalizeDrugName(name)
+		if normalized == "" {
+			return
+		}
+		entries = append(entries, &drugIndexEntry{
+			drug:       drug,
+			name:       name,
+			normalized: normalized,
+			trigrams:   trigrams(normalized),
+			isBrand:    isBrand,
+		})
+	}
+	for _, drug := range drugs {
+		add(drug, drug.GenericName, false)
+		for _, brand := range drug.BrandNames {
+			add(drug, brand, true)
+		}
+	}
+	return entries
+}
+
+// SearchDrugs ranks catalog entries by similarity to a free-text name, returning
+// at most limit matches with a score of at least minScore.
+func (s *DrugCatalogService) SearchDrugs(ctx context.Context, query string, limit int, minScore float64) ([]*models.DrugMatch, error) {
+	entries, err := s.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rankDrugs(entries, query, limit, minScore), nil
+}
+
+// rankDrugs scores each drug of entries by its name most similar to query:
+// 1 for the same normalized name, 0.8 when one name extends the other by whole
+// words, and otherwise the better of trigram similarity and edit distance ratio.
+func rankDrugs(entries []*drugIndexEntry, query string, limit int, minScore float64) []*models.DrugMatch {
+	normalized := NormalizeDrugName(query)
+	if normalized == "" {
+		return []*models.DrugMatch{}
+	}
+	queryTrigrams := trigrams(normalized)
+
+	best := map[int64]*models.DrugMatch{}
+	for _, entry := range entries {
+		score := 0.0
+		switch {
+		case entry.normalized == normalized:
+			score = 1
+		case strings.HasPrefix(entry.normalized, normalized+" ") || strings.HasPrefix(normalized, entry.normalized+" "):
+			// "amoxicillin clavulanate" vs "amoxicillin": related but not the same product.
+			score = 0.8
+		default:
+			score = max(trigramSimilarity(queryTrigrams, entry.trigrams), levenshteinRatio(normalized, entry.normalized))
+		}
+		if score < minScore {
+			continue
+		}
+		if current, ok := best[entry.drug.ID]; !ok || score > current.Score {
+			best[entry.drug.ID] = &models.DrugMatch{Drug: entry.drug, MatchedName: entry.name, Score: score}
+		}
+	}
+
+	matches := make([]*models.DrugMatch, 0, len(best))
+	for _, match := range best {
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Drug.GenericName < matches[j].Drug.GenericName
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	for _, match := range matches {
+		match.Score = float64(int(match.Score*1000+0.5)) / 1000
+	}
+	return matches
+}
+
+// MatchDrug returns the best catalog entry for a medicine name, or nil when
+// nothing scores at least MinDrugMatchScore.
+func (s *DrugCatalogService) MatchDrug(ctx context.Context, name string) (*models.DrugMatch, error) {
+	matches, err := s.SearchDrugs(ctx, name, 1, MinDrugMatchScore)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	return matches[0], nil
+}
+
+// LinkItems sets CatalogID and MatchScore on medicine items that aren't linked yet.
+func (s *DrugCatalogService) LinkItems(ctx context.Context, items []*models.Items) error {
+	for _, item := range items {
+		if item.Type != "med" || item.CatalogID != nil {
+			continue
+		}
+		match, err := s.MatchDrug(ctx, item.Name)
+		if err != nil {
+			return err
+		}
+		if match != nil {
+			id := match.Drug.ID
+			item.CatalogID = &id
+			item.MatchScore = match.Score
+		}
+	}
+	return nil
+}
+
+// Autocomplete suggests generic and brand names starting with prefix.
+func (s *DrugCatalogService) Autocomplete(ctx context.Context, prefix string, limit int) ([]*models.DrugSuggestion, error) {
+	entries, err := s.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	suggestions := make([]*models.DrugSuggestion, 0)
+	if prefix == "" {
+		return suggestions, nil
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(strings.ToLower(entry.name), prefix) && !strings.HasPrefix(entry.normalized, prefix) {
+			continue
+		}
+		suggestions = append(suggestions, &models.DrugSuggestion{
+			DrugID:      entry.drug.ID,
+			Name:        entry.name,
+			GenericName: entry.drug.GenericName,
+			IsBrand:     entry.isBrand,
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if len(suggestions[i].Name) != len(suggestions[j].Name) {
+			return len(suggestions[i].Name) < len(suggestions[j].Name)
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// splitList splits a multi-value CSV cell on "|" or ";".
+func splitList(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == '|' || r == ';' })
+	list := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			list = append(list, field)
+		}
+	}
+	return list
+}
+
+// ParseDrugCatalogCSV reads catalog entries from CSV with a header row containing
+// genericName, brandNames, strengths, forms and atcCode (snake_case headers are
+// accepted too). Multi-valued cells separate values with "|" or ";".
+func ParseDrugCatalogCSV(r io.Reader) ([]*models.Drug, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("drug catalog CSV is empty")
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(header), "_", ""))
+		columns[key] = i
+	}
+	genericCol, ok := columns["genericname"]
+	if !ok {
+		return nil, errors.New("drug catalog CSV needs a genericName column")
+	}
+	cell := func(record []string, key string) string {
+		if i, ok := columns[key]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var drugs []*models.Drug
+	for line, record := range records[1:] {
+		if genericCol >= len(record) || strings.TrimSpace(record[genericCol]) == "" {
+			return nil, fmt.Errorf("drug catalog CSV line %d: genericName is required", line+2)
+		}
+		drugs = append(drugs, &models.Drug{
+			GenericName: strings.TrimSpace(record[genericCol]),
+			BrandNames:  splitList(cell(record, "brandnames")),
+			Strengths:   splitList(cell(record, "strengths")),
+			Forms:       splitList(cell(record, "forms")),
+			ATCCode:     strings.ToUpper(cell(record, "atccode")),
+		})
+	}
+	return drugs, nil
+}
+
+// ParseDrugCatalogJSON reads catalog entries from a JSON array of drugs.
+func ParseDrugCatalogJSON(r io.Reader) ([]*models.Drug, error) {
+	var drugs []*models.Drug
+	if err := json.NewDecoder(r).Decode(&drugs); err != nil {
+		return nil, err
+	}
+	for i, drug := range drugs {
+		drug.GenericName = strings.TrimSpace(drug.GenericName)
+		if drug.GenericName == "" {
+			return nil, fmt.Errorf("drug catalog entry %d: genericName is required", i)
+		}
+		drug.ATCCode = strings.ToUpper(strings.TrimSpace(drug.ATCCode))
+		if drug.BrandNames == nil {
+			drug.BrandNames = []string{}
+		}
+		if drug.Strengths == nil {
+			drug.Strengths = []string{}
+		}
+		if drug.Forms == nil {
+			drug.Forms = []string{}
+		}
+	}
+	return drugs, nil
+}
+
+// LoadDrugCatalogFile parses a .csv or .json catalog file.
+func LoadDrugCatalogFile(path string) ([]*models.Drug, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ParseDrugCatalogCSV(f)
+	case ".json":
+		return ParseDrugCatalogJSON(f)
+	}
+	return nil, fmt.Errorf("unsupported drug catalog format %q (use .csv or .json)", filepath.Ext(path))
+}
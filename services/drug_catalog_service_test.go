@@ -0,0 +1,147 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestNormalizeDrugName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Tab. PARACETAMOL 500mg IP", want: "paracetamol"},
+		{name: "Amoxicillin + Clavulanate 625 mg tablets", want: "amoxicillin clavulanate"},
+		{name: "Syp. Cetirizine 5 ml", want: "cetirizine"},
+		{name: "Vitamin D3 60000 IU caps", want: "vitamin d3"},
+		{name: "Insulin glargine 100 units injection", want: "insulin glargine"},
+		{name: "Tab 500", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeDrugName(tt.name); got != tt.want {
+			t.Errorf("NormalizeDrugName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshteinRatio(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{a: "paracetamol", b: "paracetamol", want: 1},
+		{a: "paracetamol", b: "paracetamal", want: 1 - 1.0/11},
+		{a: "abc", b: "xyz", want: 0},
+		{a: "", b: "abc", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := levenshteinRatio(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshteinRatio(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	same := trigramSimilarity(trigrams("cetirizine"), trigrams("cetirizine"))
+	if same != 1 {
+		t.Errorf("similarity of equal names = %v, want 1", same)
+	}
+	near := trigramSimilarity(trigrams("cetirizine"), trigrams("cetrizine"))
+	far := trigramSimilarity(trigrams("cetirizine"), trigrams("metformin"))
+	if near <= far {
+		t.Errorf("similarity of a misspelling (%v) should beat an unrelated name (%v)", near, far)
+	}
+	if got := trigramSimilarity(trigrams(""), trigrams("metformin")); got != 0 {
+		t.Errorf("similarity with an empty name = %v, want 0", got)
+	}
+}
+
+func TestRankDrugs(t *testing.T) {
+	entries := buildDrugIndex([]*models.Drug{
+		{ID: 1, GenericName: "Paracetamol", BrandNames: []string{"Crocin", "Dolo 650"}},
+		{ID: 2, GenericName: "Amoxicillin"},
+		{ID: 3, GenericName: "Amoxicillin Clavulanate", BrandNames: []string{"Augmentin"}},
+		{ID: 4, GenericName: "Metformin"},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []int64
+		score float64
+	}{
+		{name: "exact generic with noise", query: "Tab. Paracetamol 500mg", want: []int64{1}, score: 1},
+		{name: "brand name", query: "DOLO 650", want: []int64{1}, score: 1},
+		{name: "misspelling", query: "paracetamal", want: []int64{1}, score: 0.909},
+		{name: "word prefix ranks after exact", query: "amoxicillin", want: []int64{2, 3}, score: 1},
+		{name: "limit", query: "amoxicillin", limit: 1, want: []int64{2}, score: 1},
+		{name: "no match", query: "warfarin", want: []int64{}},
+		{name: "empty", query: "500 mg", want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := rankDrugs(entries, tt.query, tt.limit, MinDrugMatchScore)
+			got := []int64{}
+			for _, match := range matches {
+				got = append(got, match.Drug.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("rankDrugs(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			if len(matches) > 0 && matches[0].Score != tt.score {
+				t.Errorf("best score = %v, want %v", matches[0].Score, tt.score)
+			}
+		})
+	}
+
+	matches := rankDrugs(entries, "Amoxicillin Clavulanate", 0, MinDrugMatchScore)
+	if len(matches) < 2 || matches[0].Drug.ID != 3 || matches[1].Score != 0.8 {
+		t.Errorf("combination query should rank the combination first and the single drug at 0.8, got %+v", matches)
+	}
+}
+
+func TestParseDrugCatalogCSV(t *testing.T) {
+	csv := "generic_name, brand_names, strengths, forms, atc_code\n" +
+		"Paracetamol,Crocin|Dolo 650 ,500 mg;650 mg,tablet|syrup,n02be01\n" +
+		"Metformin,,,,\n"
+	drugs, err := ParseDrugCatalogCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("ParseDrugCatalogCSV() error = %v", err)
+	}
+	want := []*models.Drug{
+		{
+			GenericName: "Paracetamol",
+			BrandNames:  []string{"Crocin", "Dolo 650"},
+			Strengths:   []string{"500 mg", "650 mg"},
+			Forms:       []string{"tablet", "syrup"},
+			ATCCode:     "N02BE01",
+		},
+		{GenericName: "Metformin", BrandNames: []string{}, Strengths: []string{}, Forms: []string{}},
+	}
+	if !reflect.DeepEqual(drugs, want) {
+		t.Errorf("ParseDrugCatalogCSV() = %+v, want %+v", drugs, want)
+	}
+
+	errorTests := []struct {
+		name string
+		csv  string
+	}{
+		{name: "empty", csv: ""},
+		{name: "no generic column", csv: "name,brandNames\nParacetamol,Crocin\n"},
+		{name: "blank generic name", csv: "genericName,brandNames\n ,Crocin\n"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDrugCatalogCSV(strings.NewReader(tt.csv)); err == nil {
+				t.Error("ParseDrugCatalogCSV() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,773 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/fhir"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type FHIRService struct {
+	db *pgxpool.Pool
+}
+
+func NewFHIRService(db *pgxpool.Pool) *FHIRService {
+	return &FHIRService{db: db}
+}
+
+// Patient maps a user and their health profile to a FHIR Patient.
+func (s *FHIRService) Patient(ctx context.Context, userID int64) (*fhir.Patient, error) {
+	user, err := NewUserService(s.db).GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := NewHealthProfileService(s.db).GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return fhir.NewPatient(user, profile), nil
+}
+
+// Practitioner maps a doctor to a FHIR Practitioner.
+func (s *FHIRService) Practitioner(ctx context.Context, docID int64) (*fhir.Practitioner, error) {
+	doctor, err := NewDoctorService(s.db).GetDoctor(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+	return fhir.NewPractitioner(doctor), nil
+}
+
+// ItemRequest maps an item to a MedicationRequest, or a ServiceRequest for tests.
+func (s *FHIRService) ItemRequest(ctx context.Context, prescription *models.Prescription, item *models.Items) (fhir.Resource, error) {
+	if item.Type != "med" {
+		return fhir.NewServiceRequest(prescription, item), nil
+	}
+	var drug *models.Drug
+	if item.CatalogID != nil {
+		var err error
+		drug, err = NewDrugCatalogService(s.db).GetDrug(ctx, *item.CatalogID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+	}
+	return fhir.NewMedicationRequest(prescription, item, drug, DosageSummary(item.Dosage)), nil
+}
+
+// PatientRequests maps the items of the given type ("med" or "test") on all of
+// a patient's prescriptions to FHIR requests, newest prescription first.
+func (s *FHIRService) PatientRequests(ctx context.Context, userID int64, itemType string) ([]fhir.Resource, error) {
+	prescriptions, err := NewPrescriptionService(s.db).GetUserPrescriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]fhir.Resource, 0)
+	for _, prescription := range prescriptions {
+		items, err := prescriptionItems(ctx, s.db, prescription.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if (item.Type == "med") != (itemType == "med") {
+				continue
+			}
+			resource, err := s.ItemRequest(ctx, prescription, item)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
+
+// DocumentReference maps the uploaded files of a prescription to a
+// DocumentReference. Each file points at the authenticated download endpoint
+// under baseURL; quarantined and unfinished uploads are left out.
+func (s *FHIRService) DocumentReference(ctx context.Context, prescription *models.Prescription, baseURL string) (*fhir.DocumentReference, error) {
+	attachments, err := prescriptionAttachments(ctx, s.db, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	fileURL := func(attachmentID int64) string {
+		query := url.Values{"id": {strconv.FormatInt(prescription.ID, 10)}, "download": {"true"}}
+		if attachmentID != 0 {
+			query.Set("attachmentId", strconv.FormatInt(attachmentID, 10))
+		}
+		return baseURL + "/api/prescriptions/file?" + query.Encode()
+	}
+
+	var contents []fhir.Attachment
+	for _, attachment := range attachments {
+		if attachment.Status != models.AttachmentStatusUploaded {
+			continue
+		}
+		contents = append(contents, fhir.Attachment{
+			ContentType: attachment.ContentType,
+			URL:         fileURL(attachment.ID),
+			Size:        attachment.Size,
+			Title:       attachment.FileName,
+			Creation:    attachment.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	if len(contents) == 0 {
+		switch {
+		case prescription.ObjectKey != "":
+			contents = append(contents, fhir.Attachment{URL: fileURL(0), Title: "Prescription"})
+		case prescription.Link != "":
+			contents = append(contents, fhir.Attachment{URL: prescription.Link, Title: "Prescription"})
+		}
+	}
+	return fhir.NewDocumentReference(prescription, contents), nil
+}
+
+// PatientDocuments maps every prescription of a patient to a DocumentReference.
+func (s *FHIRService) PatientDocuments(ctx context.Context, userID int64, baseURL string) ([]fhir.Resource, error) {
+	prescriptions, err := NewPrescriptionService(s.db).GetUserPrescriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]fhir.Resource, 0, len(prescriptions))
+	for _, prescription := range prescriptions {
+		document, err := s.DocumentReference(ctx, prescription, baseURL)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, document)
+	}
+	return resources, nil
+}
+
+// FHIRImport is the result of importing a bundle: the transaction-response
+// bundle for the caller and the prescriptions and items that were created.
+type FHIRImport struct {
+	Response      *fhir.Bundle
+	Prescriptions []int64
+	Items         []*models.Items
+	// CourseStarts holds, by item ID, when the requests that gave an authoredOn were issued.
+	CourseStarts map[int64]time.Time
+}
+
+// importPatient is a Patient entry of an incoming bundle. existing is set when
+// its email belongs to a user of this server, who is then left unchanged.
+type importPatient struct {
+	entry     int
+	user      *models.User
+	birthDate string
+	existing  bool
+}
+
+// importRequest is a MedicationRequest or ServiceRequest entry, resolved to
+// the item it becomes and the prescription group it belongs to.
+type importRequest struct {
+	entry     int
+	kind      string
+	patient   string
+	requester string
+	docID     int64
+	group     string
+	reasons   []string
+	authored  time.Time
+	order     bool
+	item      *models.Items
+}
+
+// importValidator collects the OperationOutcome issues of a bundle.
+type importValidator struct {
+	outcome fhir.OperationOutcome
+}
+
+func (v *importValidator) add(code, expression, format string, args ...interface{}) {
+	v.outcome.Issue = append(v.outcome.Issue, fhir.Issue{
+		Severity:    fhir.SeverityError,
+		Code:        code,
+		Diagnostics: fmt.Sprintf(format, args...),
+		Expression:  []string{expression},
+	})
+}
+
+func humanName(names []fhir.HumanName) string {
+	for _, name := range names {
+		if text := strings.TrimSpace(name.Text); text != "" {
+			return text
+		}
+		if full := strings.TrimSpace(strings.Join(append(slices.Clone(name.Given), name.Family), " ")); full != "" {
+			return full
+		}
+	}
+	return ""
+}
+
+func contact(points []fhir.ContactPoint, system string) string {
+	for _, point := range points {
+		if point.System == system && strings.TrimSpace(point.Value) != "" {
+			return strings.TrimSpace(point.Value)
+		}
+	}
+	return ""
+}
+
+// localID parses a reference such as "Patient/12" to a local resource.
+func localID(reference, resourceType string) (int64, bool) {
+	value, ok := strings.CutPrefix(reference, resourceType+"/")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	return id, err == nil
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ImportBundle creates patients and prescriptions from a FHIR transaction or
+// collection bundle. Patients are matched to existing users by email and
+// practitioners to registered doctors by identifier or email. Requests are
+// grouped into prescriptions by groupIdentifier (requisition for tests), or by
+// patient and requester when absent; each prescription is created awaiting
+// its doctor's review, with active orders already approved.
+//
+// The whole bundle is validated first and imported in one transaction. When
+// it is invalid, nothing is written and the returned error is a
+// *fhir.OperationOutcome listing every problem.
+func (s *FHIRService) ImportBundle(ctx context.Context, bundle *fhir.Bundle) (*FHIRImport, error) {
+	v := &importValidator{outcome: fhir.OperationOutcome{ResourceType: "OperationOutcome"}}
+	if bundle.ResourceType != "Bundle" {
+		v.add(fhir.IssueInvalid, "resourceType", "expected a Bundle, got %q", bundle.ResourceType)
+		return nil, &v.outcome
+	}
+	if bundle.Type != "transaction" && bundle.Type != "collection" {
+		v.add(fhir.IssueNotSupported, "Bundle.type", "bundle type %q is not supported; use transaction or collection", bundle.Type)
+		return nil, &v.outcome
+	}
+
+	patients := make(map[string]*importPatient) // by fullUrl and Patient/<id> alias
+	var patientList []*importPatient
+	doctors := make(map[string]int64) // practitioner aliases to doctor IDs
+	practitionerEntries := make(map[int]int64)
+	var requests []*importRequest
+	emails := make(map[string]bool)
+
+	for i, entry := range bundle.Entry {
+		path := fmt.Sprintf("Bundle.entry[%d].resource", i)
+		var header struct {
+			ResourceType string `json:"resourceType"`
+			ID           string `json:"id"`
+		}
+		if err := json.Unmarshal(entry.Resource, &header); err != nil {
+			v.add(fhir.IssueInvalid, path, "resource is not valid JSON: %v", err)
+			continue
+		}
+		aliases := []string{}
+		if entry.FullURL != "" {
+			aliases = append(aliases, entry.FullURL)
+		}
+		if header.ID != "" {
+			aliases = append(aliases, header.ResourceType+"/"+header.ID)
+		}
+
+		switch header.ResourceType {
+		case "Patient":
+			var resource fhir.Patient
+			if err := json.Unmarshal(entry.Resource, &resource); err != nil {
+				v.add(fhir.IssueInvalid, path, "invalid Patient: %v", err)
+				continue
+			}
+			patient := &importPatient{entry: i, user: &models.User{
+				Name:      humanName(resource.Name),
+				Email:     strings.ToLower(contact(resource.Telecom, "email")),
+				PhnNumber: contact(resource.Telecom, "phone"),
+			}, birthDate: resource.BirthDate}
+			if patient.user.Name == "" {
+				v.add(fhir.IssueRequired, path+".name", "patient name is required")
+			}
+			if patient.user.Email == "" {
+				v.add(fhir.IssueRequired, path+".telecom", "patient email is required to match or create an account")
+			} else if emails[patient.user.Email] {
+				v.add(fhir.IssueDuplicate, path+".telecom", "patient %s appears more than once", patient.user.Email)
+			}
+			emails[patient.user.Email] = true
+			if patient.birthDate != "" {
+				if _, err := time.Parse("2006-01-02", patient.birthDate); err != nil {
+					v.add(fhir.IssueInvalid, path+".birthDate", "birthDate must be a full date (YYYY-MM-DD)")
+				}
+			}
+			if patient.user.Email != "" {
+				err := s.db.QueryRow(ctx, "SELECT id FROM users WHERE LOWER(email) = $1", patient.user.Email).Scan(&patient.user.ID)
+				switch {
+				case err == nil:
+					patient.existing = true
+				case !errors.Is(err, pgx.ErrNoRows):
+					return nil, err
+				}
+			}
+			patientList = append(patientList, patient)
+			for _, alias := range aliases {
+				patients[alias] = patient
+			}
+
+		case "Practitioner":
+			var resource fhir.Practitioner
+			if err := json.Unmarshal(entry.Resource, &resource); err != nil {
+				v.add(fhir.IssueInvalid, path, "invalid Practitioner: %v", err)
+				continue
+			}
+			docID, err := s.matchDoctor(ctx, &resource)
+			if err != nil {
+				return nil, err
+			}
+			if docID == 0 {
+				v.add(fhir.IssueNotFound, path, "practitioner %q is not a registered doctor; doctors must sign up before prescriptions are imported for them", humanName(resource.Name))
+				continue
+			}
+			practitionerEntries[i] = docID
+			for _, alias := range aliases {
+				doctors[alias] = docID
+			}
+
+		case "MedicationRequest", "ServiceRequest":
+			if request := parseRequest(v, i, header.ResourceType, entry.Resource); request != nil {
+				requests = append(requests, request)
+			}
+
+		default:
+			v.add(fhir.IssueNotSupported, path, "%s resources cannot be imported", header.ResourceType)
+		}
+	}
+
+	// Resolve the references of every request now that all entries are known.
+	for _, request := range requests {
+		path := fmt.Sprintf("Bundle.entry[%d].resource", request.entry)
+		if _, ok := patients[request.patient]; !ok && request.patient != "" {
+			userID, ok := localID(request.patient, "Patient")
+			if !ok {
+				v.add(fhir.IssueNotFound, path+".subject", "subject %q does not refer to a patient in the bundle or on this server", request.patient)
+			} else if _, err := NewUserService(s.db).GetUser(ctx, userID); err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					return nil, err
+				}
+				v.add(fhir.IssueNotFound, path+".subject", "patient %d does not exist", userID)
+			} else {
+				patients[request.patient] = &importPatient{entry: -1, user: &models.User{ID: userID}, existing: true}
+			}
+		}
+	}
+	for _, request := range requests {
+		path := fmt.Sprintf("Bundle.entry[%d].resource.requester", request.entry)
+		reference := request.requester
+		if reference == "" {
+			continue
+		}
+		if docID, ok := doctors[reference]; ok {
+			request.docID = docID
+		} else if docID, ok := localID(reference, "Practitioner"); ok {
+			if _, err := NewDoctorService(s.db).GetDoctor(ctx, docID); err != nil {
+				if !errors.Is(err, pgx.ErrNoRows) {
+					return nil, err
+				}
+				v.add(fhir.IssueNotFound, path, "practitioner %d does not exist", docID)
+			}
+			request.docID = docID
+		} else {
+			v.add(fhir.IssueNotFound, path, "requester %q does not refer to a practitioner in the bundle or on this server", reference)
+		}
+	}
+	if len(v.outcome.Issue) > 0 {
+		return nil, &v.outcome
+	}
+
+	// Group requests into prescriptions, keeping bundle order.
+	type group struct {
+		patient *importPatient
+		docID   int64
+		reasons []string
+		items   []*models.Items
+	}
+	groups := make(map[string]*group)
+	var groupOrder []string
+	for _, request := range requests {
+		key := request.group
+		if key == "" {
+			key = request.patient + "|" + strconv.FormatInt(request.docID, 10)
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{patient: patients[request.patient], docID: request.docID}
+			groups[key] = g
+			groupOrder = append(groupOrder, key)
+		} else if g.patient != patients[request.patient] || g.docID != request.docID {
+			v.add(fhir.IssueInvalid, fmt.Sprintf("Bundle.entry[%d].resource", request.entry),
+				"requests of one prescription must share the same subject and requester")
+			continue
+		}
+		for _, reason := range request.reasons {
+			if !slices.Contains(g.reasons, reason) {
+				g.reasons = append(g.reasons, reason)
+			}
+		}
+		g.items = append(g.items, request.item)
+	}
+	if len(v.outcome.Issue) > 0 {
+		return nil, &v.outcome
+	}
+
+	items := make([]*models.Items, 0, len(requests))
+	for _, request := range requests {
+		items = append(items, request.item)
+	}
+	if err := NewDrugCatalogService(s.db).LinkItems(ctx, items); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, patient := range patientList {
+		if patient.existing {
+			continue
+		}
+		// Imported patients get an unguessable password; they cannot sign in
+		// until one is set for them.
+		password, err := randomPassword()
+		if err != nil {
+			return nil, err
+		}
+		hashed, err := utils.HashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.QueryRow(ctx,
+			"INSERT INTO users (name, phnNumber, email, password) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+			patient.user.Name, patient.user.PhnNumber, patient.user.Email, hashed).Scan(&patient.user.ID, &patient.user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if patient.birthDate != "" {
+			_, err = tx.Exec(ctx,
+				"INSERT INTO health_profiles (userId, dateOfBirth) VALUES ($1, $2) ON CONFLICT (userId) DO NOTHING",
+				patient.user.ID, patient.birthDate)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	const importNote = "imported from FHIR"
+	result := &FHIRImport{CourseStarts: make(map[int64]time.Time)}
+	for _, key := range groupOrder {
+		g := groups[key]
+		var presID int64
+		err := tx.QueryRow(ctx,
+			`INSERT INTO prescriptions (docId, userId, symptoms, link, seenByPatient, status, statusChangedAt)
+			 VALUES ($1, $2, $3, '', FALSE, $4, NOW())
+			 RETURNING id`,
+			g.docID, g.patient.user.ID, strings.Join(g.reasons, "; "), models.PrescriptionStatusSubmitted).Scan(&presID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(ctx,
+			`INSERT INTO prescription_status_history (presId, fromStatus, toStatus, actorRole, actorId, note)
+			 VALUES ($1, '', $2, $3, 0, $4)`,
+			presID, models.PrescriptionStatusSubmitted, models.StatusActorSystem, importNote)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range g.items {
+			item.PresID = presID
+			err := tx.QueryRow(ctx,
+				`INSERT INTO items (presId, name, type, aiReasons, docReason, approved, catalogId, matchScore,
+					doseAmount, doseUnit, route, frequency, timesPerDay, asNeeded, durationDays, quantity, instructions)
+				 VALUES ($1, $2, $3, '', $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+				 RETURNING id, created_at`,
+				item.PresID, item.Name, item.Type, item.DocReason, item.Approved, item.CatalogID, item.MatchScore,
+				item.DoseAmount, item.DoseUnit, item.Route, item.Frequency, item.TimesPerDay, item.AsNeeded, item.DurationDays, item.Quantity, item.Instructions,
+			).Scan(&item.ID, &item.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+			result.Items = append(result.Items, item)
+		}
+
+		if err := recordVersion(ctx, tx, presID, models.StatusActorSystem, 0, importNote); err != nil {
+			return nil, err
+		}
+		if _, err := transitionStatus(ctx, tx, presID, models.PrescriptionStatusAwaitingReview, models.StatusActorSystem, 0, importNote); err != nil {
+			return nil, err
+		}
+		result.Prescriptions = append(result.Prescriptions, presID)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	held, err := s.approveOrders(ctx, requests, result.Prescriptions)
+	if err != nil {
+		// The import itself is committed; orders left unapproved wait for their doctor.
+		log.Printf("approving imported orders failed: %v", err)
+	}
+
+	// Answer each entry in bundle order, as a transaction-response does.
+	responses := make([]fhir.BundleEntry, len(bundle.Entry))
+	for i := range responses {
+		responses[i].Response = &fhir.BundleResponse{Status: "200 OK"}
+	}
+	for _, patient := range patientList {
+		response := responses[patient.entry].Response
+		response.Location = "Patient/" + strconv.FormatInt(patient.user.ID, 10)
+		if !patient.existing {
+			response.Status = "201 Created"
+		}
+	}
+	for _, request := range requests {
+		if !request.authored.IsZero() {
+			result.CourseStarts[request.item.ID] = request.authored
+		}
+		responses[request.entry].Response = &fhir.BundleResponse{
+			Status:   "201 Created",
+			Location: request.kind + "/" + strconv.FormatInt(request.item.ID, 10),
+		}
+		if warnings, ok := held[request.item.ID]; ok {
+			subjects := make([]string, 0, len(warnings))
+			for _, warning := range warnings {
+				subjects = append(subjects, warning.Subject)
+			}
+			responses[request.entry].Response.Outcome = &fhir.OperationOutcome{
+				ResourceType: "OperationOutcome",
+				Issue: []fhir.Issue{{
+					Severity:    fhir.SeverityWarning,
+					Code:        fhir.IssueBusinessRule,
+					Diagnostics: "not approved: serious interactions must be acknowledged by the doctor (" + strings.Join(subjects, "; ") + ")",
+				}},
+			}
+		}
+	}
+	for entry, docID := range practitionerEntries {
+		responses[entry].Response.Location = "Practitioner/" + strconv.FormatInt(docID, 10)
+	}
+	result.Response = &fhir.Bundle{ResourceType: "Bundle", Type: bundle.Type + "-response", Entry: responses}
+	return result, nil
+}
+
+// approveOrders checks the imported prescriptions for interactions and
+// approves the active orders among their items, as a doctor's approval would.
+// Orders with unacknowledged serious interactions stay unapproved for their
+// doctor to review; they are returned by item ID with the blocking warnings.
+func (s *FHIRService) approveOrders(ctx context.Context, requests []*importRequest, presIDs []int64) (map[int64][]*models.PrescriptionWarning, error) {
+	interactionService := NewInteractionService(s.db)
+	held := make(map[int64][]*models.PrescriptionWarning)
+	for _, presID := range presIDs {
+		warnings, err := interactionService.CheckPrescription(ctx, presID)
+		if err != nil {
+			return nil, err
+		}
+		var orders []*importRequest
+		for _, request := range requests {
+			if !request.order || request.item.PresID != presID {
+				continue
+			}
+			if blocking := BlockingWarnings(warnings, request.item.ID); len(blocking) > 0 {
+				held[request.item.ID] = blocking
+				continue
+			}
+			orders = append(orders, request)
+		}
+		if err := s.approveItems(ctx, presID, orders); err != nil {
+			return nil, err
+		}
+	}
+	return held, nil
+}
+
+// approveItems approves the items of the given requests on one prescription,
+// recording a single version for them.
+func (s *FHIRService) approveItems(ctx context.Context, presID int64, requests []*importRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, request := range requests {
+		item, err := setItemApproved(ctx, tx, request.item.ID, true)
+		if err != nil {
+			return err
+		}
+		*request.item = *item
+	}
+	if err := recordVersion(ctx, tx, presID, models.StatusActorSystem, 0, "imported active orders approved"); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// matchDoctor finds the registered doctor a Practitioner describes, by this
+// server's identifier or by email. It returns 0 when there is none.
+func (s *FHIRService) matchDoctor(ctx context.Context, practitioner *fhir.Practitioner) (int64, error) {
+	for _, identifier := range practitioner.Identifier {
+		if identifier.System != fhir.SystemPractitioner {
+			continue
+		}
+		docID, err := strconv.ParseInt(identifier.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, err := NewDoctorService(s.db).GetDoctor(ctx, docID); err == nil {
+			return docID, nil
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, err
+		}
+	}
+	if email := contact(practitioner.Telecom, "email"); email != "" {
+		var docID int64
+		err := s.db.QueryRow(ctx, "SELECT id FROM doctors WHERE LOWER(email) = LOWER($1)", email).Scan(&docID)
+		if err == nil {
+			return docID, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// parseDateTime parses a FHIR dateTime given as a full date or a timestamp.
+func parseDateTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseRequest decodes a MedicationRequest or ServiceRequest entry into the
+// item it becomes. Problems are added to v and nil is returned.
+func parseRequest(v *importValidator, entry int, kind string, raw json.RawMessage) *importRequest {
+	path := fmt.Sprintf("Bundle.entry[%d].resource", entry)
+	request := &importRequest{entry: entry, kind: kind, item: &models.Items{}}
+
+	var (
+		status, intent string
+		authoredOn     string
+		subject        fhir.Reference
+		requester      *fhir.Reference
+		group          *fhir.Identifier
+		reasons        []fhir.CodeableConcept
+		notes          []fhir.Annotation
+	)
+	if kind == "MedicationRequest" {
+		var resource fhir.MedicationRequest
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			v.add(fhir.IssueInvalid, path, "invalid MedicationRequest: %v", err)
+			return nil
+		}
+		status, intent, subject, requester = resource.Status, resource.Intent, resource.Subject, resource.Requester
+		group, reasons, notes, authoredOn = resource.GroupIdentifier, resource.ReasonCode, resource.Note, resource.AuthoredOn
+		request.item.Type = "med"
+		request.item.Name = resource.MedicationCodeableConcept.Label()
+		if request.item.Name == "" {
+			v.add(fhir.IssueRequired, path+".medicationCodeableConcept", "medication name is required")
+		}
+
+		var dosage *fhir.Dosage
+		if len(resource.DosageInstruction) > 0 {
+			dosage = &resource.DosageInstruction[0]
+		}
+		var base models.Dosage
+		if dosage != nil && strings.TrimSpace(dosage.Text) != "" {
+			parsed, err := ParseDosage(dosage.Text)
+			if err != nil {
+				// Keep free text we cannot parse as instructions rather than reject it.
+				parsed = models.Dosage{Instructions: strings.TrimSpace(dosage.Text)}
+			}
+			base = parsed
+		}
+		request.item.Dosage = MergeDosage(base, fhir.DosageFields(dosage))
+		if dispense := resource.DispenseRequest; dispense != nil && dispense.Quantity != nil && request.item.Quantity == 0 {
+			request.item.Quantity = dispense.Quantity.Value
+		}
+		if err := NormalizeDosage(&request.item.Dosage); err != nil {
+			v.add(fhir.IssueInvalid, path+".dosageInstruction[0]", "%v", err)
+		}
+	} else {
+		var resource fhir.ServiceRequest
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			v.add(fhir.IssueInvalid, path, "invalid ServiceRequest: %v", err)
+			return nil
+		}
+		status, intent, subject, requester = resource.Status, resource.Intent, resource.Subject, resource.Requester
+		group, reasons, notes, authoredOn = resource.Requisition, resource.ReasonCode, resource.Note, resource.AuthoredOn
+		request.item.Type = "test"
+		request.item.Name = resource.Code.Label()
+		if request.item.Name == "" {
+			v.add(fhir.IssueRequired, path+".code", "test name is required")
+		}
+	}
+
+	if status != "active" && status != "draft" {
+		v.add(fhir.IssueNotSupported, path+".status", "only active or draft requests can be imported, got %q", status)
+	}
+	// Active orders were already issued by the requester and are approved
+	// once checked for interactions; anything else is a proposal their doctor
+	// still has to approve.
+	request.order = status == "active" && intent == "order"
+
+	if authoredOn != "" {
+		authored, err := parseDateTime(authoredOn)
+		if err != nil {
+			v.add(fhir.IssueInvalid, path+".authoredOn", "authoredOn must be a date or an RFC 3339 timestamp")
+		}
+		request.authored = authored
+	}
+
+	request.patient = subject.Reference
+	if request.patient == "" {
+		v.add(fhir.IssueRequired, path+".subject", "subject is required")
+	}
+	if requester == nil || requester.Reference == "" {
+		v.add(fhir.IssueRequired, path+".requester", "requester is required")
+	} else {
+		request.requester = requester.Reference
+	}
+	if group != nil && group.Value != "" {
+		request.group = group.System + "|" + group.Value
+	}
+	for _, reason := range reasons {
+		if label := strings.TrimSpace(reason.Label()); label != "" {
+			request.reasons = append(request.reasons, label)
+		}
+	}
+	var texts []string
+	for _, note := range notes {
+		if text := strings.TrimSpace(note.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	request.item.DocReason = strings.Join(texts, "\n")
+	return request
+}
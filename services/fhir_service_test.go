@@ -0,0 +1,239 @@
+package services
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/fhir"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestParseRequest(t *testing.T) {
+	const prefix = "Bundle.entry[0].resource"
+
+	tests := []struct {
+		name          string
+		kind          string
+		resource      string
+		wantItem      models.Items
+		wantOrder     bool
+		wantGroup     string
+		wantReasons   []string
+		wantAuthored  string
+		wantIssues    []string // expressions, relative to the resource
+		wantNilResult bool
+	}{
+		{
+			name: "active order with a free-text sig",
+			kind: "MedicationRequest",
+			resource: `{"resourceType":"MedicationRequest","status":"active","intent":"order",
+				"medicationCodeableConcept":{"text":"Amoxicillin"},
+				"subject":{"reference":"Patient/3"},"requester":{"reference":"Practitioner/9"},
+				"authoredOn":"2026-03-01","groupIdentifier":{"system":"urn:clinic","value":"rx-1"},
+				"reasonCode":[{"text":"otitis"},{"text":" "}],"note":[{"text":"check allergy"}],
+				"dosageInstruction":[{"text":"500 mg PO TID x 5 days"}]}`,
+			wantItem: models.Items{Type: "med", Name: "Amoxicillin", DocReason: "check allergy",
+				Dosage: models.Dosage{DoseAmount: 500, DoseUnit: "mg", Route: "oral", Frequency: "TID", TimesPerDay: 3, DurationDays: 5}},
+			wantOrder:    true,
+			wantGroup:    "urn:clinic|rx-1",
+			wantReasons:  []string{"otitis"},
+			wantAuthored: "2026-03-01T00:00:00Z",
+		},
+		{
+			name: "unparseable text kept as instructions, structured dose merged",
+			kind: "MedicationRequest",
+			resource: `{"resourceType":"MedicationRequest","status":"draft","intent":"proposal",
+				"medicationCodeableConcept":{"coding":[{"display":"Salbutamol"}]},
+				"subject":{"reference":"Patient/3"},"requester":{"reference":"Practitioner/9"},
+				"authoredOn":"2026-03-01T09:30:00+05:30",
+				"dosageInstruction":[{"text":"as discussed","doseAndRate":[{"doseQuantity":{"value":2,"unit":"puff"}}]}],
+				"dispenseRequest":{"quantity":{"value":1,"unit":"inhaler"}}}`,
+			wantItem: models.Items{Type: "med", Name: "Salbutamol",
+				Dosage: models.Dosage{DoseAmount: 2, DoseUnit: "puff", Quantity: 1, Instructions: "as discussed"}},
+			wantAuthored: "2026-03-01T04:00:00Z",
+		},
+		{
+			name: "active proposal is not an order",
+			kind: "ServiceRequest",
+			resource: `{"resourceType":"ServiceRequest","status":"active","intent":"plan","code":{"text":"CBC"},
+				"subject":{"reference":"Patient/3"},"requester":{"reference":"Practitioner/9"},
+				"requisition":{"value":"lab-7"}}`,
+			wantItem:  models.Items{Type: "test", Name: "CBC"},
+			wantGroup: "|lab-7",
+		},
+		{
+			name: "missing name, subject and requester",
+			kind: "MedicationRequest",
+			resource: `{"resourceType":"MedicationRequest","status":"active","intent":"order",
+				"subject":{},"requester":{"display":"Dr. Rao"}}`,
+			wantItem:   models.Items{Type: "med"},
+			wantOrder:  true,
+			wantIssues: []string{".medicationCodeableConcept", ".subject", ".requester"},
+		},
+		{
+			name: "completed status and invalid authoredOn",
+			kind: "ServiceRequest",
+			resource: `{"resourceType":"ServiceRequest","status":"completed","intent":"order","code":{"text":"Lipid panel"},
+				"subject":{"reference":"Patient/3"},"requester":{"reference":"Practitioner/9"},"authoredOn":"March 1st"}`,
+			wantItem:   models.Items{Type: "test", Name: "Lipid panel"},
+			wantIssues: []string{".status", ".authoredOn"},
+		},
+		{
+			name: "invalid dosage",
+			kind: "MedicationRequest",
+			resource: `{"resourceType":"MedicationRequest","status":"active","intent":"order",
+				"medicationCodeableConcept":{"text":"Paracetamol"},
+				"subject":{"reference":"Patient/3"},"requester":{"reference":"Practitioner/9"},
+				"dosageInstruction":[{"doseAndRate":[{"doseQuantity":{"value":-5,"unit":"mg"}}]}]}`,
+			wantIssues: []string{".dosageInstruction[0]"},
+		},
+		{
+			name:          "malformed resource",
+			kind:          "MedicationRequest",
+			resource:      `{"resourceType":"MedicationRequest","status":7}`,
+			wantIssues:    []string{""},
+			wantNilResult: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &importValidator{}
+			request := parseRequest(v, 0, tt.kind, json.RawMessage(tt.resource))
+
+			var issues []string
+			for _, issue := range v.outcome.Issue {
+				issues = append(issues, issue.Expression[0])
+			}
+			var wantIssues []string
+			for _, expression := range tt.wantIssues {
+				wantIssues = append(wantIssues, prefix+expression)
+			}
+			if !slices.Equal(issues, wantIssues) {
+				t.Errorf("issues at %v, want %v (%+v)", issues, wantIssues, v.outcome.Issue)
+			}
+			if tt.wantNilResult {
+				if request != nil {
+					t.Errorf("parseRequest() = %+v, want nil", request)
+				}
+				return
+			}
+			if request == nil {
+				t.Fatal("parseRequest() = nil")
+			}
+			if tt.wantItem.Type == "" {
+				// Only the issues matter for this case.
+				return
+			}
+
+			if *request.item != tt.wantItem {
+				t.Errorf("item = %+v, want %+v", *request.item, tt.wantItem)
+			}
+			if request.order != tt.wantOrder || request.group != tt.wantGroup || !slices.Equal(request.reasons, tt.wantReasons) {
+				t.Errorf("order %v, group %q, reasons %v, want %v, %q, %v",
+					request.order, request.group, request.reasons, tt.wantOrder, tt.wantGroup, tt.wantReasons)
+			}
+			if tt.wantAuthored != "" {
+				if got := request.authored.UTC().Format(time.RFC3339); got != tt.wantAuthored {
+					t.Errorf("authored = %s, want %s", got, tt.wantAuthored)
+				}
+			}
+		})
+	}
+}
+
+// TestDosageRoundTrip checks that a normalized dosage exported with
+// fhir.NewDosage is imported back unchanged.
+func TestDosageRoundTrip(t *testing.T) {
+	tests := []models.Dosage{
+		{DoseAmount: 500, DoseUnit: "mg", Route: "oral", Frequency: "BID", TimesPerDay: 2, DurationDays: 5, Instructions: "after food"},
+		{DoseAmount: 2, DoseUnit: "puff", Frequency: "Q6H", TimesPerDay: 4, AsNeeded: true},
+		{DoseAmount: 1, DoseUnit: "tab", TimesPerDay: 1, DurationDays: 14, Quantity: 14},
+	}
+
+	for _, want := range tests {
+		got := fhir.DosageFields(fhir.NewDosage(want, ""))
+		if err := NormalizeDosage(&got); err != nil {
+			t.Fatalf("NormalizeDosage(%+v) error: %v", got, err)
+		}
+		if got != want {
+			t.Errorf("round trip of %+v = %+v", want, got)
+		}
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "2026-03-01", want: "2026-03-01T00:00:00Z"},
+		{value: "2026-03-01T09:30:00Z", want: "2026-03-01T09:30:00Z"},
+		{value: "2026-03-01T09:30:00+05:30", want: "2026-03-01T04:00:00Z"},
+		{value: "2026-03", wantErr: true},
+		{value: "01/03/2026", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDateTime(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseDateTime(%q) = %s, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDateTime(%q) error: %v", tt.value, err)
+			}
+			if s := got.UTC().Format(time.RFC3339); s != tt.want {
+				t.Errorf("parseDateTime(%q) = %s, want %s", tt.value, s, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalID(t *testing.T) {
+	tests := []struct {
+		reference    string
+		resourceType string
+		wantID       int64
+		wantOK       bool
+	}{
+		{reference: "Patient/12", resourceType: "Patient", wantID: 12, wantOK: true},
+		{reference: "Practitioner/9", resourceType: "Patient"},
+		{reference: "Patient/abc", resourceType: "Patient"},
+		{reference: "urn:uuid:5f1c", resourceType: "Patient"},
+		{reference: "https://ehr.example/Patient/12", resourceType: "Patient"},
+	}
+
+	for _, tt := range tests {
+		if id, ok := localID(tt.reference, tt.resourceType); id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("localID(%q, %q) = %d, %v, want %d, %v", tt.reference, tt.resourceType, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func TestHumanName(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []fhir.HumanName
+		want  string
+	}{
+		{name: "text preferred", names: []fhir.HumanName{{Text: "Asha Rao", Given: []string{"A."}, Family: "Rao"}}, want: "Asha Rao"},
+		{name: "given and family", names: []fhir.HumanName{{Given: []string{"Asha", "K."}, Family: "Rao"}}, want: "Asha K. Rao"},
+		{name: "first usable name", names: []fhir.HumanName{{Text: " "}, {Family: "Rao"}}, want: "Rao"},
+		{name: "none", names: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := humanName(tt.names); got != tt.want {
+				t.Errorf("humanName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,498 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/signing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNotFinalized is returned when amending a prescription that was never finalized.
+var ErrNotFinalized = errors.New("prescription is not finalized")
+
+// ErrNotAmendable is returned when amending a finalized prescription that has
+// since expired or been cancelled.
+var ErrNotAmendable = errors.New("only prescriptions that are still finalized can be amended")
+
+// canonicalVersion is bumped whenever the canonical content format changes, so
+// older signatures stay verifiable against the format they were made with.
+const canonicalVersion = 1
+
+// verificationCodeLength is the number of hex characters of the content hash
+// printed on a prescription as its verification code.
+const verificationCodeLength = 16
+
+// VerificationCode returns the code printed on a copy of a prescription with
+// the given content hash. It identifies that exact content without revealing it.
+func VerificationCode(contentHash string) string {
+	if len(contentHash) < verificationCodeLength {
+		return ""
+	}
+	return contentHash[:verificationCodeLength]
+}
+
+func codeMatches(code, contentHash string) bool {
+	expected := VerificationCode(contentHash)
+	return expected != "" && subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1
+}
+
+// canonicalPrescription is the signed content of a finalized prescription. It
+// only holds fields that cannot change without an amendment; seen flags,
+// follow-up dates and upload progress are deliberately left out.
+type canonicalPrescription struct {
+	Version     int    `json:"version"`
+	ID          int64  `json:"id"`
+	UserID      int64  `json:"userId"`
+	DocID       int64  `json:"docId"`
+	CreatedAt   string `json:"createdAt"`
+	FinalizedAt string `json:"finalizedAt"`
+	// Omitted for prescriptions signed before validity periods existed.
+	ValidUntil  string                `json:"validUntil,omitempty"`
+	Symptoms    string                `json:"symptoms"`
+	Items       []canonicalItem       `json:"items"`
+	Attachments []canonicalAttachment `json:"attachments"`
+}
+
+type canonicalItem struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	DocReason string `json:"docReason"`
+	Approved  bool   `json:"approved"`
+	CatalogID *int64 `json:"catalogId"`
+	models.Dosage
+	// Refill fields are omitted while zero, so prescriptions signed before
+	// refills existed keep their content hash.
+	models.RefillPolicy
+}
+
+type canonicalAttachment struct {
+	ID          int64  `json:"id"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// canonicalTime formats t the way Postgres stores it, so a hash computed before
+// the row is written matches one computed after it is read back.
+func canonicalTime(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+}
+
+// CanonicalContent encodes a prescription, its items and attachments in the
+// deterministic form that is hashed and signed. Items and attachments are
+// ordered by ID.
+func CanonicalContent(prescription *models.Prescription, items []*models.Items, attachments []*models.Attachment, finalizedAt time.Time) ([]byte, error) {
+	content := canonicalPrescription{
+		Version:     canonicalVersion,
+		ID:          prescription.ID,
+		UserID:      prescription.UserID,
+		DocID:       prescription.DocID,
+		CreatedAt:   canonicalTime(prescription.CreatedAt),
+		FinalizedAt: canonicalTime(finalizedAt),
+		Symptoms:    prescription.Symptoms,
+		Items:       make([]canonicalItem, 0, len(items)),
+		Attachments: make([]canonicalAttachment, 0, len(attachments)),
+	}
+	if prescription.ValidUntil != nil {
+		content.ValidUntil = canonicalTime(*prescription.ValidUntil)
+	}
+	for _, item := range items {
+		content.Items = append(content.Items, canonicalItem{
+			ID:           item.ID,
+			Name:         item.Name,
+			Type:         item.Type,
+			DocReason:    item.DocReason,
+			Approved:     item.Approved,
+			CatalogID:    item.CatalogID,
+			Dosage:       item.Dosage,
+			RefillPolicy: item.RefillPolicy,
+		})
+	}
+	for _, attachment := range attachments {
+		content.Attachments = append(content.Attachments, canonicalAttachment{
+			ID:          attachment.ID,
+			FileName:    attachment.FileName,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+		})
+	}
+	slices.SortFunc(content.Items, func(a, b canonicalItem) int { return cmp.Compare(a.ID, b.ID) })
+	slices.SortFunc(content.Attachments, func(a, b canonicalAttachment) int { return cmp.Compare(a.ID, b.ID) })
+	return json.Marshal(content)
+}
+
+type FinalizationService struct {
+	db     *pgxpool.Pool
+	signer *signing.Signer
+}
+
+func NewFinalizationService(db *pgxpool.Pool, signer *signing.Signer) *FinalizationService {
+	return &FinalizationService{db: db, signer: signer}
+}
+
+// contentHash loads the current content of a prescription through q and
+// returns its SHA-256 digest.
+func contentHash(ctx context.Context, q querier, prescription *models.Prescription, finalizedAt time.Time) ([]byte, error) {
+	items, err := prescriptionItems(ctx, q, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := prescriptionAttachments(ctx, q, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+	content, err := CanonicalContent(prescription, items, attachments, finalizedAt)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	return sum[:], nil
+}
+
+// sign hashes the prescription's current content inside tx and stores the hash
+// and its signature on the prescription.
+func (s *FinalizationService) sign(ctx context.Context, tx pgx.Tx, prescription *models.Prescription, finalizedAt time.Time) (*models.Prescription, error) {
+	digest, err := contentHash(ctx, tx, prescription, finalizedAt)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.signer.Sign(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := &models.Prescription{}
+	err = scanPrescription(tx.QueryRow(ctx,
+		`UPDATE prescriptions
+		 SET finalizedAt = $2, contentHash = $3, signature = $4, signingKeyId = $5
+		 WHERE id = $1
+		 RETURNING `+prescriptionColumns,
+		prescription.ID, finalizedAt, hex.EncodeToString(digest), signature, s.signer.KeyID(),
+	), signed)
+	if err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// setValidity stores how long a prescription being finalized inside tx stays
+// valid: validityDays from finalizedAt, or the default for its items when
+// validityDays is 0.
+func setValidity(ctx context.Context, tx pgx.Tx, prescription *models.Prescription, finalizedAt time.Time, validityDays int, defaults config.Validity) error {
+	if validityDays == 0 {
+		items, err := prescriptionItems(ctx, tx, prescription.ID)
+		if err != nil {
+			return err
+		}
+		validityDays = DefaultValidityDays(items, defaults)
+	}
+	validUntil := finalizedAt.AddDate(0, 0, validityDays)
+	if _, err := tx.Exec(ctx, "UPDATE prescriptions SET validUntil = $2 WHERE id = $1", prescription.ID, validUntil); err != nil {
+		return err
+	}
+	prescription.ValidUntil = &validUntil
+	return nil
+}
+
+// extendValidity moves the end of a finalized prescription's validity later
+// inside tx when the refills of its approved medicines need longer. It never
+// shortens the validity the doctor chose.
+func extendValidity(ctx context.Context, tx pgx.Tx, prescription *models.Prescription) error {
+	items, err := prescriptionItems(ctx, tx, prescription.ID)
+	if err != nil {
+		return err
+	}
+	days := 0
+	for _, item := range items {
+		if item.Approved && item.Type == "med" {
+			days = max(days, refillValidityDays(item))
+		}
+	}
+	validUntil := prescription.FinalizedAt.AddDate(0, 0, min(days, config.MaxValidityDays))
+	if prescription.ValidUntil != nil && !validUntil.After(*prescription.ValidUntil) {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, "UPDATE prescriptions SET validUntil = $2 WHERE id = $1", prescription.ID, validUntil); err != nil {
+		return err
+	}
+	prescription.ValidUntil = &validUntil
+	return nil
+}
+
+// Finalize moves a reviewed prescription to finalized on behalf of its doctor,
+// locking it and its items, and signs a hash of its content with the deployment
+// key. It stays valid for validityDays, or the default for its items when 0.
+func (s *FinalizationService) Finalize(ctx context.Context, presID, docID int64, note string, validityDays int, defaults config.Validity) (*models.Prescription, error) {
+	if s.signer == nil {
+		return nil, signing.ErrNotConfigured
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	prescription, err := transitionStatus(ctx, tx, presID, models.PrescriptionStatusFinalized, "doctor", docID, note)
+	if err != nil {
+		return nil, err
+	}
+	finalizedAt := time.Now().UTC().Truncate(time.Microsecond)
+	if err := setValidity(ctx, tx, prescription, finalizedAt, validityDays, defaults); err != nil {
+		return nil, err
+	}
+	prescription, err = s.sign(ctx, tx, prescription, finalizedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return prescription, nil
+}
+
+// Verify recomputes the content hash of a prescription and checks it against
+// the stored hash and signature.
+func (s *FinalizationService) Verify(ctx context.Context, presID int64) (*models.PrescriptionVerification, error) {
+	prescription, err := NewPrescriptionService(s.db).GetPrescription(ctx, presID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.PrescriptionVerification{
+		PresID:      prescription.ID,
+		Status:      prescription.Status,
+		Finalized:   prescription.FinalizedAt != nil,
+		FinalizedAt: prescription.FinalizedAt,
+		ContentHash: prescription.ContentHash,
+		Signature:   prescription.Signature,
+		KeyID:       prescription.SigningKeyID,
+		PublicKey:   s.signer.PublicKey(),
+	}
+	if prescription.FinalizedAt == nil {
+		result.Reason = ErrNotFinalized.Error()
+		return result, nil
+	}
+
+	digest, err := contentHash(ctx, s.db, prescription, *prescription.FinalizedAt)
+	if err != nil {
+		return nil, err
+	}
+	result.ComputedHash = hex.EncodeToString(digest)
+
+	switch {
+	case result.ComputedHash != prescription.ContentHash:
+		result.Reason = "content has changed since it was signed"
+	case s.signer == nil:
+		result.Reason = signing.ErrNotConfigured.Error()
+	case prescription.SigningKeyID != s.signer.KeyID():
+		result.Reason = "signed with a different key than this deployment's"
+	default:
+		valid, err := s.signer.Verify(digest, prescription.Signature)
+		if err != nil {
+			return nil, err
+		}
+		result.Valid = valid
+		if !valid {
+			result.Reason = "signature does not match"
+		}
+	}
+	return result, nil
+}
+
+// VerifyPublic checks a printed copy of a prescription by its verification
+// code. A code that matches neither the current content nor an amended-away
+// version returns pgx.ErrNoRows, exactly as an unknown prescription does, so
+// the endpoint cannot be used to probe which prescriptions exist.
+func (s *FinalizationService) VerifyPublic(ctx context.Context, presID int64, code string) (*models.PublicVerification, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) != verificationCodeLength {
+		return nil, pgx.ErrNoRows
+	}
+
+	prescription, err := NewPrescriptionService(s.db).GetPrescription(ctx, presID)
+	if err != nil {
+		return nil, err
+	}
+	if prescription.FinalizedAt == nil {
+		return nil, pgx.ErrNoRows
+	}
+
+	result := &models.PublicVerification{
+		PresID:      prescription.ID,
+		Status:      prescription.Status,
+		FinalizedAt: prescription.FinalizedAt,
+		ValidUntil:  prescription.ValidUntil,
+	}
+
+	if !codeMatches(code, prescription.ContentHash) {
+		rows, err := s.db.Query(ctx, "SELECT previousHash FROM prescription_amendments WHERE presId = $1", presID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		amended := false
+		for rows.Next() {
+			var previousHash string
+			if err := rows.Scan(&previousHash); err != nil {
+				return nil, err
+			}
+			amended = amended || codeMatches(code, previousHash)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if !amended {
+			return nil, pgx.ErrNoRows
+		}
+		result.Reason = "prescription was amended after this copy was issued"
+		return result, nil
+	}
+
+	verification, err := s.Verify(ctx, presID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !verification.Valid:
+		result.Reason = verification.Reason
+	case prescription.Status != models.PrescriptionStatusFinalized:
+		result.Reason = "prescription is " + prescription.Status
+	case IsExpired(prescription, time.Now()):
+		result.Reason = "prescription expired on " + prescription.ValidUntil.UTC().Format(time.DateOnly)
+	default:
+		result.Valid = true
+	}
+	return result, nil
+}
+
+// Amend applies changes to the items of a finalized prescription on behalf of
+// its doctor, re-signs the new content and records the amendment. It returns
+// the amendment and the changed items.
+func (s *FinalizationService) Amend(ctx context.Context, presID, docID int64, reason string, changes []models.ItemAmendment) (*models.PrescriptionAmendment, []*models.Items, error) {
+	if s.signer == nil {
+		return nil, nil, signing.ErrNotConfigured
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	prescription := &models.Prescription{}
+	err = scanPrescription(tx.QueryRow(ctx,
+		"SELECT "+prescriptionColumns+" FROM prescriptions WHERE id = $1 FOR UPDATE",
+		presID), prescription)
+	if err != nil {
+		return nil, nil, err
+	}
+	if prescription.FinalizedAt == nil {
+		return nil, nil, ErrNotFinalized
+	}
+	if prescription.Status != models.PrescriptionStatusFinalized {
+		return nil, nil, fmt.Errorf("%w: it is %s", ErrNotAmendable, prescription.Status)
+	}
+	// One past its validity that the expiry job has not moved yet must not be
+	// re-signed either, least of all with a validUntil moved forward by refills.
+	if IsExpired(prescription, time.Now()) {
+		return nil, nil, fmt.Errorf("%w: it expired on %s", ErrNotAmendable, prescription.ValidUntil.UTC().Format(time.DateOnly))
+	}
+
+	items := make([]*models.Items, 0, len(changes))
+	refillsChanged := false
+	for _, change := range changes {
+		var itemPresID int64
+		err := tx.QueryRow(ctx, "SELECT presId FROM items WHERE id = $1 FOR UPDATE", change.ItemID).Scan(&itemPresID)
+		if err != nil || itemPresID != presID {
+			return nil, nil, fmt.Errorf("item %d: %w", change.ItemID, pgx.ErrNoRows)
+		}
+
+		var item *models.Items
+		if change.DocReason != nil {
+			if item, err = updateItemDocReason(ctx, tx, change.ItemID, *change.DocReason); err != nil {
+				return nil, nil, err
+			}
+		}
+		if change.Dosage != nil {
+			if item, err = updateItemDosage(ctx, tx, change.ItemID, *change.Dosage); err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return nil, nil, fmt.Errorf("%w: item %d is not a medicine", ErrInvalidDosage, change.ItemID)
+				}
+				return nil, nil, err
+			}
+		}
+		if change.Refills != nil {
+			if item, err = updateItemRefills(ctx, tx, change.ItemID, *change.Refills); err != nil {
+				return nil, nil, err
+			}
+			refillsChanged = true
+		}
+		if change.Withdraw {
+			if item, err = setItemApproved(ctx, tx, change.ItemID, false); err != nil {
+				return nil, nil, err
+			}
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	// Added refills must still be requestable; the new end is part of the signed content.
+	if refillsChanged {
+		if err := extendValidity(ctx, tx, prescription); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := recordVersion(ctx, tx, presID, "doctor", docID, reason); err != nil {
+		return nil, nil, err
+	}
+
+	signed, err := s.sign(ctx, tx, prescription, *prescription.FinalizedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return nil, nil, err
+	}
+	amendment := &models.PrescriptionAmendment{
+		PresID:       presID,
+		DocID:        docID,
+		Reason:       reason,
+		Changes:      changes,
+		PreviousHash: prescription.ContentHash,
+		ContentHash:  signed.ContentHash,
+	}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO prescription_amendments (presId, docId, reason, changes, previousHash, contentHash)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, created_at`,
+		presID, docID, reason, changesJSON, amendment.PreviousHash, amendment.ContentHash,
+	).Scan(&amendment.ID, &amendment.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return amendment, items, nil
+}
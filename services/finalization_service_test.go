@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+// canonicalFixture is a finalized prescription with two items and one attachment.
+type canonicalFixture struct {
+	prescription *models.Prescription
+	items        []*models.Items
+	attachments  []*models.Attachment
+	finalizedAt  time.Time
+}
+
+func newCanonicalFixture() *canonicalFixture {
+	createdAt := time.Date(2026, 3, 1, 9, 30, 0, 123456789, time.UTC)
+	validUntil := createdAt.AddDate(0, 0, 30)
+	catalogID := int64(7)
+	return &canonicalFixture{
+		prescription: &models.Prescription{ID: 42, UserID: 3, DocID: 9, CreatedAt: createdAt, Symptoms: "fever", ValidUntil: &validUntil},
+		items: []*models.Items{
+			{ID: 11, Name: "Paracetamol", Type: "medicine", Approved: true, CatalogID: &catalogID,
+				Dosage: models.Dosage{DoseAmount: 500, DoseUnit: "mg", Frequency: "TID", TimesPerDay: 3, DurationDays: 5}},
+			{ID: 10, Name: "CBC", Type: "test", DocReason: "baseline"},
+		},
+		attachments: []*models.Attachment{{ID: 5, FileName: "scan.jpg", ContentType: "image/jpeg", Size: 2048}},
+		finalizedAt: createdAt.Add(time.Hour),
+	}
+}
+
+func (f *canonicalFixture) content(t *testing.T) []byte {
+	t.Helper()
+	content, err := CanonicalContent(f.prescription, f.items, f.attachments, f.finalizedAt)
+	if err != nil {
+		t.Fatalf("CanonicalContent() error: %v", err)
+	}
+	return content
+}
+
+func TestCanonicalContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(f *canonicalFixture)
+		wantChanged bool
+	}{
+		{name: "item order", change: func(f *canonicalFixture) { f.items[0], f.items[1] = f.items[1], f.items[0] }},
+		{name: "time zone and sub-microsecond precision", change: func(f *canonicalFixture) {
+			f.prescription.CreatedAt = f.prescription.CreatedAt.Truncate(time.Microsecond).In(time.FixedZone("IST", 19800))
+		}},
+		{name: "seen flag", change: func(f *canonicalFixture) { f.prescription.SeenByPatient = true }},
+		{name: "follow-up date", change: func(f *canonicalFixture) {
+			followUp := f.finalizedAt.AddDate(0, 0, 7)
+			f.prescription.FollowUpAt = &followUp
+		}},
+		{name: "status", change: func(f *canonicalFixture) { f.prescription.Status = models.PrescriptionStatusExpired }},
+		{name: "attachment upload progress", change: func(f *canonicalFixture) { f.attachments[0].ObjectKey = "prescriptions/42/scan.jpg" }},
+		{name: "symptoms", change: func(f *canonicalFixture) { f.prescription.Symptoms = "high fever" }, wantChanged: true},
+		{name: "patient", change: func(f *canonicalFixture) { f.prescription.UserID = 4 }, wantChanged: true},
+		{name: "validity", change: func(f *canonicalFixture) { f.prescription.ValidUntil = nil }, wantChanged: true},
+		{name: "finalization time", change: func(f *canonicalFixture) { f.finalizedAt = f.finalizedAt.Add(time.Second) }, wantChanged: true},
+		{name: "dose", change: func(f *canonicalFixture) { f.items[0].DoseAmount = 650 }, wantChanged: true},
+		{name: "approval", change: func(f *canonicalFixture) { f.items[1].Approved = true }, wantChanged: true},
+		{name: "refills", change: func(f *canonicalFixture) { f.items[0].Refills = 2 }, wantChanged: true},
+		{name: "removed item", change: func(f *canonicalFixture) { f.items = f.items[:1] }, wantChanged: true},
+		{name: "attachment size", change: func(f *canonicalFixture) { f.attachments[0].Size = 4096 }, wantChanged: true},
+	}
+
+	base := newCanonicalFixture().content(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newCanonicalFixture()
+			tt.change(fixture)
+			if changed := !bytes.Equal(fixture.content(t), base); changed != tt.wantChanged {
+				t.Errorf("content changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestCanonicalContentFormat(t *testing.T) {
+	var content struct {
+		Version   int               `json:"version"`
+		CreatedAt string            `json:"createdAt"`
+		Items     []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(newCanonicalFixture().content(t), &content); err != nil {
+		t.Fatal(err)
+	}
+
+	if content.Version != canonicalVersion {
+		t.Errorf("version = %d, want %d", content.Version, canonicalVersion)
+	}
+	if want := "2026-03-01T09:30:00.123456Z"; content.CreatedAt != want {
+		t.Errorf("createdAt = %q, want %q", content.CreatedAt, want)
+	}
+	// Items are ordered by ID, and unset refill fields are left out so older
+	// signatures keep verifying.
+	if len(content.Items) != 2 || !bytes.Contains(content.Items[0], []byte(`"id":10`)) {
+		t.Fatalf("items = %s, want item 10 first", content.Items)
+	}
+	for _, item := range content.Items {
+		if bytes.Contains(item, []byte("refill")) {
+			t.Errorf("item %s contains refill fields", item)
+		}
+	}
+}
+
+func TestVerificationCode(t *testing.T) {
+	hash := "3f2a9c0d4e5b6a7180f1e2d3c4b5a697"
+
+	tests := []struct {
+		name      string
+		code      string
+		hash      string
+		wantMatch bool
+	}{
+		{name: "matching code", code: "3f2a9c0d4e5b6a71", hash: hash, wantMatch: true},
+		{name: "wrong code", code: "3f2a9c0d4e5b6a72", hash: hash},
+		{name: "full hash is not the code", code: hash, hash: hash},
+		{name: "empty code", code: "", hash: hash},
+		{name: "not finalized", code: "", hash: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codeMatches(tt.code, tt.hash); got != tt.wantMatch {
+				t.Errorf("codeMatches(%q, %q) = %v, want %v", tt.code, tt.hash, got, tt.wantMatch)
+			}
+		})
+	}
+	if got := VerificationCode(hash); got != "3f2a9c0d4e5b6a71" {
+		t.Errorf("VerificationCode() = %q", got)
+	}
+}
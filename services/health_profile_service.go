@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var validPregnancyStatuses = map[string]bool{
+	models.PregnancyUnknown:       true,
+	models.PregnancyNotPregnant:   true,
+	models.PregnancyPregnant:      true,
+	models.PregnancyBreastfeeding: true,
+}
+
+var validAllergySeverities = map[string]bool{"mild": true, "moderate": true, "severe": true}
+
+// drugClass groups medicines a patient may be allergic to as a whole. Members
+// are matched by generic name, and by ATC prefix for catalog-linked items.
+type drugClass struct {
+	atcPrefixes []string
+	members     []string
+	// crossReactive lists classes with a smaller, but real, risk of reaction.
+	crossReactive []string
+}
+
+var drugClasses = map[string]drugClass{
+	"penicillin": {
+		atcPrefixes:   []string{"J01C"},
+		members:       []string{"penicillin", "amoxicillin", "ampicillin", "cloxacillin", "flucloxacillin", "piperacillin", "benzathine penicillin"},
+		crossReactive: []string{"cephalosporin"},
+	},
+	"cephalosporin": {
+		atcPrefixes:   []string{"J01DB", "J01DC", "J01DD", "J01DE"},
+		members:       []string{"cefalexin", "cephalexin", "cefadroxil", "cefuroxime", "cefixime", "cefpodoxime", "ceftriaxone", "cefotaxime", "ceftazidime", "cefepime"},
+		crossReactive: []string{"penicillin"},
+	},
+	"sulfonamide": {
+		atcPrefixes: []string{"J01E"},
+		members:     []string{"sulfamethoxazole", "trimethoprim sulfamethoxazole", "cotrimoxazole", "sulfadiazine", "sulfasalazine"},
+	},
+	"nsaid": {
+		atcPrefixes: []string{"M01A", "N02BA"},
+		members:     []string{"aspirin", "ibuprofen", "diclofenac", "naproxen", "aceclofenac", "ketorolac", "mefenamic acid", "indomethacin", "etoricoxib", "celecoxib"},
+	},
+	"macrolide": {
+		atcPrefixes: []string{"J01FA"},
+		members:     []string{"azithromycin", "clarithromycin", "erythromycin", "roxithromycin"},
+	},
+	"fluoroquinolone": {
+		atcPrefixes: []string{"J01MA"},
+		members:     []string{"ciprofloxacin", "levofloxacin", "ofloxacin", "norfloxacin", "moxifloxacin"},
+	},
+	"tetracycline": {
+		atcPrefixes: []string{"J01AA"},
+		members:     []string{"tetracycline", "doxycycline", "minocycline"},
+	},
+}
+
+// drugClassAliases maps common ways patients record a class allergy to its key.
+var drugClassAliases = map[string]string{
+	"penicillins": "penicillin", "beta lactam": "penicillin", "cephalosporins": "cephalosporin",
+	"sulfa": "sulfonamide", "sulpha": "sulfonamide", "sulfonamides": "sulfonamide", "sulpha drugs": "sulfonamide", "sulfa drugs": "sulfonamide",
+	"nsaids": "nsaid", "macrolides": "macrolide", "quinolone": "fluoroquinolone", "quinolones": "fluoroquinolone",
+	"fluoroquinolones": "fluoroquinolone", "tetracyclines": "tetracycline",
+}
+
+// allergenClasses returns the drug classes an allergy refers to: the class
+// itself for a class allergy, or the classes the named drug belongs to.
+func allergenClasses(substance string) []string {
+	if alias, ok := drugClassAliases[substance]; ok {
+		substance = alias
+	}
+	if _, ok := drugClasses[substance]; ok {
+		return []string{substance}
+	}
+	var classes []string
+	for name, class := range drugClasses {
+		if slices.Contains(class.members, substance) {
+			classes = append(classes, name)
+		}
+	}
+	return classes
+}
+
+// inDrugClass reports whether a medicine belongs to a drug class by generic name or ATC code.
+func inDrugClass(className string, names []string, drug *models.Drug) bool {
+	class := drugClasses[className]
+	for _, name := range names {
+		if slices.Contains(class.members, name) {
+			return true
+		}
+	}
+	if drug != nil && drug.ATCCode != "" {
+		for _, prefix := range class.atcPrefixes {
+			if strings.HasPrefix(drug.ATCCode, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allergyWarning checks one medicine against one documented allergy. A direct
+// or same-class match is major (contraindicated for severe allergies); a
+// cross-reactive class is moderate. It returns nil when there is no conflict.
+func allergyWarning(item *models.Items, drug *models.Drug, names []string, allergy models.Allergy) *models.PrescriptionWarning {
+	substance := NormalizeDrugName(allergy.Substance)
+	if substance == "" {
+		return nil
+	}
+
+	severity, reason := "", ""
+	if slices.Contains(names, substance) {
+		severity, reason = models.SeverityMajor, "documented allergy to "+allergy.Substance
+	} else {
+		for _, className := range allergenClasses(substance) {
+			if inDrugClass(className, names, drug) {
+				severity, reason = models.SeverityMajor, fmt.Sprintf("%s is a %s and the patient is allergic to %s", item.Name, className, allergy.Substance)
+				break
+			}
+			for _, related := range drugClasses[className].crossReactive {
+				if severity == "" && inDrugClass(related, names, drug) {
+					severity, reason = models.SeverityModerate, fmt.Sprintf("possible cross-reactivity between %s and %s allergy", item.Name, allergy.Substance)
+				}
+			}
+		}
+	}
+	if severity == "" {
+		return nil
+	}
+	if severity == models.SeverityMajor && allergy.Severity == "severe" {
+		severity = models.SeverityContraindicated
+	}
+
+	description := reason
+	if allergy.Reaction != "" {
+		description += " (reaction: " + allergy.Reaction + ")"
+	}
+	return &models.PrescriptionWarning{
+		PresID:      item.PresID,
+		ItemID:      item.ID,
+		Kind:        models.WarningKindAllergy,
+		Severity:    severity,
+		Subject:     item.Name + " / " + allergy.Substance + " allergy",
+		Description: description,
+	}
+}
+
+// DefaultHealthProfile returns an empty profile for patients who never saved one.
+func DefaultHealthProfile(userID int64) *models.HealthProfile {
+	return &models.HealthProfile{
+		UserID:             userID,
+		PregnancyStatus:    models.PregnancyUnknown,
+		Allergies:          []models.Allergy{},
+		Conditions:         []models.Condition{},
+		CurrentMedications: []models.CurrentMedication{},
+	}
+}
+
+// ValidateHealthProfile normalises and validates a profile before saving.
+func ValidateHealthProfile(profile *models.HealthProfile) error {
+	profile.DateOfBirth = strings.TrimSpace(profile.DateOfBirth)
+	if profile.DateOfBirth != "" {
+		dob, err := time.Parse("2006-01-02", profile.DateOfBirth)
+		if err != nil {
+			return errors.New("dateOfBirth must be YYYY-MM-DD")
+		}
+		if dob.After(time.Now()) {
+			return errors.New("dateOfBirth cannot be in the future")
+		}
+	}
+
+	if profile.WeightKg < 0 || profile.WeightKg > 500 {
+		return errors.New("weightKg must be between 0 and 500")
+	}
+
+	profile.PregnancyStatus = strings.ToLower(strings.TrimSpace(profile.PregnancyStatus))
+	if profile.PregnancyStatus == "" {
+		profile.PregnancyStatus = models.PregnancyUnknown
+	}
+	if !validPregnancyStatuses[profile.PregnancyStatus] {
+		return fmt.Errorf("unknown pregnancyStatus %q", profile.PregnancyStatus)
+	}
+
+	allergies := make([]models.Allergy, 0, len(profile.Allergies))
+	for _, allergy := range profile.Allergies {
+		allergy.Substance = strings.TrimSpace(allergy.Substance)
+		allergy.Reaction = strings.TrimSpace(allergy.Reaction)
+		allergy.Severity = strings.ToLower(strings.TrimSpace(allergy.Severity))
+		if allergy.Substance == "" {
+			return errors.New("each allergy needs a substance")
+		}
+		if allergy.Severity != "" && !validAllergySeverities[allergy.Severity] {
+			return fmt.Errorf("allergy severity must be mild, moderate or severe, got %q", allergy.Severity)
+		}
+		allergies = append(allergies, allergy)
+	}
+	profile.Allergies = allergies
+
+	conditions := make([]models.Condition, 0, len(profile.Conditions))
+	for _, condition := range profile.Conditions {
+		condition.Name = strings.TrimSpace(condition.Name)
+		if condition.Name == "" {
+			return errors.New("each condition needs a name")
+		}
+		conditions = append(conditions, condition)
+	}
+	profile.Conditions = conditions
+
+	medications := make([]models.CurrentMedication, 0, len(profile.CurrentMedications))
+	for _, medication := range profile.CurrentMedications {
+		medication.Name = strings.TrimSpace(medication.Name)
+		if medication.Name == "" {
+			return errors.New("each current medication needs a name")
+		}
+		medications = append(medications, medication)
+	}
+	profile.CurrentMedications = medications
+	return nil
+}
+
+// AIProfile converts a health profile into the context sent to the AI service,
+// or nil when the profile holds nothing useful.
+func AIProfile(profile *models.HealthProfile, now time.Time) *models.AIPatientProfile {
+	if profile == nil {
+		return nil
+	}
+
+	aiProfile := &models.AIPatientProfile{
+		WeightKg:           profile.WeightKg,
+		Allergies:          make([]string, 0, len(profile.Allergies)),
+		Conditions:         make([]string, 0, len(profile.Conditions)),
+		CurrentMedications: make([]string, 0, len(profile.CurrentMedications)),
+	}
+	if profile.PregnancyStatus != models.PregnancyUnknown {
+		aiProfile.PregnancyStatus = profile.PregnancyStatus
+	}
+	if dob, err := time.Parse("2006-01-02", profile.DateOfBirth); err == nil {
+		age := now.Year() - dob.Year()
+		if now.Month() < dob.Month() || (now.Month() == dob.Month() && now.Day() < dob.Day()) {
+			age--
+		}
+		aiProfile.AgeYears = max(age, 0)
+	}
+	for _, allergy := range profile.Allergies {
+		entry := allergy.Substance
+		if allergy.Reaction != "" {
+			entry += " (" + allergy.Reaction + ")"
+		}
+		aiProfile.Allergies = append(aiProfile.Allergies, entry)
+	}
+	for _, condition := range profile.Conditions {
+		aiProfile.Conditions = append(aiProfile.Conditions, condition.Name)
+	}
+	for _, medication := range profile.CurrentMedications {
+		aiProfile.CurrentMedications = append(aiProfile.CurrentMedications,
+			strings.TrimSpace(strings.Join([]string{medication.Name, medication.Dose, medication.Frequency}, " ")))
+	}
+
+	if aiProfile.AgeYears == 0 && aiProfile.WeightKg == 0 && aiProfile.PregnancyStatus == "" &&
+		len(aiProfile.Allergies) == 0 && len(aiProfile.Conditions) == 0 && len(aiProfile.CurrentMedications) == 0 {
+		return nil
+	}
+	return aiProfile
+}
+
+type HealthProfileService struct {
+	db *pgxpool.Pool
+}
+
+func NewHealthProfileService(db *pgxpool.Pool) *HealthProfileService {
+	return &HealthProfileService{db: db}
+}
+
+// GetProfile retrieves a patient's health profile, or an empty one if none is saved.
+func (s *HealthProfileService) GetProfile(ctx context.Context, userID int64) (*models.HealthProfile, error) {
+	profile := DefaultHealthProfile(userID)
+	var allergies, conditions, medications []byte
+	err := s.db.QueryRow(ctx,
+		`SELECT userId, dateOfBirth, weightKg, pregnancyStatus, allergies, conditions, currentMedications, updated_at
+		 FROM health_profiles WHERE userId = $1`,
+		userID,
+	).Scan(&profile.UserID, &profile.DateOfBirth, &profile.WeightKg, &profile.PregnancyStatus,
+		&allergies, &conditions, &medications, &profile.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return profile, nil
+		}
+		return nil, err
+	}
+
+	for _, field := range []struct {
+		raw  []byte
+		dest interface{}
+	}{
+		{allergies, &profile.Allergies},
+		{conditions, &profile.Conditions},
+		{medications, &profile.CurrentMedications},
+	} {
+		if len(field.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(field.raw, field.dest); err != nil {
+			return nil, fmt.Errorf("failed to decode health profile of user %d: %w", userID, err)
+		}
+	}
+	return profile, nil
+}
+
+// SaveProfile creates or replaces a patient's health profile.
+func (s *HealthProfileService) SaveProfile(ctx context.Context, profile *models.HealthProfile) error {
+	if err := ValidateHealthProfile(profile); err != nil {
+		return err
+	}
+
+	allergies, err := json.Marshal(profile.Allergies)
+	if err != nil {
+		return err
+	}
+	conditions, err := json.Marshal(profile.Conditions)
+	if err != nil {
+		return err
+	}
+	medications, err := json.Marshal(profile.CurrentMedications)
+	if err != nil {
+		return err
+	}
+
+	return s.db.QueryRow(ctx,
+		`INSERT INTO health_profiles
+			(userId, dateOfBirth, weightKg, pregnancyStatus, allergies, conditions, currentMedications, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
+		 ON CONFLICT (userId) DO UPDATE SET
+			dateOfBirth = EXCLUDED.dateOfBirth, weightKg = EXCLUDED.weightKg,
+			pregnancyStatus = EXCLUDED.pregnancyStatus, allergies = EXCLUDED.allergies,
+			conditions = EXCLUDED.conditions, currentMedications = EXCLUDED.currentMedications,
+			updated_at = CURRENT_TIMESTAMP
+		 RETURNING updated_at`,
+		profile.UserID, profile.DateOfBirth, profile.WeightKg, profile.PregnancyStatus,
+		string(allergies), string(conditions), string(medications),
+	).Scan(&profile.UpdatedAt)
+}
@@ -0,0 +1,568 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/bits"
+
+	"golang.org/x/image/webp"
+)
+
+const (
+	// maxImagePixels rejects decompression bombs before they are decoded. A
+	// decoded image of this size takes about 100 MB.
+	maxImagePixels = 25_000_000
+	// AIImageMaxSide is the longest side of images sent to the AI service.
+	AIImageMaxSide = 2048
+	// ThumbnailMaxSide is the longest side of stored thumbnails.
+	ThumbnailMaxSide = 320
+
+	sanitizedJPEGQuality  = 92
+	derivativeJPEGQuality = 85
+)
+
+// ErrImageTypeMismatch is returned when an image's content does not match its declared type.
+var ErrImageTypeMismatch = errors.New("file content does not match its type")
+
+// SanitizedImage is an uploaded image with its metadata removed and its EXIF
+// orientation applied. Thumbnail and AIImage are JPEG derivatives.
+type SanitizedImage struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Thumbnail   []byte
+	AIImage     []byte
+}
+
+// DetectImageType identifies an image from its magic bytes and returns its
+// MIME type, or "" when it is not a supported raster format.
+func DetectImageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	case bytes.HasPrefix(data, []byte("BM")):
+		return "image/bmp"
+	}
+	return ""
+}
+
+// SanitizeImage checks that data really is an image of the declared type and
+// re-encodes it without metadata (EXIF, GPS, comments, text chunks). BMPs are
+// converted to PNG. WebPs keep their image data unless their orientation has
+// to be applied, since there is no WebP encoder to write them back. It also
+// produces the thumbnail and AI-sized derivatives.
+func SanitizeImage(data []byte, contentType string) (*SanitizedImage, error) {
+	if contentType == "image/jpg" {
+		contentType = "image/jpeg"
+	}
+	if detected := DetectImageType(data); detected == "" || detected != contentType {
+		return nil, ErrImageTypeMismatch
+	}
+
+	if contentType != "image/bmp" {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
+		if err := checkImageSize(config.Width, config.Height); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &SanitizedImage{ContentType: contentType}
+	var img image.Image
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/jpeg":
+		decoded, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
+		img = orientImage(decoded, jpegOrientation(data))
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: sanitizedJPEGQuality}); err != nil {
+			return nil, err
+		}
+		result.Ext = ".jpg"
+
+	case "image/png":
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
+		img = decoded
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		result.Ext = ".png"
+
+	case "image/gif":
+		// Re-encoding keeps the frames and loop count but drops comment and
+		// application extensions such as XMP.
+		decoded, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
+		if len(decoded.Image) == 0 {
+			return nil, errors.New("invalid image: no frames")
+		}
+		img = decoded.Image[0]
+		if err := gif.EncodeAll(&buf, decoded); err != nil {
+			return nil, err
+		}
+		result.Ext = ".gif"
+
+	case "image/webp":
+		decoded, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
+		orientation := webpOrientation(data)
+		img = orientImage(decoded, orientation)
+		if orientation > 1 {
+			if err := png.Encode(&buf, img); err != nil {
+				return nil, err
+			}
+			result.ContentType, result.Ext = "image/png", ".png"
+			break
+		}
+		cleaned, err := stripWebPMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(cleaned)
+		result.Ext = ".webp"
+
+	case "image/bmp":
+		decoded, err := decodeBMP(data)
+		if err != nil {
+			return nil, err
+		}
+		img = decoded
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		result.ContentType, result.Ext = "image/png", ".png"
+
+	default:
+		return nil, fmt.Errorf("unsupported image type %s", contentType)
+	}
+	result.Data = buf.Bytes()
+
+	// The thumbnail is scaled from the AI image, so the full-size image is
+	// only read once.
+	large := downscale(img, AIImageMaxSide)
+	small := resizeRGBA(large, ThumbnailMaxSide)
+	var err error
+	if result.AIImage, err = encodeJPEG(large, derivativeJPEGQuality); err != nil {
+		return nil, err
+	}
+	if result.Thumbnail, err = encodeJPEG(small, derivativeJPEGQuality); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func checkImageSize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return errors.New("invalid image dimensions")
+	}
+	if int64(width)*int64(height) > maxImagePixels {
+		return fmt.Errorf("image is too large (max %d megapixels)", maxImagePixels/1_000_000)
+	}
+	return nil
+}
+
+// fitWithin returns the size of a width x height image scaled down to fit
+// within maxSide, or its own size when it already fits.
+func fitWithin(width, height, maxSide int) (int, int) {
+	if longest := max(width, height); longest > maxSide {
+		return max(1, width*maxSide/longest), max(1, height*maxSide/longest)
+	}
+	return width, height
+}
+
+// boxSpan returns the source range [lo, hi) that destination index i of n
+// covers in a source of size size.
+func boxSpan(i, n, size int) (int, int) {
+	lo := i * size / n
+	return lo, max((i+1)*size/n, lo+1)
+}
+
+// downscale flattens img onto a white background and shrinks it to fit within
+// maxSide by averaging the source pixels each destination pixel covers. Only
+// the result is allocated, whatever the size of img.
+func downscale(img image.Image, maxSide int) *image.RGBA {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	width, height := fitWithin(srcW, srcH, maxSide)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := boxSpan(y, height, srcH)
+		for x := 0; x < width; x++ {
+			x0, x1 := boxSpan(x, width, srcW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			// The colours are premultiplied, so white shows through by what
+			// the alpha leaves uncovered.
+			white := 0xFFFF*n - a
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8((r+white)/n>>8), uint8((g+white)/n>>8), uint8((b+white)/n>>8), 0xFF
+		}
+	}
+	return dst
+}
+
+// resizeRGBA shrinks src to fit within maxSide by averaging the source pixels
+// each destination pixel covers. It returns src when it already fits.
+func resizeRGBA(src *image.RGBA, maxSide int) *image.RGBA {
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+	width, height := fitWithin(srcW, srcH, maxSide)
+	if width == srcW && height == srcH {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := boxSpan(y, height, srcH)
+		for x := 0; x < width; x++ {
+			x0, x1 := boxSpan(x, width, srcW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when it has none.
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the Orientation tag from IFD0 of a TIFF-structured EXIF block.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orientImage applies an EXIF orientation so the image displays upright without it.
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	// Pixels are copied straight from img so the only full-size allocation
+	// is the result.
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// webpOrientation returns the EXIF orientation (1-8) of a WebP, or 1 when it has none.
+func webpOrientation(data []byte) int {
+	if len(data) < 12 {
+		return 1
+	}
+	end := min(len(data), 8+int(binary.LittleEndian.Uint32(data[4:])))
+	for i := 12; i+8 <= end; {
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if size < 0 || i+8+size > end {
+			return 1
+		}
+		if string(data[i:i+4]) == "EXIF" {
+			// Some encoders keep the JPEG APP1 prefix in the chunk.
+			return exifOrientation(bytes.TrimPrefix(data[i+8:i+8+size], []byte("Exif\x00\x00")))
+		}
+		i += 8 + size + size%2
+	}
+	return 1
+}
+
+// stripWebPMetadata removes the EXIF and XMP chunks of a WebP file and clears
+// their flags in the VP8X header. The image data itself is left untouched.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, errors.New("invalid WebP file")
+	}
+	end := min(len(data), 8+int(binary.LittleEndian.Uint32(data[4:])))
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for i := 12; i < end; {
+		if i+8 > end {
+			return nil, errors.New("invalid WebP chunk")
+		}
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		next := i + 8 + size + size%2
+		if size < 0 || i+8+size > end {
+			return nil, errors.New("invalid WebP chunk")
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:i+8+size]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+			if size%2 == 1 {
+				out = append(out, 0)
+			}
+		default:
+			out = append(out, data[i:min(next, end)]...)
+		}
+		i = next
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// decodeBMP decodes uncompressed and bitfield Windows bitmaps (1, 4, 8, 16, 24
+// and 32 bits per pixel). RLE-compressed and OS/2 bitmaps are not supported.
+func decodeBMP(data []byte) (image.Image, error) {
+	invalid := errors.New("invalid or unsupported BMP file")
+	if len(data) < 54 || data[0] != 'B' || data[1] != 'M' {
+		return nil, invalid
+	}
+	le16 := func(i int) uint32 { return uint32(binary.LittleEndian.Uint16(data[i:])) }
+	le32 := func(i int) uint32 { return binary.LittleEndian.Uint32(data[i:]) }
+
+	pixelOffset := int(le32(10))
+	headerSize := int(le32(14))
+	width := int(int32(le32(18)))
+	height := int(int32(le32(22)))
+	bpp := int(le16(28))
+	compression := le32(30)
+	colorsUsed := int(le32(46))
+	if headerSize < 40 || 14+headerSize > len(data) {
+		return nil, invalid
+	}
+
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	if err := checkImageSize(width, height); err != nil {
+		return nil, err
+	}
+
+	// Channel masks for 16 and 32 bit images.
+	var rMask, gMask, bMask, aMask uint32
+	switch {
+	case compression == 3 || compression == 6:
+		if len(data) < 66 {
+			return nil, invalid
+		}
+		rMask, gMask, bMask = le32(54), le32(58), le32(62)
+		if (headerSize >= 56 || compression == 6) && len(data) >= 70 {
+			aMask = le32(66)
+		}
+	case compression != 0:
+		return nil, errors.New("compressed BMP files are not supported")
+	case bpp == 16:
+		rMask, gMask, bMask = 0x7C00, 0x03E0, 0x001F
+	case bpp == 32:
+		rMask, gMask, bMask = 0x00FF0000, 0x0000FF00, 0x000000FF
+	}
+
+	var palette []color.NRGBA
+	if bpp <= 8 {
+		if bpp != 1 && bpp != 4 && bpp != 8 {
+			return nil, invalid
+		}
+		count := colorsUsed
+		if count == 0 || count > 1<<bpp {
+			count = 1 << bpp
+		}
+		start := 14 + headerSize
+		if compression == 3 && headerSize == 40 {
+			start += 12
+		}
+		if start+count*4 > len(data) {
+			return nil, invalid
+		}
+		for c := 0; c < count; c++ {
+			p := data[start+c*4:]
+			palette = append(palette, color.NRGBA{R: p[2], G: p[1], B: p[0], A: 0xFF})
+		}
+	} else if bpp != 16 && bpp != 24 && bpp != 32 {
+		return nil, invalid
+	}
+
+	rowSize := (bpp*width + 31) / 32 * 4
+	if pixelOffset < 0 || pixelOffset+rowSize*height > len(data) {
+		return nil, invalid
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := data[pixelOffset+y*rowSize : pixelOffset+(y+1)*rowSize]
+		dy := height - 1 - y
+		if topDown {
+			dy = y
+		}
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bpp {
+			case 1, 4, 8:
+				bitPos := x * bpp
+				index := int(row[bitPos/8]>>(8-bpp-bitPos%8)) & (1<<bpp - 1)
+				if index >= len(palette) {
+					return nil, invalid
+				}
+				c = palette[index]
+			case 24:
+				c = color.NRGBA{R: row[x*3+2], G: row[x*3+1], B: row[x*3], A: 0xFF}
+			case 16, 32:
+				var v uint32
+				if bpp == 16 {
+					v = uint32(binary.LittleEndian.Uint16(row[x*2:]))
+				} else {
+					v = binary.LittleEndian.Uint32(row[x*4:])
+				}
+				c = color.NRGBA{R: maskChannel(v, rMask), G: maskChannel(v, gMask), B: maskChannel(v, bMask), A: 0xFF}
+				if aMask != 0 {
+					c.A = maskChannel(v, aMask)
+				}
+			}
+			img.SetNRGBA(x, dy, c)
+		}
+	}
+	return img, nil
+}
+
+// maskChannel extracts the channel selected by mask from v and scales it to 8 bits.
+func maskChannel(v, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	width := bits.OnesCount32(mask)
+	value := (v & mask) >> shift
+	return uint8(uint64(value) * 255 / (1<<width - 1))
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// halvesImage returns a w x h image whose left half is red and right half blue.
+func halvesImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func encodedPNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodedJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withEXIFOrientation inserts an APP1 EXIF segment holding only an
+// Orientation tag right after the JPEG start marker.
+func withEXIFOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// withPNGSize rewrites the dimensions in the IHDR chunk of a PNG.
+func withPNGSize(data []byte, width, height uint32) []byte {
+	out := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(out[16:], width)
+	binary.BigEndian.PutUint32(out[20:], height)
+	binary.BigEndian.PutUint32(out[29:], crc32.ChecksumIEEE(out[12:29]))
+	return out
+}
+
+// bmp24 encodes img as an uncompressed, bottom-up 24-bit BMP.
+func bmp24(img image.Image) []byte {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	stride := (w*3 + 3) &^ 3
+	out := []byte("BM")
+	out = binary.LittleEndian.AppendUint32(out, uint32(54+stride*h))
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	out = binary.LittleEndian.AppendUint32(out, 54)
+	out = binary.LittleEndian.AppendUint32(out, 40)
+	out = binary.LittleEndian.AppendUint32(out, uint32(w))
+	out = binary.LittleEndian.AppendUint32(out, uint32(h))
+	out = binary.LittleEndian.AppendUint16(out, 1)
+	out = binary.LittleEndian.AppendUint16(out, 24)
+	out = append(out, make([]byte, 24)...)
+	for y := h - 1; y >= 0; y-- {
+		row := make([]byte, stride)
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			row[x*3], row[x*3+1], row[x*3+2] = byte(b>>8), byte(g>>8), byte(r>>8)
+		}
+		out = append(out, row...)
+	}
+	return out
+}
+
+func TestDetectImageType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "png", data: []byte("\x89PNG\r\n\x1a\n...."), want: "image/png"},
+		{name: "jpeg", data: []byte{0xFF, 0xD8, 0xFF, 0xE0}, want: "image/jpeg"},
+		{name: "gif", data: []byte("GIF89a...."), want: "image/gif"},
+		{name: "webp", data: []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), want: "image/webp"},
+		{name: "bmp", data: []byte("BM......"), want: "image/bmp"},
+		{name: "riff that is not webp", data: []byte("RIFF\x00\x00\x00\x00WAVEfmt "), want: ""},
+		{name: "pdf", data: []byte("%PDF-1.7"), want: ""},
+		{name: "empty", data: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectImageType(tt.data); got != tt.want {
+				t.Errorf("DetectImageType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitWithin(t *testing.T) {
+	tests := []struct {
+		width, height, maxSide int
+		wantW, wantH           int
+	}{
+		{width: 100, height: 50, maxSide: 320, wantW: 100, wantH: 50},
+		{width: 4000, height: 1000, maxSide: 2048, wantW: 2048, wantH: 512},
+		{width: 1000, height: 4000, maxSide: 320, wantW: 80, wantH: 320},
+		{width: 5000, height: 1, maxSide: 320, wantW: 320, wantH: 1},
+	}
+
+	for _, tt := range tests {
+		if w, h := fitWithin(tt.width, tt.height, tt.maxSide); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitWithin(%d, %d, %d) = %d, %d, want %d, %d", tt.width, tt.height, tt.maxSide, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestSanitizeImage(t *testing.T) {
+	var animated bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 30, 10), color.Palette{color.White, color.Black})
+	if err := gif.EncodeAll(&animated, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		wantType    string
+		wantSize    image.Point
+		wantAI      image.Point
+		wantThumb   image.Point
+		wantErr     string
+	}{
+		{
+			name: "png", data: encodedPNG(t, halvesImage(100, 50)), contentType: "image/png",
+			wantType: "image/png", wantSize: image.Pt(100, 50), wantAI: image.Pt(100, 50), wantThumb: image.Pt(100, 50),
+		},
+		{
+			name: "large jpeg derivatives", data: encodedJPEG(t, halvesImage(4000, 1000)), contentType: "image/jpg",
+			wantType: "image/jpeg", wantSize: image.Pt(4000, 1000), wantAI: image.Pt(2048, 512), wantThumb: image.Pt(320, 80),
+		},
+		{
+			name: "jpeg orientation applied", data: withEXIFOrientation(encodedJPEG(t, halvesImage(40, 20)), 6), contentType: "image/jpeg",
+			wantType: "image/jpeg", wantSize: image.Pt(20, 40), wantAI: image.Pt(20, 40), wantThumb: image.Pt(20, 40),
+		},
+		{
+			name: "animated gif", data: animated.Bytes(), contentType: "image/gif",
+			wantType: "image/gif", wantSize: image.Pt(30, 10), wantAI: image.Pt(30, 10), wantThumb: image.Pt(30, 10),
+		},
+		{
+			name: "bmp converted to png", data: bmp24(halvesImage(3, 2)), contentType: "image/bmp",
+			wantType: "image/png", wantSize: image.Pt(3, 2), wantAI: image.Pt(3, 2), wantThumb: image.Pt(3, 2),
+		},
+		{name: "declared type differs", data: encodedPNG(t, halvesImage(4, 4)), contentType: "image/jpeg", wantErr: ErrImageTypeMismatch.Error()},
+		{name: "not an image", data: []byte("%PDF-1.7"), contentType: "image/png", wantErr: ErrImageTypeMismatch.Error()},
+		{name: "too many pixels", data: withPNGSize(encodedPNG(t, halvesImage(1, 1)), 6000, 5000), contentType: "image/png", wantErr: "too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SanitizeImage(tt.data, tt.contentType)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SanitizeImage() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SanitizeImage() error: %v", err)
+			}
+			if got.ContentType != tt.wantType {
+				t.Errorf("content type = %q, want %q", got.ContentType, tt.wantType)
+			}
+			for _, check := range []struct {
+				what string
+				data []byte
+				want image.Point
+			}{{"image", got.Data, tt.wantSize}, {"AI image", got.AIImage, tt.wantAI}, {"thumbnail", got.Thumbnail, tt.wantThumb}} {
+				config, _, err := image.DecodeConfig(bytes.NewReader(check.data))
+				if err != nil {
+					t.Fatalf("decode %s: %v", check.what, err)
+				}
+				if size := image.Pt(config.Width, config.Height); size != check.want {
+					t.Errorf("%s size = %v, want %v", check.what, size, check.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// A 2x1 image: red on the left, blue on the right.
+	src := halvesImage(2, 1)
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+
+	tests := []struct {
+		orientation int
+		want        [][]color.RGBA // rows of the result
+	}{
+		{orientation: 1, want: [][]color.RGBA{{red, blue}}},
+		{orientation: 2, want: [][]color.RGBA{{blue, red}}},
+		{orientation: 3, want: [][]color.RGBA{{blue, red}}},
+		{orientation: 4, want: [][]color.RGBA{{red, blue}}},
+		{orientation: 5, want: [][]color.RGBA{{red}, {blue}}},
+		{orientation: 6, want: [][]color.RGBA{{red}, {blue}}},
+		{orientation: 7, want: [][]color.RGBA{{blue}, {red}}},
+		{orientation: 8, want: [][]color.RGBA{{blue}, {red}}},
+	}
+
+	for _, tt := range tests {
+		got := orientImage(src, tt.orientation)
+		for y, row := range tt.want {
+			for x, want := range row {
+				if c := color.RGBAModel.Convert(got.At(x, y)); c != want {
+					t.Errorf("orientation %d: pixel (%d, %d) = %v, want %v", tt.orientation, x, y, c, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// drugComponentSep splits combination products such as "Amoxicillin + Clavulanic acid".
+var drugComponentSep = regexp.MustCompile(`(?i)\s*(?:\+|/|,|\band\b|\bwith\b)\s*`)
+
+// warningColumns lists the prescription_warnings columns in the order scanWarning expects them.
+const warningColumns = `id, created_at, presId, itemId, kind, severity, otherItemId, otherPresId,
+	subject, description, acknowledgedAt, acknowledgedBy`
+
+func scanWarning(row pgx.Row, warning *models.PrescriptionWarning) error {
+	return row.Scan(&warning.ID, &warning.CreatedAt, &warning.PresID, &warning.ItemID, &warning.Kind,
+		&warning.Severity, &warning.OtherItemID, &warning.OtherPresID, &warning.Subject, &warning.Description,
+		&warning.AcknowledgedAt, &warning.AcknowledgedBy)
+}
+
+// interactionPair returns the normalised names of an interaction in the order they are stored.
+func interactionPair(a, b string) (string, string) {
+	a, b = NormalizeDrugName(a), NormalizeDrugName(b)
+	if b < a {
+		a, b = b, a
+	}
+	return a, b
+}
+
+// drugComponents returns the normalised names an item is checked under: the
+// whole name and, for combination products, each ingredient.
+func drugComponents(name string) []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(value string) {
+		if value = NormalizeDrugName(value); value != "" && !seen[value] {
+			seen[value] = true
+			names = append(names, value)
+		}
+	}
+	add(name)
+	for _, part := range drugComponentSep.Split(name, -1) {
+		add(part)
+	}
+	return names
+}
+
+// BlockingWarnings returns the unacknowledged warnings involving itemID that are
+// serious enough (major or contraindicated) to require acknowledgement before approval.
+func BlockingWarnings(warnings []*models.PrescriptionWarning, itemID int64) []*models.PrescriptionWarning {
+	blocking := make([]*models.PrescriptionWarning, 0)
+	for _, warning := range warnings {
+		if warning.AcknowledgedAt != nil || models.SeverityRank(warning.Severity) < models.SeverityRank(models.SeverityMajor) {
+			continue
+		}
+		if warning.ItemID == itemID || (warning.OtherItemID != nil && *warning.OtherItemID == itemID) {
+			blocking = append(blocking, warning)
+		}
+	}
+	return blocking
+}
+
+type InteractionService struct {
+	db *pgxpool.Pool
+}
+
+func NewInteractionService(db *pgxpool.Pool) *InteractionService {
+	return &InteractionService{db: db}
+}
+
+// ImportInteractions upserts dataset entries keyed by drug pair and returns how many were written.
+func (s *InteractionService) ImportInteractions(ctx context.Context, interactions []*models.DrugInteraction) (int, error) {
+	count := 0
+	for _, interaction := range interactions {
+		drugA, drugB := interactionPair(interaction.DrugA, interaction.DrugB)
+		_, err := s.db.Exec(ctx,
+			`INSERT INTO drug_interactions (drugA, drugB, severity, description)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (drugA, drugB) DO UPDATE SET
+				severity = EXCLUDED.severity, description = EXCLUDED.description`,
+			drugA, drugB, interaction.Severity, interaction.Description)
+		if err != nil {
+			return count, fmt.Errorf("failed to import interaction %s/%s: %w", drugA, drugB, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// findInteractions loads the dataset entries between any two of names.
+func (s *InteractionService) findInteractions(ctx context.Context, names []string) (map[[2]string]*models.DrugInteraction, error) {
+	found := map[[2]string]*models.DrugInteraction{}
+	if len(names) < 2 {
+		return found, nil
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT id, drugA, drugB, severity, description FROM drug_interactions
+		 WHERE drugA = ANY($1) AND drugB = ANY($1)`,
+		names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		interaction := &models.DrugInteraction{}
+		if err := rows.Scan(&interaction.ID, &interaction.DrugA, &interaction.DrugB, &interaction.Severity, &interaction.Description); err != nil {
+			return nil, err
+		}
+		found[[2]string{interaction.DrugA, interaction.DrugB}] = interaction
+	}
+	return found, rows.Err()
+}
+
+// catalogDrug returns the catalog entry an item is linked to, caching lookups in
+// drugs. It returns nil for unlinked items.
+func (s *InteractionService) catalogDrug(ctx context.Context, item *models.Items, drugs map[int64]*models.Drug) (*models.Drug, error) {
+	if item.CatalogID == nil {
+		return nil, nil
+	}
+	if drug, ok := drugs[*item.CatalogID]; ok {
+		return drug, nil
+	}
+	drug, err := NewDrugCatalogService(s.db).GetDrug(ctx, *item.CatalogID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	drugs[*item.CatalogID] = drug
+	return drug, nil
+}
+
+// medicineNames returns the names an item is checked under, preferring the
+// generic name of its catalog entry.
+func medicineNames(item *models.Items, drug *models.Drug) []string {
+	if drug != nil {
+		return drugComponents(drug.GenericName)
+	}
+	return drugComponents(item.Name)
+}
+
+// CheckPrescription compares the medicines of a prescription with each other,
+// with the patient's active medicines on other prescriptions and with the
+// current medications and allergies of their health profile. It replaces the
+// prescription's unacknowledged warnings with the result; acknowledged warnings
+// are kept so a doctor isn't asked twice about the same problem. Medicines the
+// doctor rejected or withdrew approval of are left out.
+func (s *InteractionService) CheckPrescription(ctx context.Context, presID int64) ([]*models.PrescriptionWarning, error) {
+	return s.checkPrescription(ctx, presID, 0)
+}
+
+// CheckApproval is CheckPrescription for a doctor about to approve itemID, which
+// is checked even if its approval was withdrawn earlier.
+func (s *InteractionService) CheckApproval(ctx context.Context, presID, itemID int64) ([]*models.PrescriptionWarning, error) {
+	return s.checkPrescription(ctx, presID, itemID)
+}
+
+func (s *InteractionService) checkPrescription(ctx context.Context, presID, approvingItemID int64) ([]*models.PrescriptionWarning, error) {
+	prescription, err := NewPrescriptionService(s.db).GetPrescription(ctx, presID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := NewHealthProfileService(s.db).GetProfile(ctx, prescription.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	itemService := NewItemsService(s.db)
+	presItems, err := itemService.GetPrescriptionItems(ctx, presID)
+	if err != nil {
+		return nil, err
+	}
+	rejected, err := itemService.rejectedItemIDs(ctx, presID)
+	if err != nil {
+		return nil, err
+	}
+	var medicines []*models.Items
+	for _, item := range presItems {
+		if item.Type == "med" && (!rejected[item.ID] || item.ID == approvingItemID) {
+			medicines = append(medicines, item)
+		}
+	}
+	others, err := itemService.GetActivePatientMedicines(ctx, prescription.UserID, presID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Medicines the patient reports taking are checked like items without an ID.
+	var reported []*models.Items
+	for _, medication := range profile.CurrentMedications {
+		reported = append(reported, &models.Items{Name: medication.Name, Type: "med"})
+	}
+	if err := NewDrugCatalogService(s.db).LinkItems(ctx, reported); err != nil {
+		return nil, err
+	}
+
+	drugs := map[int64]*models.Drug{}
+	itemDrugs := map[*models.Items]*models.Drug{}
+	itemNames := map[*models.Items][]string{}
+	var allNames []string
+	for _, item := range slices.Concat(medicines, others, reported) {
+		drug, err := s.catalogDrug(ctx, item, drugs)
+		if err != nil {
+			return nil, err
+		}
+		itemDrugs[item] = drug
+		itemNames[item] = medicineNames(item, drug)
+		allNames = append(allNames, itemNames[item]...)
+	}
+
+	interactions, err := s.findInteractions(ctx, allNames)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pair every medicine with the ones after it and with every other medicine
+	// the patient takes, keeping the most severe interaction found for each pair.
+	var warnings []*models.PrescriptionWarning
+	check := func(item, other *models.Items) {
+		var worst *models.DrugInteraction
+		for _, a := range itemNames[item] {
+			for _, b := range itemNames[other] {
+				if a == b {
+					continue
+				}
+				key := [2]string{min(a, b), max(a, b)}
+				if interaction, ok := interactions[key]; ok {
+					if worst == nil || models.SeverityRank(interaction.Severity) > models.SeverityRank(worst.Severity) {
+						worst = interaction
+					}
+				}
+			}
+		}
+		if worst == nil {
+			return
+		}
+		warning := &models.PrescriptionWarning{
+			PresID:      presID,
+			ItemID:      item.ID,
+			Kind:        models.WarningKindInteraction,
+			Severity:    worst.Severity,
+			Subject:     item.Name + " + " + other.Name,
+			Description: worst.Description,
+		}
+		if other.ID != 0 {
+			otherItemID, otherPresID := other.ID, other.PresID
+			warning.OtherItemID = &otherItemID
+			warning.OtherPresID = &otherPresID
+		} else {
+			warning.Subject += " (current medication)"
+		}
+		warnings = append(warnings, warning)
+	}
+	for i, item := range medicines {
+		for _, other := range medicines[i+1:] {
+			check(item, other)
+		}
+		for _, other := range others {
+			check(item, other)
+		}
+		for _, other := range reported {
+			check(item, other)
+		}
+	}
+	if err := s.replaceWarnings(ctx, presID, models.WarningKindInteraction, warnings); err != nil {
+		return nil, err
+	}
+
+	var allergyWarnings []*models.PrescriptionWarning
+	for _, item := range medicines {
+		for _, allergy := range profile.Allergies {
+			if warning := allergyWarning(item, itemDrugs[item], itemNames[item], allergy); warning != nil {
+				allergyWarnings = append(allergyWarnings, warning)
+			}
+		}
+	}
+	if err := s.replaceWarnings(ctx, presID, models.WarningKindAllergy, allergyWarnings); err != nil {
+		return nil, err
+	}
+
+	return s.GetPrescriptionWarnings(ctx, presID)
+}
+
+// replaceWarnings swaps the unacknowledged warnings of one kind for a freshly
+// computed set, skipping pairs the doctor already acknowledged.
+func (s *InteractionService) replaceWarnings(ctx context.Context, presID int64, kind string, warnings []*models.PrescriptionWarning) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		"DELETE FROM prescription_warnings WHERE presId = $1 AND kind = $2 AND acknowledgedAt IS NULL",
+		presID, kind); err != nil {
+		return err
+	}
+
+	for _, warning := range warnings {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO prescription_warnings (presId, itemId, kind, severity, otherItemId, otherPresId, subject, description)
+			 SELECT $1, $2, $3, $4, $5, $6, $7, $8
+			 WHERE NOT EXISTS (
+				SELECT 1 FROM prescription_warnings
+				WHERE presId = $1 AND itemId = $2 AND kind = $3 AND subject = $7
+				  AND otherItemId IS NOT DISTINCT FROM $5 AND severity = $4
+			 )`,
+			warning.PresID, warning.ItemID, warning.Kind, warning.Severity, warning.OtherItemID, warning.OtherPresID,
+			warning.Subject, warning.Description)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// GetPrescriptionWarnings retrieves the warnings of a prescription, most severe first.
+func (s *InteractionService) GetPrescriptionWarnings(ctx context.Context, presID int64) ([]*models.PrescriptionWarning, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+warningColumns+` FROM prescription_warnings
+		 WHERE presId = $1
+		 ORDER BY CASE severity
+			WHEN 'contraindicated' THEN 4 WHEN 'major' THEN 3 WHEN 'moderate' THEN 2 WHEN 'minor' THEN 1 ELSE 0
+		 END DESC, id`,
+		presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	warnings := make([]*models.PrescriptionWarning, 0)
+	for rows.Next() {
+		warning := &models.PrescriptionWarning{}
+		if err := scanWarning(rows, warning); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings, rows.Err()
+}
+
+// AcknowledgeWarnings records that a doctor reviewed the given warnings.
+func (s *InteractionService) AcknowledgeWarnings(ctx context.Context, warningIDs []int64, docID int64, now time.Time) error {
+	if len(warningIDs) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec(ctx,
+		`UPDATE prescription_warnings SET acknowledgedAt = $2, acknowledgedBy = $3
+		 WHERE id = ANY($1) AND acknowledgedAt IS NULL`,
+		warningIDs, now, docID)
+	return err
+}
+
+// RecheckPatientPrescriptions re-runs the interaction check on a patient's
+// prescriptions other than excludePresID, e.g. after a new medicine was approved.
+func (s *InteractionService) RecheckPatientPrescriptions(ctx context.Context, userID, excludePresID int64) error {
+	prescriptions, err := NewPrescriptionService(s.db).GetUserPrescriptions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, prescription := range prescriptions {
+		if prescription.ID == excludePresID {
+			continue
+		}
+		if _, err := s.CheckPrescription(ctx, prescription.ID); err != nil {
+			return fmt.Errorf("prescription %d: %w", prescription.ID, err)
+		}
+	}
+	return nil
+}
+
+// normalizeInteraction validates a dataset entry read from a file.
+func normalizeInteraction(interaction *models.DrugInteraction) error {
+	interaction.DrugA = strings.TrimSpace(interaction.DrugA)
+	interaction.DrugB = strings.TrimSpace(interaction.DrugB)
+	if NormalizeDrugName(interaction.DrugA) == "" || NormalizeDrugName(interaction.DrugB) == "" {
+		return errors.New("drugA and drugB are required")
+	}
+	interaction.Severity = strings.ToLower(strings.TrimSpace(interaction.Severity))
+	if models.SeverityRank(interaction.Severity) == 0 {
+		return fmt.Errorf("unknown severity %q", interaction.Severity)
+	}
+	interaction.Description = strings.TrimSpace(interaction.Description)
+	return nil
+}
+
+// ParseInteractionsCSV reads dataset entries from CSV with a header row containing
+// drugA, drugB, severity and description (snake_case headers are accepted too).
+func ParseInteractionsCSV(r io.Reader) ([]*models.DrugInteraction, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("interaction CSV is empty")
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(header), "_", ""))
+		columns[key] = i
+	}
+	for _, required := range []string{"druga", "drugb", "severity"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.New("interaction CSV needs drugA, drugB and severity columns")
+		}
+	}
+	cell := func(record []string, key string) string {
+		if i, ok := columns[key]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var interactions []*models.DrugInteraction
+	for line, record := range records[1:] {
+		interaction := &models.DrugInteraction{
+			DrugA:       cell(record, "druga"),
+			DrugB:       cell(record, "drugb"),
+			Severity:    cell(record, "severity"),
+			Description: cell(record, "description"),
+		}
+		if err := normalizeInteraction(interaction); err != nil {
+			return nil, fmt.Errorf("interaction CSV line %d: %w", line+2, err)
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, nil
+}
+
+// ParseInteractionsJSON reads dataset entries from a JSON array.
+func ParseInteractionsJSON(r io.Reader) ([]*models.DrugInteraction, error) {
+	var interactions []*models.DrugInteraction
+	if err := json.NewDecoder(r).Decode(&interactions); err != nil {
+		return nil, err
+	}
+	for i, interaction := range interactions {
+		if err := normalizeInteraction(interaction); err != nil {
+			return nil, fmt.Errorf("interaction entry %d: %w", i, err)
+		}
+	}
+	return interactions, nil
+}
+
+// LoadInteractionsFile parses a .csv or .json interaction dataset.
+func LoadInteractionsFile(path string) ([]*models.DrugInteraction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ParseInteractionsCSV(f)
+	case ".json":
+		return ParseInteractionsJSON(f)
+	}
+	return nil, fmt.Errorf("unsupported interaction dataset format %q (use .csv or .json)", filepath.Ext(path))
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestParseInteractionsCSV(t *testing.T) {
+	csv := "drug_a, drug_b, severity, description\n" +
+		"Warfarin , Aspirin,MAJOR, Bleeding risk \n" +
+		"Simvastatin,Clarithromycin,contraindicated,\n"
+	interactions, err := ParseInteractionsCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("ParseInteractionsCSV() error = %v", err)
+	}
+	want := []*models.DrugInteraction{
+		{DrugA: "Warfarin", DrugB: "Aspirin", Severity: models.SeverityMajor, Description: "Bleeding risk"},
+		{DrugA: "Simvastatin", DrugB: "Clarithromycin", Severity: models.SeverityContraindicated},
+	}
+	if !reflect.DeepEqual(interactions, want) {
+		t.Errorf("ParseInteractionsCSV() = %+v, want %+v", interactions, want)
+	}
+
+	errorTests := []struct {
+		name string
+		csv  string
+	}{
+		{name: "empty", csv: ""},
+		{name: "missing severity column", csv: "drugA,drugB\nWarfarin,Aspirin\n"},
+		{name: "unknown severity", csv: "drugA,drugB,severity\nWarfarin,Aspirin,severe\n"},
+		{name: "missing drug", csv: "drugA,drugB,severity\nWarfarin, ,major\n"},
+		{name: "only a strength", csv: "drugA,drugB,severity\nWarfarin,500 mg,major\n"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseInteractionsCSV(strings.NewReader(tt.csv)); err == nil {
+				t.Error("ParseInteractionsCSV() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestInteractionPair(t *testing.T) {
+	a, b := interactionPair("Tab. Warfarin 5mg", "Aspirin")
+	if a != "aspirin" || b != "warfarin" {
+		t.Errorf("interactionPair() = %q, %q, want \"aspirin\", \"warfarin\"", a, b)
+	}
+}
+
+func TestBlockingWarnings(t *testing.T) {
+	now := time.Now()
+	other := int64(2)
+	warnings := []*models.PrescriptionWarning{
+		{ID: 1, ItemID: 1, Severity: models.SeverityMinor},
+		{ID: 2, ItemID: 1, Severity: models.SeverityModerate},
+		{ID: 3, ItemID: 1, Severity: models.SeverityMajor},
+		{ID: 4, ItemID: 1, Severity: models.SeverityContraindicated},
+		{ID: 5, ItemID: 1, Severity: models.SeverityContraindicated, AcknowledgedAt: &now},
+		{ID: 6, ItemID: 3, Severity: models.SeverityMajor, OtherItemID: &other},
+		{ID: 7, ItemID: 3, Severity: models.SeverityContraindicated},
+		{ID: 8, ItemID: 1, Severity: "unknown"},
+	}
+
+	tests := []struct {
+		name   string
+		itemID int64
+		want   []int64
+	}{
+		{name: "major and contraindicated on the item", itemID: 1, want: []int64{3, 4}},
+		{name: "item as the other side of a pair", itemID: 2, want: []int64{6}},
+		{name: "item without warnings", itemID: 9, want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int64{}
+			for _, warning := range BlockingWarnings(warnings, tt.itemID) {
+				got = append(got, warning.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BlockingWarnings(%d) = %v, want %v", tt.itemID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeverityRank(t *testing.T) {
+	order := []string{"", models.SeverityMinor, models.SeverityModerate, models.SeverityMajor, models.SeverityContraindicated}
+	for i := 1; i < len(order); i++ {
+		if models.SeverityRank(order[i]) <= models.SeverityRank(order[i-1]) {
+			t.Errorf("SeverityRank(%q) should be above SeverityRank(%q)", order[i], order[i-1])
+		}
+	}
+}
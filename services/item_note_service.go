@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// itemNoteColumns lists the item_notes columns in the order scanItemNote expects them.
+const itemNoteColumns = "id, created_at, updated_at, itemId, presId, docId, note"
+
+func scanItemNote(row pgx.Row, note *models.ItemNote) error {
+	return row.Scan(&note.ID, &note.CreatedAt, &note.UpdatedAt, &note.ItemID, &note.PresID, &note.DocID, &note.Note)
+}
+
+type ItemNoteService struct {
+	db *pgxpool.Pool
+}
+
+func NewItemNoteService(db *pgxpool.Pool) *ItemNoteService {
+	return &ItemNoteService{db: db}
+}
+
+// SetNote writes a doctor's own note on an item, replacing their earlier one.
+// Notes of other doctors on the same item are left alone.
+func (s *ItemNoteService) SetNote(ctx context.Context, item *models.Items, docID int64, note string) (*models.ItemNote, error) {
+	itemNote := &models.ItemNote{}
+	err := scanItemNote(s.db.QueryRow(ctx,
+		`INSERT INTO item_notes (itemId, presId, docId, note)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (itemId, docId) DO UPDATE SET note = EXCLUDED.note, updated_at = CURRENT_TIMESTAMP
+		 RETURNING `+itemNoteColumns,
+		item.ID, item.PresID, docID, note,
+	), itemNote)
+	if err != nil {
+		return nil, err
+	}
+	return itemNote, nil
+}
+
+// GetPrescriptionNotes lists the doctors' notes on the items of a prescription,
+// grouped by item.
+func (s *ItemNoteService) GetPrescriptionNotes(ctx context.Context, presID int64) ([]*models.ItemNote, error) {
+	rows, err := s.db.Query(ctx,
+		"SELECT "+itemNoteColumns+" FROM item_notes WHERE presId = $1 ORDER BY itemId, created_at, id",
+		presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := make([]*models.ItemNote, 0)
+	for rows.Next() {
+		note := &models.ItemNote{}
+		if err := scanItemNote(rows, note); err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
@@ -4,56 +4,142 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// itemColumns lists the items columns in the order scanItem expects them.
+const itemColumns = `id, created_at, name, type, aiReasons, docReason, presId, approved, catalogId, matchScore,
+	doseAmount, doseUnit, route, frequency, timesPerDay, asNeeded, durationDays, quantity, instructions,
+	COALESCE(refills, 0), COALESCE(refillIntervalDays, 0)`
+
+// scanItem scans a row selected with itemColumns into item.
+func scanItem(row pgx.Row, item *models.Items) error {
+	return row.Scan(
+		&item.ID,
+		&item.CreatedAt,
+		&item.Name,
+		&item.Type,
+		&item.AIReasons,
+		&item.DocReason,
+		&item.PresID,
+		&item.Approved,
+		&item.CatalogID,
+		&item.MatchScore,
+		&item.DoseAmount,
+		&item.DoseUnit,
+		&item.Route,
+		&item.Frequency,
+		&item.TimesPerDay,
+		&item.AsNeeded,
+		&item.DurationDays,
+		&item.Quantity,
+		&item.Instructions,
+		&item.Refills,
+		&item.RefillIntervalDays,
+	)
+}
+
 type ItemsService struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewItemsService(db *pgx.Conn) *ItemsService {
+func NewItemsService(db *pgxpool.Pool) *ItemsService {
 	return &ItemsService{db: db}
 }
 
-// CreateItem creates a new item in a prescription
-func (s *ItemsService) CreateItem(ctx context.Context, item *models.Items) error {
-	err := s.db.QueryRow(ctx,
-		"INSERT INTO items (presId, name, type, aiReasons, docReason) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
-		item.PresID, item.Name, item.Type, item.AIReasons, item.DocReason).Scan(&item.ID, &item.CreatedAt)
-	return err
+// CreateItem creates a new item in a prescription on behalf of an actor and
+// records the new version. Finalized prescriptions return ErrPrescriptionLocked,
+// cancelled and expired ones ErrPrescriptionNotEditable.
+func (s *ItemsService) CreateItem(ctx context.Context, item *models.Items, actorRole string, actorID int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = checkPrescriptionOpen(tx.QueryRow(ctx,
+		"SELECT finalizedAt IS NOT NULL, COALESCE(status, 'submitted') FROM prescriptions WHERE id = $1",
+		item.PresID))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO items (presId, name, type, aiReasons, docReason, catalogId, matchScore,
+			doseAmount, doseUnit, route, frequency, timesPerDay, asNeeded, durationDays, quantity, instructions)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		 RETURNING id, created_at`,
+		item.PresID, item.Name, item.Type, item.AIReasons, item.DocReason, item.CatalogID, item.MatchScore,
+		item.DoseAmount, item.DoseUnit, item.Route, item.Frequency, item.TimesPerDay, item.AsNeeded, item.DurationDays, item.Quantity, item.Instructions,
+	).Scan(&item.ID, &item.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := recordVersion(ctx, tx, item.PresID, actorRole, actorID, "item added"); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// CreateItemsBulk creates multiple items for a prescription in a single query.
-func (s *ItemsService) CreateItemsBulk(ctx context.Context, items []*models.Items) error {
+// CreateItemsBulk creates multiple items in a single query on behalf of an actor
+// and records a new version of each prescription they belong to.
+func (s *ItemsService) CreateItemsBulk(ctx context.Context, items []*models.Items, actorRole string, actorID int64) error {
 	if len(items) == 0 {
 		return nil
 	}
 
+	const columnCount = 16
 	valueParts := make([]string, 0, len(items))
-	args := make([]interface{}, 0, len(items)*5)
+	args := make([]interface{}, 0, len(items)*columnCount)
+	var presIDs []int64
 	for i, item := range items {
-		base := i*5 + 1
-		valueParts = append(valueParts, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", base, base+1, base+2, base+3, base+4))
-		args = append(args, item.PresID, item.Name, item.Type, item.AIReasons, item.DocReason)
+		placeholders := make([]string, columnCount)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*columnCount+j+1)
+		}
+		valueParts = append(valueParts, "("+strings.Join(placeholders, ", ")+")")
+		args = append(args, item.PresID, item.Name, item.Type, item.AIReasons, item.DocReason, item.CatalogID, item.MatchScore,
+			item.DoseAmount, item.DoseUnit, item.Route, item.Frequency, item.TimesPerDay, item.AsNeeded, item.DurationDays, item.Quantity, item.Instructions)
+		if !slices.Contains(presIDs, item.PresID) {
+			presIDs = append(presIDs, item.PresID)
+		}
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	query := "INSERT INTO items (presId, name, type, aiReasons, docReason) VALUES " + strings.Join(valueParts, ", ")
+	query := `INSERT INTO items (presId, name, type, aiReasons, docReason, catalogId, matchScore,
+		doseAmount, doseUnit, route, frequency, timesPerDay, asNeeded, durationDays, quantity, instructions) VALUES ` + strings.Join(valueParts, ", ")
 	execArgs := make([]interface{}, 0, len(args)+1)
 	execArgs = append(execArgs, pgx.QueryExecModeSimpleProtocol)
 	execArgs = append(execArgs, args...)
-	_, err := s.db.Exec(ctx, query, execArgs...)
-	return err
+	if _, err := tx.Exec(ctx, query, execArgs...); err != nil {
+		return err
+	}
+
+	for _, presID := range presIDs {
+		if err := recordVersion(ctx, tx, presID, actorRole, actorID, "items added"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
 }
 
 // GetItem retrieves an item by ID
 func (s *ItemsService) GetItem(ctx context.Context, itemID int64) (*models.Items, error) {
 	item := &models.Items{}
-	err := s.db.QueryRow(ctx,
-		"SELECT id, created_at, name, type, aiReasons, docReason, presId FROM items WHERE id = $1",
-		itemID).Scan(&item.ID, &item.CreatedAt, &item.Name, &item.Type, &item.AIReasons, &item.DocReason, &item.PresID)
+	err := scanItem(s.db.QueryRow(ctx,
+		"SELECT "+itemColumns+" FROM items WHERE id = $1",
+		itemID), item)
 	if err != nil {
 		return nil, err
 	}
@@ -62,8 +148,12 @@ func (s *ItemsService) GetItem(ctx context.Context, itemID int64) (*models.Items
 
 // GetPrescriptionItems retrieves all items for a prescription
 func (s *ItemsService) GetPrescriptionItems(ctx context.Context, presID int64) ([]*models.Items, error) {
-	rows, err := s.db.Query(ctx,
-		"SELECT id, created_at, name, type, aiReasons, docReason, presId FROM items WHERE presId = $1",
+	return prescriptionItems(ctx, s.db, presID)
+}
+
+func prescriptionItems(ctx context.Context, q querier, presID int64) ([]*models.Items, error) {
+	rows, err := q.Query(ctx,
+		"SELECT "+itemColumns+" FROM items WHERE presId = $1",
 		presID)
 	if err != nil {
 		return nil, err
@@ -73,7 +163,54 @@ func (s *ItemsService) GetPrescriptionItems(ctx context.Context, presID int64) (
 	var items []*models.Items
 	for rows.Next() {
 		item := &models.Items{}
-		if err := rows.Scan(&item.ID, &item.CreatedAt, &item.Name, &item.Type, &item.AIReasons, &item.DocReason, &item.PresID); err != nil {
+		if err := scanItem(rows, item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// rejectedItemIDs returns the items of a prescription whose approval the doctor
+// refused or withdrew.
+func (s *ItemsService) rejectedItemIDs(ctx context.Context, presID int64) (map[int64]bool, error) {
+	rows, err := s.db.Query(ctx, "SELECT id FROM items WHERE presId = $1 AND COALESCE(rejected, FALSE)", presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rejected := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		rejected[id] = true
+	}
+	return rejected, rows.Err()
+}
+
+// GetActivePatientMedicines retrieves the approved medicine items on a patient's
+// other prescriptions whose course has not ended yet. Items without a duration
+// are treated as ongoing.
+func (s *ItemsService) GetActivePatientMedicines(ctx context.Context, userID, excludePresID int64) ([]*models.Items, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+itemColumns+` FROM items
+		 WHERE type = 'med' AND approved
+		   AND presId IN (SELECT id FROM prescriptions WHERE userId = $1 AND id <> $2)
+		   AND (durationDays = 0 OR created_at + durationDays * INTERVAL '1 day' >= NOW())
+		 ORDER BY id`,
+		userID, excludePresID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.Items
+	for rows.Next() {
+		item := &models.Items{}
+		if err := scanItem(rows, item); err != nil {
 			return nil, err
 		}
 		items = append(items, item)
@@ -81,16 +218,88 @@ func (s *ItemsService) GetPrescriptionItems(ctx context.Context, presID int64) (
 	return items, rows.Err()
 }
 
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx, so item queries can run
+// on their own or as part of a finalization or amendment.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// checkItemEditable returns ErrPrescriptionLocked if the item's prescription is
+// finalized and ErrPrescriptionNotEditable if it is cancelled or expired.
+// A missing item is left for the update itself to report.
+func checkItemEditable(ctx context.Context, q querier, itemID int64) error {
+	err := checkPrescriptionOpen(q.QueryRow(ctx,
+		`SELECT COALESCE(p.finalizedAt IS NOT NULL, FALSE), COALESCE(p.status, 'submitted')
+		 FROM items i LEFT JOIN prescriptions p ON p.id = i.presId
+		 WHERE i.id = $1`,
+		itemID))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// checkPrescriptionOpen scans whether a prescription is finalized and its
+// status, and returns the error for changing its items if it is finalized or
+// in a final status.
+func checkPrescriptionOpen(row pgx.Row) error {
+	var finalized bool
+	var status string
+	if err := row.Scan(&finalized, &status); err != nil {
+		return err
+	}
+	if finalized {
+		return ErrPrescriptionLocked
+	}
+	if status == models.PrescriptionStatusCancelled || status == models.PrescriptionStatusExpired {
+		return fmt.Errorf("%w: it is %s", ErrPrescriptionNotEditable, status)
+	}
+	return nil
+}
+
+// changeItem applies change to an item inside a transaction and records the
+// new version of its prescription. Items of finalized prescriptions return
+// ErrPrescriptionLocked.
+func (s *ItemsService) changeItem(ctx context.Context, itemID int64, actorRole string, actorID int64, reason string, change func(tx pgx.Tx) (*models.Items, error)) (*models.Items, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkItemEditable(ctx, tx, itemID); err != nil {
+		return nil, err
+	}
+	item, err := change(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordVersion(ctx, tx, item.PresID, actorRole, actorID, reason); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
 // UpdateItemDocReason updates only the docReason of an item by ID.
-func (s *ItemsService) UpdateItemDocReason(ctx context.Context, itemID int64, docReason string) (*models.Items, error) {
+func (s *ItemsService) UpdateItemDocReason(ctx context.Context, itemID int64, docReason, actorRole string, actorID int64, reason string) (*models.Items, error) {
+	return s.changeItem(ctx, itemID, actorRole, actorID, reason, func(tx pgx.Tx) (*models.Items, error) {
+		return updateItemDocReason(ctx, tx, itemID, docReason)
+	})
+}
+
+func updateItemDocReason(ctx context.Context, q querier, itemID int64, docReason string) (*models.Items, error) {
 	item := &models.Items{}
-	err := s.db.QueryRow(ctx,
+	err := scanItem(q.QueryRow(ctx,
 		`UPDATE items
 		 SET docReason = $2
 		 WHERE id = $1
-		 RETURNING id, created_at, name, type, aiReasons, docReason, presId`,
+		 RETURNING `+itemColumns,
 		itemID, docReason,
-	).Scan(&item.ID, &item.CreatedAt, &item.Name, &item.Type, &item.AIReasons, &item.DocReason, &item.PresID)
+	), item)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, pgx.ErrNoRows
@@ -99,3 +308,87 @@ func (s *ItemsService) UpdateItemDocReason(ctx context.Context, itemID int64, do
 	}
 	return item, nil
 }
+
+// UpdateItemDosage replaces the structured dosage of a medicine item by ID.
+func (s *ItemsService) UpdateItemDosage(ctx context.Context, itemID int64, dosage models.Dosage, actorRole string, actorID int64, reason string) (*models.Items, error) {
+	return s.changeItem(ctx, itemID, actorRole, actorID, reason, func(tx pgx.Tx) (*models.Items, error) {
+		return updateItemDosage(ctx, tx, itemID, dosage)
+	})
+}
+
+func updateItemDosage(ctx context.Context, q querier, itemID int64, dosage models.Dosage) (*models.Items, error) {
+	item := &models.Items{}
+	err := scanItem(q.QueryRow(ctx,
+		`UPDATE items
+		 SET doseAmount = $2, doseUnit = $3, route = $4, frequency = $5, timesPerDay = $6,
+		     asNeeded = $7, durationDays = $8, quantity = $9, instructions = $10
+		 WHERE id = $1 AND type = 'med'
+		 RETURNING `+itemColumns,
+		itemID, dosage.DoseAmount, dosage.DoseUnit, dosage.Route, dosage.Frequency, dosage.TimesPerDay,
+		dosage.AsNeeded, dosage.DurationDays, dosage.Quantity, dosage.Instructions,
+	), item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// UpdateItemRefills sets how often an approved medicine item may be refilled.
+func (s *ItemsService) UpdateItemRefills(ctx context.Context, itemID int64, policy models.RefillPolicy, actorRole string, actorID int64, reason string) (*models.Items, error) {
+	return s.changeItem(ctx, itemID, actorRole, actorID, reason, func(tx pgx.Tx) (*models.Items, error) {
+		return updateItemRefills(ctx, tx, itemID, policy)
+	})
+}
+
+// updateItemRefills returns ErrNotRefillable if the item is not an approved medicine.
+func updateItemRefills(ctx context.Context, q querier, itemID int64, policy models.RefillPolicy) (*models.Items, error) {
+	if err := ValidateRefillPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	var itemType string
+	var approved bool
+	err := q.QueryRow(ctx, "SELECT COALESCE(type, ''), COALESCE(approved, FALSE) FROM items WHERE id = $1", itemID).Scan(&itemType, &approved)
+	if err != nil {
+		return nil, err
+	}
+	if itemType != "med" || !approved {
+		return nil, fmt.Errorf("%w: item %d is not an approved medicine", ErrNotRefillable, itemID)
+	}
+
+	item := &models.Items{}
+	err = scanItem(q.QueryRow(ctx,
+		`UPDATE items
+		 SET refills = $2, refillIntervalDays = $3
+		 WHERE id = $1
+		 RETURNING `+itemColumns,
+		itemID, policy.Refills, policy.RefillIntervalDays,
+	), item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// SetItemApproved marks an item as approved or not approved by the doctor. An
+// item set to not approved is remembered as rejected, unlike one never reviewed.
+func (s *ItemsService) SetItemApproved(ctx context.Context, itemID int64, approved bool, actorRole string, actorID int64, reason string) (*models.Items, error) {
+	return s.changeItem(ctx, itemID, actorRole, actorID, reason, func(tx pgx.Tx) (*models.Items, error) {
+		return setItemApproved(ctx, tx, itemID, approved)
+	})
+}
+
+func setItemApproved(ctx context.Context, q querier, itemID int64, approved bool) (*models.Items, error) {
+	item := &models.Items{}
+	err := scanItem(q.QueryRow(ctx,
+		`UPDATE items
+		 SET approved = $2, rejected = NOT $2
+		 WHERE id = $1
+		 RETURNING `+itemColumns,
+		itemID, approved,
+	), item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// messageColumns lists the messages columns in the order scanMessage expects them.
+const messageColumns = "id, created_at, presId, senderRole, senderId, COALESCE(body, ''), readAt"
+
+func scanMessage(row pgx.Row, message *models.Message) error {
+	return row.Scan(&message.ID, &message.CreatedAt, &message.PresID, &message.SenderRole, &message.SenderID,
+		&message.Body, &message.ReadAt)
+}
+
+type MessageService struct {
+	db *pgxpool.Pool
+}
+
+func NewMessageService(db *pgxpool.Pool) *MessageService {
+	return &MessageService{db: db}
+}
+
+// SendMessage adds a message to the thread of its prescription. An attached
+// file is recorded with the outbox jobs that store it, as for prescription
+// uploads; uploads holds the file and any thumbnail.
+func (s *MessageService) SendMessage(ctx context.Context, message *models.Message, attachment *models.Attachment, uploads []*models.UploadJob) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = scanMessage(tx.QueryRow(ctx,
+		`INSERT INTO messages (presId, senderRole, senderId, body)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+messageColumns,
+		message.PresID, message.SenderRole, message.SenderID, message.Body,
+	), message)
+	if err != nil {
+		return err
+	}
+
+	if attachment != nil {
+		attachment.PresID, attachment.MessageID = message.PresID, &message.ID
+		if err := createAttachmentUploads(ctx, tx, []*models.Attachment{attachment}, [][]*models.UploadJob{uploads}); err != nil {
+			return err
+		}
+		message.Attachment = attachment
+	}
+	return tx.Commit(ctx)
+}
+
+// GetMessages returns up to limit messages of a prescription's thread, oldest
+// first. With before set, only messages older than that message are returned,
+// so clients page backwards from the newest.
+func (s *MessageService) GetMessages(ctx context.Context, presID, before int64, limit int) ([]*models.Message, error) {
+	rows, err := s.db.Query(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE presId = $1 AND ($2 = 0 OR id < $2) ORDER BY id DESC LIMIT $3",
+		presID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]*models.Message, 0)
+	byID := make(map[int64]*models.Message)
+	for rows.Next() {
+		message := &models.Message{}
+		if err := scanMessage(rows, message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+		byID[message.ID] = message
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	ids := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	attachmentRows, err := s.db.Query(ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE messageId = ANY($1)",
+		ids)
+	if err != nil {
+		return nil, err
+	}
+	defer attachmentRows.Close()
+	for attachmentRows.Next() {
+		attachment := &models.Attachment{}
+		if err := scanAttachment(attachmentRows, attachment); err != nil {
+			return nil, err
+		}
+		byID[*attachment.MessageID].Attachment = attachment
+	}
+	return messages, attachmentRows.Err()
+}
+
+// MarkRead marks the messages the other side sent in a prescription's thread
+// as read by readerRole, up to and including message upTo, or all of them when
+// upTo is 0. Messages already read keep their first read time.
+func (s *MessageService) MarkRead(ctx context.Context, presID int64, readerRole string, upTo int64) (*models.MessageReadReceipt, error) {
+	receipt := &models.MessageReadReceipt{PresID: presID, ReaderRole: readerRole, ReadAt: time.Now()}
+	rows, err := s.db.Query(ctx,
+		`UPDATE messages SET readAt = $4
+		 WHERE presId = $1 AND senderRole <> $2 AND readAt IS NULL AND ($3 = 0 OR id <= $3)
+		 RETURNING id`,
+		presID, readerRole, upTo, receipt.ReadAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		receipt.Count++
+		receipt.UpTo = max(receipt.UpTo, id)
+	}
+	return receipt, rows.Err()
+}
+
+// UnreadCounts returns how many messages from the other side readerRole has
+// not read in the threads of the given prescriptions. Prescriptions without
+// unread messages are left out.
+func (s *MessageService) UnreadCounts(ctx context.Context, readerRole string, presIDs []int64) (map[int64]int, error) {
+	counts := make(map[int64]int)
+	if len(presIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT presId, COUNT(*) FROM messages
+		 WHERE presId = ANY($1) AND senderRole <> $2 AND readAt IS NULL
+		 GROUP BY presId`,
+		presIDs, readerRole)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var presID int64
+		var count int
+		if err := rows.Scan(&presID, &count); err != nil {
+			return nil, err
+		}
+		counts[presID] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetMessageAttachment retrieves a file sent in the thread of a prescription.
+func (s *MessageService) GetMessageAttachment(ctx context.Context, presID, attachmentID int64) (*models.Attachment, error) {
+	attachment := &models.Attachment{}
+	err := scanAttachment(s.db.QueryRow(ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE id = $1 AND presId = $2 AND messageId IS NOT NULL",
+		attachmentID, presID), attachment)
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/notify"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxReminderLeadMinutes bounds how early a dose reminder can be sent.
+const maxReminderLeadMinutes = 120
+
+var validChannels = map[string]bool{
+	notify.ChannelLog:   true,
+	notify.ChannelEmail: true,
+	notify.ChannelSMS:   true,
+	notify.ChannelPush:  true,
+}
+
+// DefaultNotificationPreferences returns the settings used for patients who never saved any.
+func DefaultNotificationPreferences(userID int64) *models.NotificationPreferences {
+	return &models.NotificationPreferences{
+		UserID:            userID,
+		Channels:          []string{notify.ChannelEmail},
+		Timezone:          "UTC",
+		DoseReminders:     true,
+		FollowUpReminders: true,
+		LeadMinutes:       10,
+	}
+}
+
+// PreferencesLocation returns the time zone of the preferences, falling back to UTC.
+func PreferencesLocation(prefs *models.NotificationPreferences) *time.Location {
+	if prefs == nil || prefs.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// parseClock parses an "HH:MM" wall-clock time into minutes after midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// QuietHoursEnd reports whether now falls inside the quiet hours of prefs and,
+// if so, when they end. Windows may wrap past midnight (e.g. 22:00-07:00).
+func QuietHoursEnd(prefs *models.NotificationPreferences, now time.Time) (time.Time, bool) {
+	if prefs.QuietStart == "" || prefs.QuietEnd == "" {
+		return time.Time{}, false
+	}
+	start, err := parseClock(prefs.QuietStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(prefs.QuietEnd)
+	if err != nil || start == end {
+		return time.Time{}, false
+	}
+
+	local := now.In(PreferencesLocation(prefs))
+	minute := local.Hour()*60 + local.Minute()
+	// Build the end from the wall clock, so it stays right on DST change days.
+	endToday := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, local.Location())
+
+	if start < end {
+		if minute >= start && minute < end {
+			return endToday, true
+		}
+		return time.Time{}, false
+	}
+
+	// Overnight window.
+	switch {
+	case minute >= start:
+		return endToday.AddDate(0, 0, 1), true
+	case minute < end:
+		return endToday, true
+	}
+	return time.Time{}, false
+}
+
+// ValidateNotificationPreferences normalises and validates preferences before saving.
+func ValidateNotificationPreferences(prefs *models.NotificationPreferences) error {
+	channels := make([]string, 0, len(prefs.Channels))
+	seen := map[string]bool{}
+	for _, channel := range prefs.Channels {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if !validChannels[channel] {
+			return fmt.Errorf("unknown notification channel %q", channel)
+		}
+		if !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+	prefs.Channels = channels
+
+	prefs.Timezone = strings.TrimSpace(prefs.Timezone)
+	if prefs.Timezone == "" {
+		prefs.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", prefs.Timezone)
+	}
+
+	if (prefs.QuietStart == "") != (prefs.QuietEnd == "") {
+		return errors.New("quietStart and quietEnd must be set together")
+	}
+	for _, clock := range []string{prefs.QuietStart, prefs.QuietEnd} {
+		if clock == "" {
+			continue
+		}
+		if _, err := parseClock(clock); err != nil {
+			return err
+		}
+	}
+
+	if prefs.LeadMinutes < 0 || prefs.LeadMinutes > maxReminderLeadMinutes {
+		return fmt.Errorf("leadMinutes must be between 0 and %d", maxReminderLeadMinutes)
+	}
+
+	if len(prefs.PushSubscription) > 0 && string(prefs.PushSubscription) != "null" {
+		var sub struct {
+			Endpoint string `json:"endpoint"`
+		}
+		if err := json.Unmarshal(prefs.PushSubscription, &sub); err != nil || !strings.HasPrefix(sub.Endpoint, "https://") {
+			return errors.New("pushSubscription must be a Web Push subscription with an https endpoint")
+		}
+	} else {
+		prefs.PushSubscription = nil
+	}
+	return nil
+}
+
+type NotificationService struct {
+	db *pgxpool.Pool
+}
+
+func NewNotificationService(db *pgxpool.Pool) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// GetPreferences retrieves a patient's notification preferences, or the defaults if none are saved.
+func (s *NotificationService) GetPreferences(ctx context.Context, userID int64) (*models.NotificationPreferences, error) {
+	prefs := &models.NotificationPreferences{}
+	var pushSubscription string
+	err := s.db.QueryRow(ctx,
+		`SELECT userId, channels, email, phnNumber, timezone, quietStart, quietEnd, pushSubscription,
+		        doseReminders, followUpReminders, leadMinutes, updated_at
+		 FROM notification_preferences WHERE userId = $1`,
+		userID,
+	).Scan(&prefs.UserID, &prefs.Channels, &prefs.Email, &prefs.PhnNumber, &prefs.Timezone, &prefs.QuietStart,
+		&prefs.QuietEnd, &pushSubscription, &prefs.DoseReminders, &prefs.FollowUpReminders, &prefs.LeadMinutes, &prefs.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DefaultNotificationPreferences(userID), nil
+		}
+		return nil, err
+	}
+	if pushSubscription != "" {
+		prefs.PushSubscription = json.RawMessage(pushSubscription)
+	}
+	return prefs, nil
+}
+
+// SavePreferences creates or replaces a patient's notification preferences.
+func (s *NotificationService) SavePreferences(ctx context.Context, prefs *models.NotificationPreferences) error {
+	if err := ValidateNotificationPreferences(prefs); err != nil {
+		return err
+	}
+
+	return s.db.QueryRow(ctx,
+		`INSERT INTO notification_preferences
+			(userId, channels, email, phnNumber, timezone, quietStart, quietEnd, pushSubscription,
+			 doseReminders, followUpReminders, leadMinutes, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, CURRENT_TIMESTAMP)
+		 ON CONFLICT (userId) DO UPDATE SET
+			channels = EXCLUDED.channels, email = EXCLUDED.email, phnNumber = EXCLUDED.phnNumber,
+			timezone = EXCLUDED.timezone, quietStart = EXCLUDED.quietStart, quietEnd = EXCLUDED.quietEnd,
+			pushSubscription = EXCLUDED.pushSubscription, doseReminders = EXCLUDED.doseReminders,
+			followUpReminders = EXCLUDED.followUpReminders, leadMinutes = EXCLUDED.leadMinutes,
+			updated_at = CURRENT_TIMESTAMP
+		 RETURNING updated_at`,
+		prefs.UserID, prefs.Channels, strings.TrimSpace(prefs.Email), strings.TrimSpace(prefs.PhnNumber), prefs.Timezone,
+		prefs.QuietStart, prefs.QuietEnd, string(prefs.PushSubscription),
+		prefs.DoseReminders, prefs.FollowUpReminders, prefs.LeadMinutes,
+	).Scan(&prefs.UpdatedAt)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		start    string
+		end      string
+		now      string
+		want     string
+	}{
+		{name: "no quiet hours", now: "2026-01-10T13:00:00Z"},
+		{name: "inside a daytime window", start: "12:00", end: "14:00", now: "2026-01-10T13:00:00Z", want: "2026-01-10T14:00:00Z"},
+		{name: "end of a daytime window is not quiet", start: "12:00", end: "14:00", now: "2026-01-10T14:00:00Z"},
+		{name: "overnight window before midnight", start: "22:00", end: "07:00", now: "2026-01-10T23:30:00Z", want: "2026-01-11T07:00:00Z"},
+		{name: "overnight window after midnight", start: "22:00", end: "07:00", now: "2026-01-10T02:00:00Z", want: "2026-01-10T07:00:00Z"},
+		{name: "outside an overnight window", start: "22:00", end: "07:00", now: "2026-01-10T12:00:00Z"},
+		{name: "equal start and end", start: "22:00", end: "22:00", now: "2026-01-10T22:30:00Z"},
+		{name: "invalid clock", start: "25:00", end: "07:00", now: "2026-01-10T02:00:00Z"},
+		{
+			name: "patient time zone", timezone: "America/New_York", start: "22:00", end: "07:00",
+			now: "2026-01-10T04:00:00Z", want: "2026-01-10T12:00:00Z",
+		},
+		{
+			name: "ends on the DST change day", timezone: "America/New_York", start: "22:00", end: "07:00",
+			now: "2026-03-08T06:00:00Z", want: "2026-03-08T11:00:00Z",
+		},
+		{
+			name: "spans the DST change", timezone: "America/New_York", start: "22:00", end: "07:00",
+			now: "2026-03-08T03:30:00Z", want: "2026-03-08T11:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.timezone != "" {
+				if _, err := time.LoadLocation(tt.timezone); err != nil {
+					t.Skipf("time zone data not available: %v", err)
+				}
+			}
+			prefs := &models.NotificationPreferences{Timezone: tt.timezone, QuietStart: tt.start, QuietEnd: tt.end}
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, quiet := QuietHoursEnd(prefs, now)
+			if tt.want == "" {
+				if quiet {
+					t.Errorf("QuietHoursEnd(%s) = %s, want not quiet", tt.now, got.Format(time.RFC3339))
+				}
+				return
+			}
+			want, err := time.Parse(time.RFC3339, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !quiet || !got.Equal(want) {
+				t.Errorf("QuietHoursEnd(%s) = %s, %v, want %s", tt.now, got.UTC().Format(time.RFC3339), quiet, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNotificationPreferences(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefs        models.NotificationPreferences
+		wantChannels []string
+		wantTimezone string
+		wantErr      bool
+	}{
+		{
+			name:         "channels are normalised and deduplicated",
+			prefs:        models.NotificationPreferences{Channels: []string{" Email", "sms", "email"}},
+			wantChannels: []string{"email", "sms"},
+			wantTimezone: "UTC",
+		},
+		{
+			name:         "quiet hours and time zone",
+			prefs:        models.NotificationPreferences{Timezone: "Asia/Kolkata", QuietStart: "22:00", QuietEnd: "07:00"},
+			wantChannels: []string{},
+			wantTimezone: "Asia/Kolkata",
+		},
+		{name: "unknown channel", prefs: models.NotificationPreferences{Channels: []string{"pager"}}, wantErr: true},
+		{name: "unknown time zone", prefs: models.NotificationPreferences{Timezone: "Mars/Olympus"}, wantErr: true},
+		{name: "quiet start without end", prefs: models.NotificationPreferences{QuietStart: "22:00"}, wantErr: true},
+		{name: "invalid quiet clock", prefs: models.NotificationPreferences{QuietStart: "10pm", QuietEnd: "07:00"}, wantErr: true},
+		{name: "lead time too long", prefs: models.NotificationPreferences{LeadMinutes: maxReminderLeadMinutes + 1}, wantErr: true},
+		{
+			name:    "push subscription over http",
+			prefs:   models.NotificationPreferences{PushSubscription: json.RawMessage(`{"endpoint":"http://push.example"}`)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefs := tt.prefs
+			err := ValidateNotificationPreferences(&prefs)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ValidateNotificationPreferences(%+v) succeeded, want an error", tt.prefs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateNotificationPreferences(%+v) error: %v", tt.prefs, err)
+			}
+			if !slices.Equal(prefs.Channels, tt.wantChannels) || prefs.Timezone != tt.wantTimezone {
+				t.Errorf("got channels %v, time zone %q, want %v, %q", prefs.Channels, prefs.Timezone, tt.wantChannels, tt.wantTimezone)
+			}
+		})
+	}
+}
@@ -0,0 +1,816 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// vitalType describes a supported vital sign: its LOINC code, canonical unit,
+// plausible range for validation and usual adult range for flagging.
+type vitalType struct {
+	label                 string
+	code                  string
+	unit                  string
+	min, max              float64
+	normalLow, normalHigh float64
+	// Blood pressure only: diastolic ranges.
+	secondary                               bool
+	secondaryMin, secondaryMax              float64
+	secondaryNormalLow, secondaryNormalHigh float64
+}
+
+var vitalTypes = map[string]vitalType{
+	"blood_pressure": {
+		label: "Blood pressure", code: "85354-9", unit: "mmHg", min: 40, max: 300, normalLow: 90, normalHigh: 139,
+		secondary: true, secondaryMin: 20, secondaryMax: 200, secondaryNormalLow: 60, secondaryNormalHigh: 89,
+	},
+	"heart_rate":       {label: "Heart rate", code: "8867-4", unit: "/min", min: 20, max: 250, normalLow: 60, normalHigh: 100},
+	"respiratory_rate": {label: "Respiratory rate", code: "9279-1", unit: "/min", min: 4, max: 80, normalLow: 12, normalHigh: 20},
+	"temperature":      {label: "Temperature", code: "8310-5", unit: "Cel", min: 30, max: 45, normalLow: 36.1, normalHigh: 37.8},
+	"spo2":             {label: "SpO2", code: "59408-5", unit: "%", min: 50, max: 100, normalLow: 95, normalHigh: 100},
+	"blood_glucose":    {label: "Blood glucose", code: "2339-0", unit: "mg/dL", min: 10, max: 1000, normalLow: 70, normalHigh: 140},
+	"weight":           {label: "Weight", code: "29463-7", unit: "kg", min: 0.5, max: 500},
+	"height":           {label: "Height", code: "8302-2", unit: "cm", min: 20, max: 260},
+}
+
+var vitalTypeAliases = map[string]string{
+	"bp": "blood_pressure", "pulse": "heart_rate", "hr": "heart_rate", "rr": "respiratory_rate",
+	"temp": "temperature", "oxygen_saturation": "spo2", "spo₂": "spo2", "glucose": "blood_glucose",
+	"sugar": "blood_glucose", "blood_sugar": "blood_glucose",
+}
+
+// vitalUnitConversions converts alternative units to each type's canonical unit.
+var vitalUnitConversions = map[string]map[string]func(float64) float64{
+	"temperature": {
+		"f": fahrenheitToCelsius, "°f": fahrenheitToCelsius, "degf": fahrenheitToCelsius, "fahrenheit": fahrenheitToCelsius,
+		"c": identity, "°c": identity, "degc": identity, "celsius": identity,
+	},
+	"blood_glucose": {"mmol/l": func(v float64) float64 { return v * 18.016 }},
+	"weight":        {"lb": poundsToKg, "lbs": poundsToKg, "g": func(v float64) float64 { return v / 1000 }},
+	"height": {
+		"m":  func(v float64) float64 { return v * 100 },
+		"in": func(v float64) float64 { return v * 2.54 },
+	},
+	"heart_rate":       {"bpm": identity},
+	"respiratory_rate": {"breaths/min": identity},
+}
+
+func identity(v float64) float64            { return v }
+func fahrenheitToCelsius(v float64) float64 { return (v - 32) * 5 / 9 }
+func poundsToKg(v float64) float64          { return v * 0.45359237 }
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// labAnalyte holds defaults for a common LOINC code. critLow and critHigh are
+// the usual critical (panic) limits, flagged LL and HH.
+type labAnalyte struct {
+	name              string
+	unit              string
+	refLow            *float64
+	refHigh           *float64
+	critLow, critHigh *float64
+}
+
+func ref(v float64) *float64 { return &v }
+
+var labAnalytes = map[string]labAnalyte{
+	"2345-7":  {name: "Glucose (fasting)", unit: "mg/dL", refLow: ref(70), refHigh: ref(99), critLow: ref(40), critHigh: ref(400)},
+	"4548-4":  {name: "Hemoglobin A1c", unit: "%", refLow: ref(4), refHigh: ref(5.6)},
+	"718-7":   {name: "Hemoglobin", unit: "g/dL", refLow: ref(12), refHigh: ref(17.5), critLow: ref(7), critHigh: ref(20)},
+	"6690-2":  {name: "WBC count", unit: "10*3/uL", refLow: ref(4.5), refHigh: ref(11), critLow: ref(2), critHigh: ref(30)},
+	"777-3":   {name: "Platelet count", unit: "10*3/uL", refLow: ref(150), refHigh: ref(450), critLow: ref(20), critHigh: ref(1000)},
+	"2160-0":  {name: "Creatinine", unit: "mg/dL", refLow: ref(0.6), refHigh: ref(1.3), critHigh: ref(5)},
+	"3094-0":  {name: "Urea nitrogen (BUN)", unit: "mg/dL", refLow: ref(7), refHigh: ref(20)},
+	"2093-3":  {name: "Total cholesterol", unit: "mg/dL", refHigh: ref(200)},
+	"2571-8":  {name: "Triglycerides", unit: "mg/dL", refHigh: ref(150)},
+	"2085-9":  {name: "HDL cholesterol", unit: "mg/dL", refLow: ref(40)},
+	"13457-7": {name: "LDL cholesterol (calculated)", unit: "mg/dL", refHigh: ref(100)},
+	"1742-6":  {name: "ALT", unit: "U/L", refLow: ref(7), refHigh: ref(56)},
+	"1920-8":  {name: "AST", unit: "U/L", refLow: ref(10), refHigh: ref(40)},
+	"3016-3":  {name: "TSH", unit: "mIU/L", refLow: ref(0.4), refHigh: ref(4)},
+	"2951-2":  {name: "Sodium", unit: "mmol/L", refLow: ref(135), refHigh: ref(145), critLow: ref(120), critHigh: ref(160)},
+	"2823-3":  {name: "Potassium", unit: "mmol/L", refLow: ref(3.5), refHigh: ref(5.1), critLow: ref(2.5), critHigh: ref(6.5)},
+}
+
+var validLabFlags = map[string]bool{
+	models.LabFlagNormal: true, models.LabFlagLow: true, models.LabFlagHigh: true,
+	models.LabFlagCriticalLow: true, models.LabFlagCriticalHigh: true, models.LabFlagAbnormal: true,
+}
+
+// abnormalQualitative are qualitative results that are flagged abnormal.
+var abnormalQualitative = map[string]bool{"positive": true, "reactive": true, "detected": true, "present": true}
+
+// refRangeRe matches reference ranges such as "70-99", "< 200" or ">40".
+var refRangeRe = regexp.MustCompile(`^\s*(?:([\d.]+)\s*[-–]\s*([\d.]+)|([<>])=?\s*([\d.]+))\s*$`)
+
+// parseRefRange parses a textual reference range into bounds.
+func parseRefRange(text string) (low, high *float64, ok bool) {
+	m := refRangeRe.FindStringSubmatch(text)
+	if m == nil {
+		return nil, nil, false
+	}
+	number := func(s string) *float64 {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil
+		}
+		return &v
+	}
+	if m[1] != "" {
+		return number(m[1]), number(m[2]), true
+	}
+	if m[3] == "<" {
+		return nil, number(m[4]), true
+	}
+	return number(m[4]), nil, true
+}
+
+// observationTimeLayouts are the timestamp formats accepted for readings.
+var observationTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseObservationTime parses a reading timestamp; values without a zone are UTC.
+func ParseObservationTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range observationTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// normalizeVitalType lower-cases a vital type name, joins words with
+// underscores and resolves aliases such as "bp" or "Blood Sugar".
+func normalizeVitalType(name string) string {
+	name = strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(name, "-", " "))), "_")
+	if alias, ok := vitalTypeAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// ValidateVital normalises the type and unit of a reading, converting to the
+// canonical unit, and checks the values are plausible.
+func ValidateVital(vital *models.Vital, now time.Time) error {
+	vitalName := normalizeVitalType(vital.Type)
+	vt, ok := vitalTypes[vitalName]
+	if !ok {
+		return fmt.Errorf("unknown vital type %q", vital.Type)
+	}
+	vital.Type = vitalName
+	vital.Code = vt.code
+
+	unit := strings.ToLower(strings.TrimSpace(vital.Unit))
+	if unit != "" && unit != strings.ToLower(vt.unit) {
+		convert, ok := vitalUnitConversions[vitalName][unit]
+		if !ok {
+			return fmt.Errorf("unsupported unit %q for %s (use %s)", vital.Unit, vitalName, vt.unit)
+		}
+		vital.Value = roundTo(convert(vital.Value), 2)
+	}
+	vital.Unit = vt.unit
+
+	if vital.Value < vt.min || vital.Value > vt.max {
+		return fmt.Errorf("%s must be between %g and %g %s", vitalName, vt.min, vt.max, vt.unit)
+	}
+	if vt.secondary {
+		if vital.SecondaryValue == nil {
+			return errors.New("blood_pressure needs the diastolic value in secondaryValue")
+		}
+		if *vital.SecondaryValue < vt.secondaryMin || *vital.SecondaryValue > vt.secondaryMax || *vital.SecondaryValue >= vital.Value {
+			return errors.New("diastolic pressure must be plausible and below the systolic pressure")
+		}
+	} else {
+		vital.SecondaryValue = nil
+	}
+
+	if vital.MeasuredAt.IsZero() {
+		vital.MeasuredAt = now
+	}
+	if vital.MeasuredAt.After(now.Add(5 * time.Minute)) {
+		return errors.New("measuredAt cannot be in the future")
+	}
+	vital.Context = strings.TrimSpace(vital.Context)
+	vital.Note = strings.TrimSpace(vital.Note)
+	return nil
+}
+
+// VitalAbnormal reports whether a reading is outside the usual adult range.
+func VitalAbnormal(vital *models.Vital) bool {
+	vt, ok := vitalTypes[vital.Type]
+	if !ok || vt.normalHigh == 0 {
+		return false
+	}
+	if vital.Value < vt.normalLow || vital.Value > vt.normalHigh {
+		return true
+	}
+	if vt.secondary && vital.SecondaryValue != nil {
+		return *vital.SecondaryValue < vt.secondaryNormalLow || *vital.SecondaryValue > vt.secondaryNormalHigh
+	}
+	return false
+}
+
+// ComputeLabFlag derives the abnormal flag of a result from its reference range,
+// flagging LL or HH beyond the critical limits of known codes reported in their
+// default unit. It returns "" when there is nothing to compare against.
+func ComputeLabFlag(result *models.LabResult) string {
+	if result.Value == nil {
+		if result.ValueText == "" {
+			return ""
+		}
+		if abnormalQualitative[strings.ToLower(strings.TrimSpace(result.ValueText))] {
+			return models.LabFlagAbnormal
+		}
+		return models.LabFlagNormal
+	}
+	if analyte, ok := labAnalytes[result.Code]; ok && strings.EqualFold(result.Unit, analyte.unit) {
+		switch {
+		case analyte.critLow != nil && *result.Value < *analyte.critLow:
+			return models.LabFlagCriticalLow
+		case analyte.critHigh != nil && *result.Value > *analyte.critHigh:
+			return models.LabFlagCriticalHigh
+		}
+	}
+	if result.RefLow == nil && result.RefHigh == nil {
+		return ""
+	}
+	switch {
+	case result.RefLow != nil && *result.Value < *result.RefLow:
+		return models.LabFlagLow
+	case result.RefHigh != nil && *result.Value > *result.RefHigh:
+		return models.LabFlagHigh
+	}
+	return models.LabFlagNormal
+}
+
+// ValidateLabResult fills defaults for known codes, parses the reference range
+// and sets the abnormal flag unless the lab reported one.
+func ValidateLabResult(result *models.LabResult, now time.Time) error {
+	result.Code = strings.ToUpper(strings.TrimSpace(result.Code))
+	result.Name = strings.TrimSpace(result.Name)
+	result.Unit = strings.TrimSpace(result.Unit)
+	result.ValueText = strings.TrimSpace(result.ValueText)
+	result.RefText = strings.TrimSpace(result.RefText)
+
+	if analyte, ok := labAnalytes[result.Code]; ok {
+		if result.Name == "" {
+			result.Name = analyte.name
+		}
+		if result.Unit == "" {
+			result.Unit = analyte.unit
+		}
+		// Default ranges only apply when the result is in the default unit.
+		if result.RefLow == nil && result.RefHigh == nil && result.RefText == "" && strings.EqualFold(result.Unit, analyte.unit) {
+			result.RefLow, result.RefHigh = analyte.refLow, analyte.refHigh
+		}
+	}
+	if result.Name == "" {
+		return errors.New("lab result needs a name or a known code")
+	}
+	if result.Value == nil && result.ValueText == "" {
+		return fmt.Errorf("lab result %s needs a value or valueText", result.Name)
+	}
+	if result.RefLow == nil && result.RefHigh == nil && result.RefText != "" {
+		if low, high, ok := parseRefRange(result.RefText); ok {
+			result.RefLow, result.RefHigh = low, high
+		}
+	}
+	if result.RefLow != nil && result.RefHigh != nil && *result.RefLow > *result.RefHigh {
+		return fmt.Errorf("lab result %s has refLow above refHigh", result.Name)
+	}
+
+	result.Flag = strings.ToUpper(strings.TrimSpace(result.Flag))
+	if result.Flag == "" {
+		result.Flag = ComputeLabFlag(result)
+	} else if !validLabFlags[result.Flag] {
+		return fmt.Errorf("unknown lab flag %q", result.Flag)
+	}
+
+	if result.CollectedAt.IsZero() {
+		result.CollectedAt = now
+	}
+	if result.CollectedAt.After(now.Add(5 * time.Minute)) {
+		return errors.New("collectedAt cannot be in the future")
+	}
+	result.Lab = strings.TrimSpace(result.Lab)
+	result.Note = strings.TrimSpace(result.Note)
+	return nil
+}
+
+// csvTable reads a CSV with a header row and indexes the columns by lower-cased
+// header name with underscores removed.
+type csvTable struct {
+	columns map[string]int
+	rows    [][]string
+}
+
+func readCSVTable(r io.Reader) (*csvTable, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, errors.New("CSV needs a header row and at least one data row")
+	}
+	table := &csvTable{columns: map[string]int{}, rows: records[1:]}
+	for i, header := range records[0] {
+		table.columns[strings.ToLower(strings.ReplaceAll(strings.TrimSpace(header), "_", ""))] = i
+	}
+	return table, nil
+}
+
+func (t *csvTable) cell(row []string, keys ...string) string {
+	for _, key := range keys {
+		if i, ok := t.columns[key]; ok && i < len(row) {
+			if value := strings.TrimSpace(row[i]); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+func optionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", value)
+	}
+	return &v, nil
+}
+
+// ParseVitalsCSV reads readings from CSV with the columns type, value, unit,
+// measuredAt and optionally secondaryValue (or diastolic), context and note.
+// Blood pressure may also be written as "120/80" in the value column.
+func ParseVitalsCSV(r io.Reader) ([]*models.Vital, error) {
+	table, err := readCSVTable(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := table.columns["type"]; !ok {
+		return nil, errors.New("vitals CSV needs type and value columns")
+	}
+
+	vitals := make([]*models.Vital, 0, len(table.rows))
+	for i, row := range table.rows {
+		line := i + 2
+		vital := &models.Vital{
+			Type:    table.cell(row, "type"),
+			Unit:    table.cell(row, "unit"),
+			Context: table.cell(row, "context"),
+			Note:    table.cell(row, "note"),
+		}
+
+		value := table.cell(row, "value")
+		secondary := table.cell(row, "secondaryvalue", "diastolic")
+		if systolic, diastolic, ok := strings.Cut(value, "/"); ok {
+			value, secondary = strings.TrimSpace(systolic), strings.TrimSpace(diastolic)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("vitals CSV line %d: invalid value %q", line, value)
+		}
+		vital.Value = v
+		if vital.SecondaryValue, err = optionalFloat(secondary); err != nil {
+			return nil, fmt.Errorf("vitals CSV line %d: %w", line, err)
+		}
+
+		if measuredAt := table.cell(row, "measuredat", "date", "time"); measuredAt != "" {
+			if vital.MeasuredAt, err = ParseObservationTime(measuredAt); err != nil {
+				return nil, fmt.Errorf("vitals CSV line %d: %w", line, err)
+			}
+		}
+		vitals = append(vitals, vital)
+	}
+	return vitals, nil
+}
+
+// ParseLabResultsCSV reads results from CSV with the columns code, name, value,
+// unit, collectedAt and optionally refLow, refHigh, refRange ("70-99"), flag,
+// lab and note. Non-numeric values are stored as valueText.
+func ParseLabResultsCSV(r io.Reader) ([]*models.LabResult, error) {
+	table, err := readCSVTable(r)
+	if err != nil {
+		return nil, err
+	}
+	_, hasCode := table.columns["code"]
+	_, hasName := table.columns["name"]
+	if !hasCode && !hasName {
+		return nil, errors.New("lab CSV needs a code or name column and a value column")
+	}
+
+	results := make([]*models.LabResult, 0, len(table.rows))
+	for i, row := range table.rows {
+		line := i + 2
+		result := &models.LabResult{
+			Code:    table.cell(row, "code", "loinc"),
+			Name:    table.cell(row, "name", "test"),
+			Unit:    table.cell(row, "unit", "units"),
+			RefText: table.cell(row, "refrange", "referencerange"),
+			Flag:    table.cell(row, "flag"),
+			Lab:     table.cell(row, "lab"),
+			Note:    table.cell(row, "note"),
+		}
+
+		value := table.cell(row, "value", "result")
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			result.Value = &v
+		} else {
+			result.ValueText = value
+		}
+		if result.RefLow, err = optionalFloat(table.cell(row, "reflow")); err != nil {
+			return nil, fmt.Errorf("lab CSV line %d: %w", line, err)
+		}
+		if result.RefHigh, err = optionalFloat(table.cell(row, "refhigh")); err != nil {
+			return nil, fmt.Errorf("lab CSV line %d: %w", line, err)
+		}
+		if collectedAt := table.cell(row, "collectedat", "date"); collectedAt != "" {
+			if result.CollectedAt, err = ParseObservationTime(collectedAt); err != nil {
+				return nil, fmt.Errorf("lab CSV line %d: %w", line, err)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// vitalColumns lists the vitals columns in the order scanVital expects them.
+const vitalColumns = "id, created_at, userId, type, code, value, secondaryValue, unit, measuredAt, context, note, source, recordedBy"
+
+func scanVital(row pgx.Row, vital *models.Vital) error {
+	return row.Scan(&vital.ID, &vital.CreatedAt, &vital.UserID, &vital.Type, &vital.Code, &vital.Value,
+		&vital.SecondaryValue, &vital.Unit, &vital.MeasuredAt, &vital.Context, &vital.Note, &vital.Source, &vital.RecordedBy)
+}
+
+// labResultColumns lists the lab_results columns in the order scanLabResult expects them.
+const labResultColumns = `id, created_at, userId, presId, code, name, value, valueText, unit, refLow, refHigh,
+	refText, flag, collectedAt, lab, note, source, recordedBy`
+
+func scanLabResult(row pgx.Row, result *models.LabResult) error {
+	return row.Scan(&result.ID, &result.CreatedAt, &result.UserID, &result.PresID, &result.Code, &result.Name,
+		&result.Value, &result.ValueText, &result.Unit, &result.RefLow, &result.RefHigh, &result.RefText,
+		&result.Flag, &result.CollectedAt, &result.Lab, &result.Note, &result.Source, &result.RecordedBy)
+}
+
+type ObservationService struct {
+	db *pgxpool.Pool
+}
+
+func NewObservationService(db *pgxpool.Pool) *ObservationService {
+	return &ObservationService{db: db}
+}
+
+// ValidateVitals validates a batch of readings, naming the first invalid one.
+func ValidateVitals(vitals []*models.Vital, now time.Time) error {
+	for i, vital := range vitals {
+		if err := ValidateVital(vital, now); err != nil {
+			return fmt.Errorf("reading %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ValidateLabResults validates a batch of lab results, naming the first invalid one.
+func ValidateLabResults(results []*models.LabResult, now time.Time) error {
+	for i, result := range results {
+		if err := ValidateLabResult(result, now); err != nil {
+			return fmt.Errorf("result %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// CreateVitals validates and stores readings in one transaction, so an import
+// is either stored completely or not at all.
+func (s *ObservationService) CreateVitals(ctx context.Context, vitals []*models.Vital) error {
+	if err := ValidateVitals(vitals, time.Now()); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, vital := range vitals {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO vitals (userId, type, code, value, secondaryValue, unit, measuredAt, context, note, source, recordedBy)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			 RETURNING id, created_at`,
+			vital.UserID, vital.Type, vital.Code, vital.Value, vital.SecondaryValue, vital.Unit, vital.MeasuredAt,
+			vital.Context, vital.Note, vital.Source, vital.RecordedBy,
+		).Scan(&vital.ID, &vital.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateLabResults validates and stores results in one transaction.
+func (s *ObservationService) CreateLabResults(ctx context.Context, results []*models.LabResult) error {
+	if err := ValidateLabResults(results, time.Now()); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, result := range results {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO lab_results (userId, presId, code, name, value, valueText, unit, refLow, refHigh,
+				refText, flag, collectedAt, lab, note, source, recordedBy)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			 RETURNING id, created_at`,
+			result.UserID, result.PresID, result.Code, result.Name, result.Value, result.ValueText, result.Unit,
+			result.RefLow, result.RefHigh, result.RefText, result.Flag, result.CollectedAt, result.Lab, result.Note,
+			result.Source, result.RecordedBy,
+		).Scan(&result.ID, &result.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// timeRangeClause appends optional [from, to) bounds on column to a query.
+func timeRangeClause(query string, args []interface{}, column string, from, to time.Time) (string, []interface{}) {
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(" AND %s >= $%d", column, len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(" AND %s < $%d", column, len(args))
+	}
+	return query, args
+}
+
+// GetUserVitals retrieves a patient's readings within [from, to), newest first,
+// optionally limited to one type.
+func (s *ObservationService) GetUserVitals(ctx context.Context, userID int64, vitalType string, from, to time.Time) ([]*models.Vital, error) {
+	query := "SELECT " + vitalColumns + " FROM vitals WHERE userId = $1"
+	args := []interface{}{userID}
+	if vitalType = normalizeVitalType(vitalType); vitalType != "" {
+		args = append(args, vitalType)
+		query += fmt.Sprintf(" AND type = $%d", len(args))
+	}
+	query, args = timeRangeClause(query, args, "measuredAt", from, to)
+	query += " ORDER BY measuredAt DESC, id DESC"
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vitals := make([]*models.Vital, 0)
+	for rows.Next() {
+		vital := &models.Vital{}
+		if err := scanVital(rows, vital); err != nil {
+			return nil, err
+		}
+		vitals = append(vitals, vital)
+	}
+	return vitals, rows.Err()
+}
+
+// GetUserLabResults retrieves a patient's lab results within [from, to), newest
+// first, optionally limited to one code.
+func (s *ObservationService) GetUserLabResults(ctx context.Context, userID int64, code string, from, to time.Time) ([]*models.LabResult, error) {
+	query := "SELECT " + labResultColumns + " FROM lab_results WHERE userId = $1"
+	args := []interface{}{userID}
+	if code != "" {
+		args = append(args, strings.ToUpper(code))
+		query += fmt.Sprintf(" AND code = $%d", len(args))
+	}
+	query, args = timeRangeClause(query, args, "collectedAt", from, to)
+	query += " ORDER BY collectedAt DESC, id DESC"
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*models.LabResult, 0)
+	for rows.Next() {
+		result := &models.LabResult{}
+		if err := scanLabResult(rows, result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func vitalSummary(vital *models.Vital) string {
+	label := vital.Type
+	if vt, ok := vitalTypes[vital.Type]; ok {
+		label = vt.label
+	}
+	value := formatNumber(vital.Value)
+	if vital.SecondaryValue != nil {
+		value += "/" + formatNumber(*vital.SecondaryValue)
+	}
+	return fmt.Sprintf("%s %s %s", label, value, vital.Unit)
+}
+
+func labSummary(result *models.LabResult) string {
+	value := result.ValueText
+	if result.Value != nil {
+		value = strings.TrimSpace(formatNumber(*result.Value) + " " + result.Unit)
+	}
+	summary := result.Name + " " + value
+	if result.Flag != "" && result.Flag != models.LabFlagNormal {
+		summary += " (" + result.Flag + ")"
+	}
+	return summary
+}
+
+// timelineKindAliases maps the accepted spellings of a timeline kind.
+var timelineKindAliases = map[string]string{
+	"vital": models.TimelineKindVital, "vitals": models.TimelineKindVital,
+	"lab": models.TimelineKindLab, "labs": models.TimelineKindLab,
+	"lab_result": models.TimelineKindLab, "lab_results": models.TimelineKindLab,
+	"prescription": models.TimelineKindPrescription, "prescriptions": models.TimelineKindPrescription,
+	"rx": models.TimelineKindPrescription,
+}
+
+// ParseTimelineKinds normalises a comma-separated list of timeline kinds such
+// as "vitals, Labs". An empty list selects every kind.
+func ParseTimelineKinds(value string) ([]string, error) {
+	var kinds []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(name, "-", " "))), "_")
+		if name == "" {
+			continue
+		}
+		kind, ok := timelineKindAliases[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown timeline type %q (use vital, lab or prescription)", name)
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds, nil
+}
+
+// timelineSources gives, per kind, the table and timestamp column an entry is
+// read from.
+var timelineSources = []struct{ kind, table, column string }{
+	{models.TimelineKindVital, "vitals", "measuredAt"},
+	{models.TimelineKindLab, "lab_results", "collectedAt"},
+	{models.TimelineKindPrescription, "prescriptions", "created_at"},
+}
+
+// Timeline merges a patient's vitals, lab results and prescriptions within
+// [from, to) into one list, newest first. kinds limits the entries to some
+// kinds (all when empty) and limit caps their number.
+func (s *ObservationService) Timeline(ctx context.Context, userID int64, kinds []string, from, to time.Time, limit int) ([]*models.TimelineEntry, error) {
+	args := []interface{}{userID}
+	var branches []string
+	for _, source := range timelineSources {
+		if len(kinds) > 0 && !slices.Contains(kinds, source.kind) {
+			continue
+		}
+		branch := fmt.Sprintf("SELECT '%s' AS kind, id, %s AS at FROM %s WHERE userId = $1", source.kind, source.column, source.table)
+		branch, args = timeRangeClause(branch, args, source.column, from, to)
+		branches = append(branches, branch)
+	}
+	if len(branches) == 0 {
+		return []*models.TimelineEntry{}, nil
+	}
+	query := strings.Join(branches, " UNION ALL ") + " ORDER BY at DESC, id DESC"
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*models.TimelineEntry, 0)
+	ids := map[string][]int64{}
+	for rows.Next() {
+		entry := &models.TimelineEntry{}
+		if err := rows.Scan(&entry.Kind, &entry.ID, &entry.At); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, entry)
+		ids[entry.Kind] = append(ids[entry.Kind], entry.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.fillTimeline(ctx, entries, ids); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// fillTimeline loads the rows behind the selected timeline entries, by kind,
+// and sets their summary, abnormal mark and data.
+func (s *ObservationService) fillTimeline(ctx context.Context, entries []*models.TimelineEntry, ids map[string][]int64) error {
+	byID := map[string]map[int64]*models.TimelineEntry{}
+	for _, entry := range entries {
+		if byID[entry.Kind] == nil {
+			byID[entry.Kind] = map[int64]*models.TimelineEntry{}
+		}
+		byID[entry.Kind][entry.ID] = entry
+	}
+	fill := func(kind string, id int64, summary string, abnormal bool, data interface{}) {
+		if entry, ok := byID[kind][id]; ok {
+			entry.Summary, entry.Abnormal, entry.Data = summary, abnormal, data
+		}
+	}
+
+	if len(ids[models.TimelineKindVital]) > 0 {
+		rows, err := s.db.Query(ctx, "SELECT "+vitalColumns+" FROM vitals WHERE id = ANY($1)", ids[models.TimelineKindVital])
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			vital := &models.Vital{}
+			if err := scanVital(rows, vital); err != nil {
+				rows.Close()
+				return err
+			}
+			fill(models.TimelineKindVital, vital.ID, vitalSummary(vital), VitalAbnormal(vital), vital)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	if len(ids[models.TimelineKindLab]) > 0 {
+		rows, err := s.db.Query(ctx, "SELECT "+labResultColumns+" FROM lab_results WHERE id = ANY($1)", ids[models.TimelineKindLab])
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			result := &models.LabResult{}
+			if err := scanLabResult(rows, result); err != nil {
+				rows.Close()
+				return err
+			}
+			abnormal := result.Flag != "" && result.Flag != models.LabFlagNormal
+			fill(models.TimelineKindLab, result.ID, labSummary(result), abnormal, result)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	if len(ids[models.TimelineKindPrescription]) > 0 {
+		prescriptions, err := NewPrescriptionService(s.db).queryPrescriptions(ctx,
+			"SELECT "+prescriptionColumns+" FROM prescriptions WHERE id = ANY($1)", ids[models.TimelineKindPrescription])
+		if err != nil {
+			return err
+		}
+		for _, prescription := range prescriptions {
+			summary := "Prescription"
+			if prescription.Symptoms != "" {
+				summary += ": " + prescription.Symptoms
+			}
+			fill(models.TimelineKindPrescription, prescription.ID, summary, false, prescription)
+		}
+	}
+	return nil
+}
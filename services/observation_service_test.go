@@ -0,0 +1,234 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestValidateVital(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	diastolic := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name      string
+		vital     models.Vital
+		wantType  string
+		wantValue float64
+		wantUnit  string
+		wantErr   bool
+	}{
+		{name: "alias and canonical unit", vital: models.Vital{Type: "BP", Value: 128, SecondaryValue: diastolic(84)}, wantType: "blood_pressure", wantValue: 128, wantUnit: "mmHg"},
+		{name: "words joined by underscores", vital: models.Vital{Type: "Heart Rate", Value: 72, Unit: "bpm"}, wantType: "heart_rate", wantValue: 72, wantUnit: "/min"},
+		{name: "fahrenheit converted", vital: models.Vital{Type: "temp", Value: 98.6, Unit: "°F"}, wantType: "temperature", wantValue: 37, wantUnit: "Cel"},
+		{name: "glucose in mmol/L", vital: models.Vital{Type: "blood sugar", Value: 5.5, Unit: "mmol/L"}, wantType: "blood_glucose", wantValue: 99.09, wantUnit: "mg/dL"},
+		{name: "pounds converted", vital: models.Vital{Type: "weight", Value: 154, Unit: "lb"}, wantType: "weight", wantValue: 69.85, wantUnit: "kg"},
+		{name: "unknown type", vital: models.Vital{Type: "mood", Value: 5}, wantErr: true},
+		{name: "unsupported unit", vital: models.Vital{Type: "spo2", Value: 0.97, Unit: "fraction"}, wantErr: true},
+		{name: "implausible value", vital: models.Vital{Type: "heart_rate", Value: 400}, wantErr: true},
+		{name: "blood pressure without diastolic", vital: models.Vital{Type: "bp", Value: 120}, wantErr: true},
+		{name: "diastolic above systolic", vital: models.Vital{Type: "bp", Value: 80, SecondaryValue: diastolic(120)}, wantErr: true},
+		{name: "measured in the future", vital: models.Vital{Type: "heart_rate", Value: 70, MeasuredAt: now.Add(time.Hour)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vital := tt.vital
+			err := ValidateVital(&vital, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ValidateVital(%+v) succeeded, want an error", tt.vital)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateVital(%+v) error: %v", tt.vital, err)
+			}
+			if vital.Type != tt.wantType || vital.Value != tt.wantValue || vital.Unit != tt.wantUnit {
+				t.Errorf("ValidateVital() = %s %g %s, want %s %g %s", vital.Type, vital.Value, vital.Unit, tt.wantType, tt.wantValue, tt.wantUnit)
+			}
+			if vital.MeasuredAt.IsZero() {
+				t.Error("ValidateVital() left measuredAt unset")
+			}
+		})
+	}
+}
+
+func TestComputeLabFlag(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name   string
+		result models.LabResult
+		want   string
+	}{
+		{name: "within range", result: models.LabResult{Value: value(90), RefLow: value(70), RefHigh: value(99)}, want: models.LabFlagNormal},
+		{name: "below range", result: models.LabResult{Value: value(65), RefLow: value(70), RefHigh: value(99)}, want: models.LabFlagLow},
+		{name: "above range", result: models.LabResult{Value: value(120), RefLow: value(70), RefHigh: value(99)}, want: models.LabFlagHigh},
+		{name: "upper bound only", result: models.LabResult{Value: value(250), RefHigh: value(200)}, want: models.LabFlagHigh},
+		{name: "no range", result: models.LabResult{Value: value(12)}, want: ""},
+		{name: "critically low potassium", result: models.LabResult{Code: "2823-3", Unit: "mmol/L", Value: value(2.1), RefLow: value(3.5), RefHigh: value(5.1)}, want: models.LabFlagCriticalLow},
+		{name: "critically high glucose", result: models.LabResult{Code: "2345-7", Unit: "mg/dL", Value: value(450), RefLow: value(70), RefHigh: value(99)}, want: models.LabFlagCriticalHigh},
+		{name: "critical limits need the default unit", result: models.LabResult{Code: "2345-7", Unit: "mmol/L", Value: value(450), RefHigh: value(5.5)}, want: models.LabFlagHigh},
+		{name: "positive qualitative result", result: models.LabResult{ValueText: "Positive"}, want: models.LabFlagAbnormal},
+		{name: "negative qualitative result", result: models.LabResult{ValueText: "negative"}, want: models.LabFlagNormal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result
+			if got := ComputeLabFlag(&result); got != tt.want {
+				t.Errorf("ComputeLabFlag(%+v) = %q, want %q", tt.result, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLabResult(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	value := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name     string
+		result   models.LabResult
+		wantName string
+		wantFlag string
+		wantErr  bool
+	}{
+		{name: "known code fills name and range", result: models.LabResult{Code: "4548-4", Value: value(7.2)}, wantName: "Hemoglobin A1c", wantFlag: models.LabFlagHigh},
+		{name: "textual reference range", result: models.LabResult{Name: "CRP", Value: value(12), Unit: "mg/L", RefText: "<5"}, wantName: "CRP", wantFlag: models.LabFlagHigh},
+		{name: "reported flag is kept", result: models.LabResult{Code: "4548-4", Value: value(5), Flag: "hh"}, wantName: "Hemoglobin A1c", wantFlag: models.LabFlagCriticalHigh},
+		{name: "unknown flag", result: models.LabResult{Name: "CRP", Value: value(1), Flag: "X"}, wantErr: true},
+		{name: "no name or known code", result: models.LabResult{Code: "0000-0", Value: value(1)}, wantErr: true},
+		{name: "no value", result: models.LabResult{Name: "CRP"}, wantErr: true},
+		{name: "inverted range", result: models.LabResult{Name: "CRP", Value: value(1), RefLow: value(5), RefHigh: value(1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result
+			err := ValidateLabResult(&result, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ValidateLabResult(%+v) succeeded, want an error", tt.result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateLabResult(%+v) error: %v", tt.result, err)
+			}
+			if result.Name != tt.wantName || result.Flag != tt.wantFlag {
+				t.Errorf("ValidateLabResult() = %q flagged %q, want %q flagged %q", result.Name, result.Flag, tt.wantName, tt.wantFlag)
+			}
+		})
+	}
+}
+
+func TestParseRefRange(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantLow  string
+		wantHigh string
+		wantOK   bool
+	}{
+		{text: "70-99", wantLow: "70", wantHigh: "99", wantOK: true},
+		{text: " 3.5 – 5.1 ", wantLow: "3.5", wantHigh: "5.1", wantOK: true},
+		{text: "< 200", wantHigh: "200", wantOK: true},
+		{text: ">=40", wantLow: "40", wantOK: true},
+		{text: "negative"},
+	}
+
+	bound := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return formatNumber(*v)
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			low, high, ok := parseRefRange(tt.text)
+			if ok != tt.wantOK || bound(low) != tt.wantLow || bound(high) != tt.wantHigh {
+				t.Errorf("parseRefRange(%q) = %q, %q, %v, want %q, %q, %v", tt.text, bound(low), bound(high), ok, tt.wantLow, tt.wantHigh, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseVitalsCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "blood pressure written as a fraction",
+			csv:  "type,value,unit,measured_at\nbp,120/80,mmHg,2026-03-01 08:00\nheart rate,72,bpm,2026-03-01\n",
+			want: []string{"bp 120/80 2026-03-01T08:00:00Z", "heart rate 72 2026-03-01T00:00:00Z"},
+		},
+		{
+			name: "separate diastolic column",
+			csv:  "Type,Value,Diastolic\nblood_pressure,135,88\n",
+			want: []string{"blood_pressure 135/88 0001-01-01T00:00:00Z"},
+		},
+		{name: "missing type column", csv: "value\n72\n", wantErr: "needs type"},
+		{name: "invalid value", csv: "type,value\nheart_rate,fast\n", wantErr: "line 2"},
+		{name: "invalid timestamp", csv: "type,value,date\nheart_rate,70,yesterday\n", wantErr: "line 2"},
+		{name: "header only", csv: "type,value\n", wantErr: "at least one data row"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vitals, err := ParseVitalsCSV(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseVitalsCSV() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseVitalsCSV() error: %v", err)
+			}
+			got := make([]string, len(vitals))
+			for i, vital := range vitals {
+				value := formatNumber(vital.Value)
+				if vital.SecondaryValue != nil {
+					value += "/" + formatNumber(*vital.SecondaryValue)
+				}
+				got[i] = vital.Type + " " + value + " " + vital.MeasuredAt.Format(time.RFC3339)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseVitalsCSV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimelineKinds(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "vitals", want: []string{models.TimelineKindVital}},
+		{value: " Labs , lab-results,prescriptions", want: []string{models.TimelineKindLab, models.TimelineKindPrescription}},
+		{value: "rx,,vital", want: []string{models.TimelineKindPrescription, models.TimelineKindVital}},
+		{value: "appointments", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTimelineKinds(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimelineKinds(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseTimelineKinds(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrRasterizerUnavailable is returned when no PDF rasterizer is installed.
+var ErrRasterizerUnavailable = errors.New("PDF rasterizer is not available")
+
+// pdfPageRe matches page objects, but not the /Pages tree nodes.
+var pdfPageRe = regexp.MustCompile(`/Type\s*/Page\b`)
+
+// CountPDFPages estimates the page count of a PDF from its page objects. It can
+// under-count PDFs that keep pages in compressed object streams, so treat it as
+// a lower bound for limits and not as the exact count.
+func CountPDFPages(data []byte) int {
+	return len(pdfPageRe.FindAll(data, -1))
+}
+
+// IsPDF reports whether data starts with the PDF signature.
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+// PDFRasterizer renders the pages of a PDF to PNG images.
+type PDFRasterizer interface {
+	Rasterize(ctx context.Context, pdf []byte, maxPages int) ([][]byte, error)
+	// Available returns ErrRasterizerUnavailable when PDFs cannot be rendered.
+	Available() error
+}
+
+// PopplerRasterizer renders pages locally with poppler's pdftoppm, so PDF
+// contents never leave the server before the AI call.
+type PopplerRasterizer struct {
+	Command string
+	DPI     int
+	Timeout time.Duration
+}
+
+// NewPopplerRasterizer creates a rasterizer using PDFTOPPM_PATH or pdftoppm from PATH.
+func NewPopplerRasterizer() *PopplerRasterizer {
+	command := os.Getenv("PDFTOPPM_PATH")
+	if command == "" {
+		command = "pdftoppm"
+	}
+	return &PopplerRasterizer{Command: command, DPI: 150, Timeout: 60 * time.Second}
+}
+
+// DefaultPDFRasterizer is used to turn uploaded PDFs into page images.
+var DefaultPDFRasterizer PDFRasterizer = NewPopplerRasterizer()
+
+func (p *PopplerRasterizer) Available() error {
+	if _, err := exec.LookPath(p.Command); err != nil {
+		return fmt.Errorf("%w: %s not found", ErrRasterizerUnavailable, p.Command)
+	}
+	return nil
+}
+
+func (p *PopplerRasterizer) Rasterize(ctx context.Context, pdf []byte, maxPages int) ([][]byte, error) {
+	command, err := exec.LookPath(p.Command)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s not found", ErrRasterizerUnavailable, p.Command)
+	}
+
+	dir, err := os.MkdirTemp("", "pdfpages-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, pdf, 0o600); err != nil {
+		return nil, err
+	}
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	args := []string{"-png", "-r", strconv.Itoa(p.DPI)}
+	if maxPages > 0 {
+		args = append(args, "-l", strconv.Itoa(maxPages))
+	}
+	args = append(args, input, filepath.Join(dir, "page"))
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	// pdftoppm names pages page-1.png, page-01.png, ... depending on the page count.
+	files, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	pageNumber := func(path string) int {
+		base := filepath.Base(path)
+		n, _ := strconv.Atoi(base[len("page-") : len(base)-len(".png")])
+		return n
+	}
+	sort.Slice(files, func(i, j int) bool { return pageNumber(files[i]) < pageNumber(files[j]) })
+
+	pages := make([][]byte, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, data)
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("PDF has no pages")
+	}
+	return pages, nil
+}
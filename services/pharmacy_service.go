@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pharmacyColumns lists the pharmacies columns in the order scanPharmacy expects them.
+const pharmacyColumns = "id, created_at, name, licenseNumber, COALESCE(address, ''), COALESCE(phnNumber, ''), email, password"
+
+func scanPharmacy(row pgx.Row, pharmacy *models.Pharmacy) error {
+	return row.Scan(&pharmacy.ID, &pharmacy.CreatedAt, &pharmacy.Name, &pharmacy.LicenseNumber,
+		&pharmacy.Address, &pharmacy.PhnNumber, &pharmacy.Email, &pharmacy.Password)
+}
+
+type PharmacyService struct {
+	db *pgxpool.Pool
+}
+
+func NewPharmacyService(db *pgxpool.Pool) *PharmacyService {
+	return &PharmacyService{db: db}
+}
+
+// CreatePharmacy registers a pharmacy with a hashed password.
+func (s *PharmacyService) CreatePharmacy(ctx context.Context, req *models.PharmacyCreateRequest) (*models.Pharmacy, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.LicenseNumber = strings.TrimSpace(req.LicenseNumber)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Name == "" || req.LicenseNumber == "" || req.Email == "" || req.Password == "" {
+		return nil, errors.New("name, licenseNumber, email and password are required")
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	pharmacy := &models.Pharmacy{
+		Name:          req.Name,
+		LicenseNumber: req.LicenseNumber,
+		Address:       strings.TrimSpace(req.Address),
+		PhnNumber:     strings.TrimSpace(req.PhnNumber),
+		Email:         req.Email,
+	}
+	err = s.db.QueryRow(ctx,
+		"INSERT INTO pharmacies (name, licenseNumber, address, phnNumber, email, password) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+		pharmacy.Name, pharmacy.LicenseNumber, pharmacy.Address, pharmacy.PhnNumber, pharmacy.Email, hashedPassword).Scan(&pharmacy.ID, &pharmacy.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return pharmacy, nil
+}
+
+// GetPharmacy retrieves a pharmacy by ID
+func (s *PharmacyService) GetPharmacy(ctx context.Context, pharmacyID int64) (*models.Pharmacy, error) {
+	pharmacy := &models.Pharmacy{}
+	if err := scanPharmacy(s.db.QueryRow(ctx, "SELECT "+pharmacyColumns+" FROM pharmacies WHERE id = $1", pharmacyID), pharmacy); err != nil {
+		return nil, err
+	}
+	return pharmacy, nil
+}
+
+// GetAllPharmacies lists pharmacies by name, without their password hashes.
+func (s *PharmacyService) GetAllPharmacies(ctx context.Context) ([]*models.Pharmacy, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+pharmacyColumns+" FROM pharmacies ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pharmacies := make([]*models.Pharmacy, 0)
+	for rows.Next() {
+		pharmacy := &models.Pharmacy{}
+		if err := scanPharmacy(rows, pharmacy); err != nil {
+			return nil, err
+		}
+		pharmacy.Password = ""
+		pharmacies = append(pharmacies, pharmacy)
+	}
+	return pharmacies, rows.Err()
+}
+
+// LoginPharmacy authenticates a pharmacy by email and password
+func (s *PharmacyService) LoginPharmacy(ctx context.Context, email, password string) (*models.Pharmacy, error) {
+	pharmacy := &models.Pharmacy{}
+	err := scanPharmacy(s.db.QueryRow(ctx, "SELECT "+pharmacyColumns+" FROM pharmacies WHERE LOWER(email) = LOWER($1)", strings.TrimSpace(email)), pharmacy)
+	if err != nil {
+		return nil, errors.New("invalid email or password")
+	}
+
+	if !utils.VerifyPassword(pharmacy.Password, password) {
+		return nil, errors.New("invalid email or password")
+	}
+	return pharmacy, nil
+}
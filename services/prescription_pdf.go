@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/pdf"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/qr"
+)
+
+// Layout of the printed prescription, in points.
+const (
+	pdfMargin     = 50.0
+	pdfFooterTop  = pdf.PageHeight - 170
+	pdfQRSize     = 110.0
+	pdfItemIndent = 18.0
+)
+
+// prescriptionPDF tracks the current page and writing position while laying
+// out a prescription, starting a new page when the footer would be reached.
+type prescriptionPDF struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+func (p *prescriptionPDF) newPage() {
+	p.page = p.doc.AddPage()
+	p.y = pdfMargin
+}
+
+func (p *prescriptionPDF) ensureSpace(height float64) {
+	if p.y+height > pdfFooterTop {
+		p.newPage()
+	}
+}
+
+// paragraph writes wrapped text at indent and advances past it.
+func (p *prescriptionPDF) paragraph(indent float64, font pdf.Font, size float64, text string) {
+	lineHeight := size * 1.35
+	for _, line := range pdf.Wrap(text, font, size, pdf.PageWidth-2*pdfMargin-indent) {
+		p.ensureSpace(lineHeight)
+		p.y += lineHeight
+		p.page.Text(pdfMargin+indent, p.y, font, size, line)
+	}
+}
+
+func (p *prescriptionPDF) heading(text string) {
+	p.ensureSpace(40)
+	p.y += 18
+	p.paragraph(0, pdf.HelveticaBold, 12, text)
+	p.y += 4
+	p.page.Line(pdfMargin, p.y, pdf.PageWidth-pdfMargin, p.y, 0.5)
+}
+
+// RenderPDF lays out a finalized prescription for printing: patient, doctor,
+// approved items with their dosage and notes, and a QR code linking to
+// verifyURL, where the copy can be checked without signing in.
+func (s *FinalizationService) RenderPDF(ctx context.Context, prescription *models.Prescription, verifyURL string) ([]byte, error) {
+	if prescription.FinalizedAt == nil {
+		return nil, ErrNotFinalized
+	}
+
+	patient, err := NewUserService(s.db).GetUser(ctx, prescription.UserID)
+	if err != nil {
+		return nil, err
+	}
+	doctor, err := NewDoctorService(s.db).GetDoctor(ctx, prescription.DocID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := NewHealthProfileService(s.db).GetProfile(ctx, prescription.UserID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := prescriptionItems(ctx, s.db, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := NewPrescriptionService(s.db).GetStatusHistory(ctx, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+	note := ""
+	for _, change := range history {
+		if change.ToStatus == models.PrescriptionStatusFinalized {
+			note = change.Note
+		}
+	}
+
+	code, err := qr.Encode([]byte(verifyURL), qr.M)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode verification link: %w", err)
+	}
+
+	issued := prescription.FinalizedAt.UTC().Format("2 January 2006")
+	p := &prescriptionPDF{doc: pdf.New(fmt.Sprintf("Prescription #%d", prescription.ID), time.Now())}
+	p.newPage()
+
+	p.page.Text(pdfMargin, p.y+20, pdf.HelveticaBold, 20, "Prescription")
+	ref := fmt.Sprintf("#%d", prescription.ID)
+	p.page.Text(pdf.PageWidth-pdfMargin-pdf.TextWidth(ref, pdf.HelveticaBold, 14), p.y+20, pdf.HelveticaBold, 14, ref)
+	p.y += 26
+	dates := "Issued " + issued
+	if prescription.ValidUntil != nil {
+		dates += ", valid until " + prescription.ValidUntil.UTC().Format("2 January 2006")
+	}
+	if prescription.ParentPresID != nil {
+		dates += fmt.Sprintf(" (refill of prescription #%d)", *prescription.ParentPresID)
+	}
+	p.paragraph(0, pdf.Helvetica, 10, dates)
+	if prescription.Status != models.PrescriptionStatusFinalized {
+		p.y += 4
+		p.paragraph(0, pdf.HelveticaBold, 11, "This prescription is "+prescription.Status+" and must not be dispensed.")
+	}
+
+	p.heading("Doctor")
+	p.paragraph(0, pdf.HelveticaBold, 11, doctor.Name)
+	if doctor.Speciality != "" {
+		p.paragraph(0, pdf.Helvetica, 10, doctor.Speciality)
+	}
+
+	p.heading("Patient")
+	p.paragraph(0, pdf.HelveticaBold, 11, patient.Name)
+	if profile.DateOfBirth != "" {
+		dob := profile.DateOfBirth
+		if parsed, err := time.Parse("2006-01-02", dob); err == nil {
+			dob = parsed.Format("2 January 2006")
+		}
+		p.paragraph(0, pdf.Helvetica, 10, "Date of birth: "+dob)
+	}
+
+	p.heading("Prescribed")
+	n := 0
+	for _, item := range items {
+		if !item.Approved {
+			continue
+		}
+		n++
+		p.ensureSpace(50)
+		p.y += 6
+		p.paragraph(0, pdf.HelveticaBold, 11, fmt.Sprintf("%d. %s", n, item.Name))
+		if summary := DosageSummary(item.Dosage); summary != "" {
+			p.paragraph(pdfItemIndent, pdf.Helvetica, 10, summary)
+		}
+		if item.DocReason != "" {
+			p.paragraph(pdfItemIndent, pdf.Helvetica, 10, "Note: "+item.DocReason)
+		}
+	}
+	if n == 0 {
+		p.paragraph(0, pdf.Helvetica, 10, "No items were approved on this prescription.")
+	}
+
+	if note != "" {
+		p.heading("Doctor's notes")
+		p.paragraph(0, pdf.Helvetica, 10, note)
+	}
+
+	// The footer sits on the last page, below everything else.
+	page := p.page
+	top := pdfFooterTop + 20
+	page.Line(pdfMargin, top-10, pdf.PageWidth-pdfMargin, top-10, 0.5)
+	module := pdfQRSize / float64(code.Size)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				page.Rect(pdfMargin+float64(x)*module, top+float64(y)*module, module, module)
+			}
+		}
+	}
+
+	textX := pdfMargin + pdfQRSize + 20
+	lines := []struct {
+		font pdf.Font
+		text string
+	}{
+		{pdf.HelveticaBold, fmt.Sprintf("Signed electronically by %s on %s", doctor.Name, issued)},
+		{pdf.Helvetica, "Scan the code to confirm this prescription is authentic and has not"},
+		{pdf.Helvetica, "been changed. No patient details are shown when verifying."},
+		{pdf.Helvetica, "Verification code: " + VerificationCode(prescription.ContentHash)},
+		{pdf.Helvetica, "Signing key: " + prescription.SigningKeyID},
+	}
+	y := top + 12
+	for _, line := range lines {
+		for _, text := range pdf.Wrap(line.text, line.font, 9, pdf.PageWidth-pdfMargin-textX) {
+			page.Text(textX, y, line.font, 9, text)
+			y += 14
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := p.doc.WriteTo(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
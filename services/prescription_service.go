@@ -2,90 +2,267 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// prescriptionColumns lists the prescriptions columns in the order scanPrescription expects them.
+const prescriptionColumns = `id, created_at, docId, userId, symptoms, COALESCE(link, ''), COALESCE(objectKey, ''), COALESCE(seenByPatient, FALSE),
+	followUpAt, COALESCE(status, 'submitted'), COALESCE(statusChangedAt, created_at), finalizedAt,
+	COALESCE(contentHash, ''), COALESCE(signature, ''), COALESCE(signingKeyId, ''), parentPresId, validUntil,
+	COALESCE(analysisStatus, ''), COALESCE(analysisError, '')`
+
+// scanPrescription scans a row selected with prescriptionColumns into prescription.
+func scanPrescription(row pgx.Row, prescription *models.Prescription) error {
+	return row.Scan(
+		&prescription.ID,
+		&prescription.CreatedAt,
+		&prescription.DocID,
+		&prescription.UserID,
+		&prescription.Symptoms,
+		&prescription.Link,
+		&prescription.ObjectKey,
+		&prescription.SeenByPatient,
+		&prescription.FollowUpAt,
+		&prescription.Status,
+		&prescription.StatusChangedAt,
+		&prescription.FinalizedAt,
+		&prescription.ContentHash,
+		&prescription.Signature,
+		&prescription.SigningKeyID,
+		&prescription.ParentPresID,
+		&prescription.ValidUntil,
+		&prescription.AnalysisStatus,
+		&prescription.AnalysisError,
+	)
+}
+
+// ErrInvalidStatusTransition is returned when a prescription cannot move from
+// its current status to the requested one.
+var ErrInvalidStatusTransition = errors.New("invalid status transition")
+
+// ErrStatusTransitionForbidden is returned when the transition exists but the
+// actor's role may not make it.
+var ErrStatusTransitionForbidden = errors.New("role may not make this status transition")
+
+// ErrPrescriptionLocked is returned when a finalized prescription or one of its
+// items is edited directly instead of through an amendment.
+var ErrPrescriptionLocked = errors.New("prescription is finalized; changes require an amendment")
+
+// ErrPrescriptionNotEditable is returned when the items of a prescription that
+// is not awaiting review or reviewed are changed, e.g. of a cancelled one.
+var ErrPrescriptionNotEditable = errors.New("items can only be changed while the prescription is awaiting review or reviewed")
+
+// prescriptionTransitions maps each status to the statuses it may move to and
+// the actor roles allowed to make that move. Patients can withdraw a
+// prescription until their doctor has reviewed it; after that only the doctor
+// can cancel. Finalized prescriptions only expire; cancelled and expired are final.
+var prescriptionTransitions = map[string]map[string][]string{
+	models.PrescriptionStatusSubmitted: {
+		models.PrescriptionStatusAnalyzing:      {models.StatusActorSystem},
+		models.PrescriptionStatusAwaitingReview: {models.StatusActorSystem},
+		models.PrescriptionStatusCancelled:      {"user", "doctor"},
+	},
+	models.PrescriptionStatusAnalyzing: {
+		models.PrescriptionStatusAwaitingReview: {models.StatusActorSystem},
+		models.PrescriptionStatusCancelled:      {"user", "doctor"},
+	},
+	models.PrescriptionStatusAwaitingReview: {
+		models.PrescriptionStatusReviewed:  {"doctor"},
+		models.PrescriptionStatusCancelled: {"user", "doctor"},
+	},
+	models.PrescriptionStatusReviewed: {
+		models.PrescriptionStatusAwaitingReview: {"doctor"},
+		models.PrescriptionStatusFinalized:      {"doctor"},
+		models.PrescriptionStatusCancelled:      {"doctor"},
+	},
+	models.PrescriptionStatusFinalized: {
+		models.PrescriptionStatusExpired: {models.StatusActorSystem},
+	},
+}
+
+// ArchivedStatuses are the final statuses. Prescriptions in them are listed in
+// the archive view rather than with the active ones.
+var ArchivedStatuses = []string{models.PrescriptionStatusExpired, models.PrescriptionStatusCancelled}
+
+// ActiveStatuses are the statuses of prescriptions still in use.
+var ActiveStatuses = []string{
+	models.PrescriptionStatusSubmitted, models.PrescriptionStatusAnalyzing,
+	models.PrescriptionStatusAwaitingReview, models.PrescriptionStatusReviewed,
+	models.PrescriptionStatusFinalized,
+}
+
+// ValidPrescriptionStatus reports whether status is a known prescription status.
+func ValidPrescriptionStatus(status string) bool {
+	switch status {
+	case models.PrescriptionStatusSubmitted, models.PrescriptionStatusAnalyzing,
+		models.PrescriptionStatusAwaitingReview, models.PrescriptionStatusReviewed,
+		models.PrescriptionStatusFinalized, models.PrescriptionStatusCancelled,
+		models.PrescriptionStatusExpired:
+		return true
+	}
+	return false
+}
+
+// CheckItemsEditable checks that the doctor may change the items of a
+// prescription: finalized ones return ErrPrescriptionLocked, and any other
+// status but awaiting_review and reviewed ErrPrescriptionNotEditable (wrapped).
+func CheckItemsEditable(prescription *models.Prescription) error {
+	if prescription.FinalizedAt != nil {
+		return ErrPrescriptionLocked
+	}
+	switch prescription.Status {
+	case models.PrescriptionStatusAwaitingReview, models.PrescriptionStatusReviewed:
+		return nil
+	}
+	return fmt.Errorf("%w: it is %s", ErrPrescriptionNotEditable, prescription.Status)
+}
+
+// CheckStatusTransition checks that actorRole may move a prescription from one status to another.
+func CheckStatusTransition(from, to, actorRole string) error {
+	roles, ok := prescriptionTransitions[from][to]
+	if !ok {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, from, to)
+	}
+	if !slices.Contains(roles, actorRole) {
+		return fmt.Errorf("%w: %s may not move a prescription from %s to %s", ErrStatusTransitionForbidden, actorRole, from, to)
+	}
+	return nil
+}
+
+// statusHistoryColumns lists the prescription_status_history columns in the order scanStatusChange expects them.
+const statusHistoryColumns = "id, created_at, presId, COALESCE(fromStatus, ''), toStatus, actorRole, COALESCE(actorId, 0), COALESCE(note, '')"
+
+func scanStatusChange(row pgx.Row, change *models.PrescriptionStatusChange) error {
+	return row.Scan(&change.ID, &change.CreatedAt, &change.PresID, &change.FromStatus,
+		&change.ToStatus, &change.ActorRole, &change.ActorID, &change.Note)
+}
+
 type PrescriptionService struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewPrescriptionService(db *pgx.Conn) *PrescriptionService {
+func NewPrescriptionService(db *pgxpool.Pool) *PrescriptionService {
 	return &PrescriptionService{db: db}
 }
 
-// CreatePrescription creates a new prescription
+// CreatePrescription creates a new prescription in the submitted status and
+// records the patient as the actor of its first history entry and version.
 func (s *PrescriptionService) CreatePrescription(ctx context.Context, prescription *models.Prescription) error {
-	err := s.db.QueryRow(ctx,
-		`INSERT INTO prescriptions (docId, userId, symptoms, link, seenByPatient)
-		 VALUES ($1, $2, $3, $4, $5)
-		 RETURNING id, created_at, COALESCE(seenByPatient, FALSE)`,
-		prescription.DocID, prescription.UserID, prescription.Symptoms, prescription.Link, false).
-		Scan(&prescription.ID, &prescription.CreatedAt, &prescription.SeenByPatient)
-	return err
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := createPrescription(ctx, tx, prescription); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreatePrescriptionWithAttachments creates a prescription together with its
+// attachments and the outbox jobs that store their files, so a failure leaves
+// neither behind. attach is called with the new prescription's ID and returns
+// the attachments and, for each, its upload jobs.
+func (s *PrescriptionService) CreatePrescriptionWithAttachments(ctx context.Context, prescription *models.Prescription, attach func(presID int64) ([]*models.Attachment, [][]*models.UploadJob)) ([]*models.Attachment, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := createPrescription(ctx, tx, prescription); err != nil {
+		return nil, err
+	}
+	attachments, uploads := attach(prescription.ID)
+	if err := createAttachmentUploads(ctx, tx, attachments, uploads); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return attachments, nil
 }
 
-// UpdatePrescriptionLink updates only the storage link for a prescription.
-func (s *PrescriptionService) UpdatePrescriptionLink(ctx context.Context, presID int64, link string) error {
-	_, err := s.db.Exec(ctx, "UPDATE prescriptions SET link = $2 WHERE id = $1", presID, link)
+func createPrescription(ctx context.Context, tx pgx.Tx, prescription *models.Prescription) error {
+	err := tx.QueryRow(ctx,
+		`INSERT INTO prescriptions (docId, userId, symptoms, link, seenByPatient, status, statusChangedAt)
+		 VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		 RETURNING id, created_at, COALESCE(seenByPatient, FALSE), status, statusChangedAt`,
+		prescription.DocID, prescription.UserID, prescription.Symptoms, prescription.Link, false, models.PrescriptionStatusSubmitted).
+		Scan(&prescription.ID, &prescription.CreatedAt, &prescription.SeenByPatient, &prescription.Status, &prescription.StatusChangedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO prescription_status_history (presId, fromStatus, toStatus, actorRole, actorId)
+		 VALUES ($1, '', $2, 'user', $3)`,
+		prescription.ID, prescription.Status, prescription.UserID)
+	if err != nil {
+		return err
+	}
+	return recordVersion(ctx, tx, prescription.ID, "user", prescription.UserID, "created")
+}
+
+// SetAnalysisResult records how the AI analysis of a prescription ended.
+func (s *PrescriptionService) SetAnalysisResult(ctx context.Context, presID int64, status, message string) error {
+	_, err := s.db.Exec(ctx,
+		"UPDATE prescriptions SET analysisStatus = $2, analysisError = $3 WHERE id = $1",
+		presID, status, message)
 	return err
 }
 
 // GetPrescription retrieves a prescription by ID
 func (s *PrescriptionService) GetPrescription(ctx context.Context, presID int64) (*models.Prescription, error) {
 	prescription := &models.Prescription{}
-	err := s.db.QueryRow(ctx,
-		"SELECT id, created_at, docId, userId, symptoms, link, COALESCE(seenByPatient, FALSE) FROM prescriptions WHERE id = $1",
-		presID).Scan(
-		&prescription.ID,
-		&prescription.CreatedAt,
-		&prescription.DocID,
-		&prescription.UserID,
-		&prescription.Symptoms,
-		&prescription.Link,
-		&prescription.SeenByPatient,
-	)
+	err := scanPrescription(s.db.QueryRow(ctx,
+		"SELECT "+prescriptionColumns+" FROM prescriptions WHERE id = $1",
+		presID), prescription)
 	if err != nil {
 		return nil, err
 	}
 	return prescription, nil
 }
 
-// GetUserPrescriptions retrieves all prescriptions for a user
-func (s *PrescriptionService) GetUserPrescriptions(ctx context.Context, userID int64) ([]*models.Prescription, error) {
-	rows, err := s.db.Query(ctx,
-		"SELECT id, created_at, docId, userId, symptoms, link, COALESCE(seenByPatient, FALSE) FROM prescriptions WHERE userId = $1 ORDER BY created_at DESC",
-		userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// GetUserPrescriptions retrieves all prescriptions for a user, optionally only those in one of statuses
+func (s *PrescriptionService) GetUserPrescriptions(ctx context.Context, userID int64, statuses ...string) ([]*models.Prescription, error) {
+	return s.queryPrescriptions(ctx,
+		"SELECT "+prescriptionColumns+` FROM prescriptions
+		 WHERE userId = $1 AND (COALESCE(cardinality($2::TEXT[]), 0) = 0 OR COALESCE(status, 'submitted') = ANY($2))
+		 ORDER BY created_at DESC`,
+		userID, statuses)
+}
 
-	var prescriptions []*models.Prescription
-	for rows.Next() {
-		prescription := &models.Prescription{}
-		if err := rows.Scan(
-			&prescription.ID,
-			&prescription.CreatedAt,
-			&prescription.DocID,
-			&prescription.UserID,
-			&prescription.Symptoms,
-			&prescription.Link,
-			&prescription.SeenByPatient,
-		); err != nil {
-			return nil, err
-		}
-		prescriptions = append(prescriptions, prescription)
-	}
-	return prescriptions, rows.Err()
+// GetDoctorPrescriptions retrieves all prescriptions for a doctor, optionally only those in one of statuses
+func (s *PrescriptionService) GetDoctorPrescriptions(ctx context.Context, docID int64, statuses ...string) ([]*models.Prescription, error) {
+	return s.queryPrescriptions(ctx,
+		"SELECT "+prescriptionColumns+` FROM prescriptions
+		 WHERE docId = $1 AND (COALESCE(cardinality($2::TEXT[]), 0) = 0 OR COALESCE(status, 'submitted') = ANY($2))
+		 ORDER BY created_at DESC`,
+		docID, statuses)
 }
 
-// GetDoctorPrescriptions retrieves all prescriptions for a doctor
-func (s *PrescriptionService) GetDoctorPrescriptions(ctx context.Context, docID int64) ([]*models.Prescription, error) {
-	rows, err := s.db.Query(ctx,
-		"SELECT id, created_at, docId, userId, symptoms, link, COALESCE(seenByPatient, FALSE) FROM prescriptions WHERE docId = $1 ORDER BY created_at DESC",
-		docID)
+// DoctorTreatsPatient reports whether a doctor is assigned to any prescription
+// of a patient. Referred doctors only see the referred prescription, not the
+// rest of the patient's record.
+func (s *PrescriptionService) DoctorTreatsPatient(ctx context.Context, docID, userID int64) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM prescriptions WHERE docId = $1 AND userId = $2)",
+		docID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (s *PrescriptionService) queryPrescriptions(ctx context.Context, query string, args ...interface{}) ([]*models.Prescription, error) {
+	rows, err := s.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -94,15 +271,7 @@ func (s *PrescriptionService) GetDoctorPrescriptions(ctx context.Context, docID
 	var prescriptions []*models.Prescription
 	for rows.Next() {
 		prescription := &models.Prescription{}
-		if err := rows.Scan(
-			&prescription.ID,
-			&prescription.CreatedAt,
-			&prescription.DocID,
-			&prescription.UserID,
-			&prescription.Symptoms,
-			&prescription.Link,
-			&prescription.SeenByPatient,
-		); err != nil {
+		if err := scanPrescription(rows, prescription); err != nil {
 			return nil, err
 		}
 		prescriptions = append(prescriptions, prescription)
@@ -113,23 +282,272 @@ func (s *PrescriptionService) GetDoctorPrescriptions(ctx context.Context, docID
 // UpdatePrescriptionSeenByPatient updates the seenByPatient status for a prescription by ID.
 func (s *PrescriptionService) UpdatePrescriptionSeenByPatient(ctx context.Context, presID int64, seenByPatient bool) (*models.Prescription, error) {
 	prescription := &models.Prescription{}
-	err := s.db.QueryRow(ctx,
+	err := scanPrescription(s.db.QueryRow(ctx,
 		`UPDATE prescriptions
 		 SET seenByPatient = $2
 		 WHERE id = $1
-		 RETURNING id, created_at, docId, userId, symptoms, link, COALESCE(seenByPatient, FALSE)`,
+		 RETURNING `+prescriptionColumns,
 		presID, seenByPatient,
-	).Scan(
-		&prescription.ID,
-		&prescription.CreatedAt,
-		&prescription.DocID,
-		&prescription.UserID,
-		&prescription.Symptoms,
-		&prescription.Link,
-		&prescription.SeenByPatient,
-	)
+	), prescription)
+	if err != nil {
+		return nil, err
+	}
+	return prescription, nil
+}
+
+// UpdatePrescriptionFollowUp sets or clears (nil) the follow-up date of a prescription
+// on behalf of an actor and records the new version. Any reminder already queued
+// for the old date is dropped so a new one is scheduled.
+func (s *PrescriptionService) UpdatePrescriptionFollowUp(ctx context.Context, presID int64, followUpAt *time.Time, actorRole string, actorID int64) (*models.Prescription, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	prescription := &models.Prescription{}
+	err = scanPrescription(tx.QueryRow(ctx,
+		`UPDATE prescriptions
+		 SET followUpAt = $2
+		 WHERE id = $1
+		 RETURNING `+prescriptionColumns,
+		presID, followUpAt,
+	), prescription)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop every reminder of the old date, sent ones included: reminders are
+	// unique per prescription, so a kept one would block the new date's reminder.
+	_, err = tx.Exec(ctx,
+		"DELETE FROM reminders WHERE kind = $1 AND refId = $2",
+		models.ReminderKindFollowUp, presID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordVersion(ctx, tx, presID, actorRole, actorID, "follow-up changed"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return prescription, nil
+}
+
+// TransitionStatus moves a prescription to status to on behalf of an actor and
+// records the change in its history. It returns ErrInvalidStatusTransition or
+// ErrStatusTransitionForbidden (wrapped) when the move is not allowed.
+// Prescriptions are finalized with FinalizationService.Finalize, which signs them.
+func (s *PrescriptionService) TransitionStatus(ctx context.Context, presID int64, to, actorRole string, actorID int64, note string) (*models.Prescription, error) {
+	if to == models.PrescriptionStatusFinalized {
+		return nil, fmt.Errorf("%w: prescriptions must be finalized so they are signed", ErrInvalidStatusTransition)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	prescription, err := transitionStatus(ctx, tx, presID, to, actorRole, actorID, note)
 	if err != nil {
 		return nil, err
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return prescription, nil
+}
+
+// transitionStatus makes a status transition inside tx, locking the prescription row.
+func transitionStatus(ctx context.Context, tx pgx.Tx, presID int64, to, actorRole string, actorID int64, note string) (*models.Prescription, error) {
+	var from string
+	err := tx.QueryRow(ctx,
+		"SELECT COALESCE(status, 'submitted') FROM prescriptions WHERE id = $1 FOR UPDATE",
+		presID).Scan(&from)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckStatusTransition(from, to, actorRole); err != nil {
+		return nil, err
+	}
+
+	prescription := &models.Prescription{}
+	err = scanPrescription(tx.QueryRow(ctx,
+		`UPDATE prescriptions
+		 SET status = $2, statusChangedAt = NOW()
+		 WHERE id = $1
+		 RETURNING `+prescriptionColumns,
+		presID, to,
+	), prescription)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO prescription_status_history (presId, fromStatus, toStatus, actorRole, actorId, note)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		presID, from, to, actorRole, actorID, note)
+	if err != nil {
+		return nil, err
+	}
+	if to == models.PrescriptionStatusCancelled {
+		if err := clearPrescriptionSchedule(ctx, tx, presID); err != nil {
+			return nil, err
+		}
+	}
+	if err := recordVersion(ctx, tx, presID, actorRole, actorID, note); err != nil {
+		return nil, err
+	}
 	return prescription, nil
 }
+
+// clearPrescriptionSchedule cancels the queued reminders of a cancelled
+// prescription's pending doses and follow-up, and removes its pending future
+// doses, so the patient is not reminded about it any more.
+func clearPrescriptionSchedule(ctx context.Context, tx pgx.Tx, presID int64) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE reminders
+		 SET status = $1, lockedBy = '', lockedUntil = NULL
+		 WHERE status IN ($2, $3)
+		   AND (kind = $4 AND refId IN (SELECT id FROM doses WHERE presId = $6 AND status = $7)
+		        OR kind = $5 AND refId = $6)`,
+		models.ReminderStatusCancelled, models.ReminderStatusPending, models.ReminderStatusSending,
+		models.ReminderKindDose, models.ReminderKindFollowUp, presID, models.DoseStatusPending)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		"DELETE FROM doses WHERE presId = $1 AND status = $2 AND scheduledAt >= NOW()",
+		presID, models.DoseStatusPending)
+	return err
+}
+
+// GetStatusHistory lists the status changes of a prescription, oldest first.
+func (s *PrescriptionService) GetStatusHistory(ctx context.Context, presID int64) ([]*models.PrescriptionStatusChange, error) {
+	rows, err := s.db.Query(ctx,
+		"SELECT "+statusHistoryColumns+" FROM prescription_status_history WHERE presId = $1 ORDER BY created_at, id",
+		presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]*models.PrescriptionStatusChange, 0)
+	for rows.Next() {
+		change := &models.PrescriptionStatusChange{}
+		if err := scanStatusChange(rows, change); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// ReleaseStalledAnalyses hands prescriptions that have been submitted or
+// analyzing for longer than stalledAfter to their doctor, e.g. when the server
+// restarted during the AI analysis. It returns how many were released.
+func (s *PrescriptionService) ReleaseStalledAnalyses(ctx context.Context, stalledAfter time.Duration) (int, error) {
+	var presIDs []int64
+	rows, err := s.db.Query(ctx,
+		`SELECT id FROM prescriptions
+		 WHERE status IN ($1, $2) AND statusChangedAt < $3
+		 ORDER BY id`,
+		models.PrescriptionStatusSubmitted, models.PrescriptionStatusAnalyzing, time.Now().Add(-stalledAfter))
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		presIDs = append(presIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, presID := range presIDs {
+		_, err := s.TransitionStatus(ctx, presID, models.PrescriptionStatusAwaitingReview, models.StatusActorSystem, 0, "analysis did not finish")
+		if err != nil {
+			// Another instance or the analysis itself moved it first.
+			if errors.Is(err, ErrInvalidStatusTransition) {
+				continue
+			}
+			return released, fmt.Errorf("prescription %d: %w", presID, err)
+		}
+		if err := s.SetAnalysisResult(ctx, presID, models.AnalysisStatusFailed, "analysis did not finish"); err != nil {
+			return released, fmt.Errorf("prescription %d: %w", presID, err)
+		}
+		released++
+	}
+	return released, nil
+}
+
+// ExpirePrescriptions moves finalized prescriptions whose validity ended before
+// now to expired and denies refill requests still pending on them. Prescriptions
+// finalized before validity periods existed have no validUntil and expire
+// legacyDays after finalization. It returns how many expired.
+func (s *PrescriptionService) ExpirePrescriptions(ctx context.Context, now time.Time, legacyDays int) (int, error) {
+	var presIDs []int64
+	rows, err := s.db.Query(ctx,
+		`SELECT id FROM prescriptions
+		 WHERE status = $1
+		   AND (validUntil <= $2 OR validUntil IS NULL AND finalizedAt <= $3)
+		 ORDER BY id`,
+		models.PrescriptionStatusFinalized, now, now.AddDate(0, 0, -legacyDays))
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		presIDs = append(presIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, presID := range presIDs {
+		err := s.expirePrescription(ctx, presID)
+		if err != nil {
+			// Another instance expired it first.
+			if errors.Is(err, ErrInvalidStatusTransition) {
+				continue
+			}
+			return expired, fmt.Errorf("prescription %d: %w", presID, err)
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func (s *PrescriptionService) expirePrescription(ctx context.Context, presID int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := transitionStatus(ctx, tx, presID, models.PrescriptionStatusExpired, models.StatusActorSystem, 0, "validity period ended"); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE refill_requests
+		 SET status = $2, docNote = 'prescription expired', decidedAt = NOW()
+		 WHERE presId = $1 AND status = $3`,
+		presID, models.RefillStatusDenied, models.RefillStatusPending)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestCancelClearsSchedule(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := NewPrescriptionService(pool)
+
+	prescription := &models.Prescription{UserID: 1, DocID: 1, Symptoms: "cough"}
+	if err := service.CreatePrescription(ctx, prescription); err != nil {
+		t.Fatal(err)
+	}
+	followUp := time.Now().Add(48 * time.Hour)
+	if _, err := service.UpdatePrescriptionFollowUp(ctx, prescription.ID, &followUp, "doctor", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	doses := []struct {
+		at     time.Time
+		status string
+	}{
+		{at: time.Now().Add(-2 * time.Hour), status: models.DoseStatusTaken},
+		{at: time.Now().Add(-time.Hour), status: models.DoseStatusPending},
+		{at: time.Now().Add(time.Hour), status: models.DoseStatusPending},
+		{at: time.Now().Add(25 * time.Hour), status: models.DoseStatusPending},
+	}
+	for _, dose := range doses {
+		var doseID int64
+		err := pool.QueryRow(ctx,
+			"INSERT INTO doses (itemId, presId, userId, scheduledAt, status) VALUES (0, $1, $2, $3, $4) RETURNING id",
+			prescription.ID, prescription.UserID, dose.at, dose.status).Scan(&doseID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reminderStatus := models.ReminderStatusPending
+		if dose.status != models.DoseStatusPending {
+			reminderStatus = models.ReminderStatusSent
+		}
+		_, err = pool.Exec(ctx,
+			"INSERT INTO reminders (userId, kind, refId, dueAt, status) VALUES ($1, $2, $3, $4, $5)",
+			prescription.UserID, models.ReminderKindDose, doseID, dose.at, reminderStatus)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := pool.Exec(ctx,
+		"INSERT INTO reminders (userId, kind, refId, dueAt) VALUES ($1, $2, $3, $4)",
+		prescription.UserID, models.ReminderKindFollowUp, prescription.ID, followUp.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.TransitionStatus(ctx, prescription.ID, models.PrescriptionStatusCancelled, "user", prescription.UserID, ""); err != nil {
+		t.Fatalf("TransitionStatus() error: %v", err)
+	}
+
+	var pendingDoses, pendingReminders, kept int
+	err = pool.QueryRow(ctx,
+		"SELECT COUNT(*) FROM doses WHERE presId = $1 AND status = $2 AND scheduledAt >= NOW()",
+		prescription.ID, models.DoseStatusPending).Scan(&pendingDoses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM reminders
+		 WHERE status IN ($1, $2)
+		   AND (kind = $3 AND refId IN (SELECT id FROM doses WHERE presId = $5) OR kind = $4 AND refId = $5)`,
+		models.ReminderStatusPending, models.ReminderStatusSending,
+		models.ReminderKindDose, models.ReminderKindFollowUp, prescription.ID).Scan(&pendingReminders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM doses WHERE presId = $1", prescription.ID).Scan(&kept); err != nil {
+		t.Fatal(err)
+	}
+
+	if pendingDoses != 0 {
+		t.Errorf("%d pending doses left, want none", pendingDoses)
+	}
+	if pendingReminders != 0 {
+		t.Errorf("%d reminders still queued, want none", pendingReminders)
+	}
+	if kept != 2 {
+		t.Errorf("%d doses kept, want the taken and the missed one", kept)
+	}
+}
+
+func TestCheckItemsEditable(t *testing.T) {
+	finalizedAt := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		prescription models.Prescription
+		want         error
+	}{
+		{name: "awaiting review", prescription: models.Prescription{Status: models.PrescriptionStatusAwaitingReview}},
+		{name: "reviewed", prescription: models.Prescription{Status: models.PrescriptionStatusReviewed}},
+		{name: "still analyzing", prescription: models.Prescription{Status: models.PrescriptionStatusAnalyzing}, want: ErrPrescriptionNotEditable},
+		{name: "finalized", prescription: models.Prescription{Status: models.PrescriptionStatusFinalized, FinalizedAt: &finalizedAt}, want: ErrPrescriptionLocked},
+		{name: "expired", prescription: models.Prescription{Status: models.PrescriptionStatusExpired, FinalizedAt: &finalizedAt}, want: ErrPrescriptionLocked},
+		{name: "cancelled", prescription: models.Prescription{Status: models.PrescriptionStatusCancelled}, want: ErrPrescriptionNotEditable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckItemsEditable(&tt.prescription)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("CheckItemsEditable() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInvalidReferral is returned for a referral without a usable kind or referred doctor.
+var ErrInvalidReferral = errors.New("invalid referral")
+
+// ErrReferralState is returned when a referral cannot be created or changed in
+// its current state, or in the state of its prescription.
+var ErrReferralState = errors.New("referral not allowed in its current state")
+
+// errFinalizedHandoff is returned for a handoff of a finalized prescription: its
+// doctor is part of the signed content, so it cannot change hands.
+var errFinalizedHandoff = fmt.Errorf("%w: a finalized prescription is signed for its doctor and cannot be handed over", ErrReferralState)
+
+// referralColumns lists the referrals columns in the order scanReferral expects them.
+const referralColumns = "id, created_at, presId, fromDocId, toDocId, kind, status, COALESCE(reason, ''), COALESCE(responseNote, ''), respondedAt, COALESCE(opinion, ''), completedAt"
+
+func scanReferral(row pgx.Row, referral *models.Referral) error {
+	return row.Scan(&referral.ID, &referral.CreatedAt, &referral.PresID, &referral.FromDocID, &referral.ToDocID,
+		&referral.Kind, &referral.Status, &referral.Reason, &referral.ResponseNote, &referral.RespondedAt,
+		&referral.Opinion, &referral.CompletedAt)
+}
+
+type ReferralService struct {
+	db *pgxpool.Pool
+}
+
+func NewReferralService(db *pgxpool.Pool) *ReferralService {
+	return &ReferralService{db: db}
+}
+
+// referredDoctor finds the doctor a referral is addressed to: by ID, by
+// username, or else the most accurate doctor of the requested speciality
+// other than the referring doctor.
+func (s *ReferralService) referredDoctor(ctx context.Context, req *models.ReferralCreateRequest, fromDocID int64) (int64, error) {
+	doctorService := NewDoctorService(s.db)
+	var docID int64
+	switch {
+	case req.ToDocID != 0:
+		doctor, err := doctorService.GetDoctor(ctx, req.ToDocID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, fmt.Errorf("%w: doctor not found", ErrInvalidReferral)
+			}
+			return 0, err
+		}
+		docID = doctor.ID
+	case req.ToUsername != "":
+		doctor, err := doctorService.GetDoctorByUsername(ctx, req.ToUsername)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, fmt.Errorf("%w: doctor not found", ErrInvalidReferral)
+			}
+			return 0, err
+		}
+		docID = doctor.ID
+	case req.Speciality != "":
+		speciality, err := NewSpecialityService(s.db).Resolve(ctx, req.Speciality)
+		if err != nil {
+			if errors.Is(err, ErrUnknownSpeciality) {
+				return 0, fmt.Errorf("%w: %v", ErrInvalidReferral, err)
+			}
+			return 0, err
+		}
+		err = s.db.QueryRow(ctx,
+			`SELECT id FROM doctors
+			 WHERE specialityCode = $1 AND id <> $2
+			 ORDER BY accuracy DESC NULLS LAST, id
+			 LIMIT 1`,
+			speciality.Code, fromDocID).Scan(&docID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, fmt.Errorf("%w: no other doctor with speciality %q", ErrInvalidReferral, req.Speciality)
+			}
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("%w: toDocId, toUsername or speciality is required", ErrInvalidReferral)
+	}
+
+	if docID == fromDocID {
+		return 0, fmt.Errorf("%w: a doctor cannot refer a prescription to themselves", ErrInvalidReferral)
+	}
+	return docID, nil
+}
+
+// Create refers a prescription from its assigned doctor to another doctor.
+// A doctor can have only one open referral per prescription, and a
+// prescription only one pending handoff.
+func (s *ReferralService) Create(ctx context.Context, prescription *models.Prescription, req *models.ReferralCreateRequest) (*models.Referral, error) {
+	req.ToUsername = strings.TrimSpace(req.ToUsername)
+	req.Speciality = strings.TrimSpace(req.Speciality)
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Kind == "" {
+		req.Kind = models.ReferralKindSecondOpinion
+	}
+	if req.Kind != models.ReferralKindSecondOpinion && req.Kind != models.ReferralKindHandoff {
+		return nil, fmt.Errorf("%w: kind must be %s or %s", ErrInvalidReferral, models.ReferralKindSecondOpinion, models.ReferralKindHandoff)
+	}
+	if slices.Contains(ArchivedStatuses, prescription.Status) {
+		return nil, fmt.Errorf("%w: prescription is %s", ErrReferralState, prescription.Status)
+	}
+	if req.Kind == models.ReferralKindHandoff && prescription.Status == models.PrescriptionStatusFinalized {
+		return nil, errFinalizedHandoff
+	}
+
+	toDocID, err := s.referredDoctor(ctx, req, prescription.DocID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The unique indexes on open referrals turn a duplicate into no row.
+	referral := &models.Referral{}
+	err = scanReferral(s.db.QueryRow(ctx,
+		`INSERT INTO referrals (presId, fromDocId, toDocId, kind, status, reason)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT DO NOTHING
+		 RETURNING `+referralColumns,
+		prescription.ID, prescription.DocID, toDocID, req.Kind, models.ReferralStatusPending, req.Reason,
+	), referral)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: the prescription already has an open referral to this doctor or a pending handoff", ErrReferralState)
+		}
+		return nil, err
+	}
+	return referral, nil
+}
+
+// GetReferral retrieves a referral by ID
+func (s *ReferralService) GetReferral(ctx context.Context, referralID int64) (*models.Referral, error) {
+	referral := &models.Referral{}
+	err := scanReferral(s.db.QueryRow(ctx,
+		"SELECT "+referralColumns+" FROM referrals WHERE id = $1",
+		referralID), referral)
+	if err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
+
+// GetPrescriptionReferrals lists the referrals of a prescription, newest first.
+func (s *ReferralService) GetPrescriptionReferrals(ctx context.Context, presID int64) ([]*models.Referral, error) {
+	return s.queryReferrals(ctx,
+		"SELECT "+referralColumns+" FROM referrals WHERE presId = $1 ORDER BY created_at DESC, id DESC",
+		presID)
+}
+
+// GetDoctorReferrals lists the referrals a doctor received (incoming) or made,
+// newest first, optionally only those with the given status.
+func (s *ReferralService) GetDoctorReferrals(ctx context.Context, docID int64, incoming bool, status string) ([]*models.Referral, error) {
+	column := "fromDocId"
+	if incoming {
+		column = "toDocId"
+	}
+	return s.queryReferrals(ctx,
+		"SELECT "+referralColumns+" FROM referrals WHERE "+column+" = $1 AND ($2 = '' OR status = $2) ORDER BY created_at DESC, id DESC",
+		docID, status)
+}
+
+func (s *ReferralService) queryReferrals(ctx context.Context, query string, args ...interface{}) ([]*models.Referral, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrals := make([]*models.Referral, 0)
+	for rows.Next() {
+		referral := &models.Referral{}
+		if err := scanReferral(rows, referral); err != nil {
+			return nil, err
+		}
+		referrals = append(referrals, referral)
+	}
+	return referrals, rows.Err()
+}
+
+// HasAccess reports whether a doctor can see a prescription through a
+// referral: they accepted a second opinion on it that is still open, or they
+// handed it over. A pending referral gives no access, since the referring
+// doctor chooses its recipient alone.
+func (s *ReferralService) HasAccess(ctx context.Context, presID, docID int64) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM referrals
+			WHERE presId = $1
+			  AND ((toDocId = $2 AND status = $3)
+			    OR (fromDocId = $2 AND kind = $4 AND status = $5))
+		)`,
+		presID, docID, models.ReferralStatusAccepted, models.ReferralKindHandoff, models.ReferralStatusCompleted).Scan(&exists)
+	return exists, err
+}
+
+// lockReferral locks a referral inside tx and checks that it is in one of the
+// given statuses. A referral that belongs to another doctor reads as not found.
+func lockReferral(ctx context.Context, tx pgx.Tx, referralID, docID int64, referred bool, statuses ...string) (*models.Referral, error) {
+	referral := &models.Referral{}
+	err := scanReferral(tx.QueryRow(ctx,
+		"SELECT "+referralColumns+" FROM referrals WHERE id = $1 FOR UPDATE",
+		referralID), referral)
+	if err != nil {
+		return nil, err
+	}
+	owner := referral.FromDocID
+	if referred {
+		owner = referral.ToDocID
+	}
+	if owner != docID {
+		return nil, pgx.ErrNoRows
+	}
+	if !slices.Contains(statuses, referral.Status) {
+		return nil, fmt.Errorf("%w: it is %s", ErrReferralState, referral.Status)
+	}
+	return referral, nil
+}
+
+// Respond records the referred doctor's answer to a pending referral. Accepting
+// a handoff makes them the assigned doctor of the prescription, together with
+// its pending refill requests, and completes the referral.
+func (s *ReferralService) Respond(ctx context.Context, referralID, docID int64, accept bool, note string) (*models.Referral, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	referral, err := lockReferral(ctx, tx, referralID, docID, true, models.ReferralStatusPending)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.ReferralStatusDeclined
+	switch {
+	case accept && referral.Kind == models.ReferralKindHandoff:
+		if err := handOver(ctx, tx, referral); err != nil {
+			return nil, err
+		}
+		status = models.ReferralStatusCompleted
+	case accept:
+		status = models.ReferralStatusAccepted
+	}
+
+	err = scanReferral(tx.QueryRow(ctx,
+		`UPDATE referrals
+		 SET status = $2, responseNote = $3, respondedAt = NOW(),
+		     completedAt = CASE WHEN $2 = $4 THEN NOW() ELSE completedAt END
+		 WHERE id = $1
+		 RETURNING `+referralColumns,
+		referralID, status, note, models.ReferralStatusCompleted,
+	), referral)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
+
+// handOver reassigns the prescription of a handoff referral inside tx and
+// records the change as a new version. The referring doctor must still be
+// assigned and the prescription still in use and not yet finalized.
+func handOver(ctx context.Context, tx pgx.Tx, referral *models.Referral) error {
+	var docID int64
+	var status string
+	err := tx.QueryRow(ctx,
+		"SELECT docId, COALESCE(status, 'submitted') FROM prescriptions WHERE id = $1 FOR UPDATE",
+		referral.PresID).Scan(&docID, &status)
+	if err != nil {
+		return err
+	}
+	if docID != referral.FromDocID {
+		return fmt.Errorf("%w: the referring doctor is no longer assigned to the prescription", ErrReferralState)
+	}
+	if slices.Contains(ArchivedStatuses, status) {
+		return fmt.Errorf("%w: prescription is %s", ErrReferralState, status)
+	}
+	if status == models.PrescriptionStatusFinalized {
+		return errFinalizedHandoff
+	}
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE prescriptions SET docId = $2 WHERE id = $1",
+		referral.PresID, referral.ToDocID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		"UPDATE refill_requests SET docId = $2 WHERE presId = $1 AND status = $3",
+		referral.PresID, referral.ToDocID, models.RefillStatusPending); err != nil {
+		return err
+	}
+	return recordVersion(ctx, tx, referral.PresID, "doctor", referral.ToDocID, fmt.Sprintf("handed over by referral %d", referral.ID))
+}
+
+// Complete closes an accepted second opinion with the referred doctor's summary.
+func (s *ReferralService) Complete(ctx context.Context, referralID, docID int64, opinion string) (*models.Referral, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	referral, err := lockReferral(ctx, tx, referralID, docID, true, models.ReferralStatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+	err = scanReferral(tx.QueryRow(ctx,
+		`UPDATE referrals SET status = $2, opinion = $3, completedAt = NOW()
+		 WHERE id = $1
+		 RETURNING `+referralColumns,
+		referralID, models.ReferralStatusCompleted, opinion,
+	), referral)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
+
+// Cancel withdraws a pending or accepted referral on behalf of the referring
+// doctor. The referred doctor loses access to the prescription.
+func (s *ReferralService) Cancel(ctx context.Context, referralID, docID int64) (*models.Referral, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	referral, err := lockReferral(ctx, tx, referralID, docID, false, models.ReferralStatusPending, models.ReferralStatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+	err = scanReferral(tx.QueryRow(ctx,
+		"UPDATE referrals SET status = $2 WHERE id = $1 RETURNING "+referralColumns,
+		referralID, models.ReferralStatusCancelled,
+	), referral)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/signing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxRefills caps how many refills a doctor can allow on one item.
+const maxRefills = 12
+
+// ErrInvalidRefillPolicy is returned for a refill count or interval out of range.
+var ErrInvalidRefillPolicy = errors.New("invalid refill policy")
+
+// ErrNotRefillable is returned when a prescription or item cannot be refilled:
+// the prescription is not finalized or has expired, or the item has no refills left.
+var ErrNotRefillable = errors.New("not refillable")
+
+// ErrRefillTooEarly is returned when a refill is requested before the item's interval has passed.
+var ErrRefillTooEarly = errors.New("refill requested too early")
+
+// ErrRefillPending is returned when the prescription already has a refill request awaiting the doctor.
+var ErrRefillPending = errors.New("a refill request for this prescription is already pending")
+
+// ErrRefillDecided is returned when reviewing a refill request that was already approved or denied.
+var ErrRefillDecided = errors.New("refill request was already decided")
+
+// ValidateRefillPolicy checks that a refill policy is usable. Refillable items
+// need an interval of at least a day.
+func ValidateRefillPolicy(policy models.RefillPolicy) error {
+	if policy.Refills < 0 || policy.Refills > maxRefills {
+		return fmt.Errorf("%w: refills must be between 0 and %d", ErrInvalidRefillPolicy, maxRefills)
+	}
+	if policy.RefillIntervalDays < 0 || policy.Refills > 0 && policy.RefillIntervalDays == 0 {
+		return fmt.Errorf("%w: refillIntervalDays must be at least 1", ErrInvalidRefillPolicy)
+	}
+	return nil
+}
+
+// refillRequestColumns lists the refill_requests columns in the order scanRefillRequest expects them.
+const refillRequestColumns = "id, created_at, presId, userId, docId, itemIds, status, COALESCE(note, ''), COALESCE(docNote, ''), decidedAt, childPresId"
+
+func scanRefillRequest(row pgx.Row, request *models.RefillRequest) error {
+	return row.Scan(&request.ID, &request.CreatedAt, &request.PresID, &request.UserID, &request.DocID,
+		&request.ItemIDs, &request.Status, &request.Note, &request.DocNote, &request.DecidedAt, &request.ChildPresID)
+}
+
+type RefillService struct {
+	db     *pgxpool.Pool
+	signer *signing.Signer
+}
+
+// NewRefillService returns a RefillService. Approving refills signs the child
+// prescription, so it needs signer; requesting and denying do not.
+func NewRefillService(db *pgxpool.Pool, signer *signing.Signer) *RefillService {
+	return &RefillService{db: db, signer: signer}
+}
+
+// refillStatus reports the refills used and left on each refillable medicine
+// of a finalized prescription. The first refill can be requested an interval
+// after finalization, each later one an interval after the previous approval.
+func refillStatus(ctx context.Context, q querier, prescription *models.Prescription) ([]*models.ItemRefillStatus, error) {
+	items, err := prescriptionItems(ctx, q, prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*models.ItemRefillStatus, 0)
+	for _, item := range items {
+		if item.Type != "med" || !item.Approved || item.Refills == 0 {
+			continue
+		}
+
+		status := &models.ItemRefillStatus{
+			ItemID:             item.ID,
+			Name:               item.Name,
+			Refills:            item.Refills,
+			RefillIntervalDays: item.RefillIntervalDays,
+		}
+		var lastFill *time.Time
+		err := q.QueryRow(ctx,
+			`SELECT COUNT(*), MAX(decidedAt) FROM refill_requests
+			 WHERE presId = $1 AND status = $2 AND $3 = ANY(itemIds)`,
+			prescription.ID, models.RefillStatusApproved, item.ID).Scan(&status.Used, &lastFill)
+		if err != nil {
+			return nil, err
+		}
+		status.Remaining = max(item.Refills-status.Used, 0)
+		if lastFill == nil {
+			lastFill = prescription.FinalizedAt
+		}
+		if status.Remaining > 0 && lastFill != nil {
+			next := lastFill.AddDate(0, 0, item.RefillIntervalDays)
+			status.NextEligibleAt = &next
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// checkRefillable returns ErrNotRefillable unless the prescription is finalized and still valid.
+func checkRefillable(prescription *models.Prescription, now time.Time) error {
+	if IsExpired(prescription, now) {
+		return fmt.Errorf("%w: prescription has expired", ErrNotRefillable)
+	}
+	if prescription.Status != models.PrescriptionStatusFinalized {
+		return fmt.Errorf("%w: prescription is %s", ErrNotRefillable, prescription.Status)
+	}
+	return nil
+}
+
+// RefillStatus reports the refillable medicines of a prescription. Prescriptions
+// that are not finalized or have expired have none.
+func (s *RefillService) RefillStatus(ctx context.Context, prescription *models.Prescription) ([]*models.ItemRefillStatus, error) {
+	if checkRefillable(prescription, time.Now()) != nil {
+		return make([]*models.ItemRefillStatus, 0), nil
+	}
+	return refillStatus(ctx, s.db, prescription)
+}
+
+// RequestRefill files a refill request by the patient of a finalized
+// prescription for the given items, or for every item with refills left when
+// req.ItemIDs is empty. Only one request per prescription can be pending.
+func (s *RefillService) RequestRefill(ctx context.Context, prescription *models.Prescription, req *models.RefillCreateRequest, now time.Time) (*models.RefillRequest, error) {
+	if err := checkRefillable(prescription, now); err != nil {
+		return nil, err
+	}
+
+	statuses, err := refillStatus(ctx, s.db, prescription)
+	if err != nil {
+		return nil, err
+	}
+
+	itemIDs := slices.Clone(req.ItemIDs)
+	if len(itemIDs) == 0 {
+		for _, status := range statuses {
+			if status.Remaining > 0 {
+				itemIDs = append(itemIDs, status.ItemID)
+			}
+		}
+		if len(itemIDs) == 0 {
+			return nil, fmt.Errorf("%w: no medicine on this prescription has refills left", ErrNotRefillable)
+		}
+	}
+	slices.Sort(itemIDs)
+	itemIDs = slices.Compact(itemIDs)
+
+	for _, itemID := range itemIDs {
+		i := slices.IndexFunc(statuses, func(status *models.ItemRefillStatus) bool { return status.ItemID == itemID })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: item %d is not a refillable medicine of this prescription", ErrNotRefillable, itemID)
+		}
+		status := statuses[i]
+		if status.Remaining == 0 {
+			return nil, fmt.Errorf("%w: all %d refills of %s have been used", ErrNotRefillable, status.Refills, status.Name)
+		}
+		if status.NextEligibleAt != nil && now.Before(*status.NextEligibleAt) {
+			return nil, fmt.Errorf("%w: %s can be refilled from %s", ErrRefillTooEarly, status.Name, status.NextEligibleAt.UTC().Format(time.DateOnly))
+		}
+	}
+
+	request := &models.RefillRequest{}
+	err = scanRefillRequest(s.db.QueryRow(ctx,
+		`INSERT INTO refill_requests (presId, userId, docId, itemIds, status, note)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (presId) WHERE status = 'pending' DO NOTHING
+		 RETURNING `+refillRequestColumns,
+		prescription.ID, prescription.UserID, prescription.DocID, itemIDs, models.RefillStatusPending, strings.TrimSpace(req.Note),
+	), request)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRefillPending
+		}
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetRefillRequest retrieves a refill request by ID
+func (s *RefillService) GetRefillRequest(ctx context.Context, requestID int64) (*models.RefillRequest, error) {
+	request := &models.RefillRequest{}
+	err := scanRefillRequest(s.db.QueryRow(ctx,
+		"SELECT "+refillRequestColumns+" FROM refill_requests WHERE id = $1",
+		requestID), request)
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetUserRefillRequests lists a patient's refill requests, newest first.
+func (s *RefillService) GetUserRefillRequests(ctx context.Context, userID int64) ([]*models.RefillRequest, error) {
+	return s.queryRefillRequests(ctx,
+		"SELECT "+refillRequestColumns+" FROM refill_requests WHERE userId = $1 ORDER BY created_at DESC, id DESC",
+		userID)
+}
+
+// GetPrescriptionRefillRequests lists the refill requests of a prescription, newest first.
+func (s *RefillService) GetPrescriptionRefillRequests(ctx context.Context, presID int64) ([]*models.RefillRequest, error) {
+	return s.queryRefillRequests(ctx,
+		"SELECT "+refillRequestColumns+" FROM refill_requests WHERE presId = $1 ORDER BY created_at DESC, id DESC",
+		presID)
+}
+
+// GetDoctorRefillQueue lists the refill requests waiting for a doctor, oldest first.
+func (s *RefillService) GetDoctorRefillQueue(ctx context.Context, docID int64) ([]*models.RefillRequest, error) {
+	return s.queryRefillRequests(ctx,
+		"SELECT "+refillRequestColumns+" FROM refill_requests WHERE docId = $1 AND status = $2 ORDER BY created_at, id",
+		docID, models.RefillStatusPending)
+}
+
+func (s *RefillService) queryRefillRequests(ctx context.Context, query string, args ...interface{}) ([]*models.RefillRequest, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]*models.RefillRequest, 0)
+	for rows.Next() {
+		request := &models.RefillRequest{}
+		if err := scanRefillRequest(rows, request); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// lockPendingRequest locks a refill request inside tx and checks that it is
+// still pending and addressed to docID.
+func lockPendingRequest(ctx context.Context, tx pgx.Tx, requestID, docID int64) (*models.RefillRequest, error) {
+	request := &models.RefillRequest{}
+	err := scanRefillRequest(tx.QueryRow(ctx,
+		"SELECT "+refillRequestColumns+" FROM refill_requests WHERE id = $1 FOR UPDATE",
+		requestID), request)
+	if err != nil {
+		return nil, err
+	}
+	if request.DocID != docID {
+		return nil, pgx.ErrNoRows
+	}
+	if request.Status != models.RefillStatusPending {
+		return nil, fmt.Errorf("%w: it is %s", ErrRefillDecided, request.Status)
+	}
+	return request, nil
+}
+
+// decide records the doctor's decision on a refill request inside tx.
+func decide(ctx context.Context, tx pgx.Tx, requestID int64, status, docNote string, childPresID *int64) (*models.RefillRequest, error) {
+	request := &models.RefillRequest{}
+	err := scanRefillRequest(tx.QueryRow(ctx,
+		`UPDATE refill_requests
+		 SET status = $2, docNote = $3, decidedAt = NOW(), childPresId = $4
+		 WHERE id = $1
+		 RETURNING `+refillRequestColumns,
+		requestID, status, docNote, childPresID,
+	), request)
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Deny turns down a pending refill request on behalf of its doctor.
+func (s *RefillService) Deny(ctx context.Context, requestID, docID int64, note string) (*models.RefillRequest, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockPendingRequest(ctx, tx, requestID, docID); err != nil {
+		return nil, err
+	}
+	request, err := decide(ctx, tx, requestID, models.RefillStatusDenied, note, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Approve grants a pending refill request on behalf of its doctor. It issues a
+// child prescription linked to the original through parentPresId, holding
+// approved copies of the requested medicines without refills of their own, and
+// takes it through review to finalized and signed without an AI run, valid for
+// the default period of its items. It returns the decided request, the child
+// prescription and its items.
+func (s *RefillService) Approve(ctx context.Context, requestID, docID int64, note string, defaults config.Validity) (*models.RefillRequest, *models.Prescription, []*models.Items, error) {
+	if s.signer == nil {
+		return nil, nil, nil, signing.ErrNotConfigured
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	request, err := lockPendingRequest(ctx, tx, requestID, docID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	parent := &models.Prescription{}
+	err = scanPrescription(tx.QueryRow(ctx,
+		"SELECT "+prescriptionColumns+" FROM prescriptions WHERE id = $1 FOR UPDATE",
+		request.PresID), parent)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := checkRefillable(parent, time.Now()); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The parent may have been amended since the request was filed.
+	statuses, err := refillStatus(ctx, tx, parent)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, itemID := range request.ItemIDs {
+		i := slices.IndexFunc(statuses, func(status *models.ItemRefillStatus) bool { return status.ItemID == itemID })
+		if i < 0 || statuses[i].Remaining == 0 {
+			return nil, nil, nil, fmt.Errorf("%w: item %d has no refills left", ErrNotRefillable, itemID)
+		}
+	}
+
+	reason := fmt.Sprintf("refill of prescription #%d", parent.ID)
+	child := &models.Prescription{}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO prescriptions (docId, userId, symptoms, link, seenByPatient, status, statusChangedAt, parentPresId)
+		 VALUES ($1, $2, $3, '', FALSE, $4, NOW(), $5)
+		 RETURNING id`,
+		parent.DocID, parent.UserID, parent.Symptoms, models.PrescriptionStatusSubmitted, parent.ID).Scan(&child.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO prescription_status_history (presId, fromStatus, toStatus, actorRole, actorId, note)
+		 VALUES ($1, '', $2, 'doctor', $3, $4)`,
+		child.ID, models.PrescriptionStatusSubmitted, docID, reason)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO items (presId, name, type, aiReasons, docReason, catalogId, matchScore, approved,
+			doseAmount, doseUnit, route, frequency, timesPerDay, asNeeded, durationDays, quantity, instructions)
+		 SELECT $1, name, type, '', docReason, catalogId, matchScore, TRUE,
+			doseAmount, doseUnit, route, frequency, timesPerDay, asNeeded, durationDays, quantity, instructions
+		 FROM items WHERE presId = $2 AND id = ANY($3)
+		 ORDER BY id`,
+		child.ID, parent.ID, request.ItemIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := recordVersion(ctx, tx, child.ID, "doctor", docID, reason); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if _, err := transitionStatus(ctx, tx, child.ID, models.PrescriptionStatusAwaitingReview, models.StatusActorSystem, 0, reason); err != nil {
+		return nil, nil, nil, err
+	}
+	if _, err := transitionStatus(ctx, tx, child.ID, models.PrescriptionStatusReviewed, "doctor", docID, "refill approved"); err != nil {
+		return nil, nil, nil, err
+	}
+	child, err = transitionStatus(ctx, tx, child.ID, models.PrescriptionStatusFinalized, "doctor", docID, note)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	finalizedAt := time.Now().UTC().Truncate(time.Microsecond)
+	if err := setValidity(ctx, tx, child, finalizedAt, 0, defaults); err != nil {
+		return nil, nil, nil, err
+	}
+	finalization := &FinalizationService{db: s.db, signer: s.signer}
+	child, err = finalization.sign(ctx, tx, child, finalizedAt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	items, err := prescriptionItems(ctx, tx, child.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	request, err = decide(ctx, tx, requestID, models.RefillStatusApproved, note, &child.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	return request, child, items, nil
+}
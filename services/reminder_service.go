@@ -0,0 +1,356 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/notify"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// reminderLookahead is how far ahead doses and follow-ups are queued as reminders.
+	reminderLookahead = 3 * time.Hour
+	// reminderLease is how long a claimed reminder stays reserved for one instance.
+	// The lease is renewed just before each reminder is sent, so it only has to
+	// cover one delivery through every channel, not the whole batch: with each
+	// send cut off after reminderSendTimeout, four channels take at most 80 seconds.
+	reminderLease = 2 * time.Minute
+	// reminderSendTimeout bounds one notifier call so a slow channel cannot hold
+	// a reminder past its lease.
+	reminderSendTimeout = 20 * time.Second
+	// reminderBatchSize caps how many reminders one dispatch run claims.
+	reminderBatchSize = 50
+	// reminderMaxAttempts is how many delivery attempts are made before giving up.
+	reminderMaxAttempts = 5
+	// staleDoseReminder drops dose reminders that could not be sent long after the dose.
+	staleDoseReminder = 2 * time.Hour
+)
+
+// ReminderService queues and delivers dose and follow-up reminders. Reminders
+// live in Postgres so they survive restarts, and are claimed with
+// FOR UPDATE SKIP LOCKED so that concurrent instances never send the same one.
+type ReminderService struct {
+	db         *pgxpool.Pool
+	notifiers  map[string]notify.Notifier
+	instanceID string
+}
+
+func NewReminderService(db *pgxpool.Pool, notifiers map[string]notify.Notifier, instanceID string) *ReminderService {
+	return &ReminderService{db: db, notifiers: notifiers, instanceID: instanceID}
+}
+
+// EnqueueDoseReminders queues a reminder for every pending dose coming up within
+// the lookahead window, honouring each patient's lead time and opt-out.
+func (s *ReminderService) EnqueueDoseReminders(ctx context.Context) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO reminders (userId, kind, refId, dueAt)
+		 SELECT d.userId, $1, d.id, d.scheduledAt - make_interval(mins => COALESCE(np.leadMinutes, 10))
+		 FROM doses d
+		 LEFT JOIN notification_preferences np ON np.userId = d.userId
+		 WHERE d.status = 'pending'
+		   AND d.scheduledAt > NOW()
+		   AND d.scheduledAt <= NOW() + make_interval(secs => $2)
+		   AND COALESCE(np.doseReminders, TRUE)
+		 ON CONFLICT (kind, refId) DO NOTHING`,
+		models.ReminderKindDose, reminderLookahead.Seconds())
+	return err
+}
+
+// EnqueueFollowUpReminders queues a reminder one day ahead of each upcoming prescription follow-up.
+func (s *ReminderService) EnqueueFollowUpReminders(ctx context.Context) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO reminders (userId, kind, refId, dueAt)
+		 SELECT p.userId, $1, p.id, GREATEST(p.followUpAt - INTERVAL '1 day', NOW())
+		 FROM prescriptions p
+		 LEFT JOIN notification_preferences np ON np.userId = p.userId
+		 WHERE p.followUpAt IS NOT NULL
+		   AND p.followUpAt > NOW()
+		   AND COALESCE(p.status, '') <> $3
+		   AND p.followUpAt - INTERVAL '1 day' <= NOW() + make_interval(secs => $2)
+		   AND COALESCE(np.followUpReminders, TRUE)
+		 ON CONFLICT (kind, refId) DO NOTHING`,
+		models.ReminderKindFollowUp, reminderLookahead.Seconds(), models.PrescriptionStatusCancelled)
+	return err
+}
+
+// claimDueReminders reserves a batch of due reminders for this instance. Rows
+// whose lease expired (e.g. the claiming instance crashed) are claimed again.
+func (s *ReminderService) claimDueReminders(ctx context.Context) ([]*models.Reminder, error) {
+	rows, err := s.db.Query(ctx,
+		`UPDATE reminders
+		 SET status = $1, lockedBy = $2, lockedUntil = NOW() + make_interval(secs => $3), attempts = attempts + 1
+		 WHERE id IN (
+			SELECT id FROM reminders
+			WHERE dueAt <= NOW()
+			  AND (status = $4 OR (status = $1 AND lockedUntil < NOW()))
+			ORDER BY dueAt
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, created_at, userId, kind, refId, dueAt, status, attempts, lastError, sentAt, channels`,
+		models.ReminderStatusSending, s.instanceID, reminderLease.Seconds(), models.ReminderStatusPending, reminderBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []*models.Reminder
+	for rows.Next() {
+		reminder := &models.Reminder{}
+		if err := rows.Scan(&reminder.ID, &reminder.CreatedAt, &reminder.UserID, &reminder.Kind, &reminder.RefID,
+			&reminder.DueAt, &reminder.Status, &reminder.Attempts, &reminder.LastError, &reminder.SentAt, &reminder.Channels); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+// DispatchDueReminders delivers the reminders that are due through each patient's channels.
+func (s *ReminderService) DispatchDueReminders(ctx context.Context) error {
+	reminders, err := s.claimDueReminders(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, reminder := range reminders {
+		// Later reminders of the batch wait for the earlier ones to be sent;
+		// skip any whose lease another instance has taken over meanwhile.
+		held, err := s.renewLease(ctx, reminder)
+		if err != nil {
+			log.Printf("reminder %d lease renewal failed: %v", reminder.ID, err)
+			continue
+		}
+		if !held {
+			continue
+		}
+		if err := s.dispatch(ctx, reminder); err != nil {
+			log.Printf("reminder %d dispatch failed: %v", reminder.ID, err)
+		}
+	}
+	return nil
+}
+
+// renewLease extends this instance's lease on a claimed reminder. held is false
+// when the reminder is no longer claimed by this instance.
+func (s *ReminderService) renewLease(ctx context.Context, reminder *models.Reminder) (bool, error) {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE reminders
+		 SET lockedUntil = NOW() + make_interval(secs => $4)
+		 WHERE id = $1 AND lockedBy = $2 AND status = $3`,
+		reminder.ID, s.instanceID, models.ReminderStatusSending, reminderLease.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *ReminderService) dispatch(ctx context.Context, reminder *models.Reminder) error {
+	now := time.Now()
+
+	prefs, err := NewNotificationService(s.db).GetPreferences(ctx, reminder.UserID)
+	if err != nil {
+		return s.retry(ctx, reminder, err)
+	}
+
+	msg, ok, err := s.buildMessage(ctx, reminder, prefs, now)
+	if err != nil {
+		return s.retry(ctx, reminder, err)
+	}
+	if !ok {
+		return s.finish(ctx, reminder, models.ReminderStatusCancelled, "", "")
+	}
+
+	if quietEnd, quiet := QuietHoursEnd(prefs, now); quiet {
+		return s.postpone(ctx, reminder, quietEnd)
+	}
+
+	user, err := NewUserService(s.db).GetUser(ctx, reminder.UserID)
+	if err != nil {
+		return s.retry(ctx, reminder, err)
+	}
+	recipient := notify.Recipient{
+		UserID:           user.ID,
+		Name:             user.Name,
+		Email:            firstNonEmpty(prefs.Email, user.Email),
+		Phone:            firstNonEmpty(prefs.PhnNumber, user.PhnNumber),
+		PushSubscription: string(prefs.PushSubscription),
+	}
+
+	var delivered []string
+	var failures []string
+	for _, channel := range prefs.Channels {
+		notifier, ok := s.notifiers[channel]
+		if !ok {
+			continue
+		}
+		if err := send(ctx, notifier, recipient, msg); err != nil {
+			if errors.Is(err, notify.ErrNoAddress) {
+				continue
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", channel, err))
+			continue
+		}
+		delivered = append(delivered, channel)
+	}
+
+	// Nothing configured for the patient's channels: fall back to the local log so
+	// the reminder is still visible during development.
+	if len(delivered) == 0 && len(failures) == 0 {
+		if logNotifier, ok := s.notifiers[notify.ChannelLog]; ok {
+			if err := send(ctx, logNotifier, recipient, msg); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", notify.ChannelLog, err))
+			} else {
+				delivered = append(delivered, notify.ChannelLog)
+			}
+		}
+	}
+
+	if len(delivered) == 0 {
+		return s.retry(ctx, reminder, errors.New(strings.Join(failures, "; ")))
+	}
+	return s.finish(ctx, reminder, models.ReminderStatusSent, strings.Join(delivered, ","), strings.Join(failures, "; "))
+}
+
+// send delivers msg through one notifier, giving up after reminderSendTimeout.
+func send(ctx context.Context, notifier notify.Notifier, to notify.Recipient, msg notify.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, reminderSendTimeout)
+	defer cancel()
+	return notifier.Send(ctx, to, msg)
+}
+
+// buildMessage renders the reminder text. ok is false when the reminder is no
+// longer relevant (dose logged or rescheduled, follow-up moved or opted out).
+func (s *ReminderService) buildMessage(ctx context.Context, reminder *models.Reminder, prefs *models.NotificationPreferences, now time.Time) (notify.Message, bool, error) {
+	loc := PreferencesLocation(prefs)
+
+	switch reminder.Kind {
+	case models.ReminderKindDose:
+		if !prefs.DoseReminders {
+			return notify.Message{}, false, nil
+		}
+		var name, unit, status string
+		var amount float64
+		var scheduledAt time.Time
+		var presID int64
+		err := s.db.QueryRow(ctx,
+			`SELECT i.name, i.doseUnit, d.amount, d.status, d.scheduledAt, d.presId
+			 FROM doses d JOIN items i ON i.id = d.itemId
+			 WHERE d.id = $1`,
+			reminder.RefID,
+		).Scan(&name, &unit, &amount, &status, &scheduledAt, &presID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return notify.Message{}, false, nil
+		}
+		if err != nil {
+			return notify.Message{}, false, err
+		}
+		if status != models.DoseStatusPending || now.Sub(scheduledAt) > staleDoseReminder {
+			return notify.Message{}, false, nil
+		}
+
+		dose := name
+		if amount > 0 {
+			dose = fmt.Sprintf("%s %s of %s", strconv.FormatFloat(amount, 'f', -1, 64), unit, name)
+		}
+		return notify.Message{
+			Subject: "Medication reminder",
+			Body:    fmt.Sprintf("Time to take %s at %s.", strings.TrimSpace(dose), scheduledAt.In(loc).Format("15:04")),
+			Data: map[string]string{
+				"type":   models.ReminderKindDose,
+				"doseId": strconv.FormatInt(reminder.RefID, 10),
+				"presId": strconv.FormatInt(presID, 10),
+			},
+		}, true, nil
+
+	case models.ReminderKindFollowUp:
+		if !prefs.FollowUpReminders {
+			return notify.Message{}, false, nil
+		}
+		prescription, err := NewPrescriptionService(s.db).GetPrescription(ctx, reminder.RefID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return notify.Message{}, false, nil
+		}
+		if err != nil {
+			return notify.Message{}, false, err
+		}
+		if prescription.FollowUpAt == nil || prescription.FollowUpAt.Before(now) || prescription.Status == models.PrescriptionStatusCancelled {
+			return notify.Message{}, false, nil
+		}
+		return notify.Message{
+			Subject: "Upcoming follow-up",
+			Body:    fmt.Sprintf("Your follow-up for prescription #%d is due on %s.", prescription.ID, prescription.FollowUpAt.In(loc).Format("Mon 2 Jan 15:04")),
+			Data: map[string]string{
+				"type":   models.ReminderKindFollowUp,
+				"presId": strconv.FormatInt(prescription.ID, 10),
+			},
+		}, true, nil
+	}
+
+	return notify.Message{}, false, fmt.Errorf("unknown reminder kind %q", reminder.Kind)
+}
+
+// retry returns a reminder to the queue with exponential backoff, or marks it
+// failed once it has used all its attempts.
+func (s *ReminderService) retry(ctx context.Context, reminder *models.Reminder, cause error) error {
+	if reminder.Attempts >= reminderMaxAttempts {
+		if err := s.finish(ctx, reminder, models.ReminderStatusFailed, "", cause.Error()); err != nil {
+			return err
+		}
+		return cause
+	}
+	backoff := time.Duration(1<<reminder.Attempts) * time.Minute
+	if err := s.release(ctx, reminder, time.Now().Add(backoff), cause.Error()); err != nil {
+		return err
+	}
+	return cause
+}
+
+// release puts a claimed reminder back in the queue to be retried at dueAt.
+func (s *ReminderService) release(ctx context.Context, reminder *models.Reminder, dueAt time.Time, lastError string) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE reminders
+		 SET status = $3, dueAt = $4, lastError = $5, lockedBy = '', lockedUntil = NULL
+		 WHERE id = $1 AND lockedBy = $2`,
+		reminder.ID, s.instanceID, models.ReminderStatusPending, dueAt, lastError)
+	return err
+}
+
+// postpone puts a claimed reminder back in the queue until dueAt without
+// counting the claim as a delivery attempt, e.g. to wait for quiet hours to end.
+func (s *ReminderService) postpone(ctx context.Context, reminder *models.Reminder, dueAt time.Time) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE reminders
+		 SET status = $3, dueAt = $4, attempts = GREATEST(attempts - 1, 0), lockedBy = '', lockedUntil = NULL
+		 WHERE id = $1 AND lockedBy = $2`,
+		reminder.ID, s.instanceID, models.ReminderStatusPending, dueAt)
+	return err
+}
+
+// finish records the final state of a claimed reminder.
+func (s *ReminderService) finish(ctx context.Context, reminder *models.Reminder, status, channels, lastError string) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE reminders
+		 SET status = $3, channels = $4, lastError = $5, lockedUntil = NULL,
+		     sentAt = CASE WHEN $3 = 'sent' THEN NOW() ELSE sentAt END
+		 WHERE id = $1 AND lockedBy = $2`,
+		reminder.ID, s.instanceID, status, channels, lastError)
+	return err
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/scanner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// scanResultColumns lists the scan_results columns in the order scanScanResult expects them.
+const scanResultColumns = "id, created_at, presId, attachmentId, fileName, sha256, size, scanner, verdict, signature, detail, durationMs"
+
+func scanScanResult(row pgx.Row, result *models.ScanResult) error {
+	return row.Scan(&result.ID, &result.CreatedAt, &result.PresID, &result.AttachmentID, &result.FileName,
+		&result.SHA256, &result.Size, &result.Scanner, &result.Verdict, &result.Signature, &result.Detail,
+		&result.DurationMs)
+}
+
+type ScanService struct {
+	db *pgxpool.Pool
+}
+
+func NewScanService(db *pgxpool.Pool) *ScanService {
+	return &ScanService{db: db}
+}
+
+// ScanFile runs the scanner over a file and returns its result ready to be
+// recorded once the attachment exists. Errors mean the file could not be scanned.
+func ScanFile(ctx context.Context, sc scanner.Scanner, fileName string, data []byte) (*models.ScanResult, error) {
+	started := time.Now()
+	verdict, err := sc.Scan(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &models.ScanResult{
+		FileName:   fileName,
+		SHA256:     hex.EncodeToString(sum[:]),
+		Size:       int64(len(data)),
+		Scanner:    sc.Name(),
+		Verdict:    verdict.Verdict,
+		Signature:  verdict.Signature,
+		Detail:     verdict.Detail,
+		DurationMs: time.Since(started).Milliseconds(),
+	}, nil
+}
+
+// RecordScanResults stores scan results for administrators to review.
+func (s *ScanService) RecordScanResults(ctx context.Context, results []*models.ScanResult) error {
+	for _, result := range results {
+		err := s.db.QueryRow(ctx,
+			`INSERT INTO scan_results (presId, attachmentId, fileName, sha256, size, scanner, verdict, signature, detail, durationMs)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			 RETURNING id, created_at`,
+			result.PresID, result.AttachmentID, result.FileName, result.SHA256, result.Size, result.Scanner,
+			result.Verdict, result.Signature, result.Detail, result.DurationMs,
+		).Scan(&result.ID, &result.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetScanResults retrieves the most recent scan results, optionally only those with verdict.
+func (s *ScanService) GetScanResults(ctx context.Context, verdict string, limit int) ([]*models.ScanResult, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+scanResultColumns+` FROM scan_results
+		 WHERE ($1 = '' OR verdict = $1)
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $2`,
+		verdict, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*models.ScanResult, 0)
+	for rows.Next() {
+		result := &models.ScanResult{}
+		if err := scanScanResult(rows, result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
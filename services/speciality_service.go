@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrUnknownSpeciality is returned for a speciality that is not in the vocabulary.
+var ErrUnknownSpeciality = errors.New("unknown speciality")
+
+type SpecialityService struct {
+	db *pgxpool.Pool
+}
+
+func NewSpecialityService(db *pgxpool.Pool) *SpecialityService {
+	return &SpecialityService{db: db}
+}
+
+// GetSpecialities returns the speciality vocabulary ordered by name.
+func (s *SpecialityService) GetSpecialities(ctx context.Context) ([]*models.Speciality, error) {
+	rows, err := s.db.Query(ctx, "SELECT code, name FROM specialities ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	specialities := make([]*models.Speciality, 0)
+	for rows.Next() {
+		speciality := &models.Speciality{}
+		if err := rows.Scan(&speciality.Code, &speciality.Name); err != nil {
+			return nil, err
+		}
+		specialities = append(specialities, speciality)
+	}
+	return specialities, rows.Err()
+}
+
+// normalizeSpeciality lowercases a speciality and collapses its spaces, the
+// form aliases are stored in.
+func normalizeSpeciality(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
+
+// Resolve finds the vocabulary entry with the given code, name or alias
+// ("Cardiologist", "Paediatrics"), ignoring case.
+func (s *SpecialityService) Resolve(ctx context.Context, value string) (*models.Speciality, error) {
+	value = normalizeSpeciality(value)
+	speciality := &models.Speciality{}
+	err := s.db.QueryRow(ctx,
+		`SELECT s.code, s.name FROM specialities s
+		 WHERE s.code = $1 OR LOWER(s.name) = $1
+		    OR s.code = (SELECT a.code FROM speciality_aliases a WHERE a.alias = $1)`,
+		value).Scan(&speciality.Code, &speciality.Name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownSpeciality, value)
+		}
+		return nil, err
+	}
+	return speciality, nil
+}
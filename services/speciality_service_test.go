@@ -0,0 +1,21 @@
+package services
+
+import "testing"
+
+func TestNormalizeSpeciality(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "Cardiology", want: "cardiology"},
+		{value: "  General   Physician\t", want: "general physician"},
+		{value: "ENT", want: "ent"},
+		{value: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeSpeciality(tt.value); got != tt.want {
+			t.Errorf("normalizeSpeciality(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
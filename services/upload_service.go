@@ -0,0 +1,531 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// uploadLease is how long a claimed upload job stays reserved for one instance.
+	uploadLease = 5 * time.Minute
+	// uploadBatchSize caps how many jobs one dispatch run claims; each holds a file in memory.
+	uploadBatchSize = 10
+	// uploadMaxAttempts is how many uploads are attempted before a job is marked failed.
+	uploadMaxAttempts = 8
+	// uploadMaxBackoff caps the delay between attempts.
+	uploadMaxBackoff = time.Hour
+	// reconcileGracePeriod leaves recent uploads alone so in-flight work is not reported.
+	reconcileGracePeriod = time.Hour
+)
+
+// uploadJobColumns lists the upload_outbox columns in the order scanUploadJob expects them.
+const uploadJobColumns = "id, created_at, attachmentId, presId, COALESCE(kind, 'original'), objectKey, contentType, size, status, attempts, nextAttemptAt, lastError, completedAt"
+
+func scanUploadJob(row pgx.Row, job *models.UploadJob, extra ...any) error {
+	return row.Scan(append([]any{&job.ID, &job.CreatedAt, &job.AttachmentID, &job.PresID, &job.Kind, &job.ObjectKey,
+		&job.ContentType, &job.Size, &job.Status, &job.Attempts, &job.NextAttemptAt, &job.LastError,
+		&job.CompletedAt}, extra...)...)
+}
+
+// UploadService moves queued attachment files into the object store and
+// reconciles the database with the store's contents. Jobs are claimed with
+// FOR UPDATE SKIP LOCKED so concurrent instances never upload the same file twice.
+type UploadService struct {
+	db         *pgxpool.Pool
+	store      storage.ObjectStore
+	instanceID string
+}
+
+func NewUploadService(db *pgxpool.Pool, store storage.ObjectStore, instanceID string) *UploadService {
+	return &UploadService{db: db, store: store, instanceID: instanceID}
+}
+
+// claimPendingUploads reserves a batch of due jobs for this instance. Jobs whose
+// lease expired (e.g. the claiming instance crashed) are claimed again.
+func (s *UploadService) claimPendingUploads(ctx context.Context) ([]*models.UploadJob, error) {
+	rows, err := s.db.Query(ctx,
+		`UPDATE upload_outbox
+		 SET status = $1, lockedBy = $2, lockedUntil = NOW() + make_interval(secs => $3), attempts = attempts + 1
+		 WHERE id IN (
+			SELECT id FROM upload_outbox
+			WHERE nextAttemptAt <= NOW()
+			  AND (status = $4 OR (status = $1 AND lockedUntil < NOW()))
+			ORDER BY id
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+uploadJobColumns+`, data`,
+		models.UploadStatusUploading, s.instanceID, uploadLease.Seconds(), models.UploadStatusPending, uploadBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.UploadJob
+	for rows.Next() {
+		job := &models.UploadJob{}
+		if err := scanUploadJob(rows, job, &job.Data); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	// Upload in queue order so a prescription's first file is usually stored first.
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, rows.Err()
+}
+
+// DispatchPendingUploads stores the files of due upload jobs.
+func (s *UploadService) DispatchPendingUploads(ctx context.Context) error {
+	jobs, err := s.claimPendingUploads(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := s.upload(ctx, job); err != nil {
+			log.Printf("upload job %d for prescription %d failed: %v", job.ID, job.PresID, err)
+		}
+	}
+	return nil
+}
+
+// upload stores one file and records it. Put overwrites the same key, so a job
+// retried after its database update failed does not leave a stray object.
+func (s *UploadService) upload(ctx context.Context, job *models.UploadJob) error {
+	if err := s.store.Put(ctx, job.ObjectKey, job.Data, job.ContentType); err != nil {
+		return s.retry(ctx, job, err)
+	}
+	if err := s.complete(ctx, job); err != nil {
+		return s.retry(ctx, job, fmt.Errorf("stored but not recorded: %w", err))
+	}
+	return nil
+}
+
+// complete records a stored thumbnail, or marks an original file's attachment
+// uploaded and points the prescription at its first stored file, then drops the
+// file bytes from the outbox.
+func (s *UploadService) complete(ctx context.Context, job *models.UploadJob) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if job.Kind == models.UploadKindThumbnail {
+		if _, err := tx.Exec(ctx,
+			"UPDATE attachments SET thumbnailKey = $2 WHERE id = $1",
+			job.AttachmentID, job.ObjectKey); err != nil {
+			return err
+		}
+	} else if err := s.completeOriginal(ctx, tx, job); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE upload_outbox
+		 SET status = $3, data = NULL, lastError = '', completedAt = NOW(), lockedUntil = NULL
+		 WHERE id = $1 AND lockedBy = $2`,
+		job.ID, s.instanceID, models.UploadStatusDone); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *UploadService) completeOriginal(ctx context.Context, tx pgx.Tx, job *models.UploadJob) error {
+	if _, err := tx.Exec(ctx,
+		`UPDATE attachments
+		 SET objectKey = $2, status = CASE WHEN status = $4 THEN status ELSE $3 END
+		 WHERE id = $1`,
+		job.AttachmentID, job.ObjectKey, models.AttachmentStatusUploaded, models.AttachmentStatusQuarantined); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx,
+		`UPDATE prescriptions p
+		 SET objectKey = (
+			SELECT a.objectKey FROM attachments a
+			WHERE a.presId = p.id AND a.status = $2 AND a.messageId IS NULL
+			ORDER BY a.position, a.id
+			LIMIT 1
+		 )
+		 WHERE p.id = $1`,
+		job.PresID, models.AttachmentStatusUploaded)
+	return err
+}
+
+// retry returns a job to the queue with exponential backoff, or marks it failed
+// once it has used all its attempts; a failed original also fails its
+// attachment. The file bytes are kept so an administrator can retry it later.
+func (s *UploadService) retry(ctx context.Context, job *models.UploadJob, cause error) error {
+	if job.Attempts >= uploadMaxAttempts {
+		_, err := s.db.Exec(ctx,
+			`UPDATE upload_outbox SET status = $3, lastError = $4, lockedUntil = NULL
+			 WHERE id = $1 AND lockedBy = $2`,
+			job.ID, s.instanceID, models.UploadStatusFailed, cause.Error())
+		if err != nil {
+			return err
+		}
+		if job.Kind != models.UploadKindThumbnail {
+			_, err = s.db.Exec(ctx,
+				"UPDATE attachments SET status = $2 WHERE id = $1 AND status <> $3",
+				job.AttachmentID, models.AttachmentStatusFailed, models.AttachmentStatusQuarantined)
+			if err != nil {
+				return err
+			}
+		}
+		return cause
+	}
+
+	backoff := min(time.Duration(1<<job.Attempts)*15*time.Second, uploadMaxBackoff)
+	_, err := s.db.Exec(ctx,
+		`UPDATE upload_outbox
+		 SET status = $3, nextAttemptAt = $4, lastError = $5, lockedBy = '', lockedUntil = NULL
+		 WHERE id = $1 AND lockedBy = $2`,
+		job.ID, s.instanceID, models.UploadStatusPending, time.Now().Add(backoff), cause.Error())
+	if err != nil {
+		return err
+	}
+	return cause
+}
+
+// RetryFailedUploads puts failed jobs back in the queue with fresh attempts.
+// A jobID of 0 retries every failed job. It returns the number of jobs queued.
+func (s *UploadService) RetryFailedUploads(ctx context.Context, jobID int64) (int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`UPDATE upload_outbox
+		 SET status = $1, attempts = 0, nextAttemptAt = NOW(), lockedBy = '', lockedUntil = NULL
+		 WHERE status = $2 AND data IS NOT NULL AND ($3::BIGINT = 0 OR id = $3)
+		 RETURNING attachmentId, COALESCE(kind, 'original')`,
+		models.UploadStatusPending, models.UploadStatusFailed, jobID)
+	if err != nil {
+		return 0, err
+	}
+	var queued int64
+	var attachmentIDs []int64
+	for rows.Next() {
+		var attachmentID int64
+		var kind string
+		if err := rows.Scan(&attachmentID, &kind); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		queued++
+		if kind != models.UploadKindThumbnail {
+			attachmentIDs = append(attachmentIDs, attachmentID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE attachments SET status = $2 WHERE id = ANY($1) AND status <> $3",
+		attachmentIDs, models.AttachmentStatusPending, models.AttachmentStatusQuarantined); err != nil {
+		return 0, err
+	}
+	return queued, tx.Commit(ctx)
+}
+
+// Reconcile compares the database with the object store and records the
+// prescriptions whose files are missing and the stored objects nothing refers
+// to. Orphans are only reported, never deleted.
+func (s *UploadService) Reconcile(ctx context.Context) error {
+	startedAt := time.Now()
+	objects, err := s.store.List(ctx, "")
+	if err != nil {
+		s.recordReconciliation(ctx, startedAt, 0, 0, err)
+		return fmt.Errorf("failed to list stored objects: %w", err)
+	}
+
+	issues, err := s.findStorageIssues(ctx, objects, startedAt)
+	if err == nil {
+		err = s.replaceStorageIssues(ctx, issues)
+	}
+	s.recordReconciliation(ctx, startedAt, len(objects), len(issues), err)
+	return err
+}
+
+func (s *UploadService) findStorageIssues(ctx context.Context, objects []*storage.ObjectInfo, now time.Time) ([]*models.StorageIssue, error) {
+	stored := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		stored[object.Key] = true
+	}
+
+	// Every key the database knows about, including uploads still in the outbox.
+	known := map[string]bool{}
+	rows, err := s.db.Query(ctx,
+		`SELECT objectKey FROM attachments WHERE COALESCE(objectKey, '') <> ''
+		 UNION SELECT thumbnailKey FROM attachments WHERE COALESCE(thumbnailKey, '') <> ''
+		 UNION SELECT objectKey FROM prescriptions WHERE COALESCE(objectKey, '') <> ''
+		 UNION SELECT objectKey FROM upload_outbox WHERE status <> $1`,
+		models.UploadStatusDone)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		known[key] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var issues []*models.StorageIssue
+	for _, object := range objects {
+		if known[object.Key] || now.Sub(object.ModTime) < reconcileGracePeriod {
+			continue
+		}
+		issues = append(issues, &models.StorageIssue{
+			Kind:      models.StorageIssueOrphanObject,
+			ObjectKey: object.Key,
+			Size:      object.Size,
+			Detail:    "no prescription refers to this object",
+		})
+	}
+
+	// Attachments that never made it to storage, or whose object has gone.
+	rows, err = s.db.Query(ctx,
+		`SELECT a.presId, a.id, COALESCE(a.objectKey, ''), a.status, COALESCE(o.status, ''), COALESCE(o.lastError, '')
+		 FROM attachments a
+		 LEFT JOIN upload_outbox o ON o.attachmentId = a.id AND COALESCE(o.kind, 'original') = 'original'
+		 WHERE a.created_at < NOW() - make_interval(secs => $1)
+		   AND COALESCE(o.status, '') NOT IN ($2, $3)
+		 ORDER BY a.presId, a.position`,
+		reconcileGracePeriod.Seconds(), models.UploadStatusPending, models.UploadStatusUploading)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var presID, attachmentID int64
+		var key, status, jobStatus, lastError string
+		if err := rows.Scan(&presID, &attachmentID, &key, &status, &jobStatus, &lastError); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		detail := ""
+		switch {
+		case status == models.AttachmentStatusUploaded && key != "" && !stored[key]:
+			detail = "object missing from storage"
+		case status == models.AttachmentStatusUploaded && key != "", status == models.AttachmentStatusQuarantined:
+			continue
+		case jobStatus == models.UploadStatusFailed:
+			detail = "upload failed: " + lastError
+		default:
+			detail = "file was never uploaded"
+		}
+		issues = append(issues, &models.StorageIssue{
+			Kind:         models.StorageIssueMissingFile,
+			PresID:       &presID,
+			AttachmentID: &attachmentID,
+			ObjectKey:    key,
+			Detail:       detail,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Prescriptions from before attachments were tracked.
+	rows, err = s.db.Query(ctx,
+		`SELECT p.id, COALESCE(p.objectKey, '')
+		 FROM prescriptions p
+		 WHERE p.created_at < NOW() - make_interval(secs => $1)
+		   AND COALESCE(p.link, '') = ''
+		   AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.presId = p.id AND a.messageId IS NULL)
+		 ORDER BY p.id`,
+		reconcileGracePeriod.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var presID int64
+		var key string
+		if err := rows.Scan(&presID, &key); err != nil {
+			return nil, err
+		}
+		detail := "no file recorded"
+		if key != "" {
+			if stored[key] {
+				continue
+			}
+			detail = "object missing from storage"
+		}
+		issues = append(issues, &models.StorageIssue{
+			Kind:      models.StorageIssueMissingFile,
+			PresID:    &presID,
+			ObjectKey: key,
+			Detail:    detail,
+		})
+	}
+	return issues, rows.Err()
+}
+
+// storageIssueKey identifies an issue across reconciliation runs.
+func storageIssueKey(issue *models.StorageIssue) string {
+	key := issue.Kind + "|" + issue.ObjectKey
+	if issue.PresID != nil {
+		key += "|" + strconv.FormatInt(*issue.PresID, 10)
+	}
+	if issue.AttachmentID != nil {
+		key += "|" + strconv.FormatInt(*issue.AttachmentID, 10)
+	}
+	return key
+}
+
+// replaceStorageIssues swaps in the issues found by a run, keeping when each
+// still-open issue was first detected.
+func (s *UploadService) replaceStorageIssues(ctx context.Context, issues []*models.StorageIssue) error {
+	previous, err := s.GetStorageIssues(ctx)
+	if err != nil {
+		return err
+	}
+	detectedAt := make(map[string]time.Time, len(previous))
+	for _, issue := range previous {
+		detectedAt[storageIssueKey(issue)] = issue.DetectedAt
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM storage_issues"); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, issue := range issues {
+		issue.DetectedAt = now
+		if at, ok := detectedAt[storageIssueKey(issue)]; ok {
+			issue.DetectedAt = at
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO storage_issues (kind, presId, attachmentId, objectKey, size, detail, detectedAt)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			issue.Kind, issue.PresID, issue.AttachmentID, issue.ObjectKey, issue.Size, issue.Detail, issue.DetectedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *UploadService) recordReconciliation(ctx context.Context, startedAt time.Time, objects, issues int, runErr error) {
+	lastError := ""
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO storage_reconciliations (startedAt, finishedAt, objectsScanned, issues, lastError)
+		 VALUES ($1, NOW(), $2, $3, $4)`,
+		startedAt, objects, issues, lastError)
+	if err != nil {
+		log.Printf("failed to record storage reconciliation: %v", err)
+	}
+}
+
+// GetStorageIssues retrieves the issues found by the last reconciliation
+func (s *UploadService) GetStorageIssues(ctx context.Context) ([]*models.StorageIssue, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT kind, presId, attachmentId, objectKey, size, detail, detectedAt
+		 FROM storage_issues
+		 ORDER BY detectedAt, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var issues []*models.StorageIssue
+	for rows.Next() {
+		issue := &models.StorageIssue{}
+		if err := rows.Scan(&issue.Kind, &issue.PresID, &issue.AttachmentID, &issue.ObjectKey,
+			&issue.Size, &issue.Detail, &issue.DetectedAt); err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, rows.Err()
+}
+
+// StorageReport summarises queued and failed uploads and the last reconciliation.
+func (s *UploadService) StorageReport(ctx context.Context) (*models.StorageReport, error) {
+	report := &models.StorageReport{
+		GeneratedAt:   time.Now(),
+		FailedUploads: make([]*models.UploadJob, 0),
+		MissingFiles:  make([]*models.StorageIssue, 0),
+		OrphanObjects: make([]*models.StorageIssue, 0),
+	}
+
+	var finishedAt time.Time
+	err := s.db.QueryRow(ctx,
+		"SELECT finishedAt, lastError FROM storage_reconciliations ORDER BY id DESC LIMIT 1",
+	).Scan(&finishedAt, &report.ReconcileError)
+	switch {
+	case err == nil:
+		report.LastReconciledAt = &finishedAt
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, err
+	}
+
+	if err := s.db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM upload_outbox WHERE status IN ($1, $2)",
+		models.UploadStatusPending, models.UploadStatusUploading,
+	).Scan(&report.PendingUploads); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx,
+		"SELECT "+uploadJobColumns+" FROM upload_outbox WHERE status = $1 ORDER BY id",
+		models.UploadStatusFailed)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		job := &models.UploadJob{}
+		if err := scanUploadJob(rows, job); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.FailedUploads = append(report.FailedUploads, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	issues, err := s.GetStorageIssues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		if issue.Kind == models.StorageIssueOrphanObject {
+			report.OrphanObjects = append(report.OrphanObjects, issue)
+		} else {
+			report.MissingFiles = append(report.MissingFiles, issue)
+		}
+	}
+	return report, nil
+}
@@ -6,14 +6,14 @@ import (
 
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
 	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/utils"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type UserService struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewUserService(db *pgx.Conn) *UserService {
+func NewUserService(db *pgxpool.Pool) *UserService {
 	return &UserService{db: db}
 }
 
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+// DefaultValidityDays returns how long a prescription with these items stays
+// valid when the doctor does not say: the longest default of the item types it
+// approves, stretched so every refill allowed on it can still be requested.
+// A prescription without approved items gets the medicine default.
+func DefaultValidityDays(items []*models.Items, defaults config.Validity) int {
+	days := 0
+	for _, item := range items {
+		if !item.Approved {
+			continue
+		}
+		switch item.Type {
+		case "med":
+			days = max(days, defaults.MedicineDays, refillValidityDays(item))
+		case "test":
+			days = max(days, defaults.TestDays)
+		}
+	}
+	if days == 0 {
+		days = defaults.MedicineDays
+	}
+	return min(days, config.MaxValidityDays)
+}
+
+// refillValidityDays returns how long a medicine's refills need its
+// prescription to stay valid. The last refill becomes eligible Refills
+// intervals after finalization at the earliest, so one more interval is left
+// to request it in.
+func refillValidityDays(item *models.Items) int {
+	if item.Refills == 0 {
+		return 0
+	}
+	return (item.Refills + 1) * item.RefillIntervalDays
+}
+
+// IsExpired reports whether a prescription is expired at now, including one
+// whose validity has ended but that the expiry job has not moved yet.
+func IsExpired(prescription *models.Prescription, now time.Time) bool {
+	if prescription.Status == models.PrescriptionStatusExpired {
+		return true
+	}
+	return prescription.ValidUntil != nil && !now.Before(*prescription.ValidUntil)
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+)
+
+func TestDefaultValidityDays(t *testing.T) {
+	defaults := config.Validity{MedicineDays: 30, TestDays: 90}
+	med := func(refills, interval int) *models.Items {
+		return &models.Items{Type: "med", Approved: true, RefillPolicy: models.RefillPolicy{Refills: refills, RefillIntervalDays: interval}}
+	}
+
+	tests := []struct {
+		name  string
+		items []*models.Items
+		want  int
+	}{
+		{name: "no items", items: nil, want: 30},
+		{name: "medicine only", items: []*models.Items{med(0, 0)}, want: 30},
+		{name: "test wins over medicine", items: []*models.Items{med(0, 0), {Type: "test", Approved: true}}, want: 90},
+		{name: "unapproved items are ignored", items: []*models.Items{med(0, 0), {Type: "test"}}, want: 30},
+		{name: "only unapproved items", items: []*models.Items{{Type: "test"}}, want: 30},
+		{name: "refills within the default", items: []*models.Items{med(1, 14)}, want: 30},
+		{name: "refills stretch the validity", items: []*models.Items{med(3, 30)}, want: 120},
+		{name: "refills beyond the test default", items: []*models.Items{med(5, 30), {Type: "test", Approved: true}}, want: 180},
+		{name: "capped at the maximum", items: []*models.Items{med(12, 90)}, want: config.MaxValidityDays},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultValidityDays(tt.items, defaults); got != tt.want {
+				t.Errorf("DefaultValidityDays() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name         string
+		prescription models.Prescription
+		want         bool
+	}{
+		{name: "no validity", prescription: models.Prescription{Status: models.PrescriptionStatusFinalized}},
+		{name: "still valid", prescription: models.Prescription{Status: models.PrescriptionStatusFinalized, ValidUntil: at(time.Hour)}},
+		{name: "ends now", prescription: models.Prescription{Status: models.PrescriptionStatusFinalized, ValidUntil: at(0)}, want: true},
+		{name: "ended, not yet moved by the job", prescription: models.Prescription{Status: models.PrescriptionStatusFinalized, ValidUntil: at(-time.Hour)}, want: true},
+		{name: "marked expired", prescription: models.Prescription{Status: models.PrescriptionStatusExpired}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsExpired(&tt.prescription, now); got != tt.want {
+				t.Errorf("IsExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// versionColumns lists the prescription_versions columns in the order scanVersion expects them.
+const versionColumns = "id, created_at, presId, version, actorRole, COALESCE(actorId, 0), COALESCE(reason, ''), diff"
+
+// scanVersion scans a row selected with versionColumns, followed by any extra columns, into version.
+func scanVersion(row pgx.Row, version *models.PrescriptionVersion, extra ...interface{}) error {
+	var diff []byte
+	dest := []interface{}{&version.ID, &version.CreatedAt, &version.PresID, &version.Version,
+		&version.ActorRole, &version.ActorID, &version.Reason, &diff}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	version.Diff = make([]models.FieldChange, 0)
+	if len(diff) > 0 {
+		return json.Unmarshal(diff, &version.Diff)
+	}
+	return nil
+}
+
+type VersionService struct {
+	db *pgxpool.Pool
+}
+
+func NewVersionService(db *pgxpool.Pool) *VersionService {
+	return &VersionService{db: db}
+}
+
+// loadSnapshot reads the current content of a prescription through q, locking
+// the prescription row so concurrent changes get consecutive versions.
+func loadSnapshot(ctx context.Context, q querier, presID int64) (*models.PrescriptionSnapshot, error) {
+	snapshot := &models.PrescriptionSnapshot{}
+	err := q.QueryRow(ctx,
+		"SELECT COALESCE(docId, 0), COALESCE(symptoms, ''), COALESCE(status, 'submitted'), followUpAt FROM prescriptions WHERE id = $1 FOR UPDATE",
+		presID).Scan(&snapshot.DocID, &snapshot.Symptoms, &snapshot.Status, &snapshot.FollowUpAt)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.FollowUpAt != nil {
+		followUpAt := snapshot.FollowUpAt.UTC()
+		snapshot.FollowUpAt = &followUpAt
+	}
+
+	items, err := prescriptionItems(ctx, q, presID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Items = make([]models.SnapshotItem, 0, len(items))
+	for _, item := range items {
+		snapshot.Items = append(snapshot.Items, models.SnapshotItem{
+			ID:           item.ID,
+			Name:         item.Name,
+			Type:         item.Type,
+			DocReason:    item.DocReason,
+			Approved:     item.Approved,
+			CatalogID:    item.CatalogID,
+			Dosage:       item.Dosage,
+			RefillPolicy: item.RefillPolicy,
+		})
+	}
+	slices.SortFunc(snapshot.Items, func(a, b models.SnapshotItem) int { return cmp.Compare(a.ID, b.ID) })
+	return snapshot, nil
+}
+
+// recordVersion stores the current content of a prescription as a new version
+// inside tx, with the fields that changed since the previous version. Nothing is
+// recorded when the content did not change.
+func recordVersion(ctx context.Context, tx pgx.Tx, presID int64, actorRole string, actorID int64, reason string) error {
+	snapshot, err := loadSnapshot(ctx, tx, presID)
+	if err != nil {
+		return err
+	}
+
+	var last int
+	var lastSnapshot []byte
+	err = tx.QueryRow(ctx,
+		"SELECT version, snapshot FROM prescription_versions WHERE presId = $1 ORDER BY version DESC LIMIT 1",
+		presID).Scan(&last, &lastSnapshot)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	var previous *models.PrescriptionSnapshot
+	if lastSnapshot != nil {
+		previous = &models.PrescriptionSnapshot{}
+		if err := json.Unmarshal(lastSnapshot, previous); err != nil {
+			return fmt.Errorf("version %d of prescription %d: %w", last, presID, err)
+		}
+	}
+	diff, err := DiffSnapshots(previous, snapshot)
+	if err != nil {
+		return err
+	}
+	if previous != nil && len(diff) == 0 {
+		return nil
+	}
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO prescription_versions (presId, version, actorRole, actorId, reason, snapshot, diff)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		presID, last+1, actorRole, actorID, reason, snapshotJSON, diffJSON)
+	return err
+}
+
+// snapshotFields flattens v into its JSON fields.
+func snapshotFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// diffFields appends the fields of old and new that differ, prefixed with
+// prefix, in field name order.
+func diffFields(changes []models.FieldChange, prefix string, old, new map[string]interface{}) []models.FieldChange {
+	names := make([]string, 0, len(old)+len(new))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !reflect.DeepEqual(old[name], new[name]) {
+			changes = append(changes, models.FieldChange{Field: prefix + name, Old: old[name], New: new[name]})
+		}
+	}
+	return changes
+}
+
+// utcSnapshot returns a copy of snapshot with its times in UTC, so the same
+// instant read from Postgres or from stored JSON compares equal.
+func utcSnapshot(snapshot *models.PrescriptionSnapshot) *models.PrescriptionSnapshot {
+	normalized := *snapshot
+	if normalized.FollowUpAt != nil {
+		followUpAt := normalized.FollowUpAt.UTC()
+		normalized.FollowUpAt = &followUpAt
+	}
+	return &normalized
+}
+
+// DiffSnapshots lists the fields that differ between two snapshots. A nil old
+// snapshot is treated as empty, so every field of new is reported.
+func DiffSnapshots(old, new *models.PrescriptionSnapshot) ([]models.FieldChange, error) {
+	if old == nil {
+		old = &models.PrescriptionSnapshot{}
+	} else if old.DocID == 0 {
+		// Versions recorded before snapshots held the doctor.
+		previous := *old
+		previous.DocID = new.DocID
+		old = &previous
+	}
+	old, new = utcSnapshot(old), utcSnapshot(new)
+
+	oldFields, err := snapshotFields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := snapshotFields(new)
+	if err != nil {
+		return nil, err
+	}
+	delete(oldFields, "items")
+	delete(newFields, "items")
+	changes := diffFields(make([]models.FieldChange, 0), "", oldFields, newFields)
+
+	oldItems := make(map[int64]models.SnapshotItem, len(old.Items))
+	ids := make([]int64, 0, len(old.Items)+len(new.Items))
+	for _, item := range old.Items {
+		oldItems[item.ID] = item
+		ids = append(ids, item.ID)
+	}
+	newItems := make(map[int64]models.SnapshotItem, len(new.Items))
+	for _, item := range new.Items {
+		newItems[item.ID] = item
+		if _, ok := oldItems[item.ID]; !ok {
+			ids = append(ids, item.ID)
+		}
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		oldItem, inOld := oldItems[id]
+		newItem, inNew := newItems[id]
+		field := fmt.Sprintf("items[%d]", id)
+		switch {
+		case !inOld:
+			changes = append(changes, models.FieldChange{Field: field, New: newItem})
+		case !inNew:
+			changes = append(changes, models.FieldChange{Field: field, Old: oldItem})
+		default:
+			oldItemFields, err := snapshotFields(oldItem)
+			if err != nil {
+				return nil, err
+			}
+			newItemFields, err := snapshotFields(newItem)
+			if err != nil {
+				return nil, err
+			}
+			changes = diffFields(changes, field+".", oldItemFields, newItemFields)
+		}
+	}
+	return changes, nil
+}
+
+// ListVersions lists the versions of a prescription, oldest first, without their snapshots.
+func (s *VersionService) ListVersions(ctx context.Context, presID int64) ([]*models.PrescriptionVersion, error) {
+	rows, err := s.db.Query(ctx,
+		"SELECT "+versionColumns+" FROM prescription_versions WHERE presId = $1 ORDER BY version",
+		presID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]*models.PrescriptionVersion, 0)
+	for rows.Next() {
+		version := &models.PrescriptionVersion{}
+		if err := scanVersion(rows, version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion retrieves one version of a prescription with its snapshot.
+func (s *VersionService) GetVersion(ctx context.Context, presID int64, number int) (*models.PrescriptionVersion, error) {
+	version := &models.PrescriptionVersion{}
+	var snapshot []byte
+	err := scanVersion(s.db.QueryRow(ctx,
+		"SELECT "+versionColumns+", snapshot FROM prescription_versions WHERE presId = $1 AND version = $2",
+		presID, number), version, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	version.Snapshot = &models.PrescriptionSnapshot{}
+	if err := json.Unmarshal(snapshot, version.Snapshot); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// DiffVersions lists the fields that differ between two versions of a prescription.
+func (s *VersionService) DiffVersions(ctx context.Context, presID int64, from, to int) ([]models.FieldChange, error) {
+	fromVersion, err := s.GetVersion(ctx, presID, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := s.GetVersion(ctx, presID, to)
+	if err != nil {
+		return nil, err
+	}
+	return DiffSnapshots(fromVersion.Snapshot, toVersion.Snapshot)
+}
@@ -0,0 +1,71 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrNotConfigured is returned when signing is attempted without a key.
+var ErrNotConfigured = errors.New("prescription signing key is not configured")
+
+// Signer signs content digests with the deployment's Ed25519 key. A nil
+// *Signer is valid and fails every operation with ErrNotConfigured.
+type Signer struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	keyID      string
+}
+
+// NewSigner returns a signer for privateKey, or nil if privateKey is empty.
+func NewSigner(privateKey ed25519.PrivateKey) *Signer {
+	if len(privateKey) == 0 {
+		return nil
+	}
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	sum := sha256.Sum256(publicKey)
+	return &Signer{
+		privateKey: privateKey,
+		publicKey:  publicKey,
+		keyID:      hex.EncodeToString(sum[:8]),
+	}
+}
+
+// KeyID is a short fingerprint of the public key, recorded with each signature
+// so a rotated key can be told apart from a forged signature.
+func (s *Signer) KeyID() string {
+	if s == nil {
+		return ""
+	}
+	return s.keyID
+}
+
+// PublicKey returns the base64 public key third parties verify signatures with.
+func (s *Signer) PublicKey() string {
+	if s == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.publicKey)
+}
+
+// Sign signs digest and returns the base64 signature.
+func (s *Signer) Sign(digest []byte) (string, error) {
+	if s == nil {
+		return "", ErrNotConfigured
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, digest)), nil
+}
+
+// Verify reports whether signature is a valid signature of digest by this key.
+func (s *Signer) Verify(digest []byte, signature string) (bool, error) {
+	if s == nil {
+		return false, ErrNotConfigured
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, nil
+	}
+	return ed25519.Verify(s.publicKey, digest, sig), nil
+}
@@ -0,0 +1,86 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestSignerVerify(t *testing.T) {
+	signer := NewSigner(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	other := NewSigner(ed25519.NewKeyFromSeed([]byte("0123456789abcdef0123456789abcdef")))
+	digest := sha256.Sum256([]byte("prescription content"))
+	tampered := sha256.Sum256([]byte("prescription content!"))
+
+	signature, err := signer.Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Sign() error: %v", err)
+	}
+	otherSignature, err := other.Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Sign() error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		digest    []byte
+		signature string
+		want      bool
+	}{
+		{name: "valid signature", digest: digest[:], signature: signature, want: true},
+		{name: "changed content", digest: tampered[:], signature: signature},
+		{name: "signed by another key", digest: digest[:], signature: otherSignature},
+		{name: "not base64", digest: digest[:], signature: "not a signature!"},
+		{name: "truncated signature", digest: digest[:], signature: base64.StdEncoding.EncodeToString([]byte("short"))},
+		{name: "empty signature", digest: digest[:], signature: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signer.Verify(tt.digest, tt.signature)
+			if err != nil {
+				t.Fatalf("Verify() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignerKeyID(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	signer := NewSigner(key)
+
+	if got := len(signer.KeyID()); got != 16 {
+		t.Errorf("KeyID() has %d characters, want 16", got)
+	}
+	if NewSigner(key).KeyID() != signer.KeyID() {
+		t.Error("KeyID() differs for the same key")
+	}
+	if NewSigner(ed25519.NewKeyFromSeed([]byte("0123456789abcdef0123456789abcdef"))).KeyID() == signer.KeyID() {
+		t.Error("KeyID() is the same for different keys")
+	}
+	public, err := base64.StdEncoding.DecodeString(signer.PublicKey())
+	if err != nil || !key.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(public)) {
+		t.Errorf("PublicKey() = %q, want the base64 public key", signer.PublicKey())
+	}
+}
+
+func TestNilSigner(t *testing.T) {
+	signer := NewSigner(nil)
+	if signer != nil {
+		t.Fatal("NewSigner(nil) returned a signer")
+	}
+	if _, err := signer.Sign([]byte("digest")); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Sign() error = %v, want ErrNotConfigured", err)
+	}
+	if _, err := signer.Verify([]byte("digest"), "c2ln"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Verify() error = %v, want ErrNotConfigured", err)
+	}
+	if signer.KeyID() != "" || signer.PublicKey() != "" {
+		t.Error("nil signer has a key")
+	}
+}
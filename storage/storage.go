@@ -0,0 +1,90 @@
+// Package storage abstracts the object store that holds uploaded files.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+)
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// MaxSignedURLExpiry is the longest expiry every driver accepts for signed URLs.
+const MaxSignedURLExpiry = 7 * 24 * time.Hour
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string
+}
+
+// ObjectStore stores objects under slash-separated keys. Objects are private;
+// clients get access through short-lived signed URLs.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]*ObjectInfo, error)
+	// SignedURL returns a URL that grants read access to the object until expiry.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// New builds the object store selected by cfg.Driver.
+func New(cfg config.Storage) (ObjectStore, error) {
+	switch cfg.Driver {
+	case config.StorageDriverSupabase:
+		return NewSupabaseStore(cfg), nil
+	case config.StorageDriverS3:
+		return NewS3Store(cfg), nil
+	case config.StorageDriverLocal:
+		return NewLocalStore(cfg)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+}
+
+// CleanKey validates an object key and returns it in canonical form.
+func CleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(key, "\\", "/")), "/")
+	if key == "" || key == "." {
+		return "", errors.New("empty object key")
+	}
+	return key, nil
+}
+
+// escapePath percent-encodes each segment of an object key for use in a URL path.
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// uriEncode percent-encodes everything except the RFC 3986 unreserved characters.
+func uriEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
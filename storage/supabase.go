@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debojyoti1915001/MedInfoAssistant-Backend/config"
+)
+
+// SupabaseStore talks to the Supabase Storage REST API.
+type SupabaseStore struct {
+	baseURL string
+	key     string
+	bucket  string
+	client  *http.Client
+}
+
+// NewSupabaseStore creates a store for cfg.Bucket. cfg is expected to be validated by config.LoadStorage.
+func NewSupabaseStore(cfg config.Storage) *SupabaseStore {
+	return &SupabaseStore{
+		baseURL: cfg.SupabaseURL,
+		key:     cfg.SupabaseKey,
+		bucket:  cfg.Bucket,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (s *SupabaseStore) objectURL(route, key string) string {
+	return fmt.Sprintf("%s/storage/v1/object/%s%s/%s", s.baseURL, route, s.bucket, escapePath(key))
+}
+
+func (s *SupabaseStore) do(ctx context.Context, method, url string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+s.key)
+	req.Header.Set("apikey", s.key)
+	return s.client.Do(req)
+}
+
+// supabaseError turns an unsuccessful response into an error, mapping 404 to ErrNotFound.
+// Supabase reports missing objects as 400 with a "not_found" body on some versions.
+func supabaseError(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusNotFound ||
+		(resp.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(string(body)), "not_found")) {
+		return ErrNotFound
+	}
+	return fmt.Errorf("supabase %s failed: status %d: %s", action, resp.StatusCode, string(body))
+}
+
+// Put uploads the object, replacing any existing one.
+func (s *SupabaseStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("x-upsert", "true")
+
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL("", key), data, header)
+	if err != nil {
+		return fmt.Errorf("failed to upload to supabase: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return supabaseError("upload", resp)
+	}
+	return nil
+}
+
+// Get downloads the object.
+func (s *SupabaseStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL("authenticated/", key), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, supabaseError("download", resp)
+	}
+	return resp.Body, responseInfo(key, resp), nil
+}
+
+// Delete removes the object. Deleting a missing object is not an error.
+func (s *SupabaseStore) Delete(ctx context.Context, key string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL("", key), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		if err := supabaseError("delete", resp); err != ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stat returns the object's metadata.
+func (s *SupabaseStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL("authenticated/", key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, supabaseError("stat", resp)
+	}
+	return responseInfo(key, resp), nil
+}
+
+// supabaseListPageSize is the number of entries requested per list call.
+const supabaseListPageSize = 1000
+
+// supabaseEntry is a file or folder returned by the list endpoint. Folders have no ID.
+type supabaseEntry struct {
+	Name      string    `json:"name"`
+	ID        *string   `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimetype"`
+		ETag     string `json:"eTag"`
+	} `json:"metadata"`
+}
+
+// List walks the bucket folder by folder, since Supabase lists one level at a time.
+func (s *SupabaseStore) List(ctx context.Context, prefix string) ([]*ObjectInfo, error) {
+	var objects []*ObjectInfo
+	folders := []string{""}
+	for len(folders) > 0 {
+		folder := folders[0]
+		folders = folders[1:]
+
+		for offset := 0; ; offset += supabaseListPageSize {
+			entries, err := s.listFolder(ctx, folder, offset)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				key := path.Join(folder, entry.Name)
+				if entry.ID == nil {
+					if strings.HasPrefix(key+"/", prefix) || strings.HasPrefix(prefix, key+"/") {
+						folders = append(folders, key)
+					}
+					continue
+				}
+				if !strings.HasPrefix(key, prefix) {
+					continue
+				}
+				objects = append(objects, &ObjectInfo{
+					Key:         key,
+					Size:        entry.Metadata.Size,
+					ContentType: entry.Metadata.MimeType,
+					ModTime:     entry.UpdatedAt,
+					ETag:        strings.Trim(entry.Metadata.ETag, `"`),
+				})
+			}
+			if len(entries) < supabaseListPageSize {
+				break
+			}
+		}
+	}
+	return objects, nil
+}
+
+func (s *SupabaseStore) listFolder(ctx context.Context, folder string, offset int) ([]supabaseEntry, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"prefix": folder,
+		"limit":  supabaseListPageSize,
+		"offset": offset,
+		"sortBy": map[string]string{"column": "name", "order": "asc"},
+	})
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	resp, err := s.do(ctx, http.MethodPost, fmt.Sprintf("%s/storage/v1/object/list/%s", s.baseURL, s.bucket), body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, supabaseError("list", resp)
+	}
+
+	var entries []supabaseEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode supabase listing: %w", err)
+	}
+	return entries, nil
+}
+
+// SignedURL asks Supabase to sign a download URL.
+func (s *SupabaseStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	body, _ := json.Marshal(map[string]int64{"expiresIn": int64(expiry / time.Second)})
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	resp, err := s.do(ctx, http.MethodPost, s.objectURL("sign/", key), body, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", supabaseError("sign", resp)
+	}
+
+	var signed struct {
+		SignedURL string `json:"signedURL"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return "", fmt.Errorf("failed to decode supabase signed URL: %w", err)
+	}
+	if signed.SignedURL == "" {
+		return "", fmt.Errorf("supabase returned an empty signed URL")
+	}
+	return s.baseURL + "/storage/v1" + signed.SignedURL, nil
+}
+
+// responseInfo reads object metadata from download or HEAD response headers.
+func responseInfo(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if info.Size < 0 {
+		info.Size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info
+}
@@ -14,11 +14,11 @@ var JWTSecret = "your-secret-key-change-in-production"
 type Claims struct {
 	ID    int64  `json:"id"`
 	Email string `json:"email"`
-	Role  string `json:"role"` // "user" or "doctor"
+	Role  string `json:"role"` // "user", "doctor" or "pharmacy"
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a JWT token for a user or doctor
+// GenerateToken creates a JWT token for a user, doctor or pharmacy
 func GenerateToken(id int64, email string, role string) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour) // Token valid for 24 hours
 
@@ -41,8 +41,58 @@ func GenerateToken(id int64, email string, role string) (string, error) {
 	return tokenString, nil
 }
 
+// StreamTokenAudience marks tokens that only open the message event stream.
+const StreamTokenAudience = "message-stream"
+
+// StreamTokenExpiry is how long a stream token can be used to connect.
+const StreamTokenExpiry = time.Minute
+
+// GenerateStreamToken creates a short-lived token that lets the holder of
+// claims open the message event stream. It is meant for query strings, which
+// end up in logs, so it is not accepted anywhere else.
+func GenerateStreamToken(claims *Claims) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(StreamTokenExpiry)
+	streamClaims := &Claims{
+		ID:    claims.ID,
+		Email: claims.Email,
+		Role:  claims.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{StreamTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, streamClaims)
+	tokenString, err := token.SignedString([]byte(JWTSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
 // VerifyToken validates a JWT token and returns the claims
 func VerifyToken(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stream tokens only open the event stream
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
+
+// VerifyStreamToken validates a token issued by GenerateStreamToken.
+func VerifyStreamToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, jwt.WithAudience(StreamTokenAudience))
+}
+
+func parseToken(tokenString string, options ...jwt.ParserOption) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -51,7 +101,7 @@ func VerifyToken(tokenString string) (*Claims, error) {
 			return nil, errors.New("unexpected signing method")
 		}
 		return []byte(JWTSecret), nil
-	})
+	}, options...)
 
 	if err != nil {
 		return nil, err
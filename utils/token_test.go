@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signed returns claims signed with key, for tokens the generators never make.
+func signed(t *testing.T, claims *Claims, key string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyTokens(t *testing.T) {
+	session, err := GenerateToken(3, "asha@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, expiresAt, err := GenerateStreamToken(&Claims{ID: 9, Email: "dr.rao@example.com", Role: "doctor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d <= 0 || d > StreamTokenExpiry {
+		t.Errorf("stream token expires in %s, want at most %s", d, StreamTokenExpiry)
+	}
+	past := jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredStream := signed(t, &Claims{ID: 9, Role: "doctor", RegisteredClaims: jwt.RegisteredClaims{
+		Audience: jwt.ClaimStrings{StreamTokenAudience}, ExpiresAt: past,
+	}}, JWTSecret)
+	otherAudience := signed(t, &Claims{ID: 9, Role: "doctor", RegisteredClaims: jwt.RegisteredClaims{
+		Audience: jwt.ClaimStrings{"reports"}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}, JWTSecret)
+	forged := signed(t, &Claims{ID: 3, Role: "user", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}, "another-secret")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantToken  int64 // ID accepted by VerifyToken, 0 when rejected
+		wantStream int64 // ID accepted by VerifyStreamToken, 0 when rejected
+	}{
+		{name: "session token", token: session, wantToken: 3},
+		{name: "stream token", token: stream, wantStream: 9},
+		{name: "expired stream token", token: expiredStream},
+		{name: "other audience", token: otherAudience},
+		{name: "wrong secret", token: forged},
+		{name: "malformed", token: "not.a.token"},
+	}
+
+	id := func(claims *Claims, err error) int64 {
+		if err != nil {
+			return 0
+		}
+		return claims.ID
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := id(VerifyToken(tt.token)); got != tt.wantToken {
+				t.Errorf("VerifyToken() accepted ID %d, want %d", got, tt.wantToken)
+			}
+			if got := id(VerifyStreamToken(tt.token)); got != tt.wantStream {
+				t.Errorf("VerifyStreamToken() accepted ID %d, want %d", got, tt.wantStream)
+			}
+		})
+	}
+}